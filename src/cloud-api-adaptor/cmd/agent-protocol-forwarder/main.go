@@ -118,7 +118,7 @@ func (cfg *Config) Setup() (cmd.Starter, error) {
 		}
 	}
 
-	interceptor := interceptor.NewInterceptor(cfg.kataAgentSocketPath, cfg.kataAgentNamespace)
+	interceptor := interceptor.NewInterceptor(cfg.kataAgentSocketPath, cfg.kataAgentNamespace, cfg.daemonConfig.SandboxID, cfg.daemonConfig.EncryptedFiles)
 
 	podNode := podnetwork.NewPodNode(cfg.kataAgentNamespace, cfg.HostInterface, cfg.daemonConfig.PodNetwork)
 
@@ -0,0 +1,9 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	// Support for out-of-process cloud provider plugins
+	_ "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/grpcplugin"
+)
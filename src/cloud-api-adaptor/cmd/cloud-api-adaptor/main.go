@@ -9,10 +9,14 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/cmd"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor"
+	adaptorcloud "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/cloud"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/proxy"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/agent"
 	daemon "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler/vxlan"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/kubemgr"
@@ -93,6 +97,13 @@ func (cfg *daemonConfig) Setup() (cmd.Starter, error) {
 		secureCommsInbounds  string
 		secureCommsOutbounds string
 		secureCommsKbsAddr   string
+		podTagLabels         string
+		podTagAnnotations    string
+		userDataSigningKey   string
+		userDataEncryptKey   string
+		userDataEncrypted    string
+		attestationConfig    string
+		agentOptions         string
 	)
 
 	cmd.Parse(programName, os.Args[1:], func(flags *flag.FlagSet) {
@@ -123,13 +134,57 @@ func (cfg *daemonConfig) Setup() (cmd.Starter, error) {
 		flags.IntVar(&cfg.networkConfig.VXLANPort, "vxlan-port", vxlan.DefaultVXLANPort, "VXLAN UDP port number (VXLAN tunnel mode only")
 		flags.IntVar(&cfg.networkConfig.VXLANMinID, "vxlan-min-id", vxlan.DefaultVXLANMinID, "Minimum VXLAN ID (VXLAN tunnel mode only")
 		flags.StringVar(&cfg.serverConfig.AAKBCParams, "aa-kbc-params", "", "attestation-agent KBC parameters")
+		flags.StringVar(&cfg.serverConfig.InitdataDefaults, "initdata-defaults", "", "YAML file, typically mounted from a ConfigMap, with the rules selecting the default initdata of pods")
+		flags.StringVar(&cfg.serverConfig.InitdataFiles, "initdata-files", "", "YAML allowlist of the initdata files provisioned in pod VMs, in addition to aa.toml, cdh.toml and policy.rego")
+		flags.StringVar(&attestationConfig, "attestation-config", "", "YAML file configuring the attestation-agent and confidential-data-hub of pod VMs, takes precedence over aa-kbc-params")
 		flags.BoolVar(&cfg.serverConfig.EnableCloudConfigVerify, "cloud-config-verify", false, "Enable cloud config verify - should use it for production")
+		flags.BoolVar(&cfg.serverConfig.PodTags.Enabled, "pod-tags", false, "Tag pod VMs with the pod namespace, name and owner")
+		flags.StringVar(&podTagLabels, "pod-tag-labels", "", "Comma separated list of pod labels to add to the pod VM tags")
+		flags.StringVar(&podTagAnnotations, "pod-tag-annotations", "", "Comma separated list of pod annotations to add to the pod VM tags")
+		flags.StringVar(&agentOptions, "agent-config-annotations", "", fmt.Sprintf("Comma separated list of agent options that pods may set with %s<option> annotations, out of %s", agent.AnnotationPrefix, strings.Join(agent.OptionNames(), ",")))
+		flags.StringVar(&cfg.serverConfig.ProfilesDir, "provider-profiles-dir", "", "Directory with a subdirectory of configs per provider profile, typically mounted from Secrets, that pods select with the peerpods.confidentialcontainers.org/profile annotation or their RuntimeClass")
+		flags.BoolVar(&cfg.serverConfig.RegistryAuthFallback, "registry-auth-fallback", false, "Provide the node-wide registry auth.json to the pod VMs of pods without pull secrets")
+		flags.StringVar(&userDataSigningKey, "userdata-signing-key", "", "PEM file of the ed25519 private key signing the pod VM userdata")
+		flags.StringVar(&userDataEncryptKey, "userdata-encryption-key", "", "File of the 32 byte key encrypting secret files in the pod VM userdata")
+		flags.StringVar(&userDataEncrypted, "userdata-encrypted-files", adaptorcloud.AuthFilePath, "Comma separated list of userdata files to encrypt with the userdata encryption key")
 
 		cloud.ParseCmd(flags)
 	})
 
 	cmd.ShowVersion(programName)
 
+	if podTagLabels != "" {
+		cfg.serverConfig.PodTags.Labels = strings.Split(podTagLabels, ",")
+	}
+	if podTagAnnotations != "" {
+		cfg.serverConfig.PodTags.Annotations = strings.Split(podTagAnnotations, ",")
+	}
+
+	if agentOptions != "" {
+		cfg.serverConfig.AgentOptions = strings.Split(agentOptions, ",")
+		for _, option := range cfg.serverConfig.AgentOptions {
+			if !slices.Contains(agent.OptionNames(), option) {
+				return nil, fmt.Errorf("unknown agent option %q, must be one of %s", option, strings.Join(agent.OptionNames(), ","))
+			}
+		}
+	}
+
+	var encryptedFiles []string
+	if userDataEncrypted != "" {
+		encryptedFiles = strings.Split(userDataEncrypted, ",")
+	}
+	protection, err := adaptorcloud.LoadUserDataProtection(userDataSigningKey, userDataEncryptKey, encryptedFiles)
+	if err != nil {
+		return nil, err
+	}
+	cfg.serverConfig.UserDataProtection = protection
+
+	if attestationConfig != "" {
+		if cfg.serverConfig.Attestation, err = adaptorcloud.LoadAttestationConfig(attestationConfig); err != nil {
+			return nil, err
+		}
+	}
+
 	fmt.Printf("%s: starting Cloud API Adaptor daemon for %q\n", programName, cloudName)
 
 	if secureComms {
@@ -150,8 +205,18 @@ func (cfg *daemonConfig) Setup() (cmd.Starter, error) {
 		}
 	}
 
+	// Keep AA_KBC_PARAMS support as it is used by e2e test, KBS is dynamic k8s service in e2e test
+	if cfg.serverConfig.Attestation == nil && cfg.serverConfig.AAKBCParams != "" {
+		if cfg.serverConfig.Attestation, err = adaptorcloud.AttestationConfigFromAAKBCParams(cfg.serverConfig.AAKBCParams); err != nil {
+			return nil, err
+		}
+	}
+
 	cloud.LoadEnv()
 
+	cfg.serverConfig.CloudName = cloudName
+	cfg.serverConfig.ConfigNamespace = os.Getenv("PEERPODS_NAMESPACE")
+
 	workerNode := podnetwork.NewWorkerNode(cfg.TunnelType, cfg.HostInterface, cfg.VXLANPort, cfg.VXLANMinID)
 
 	provider, err := cloud.NewProvider()
@@ -4,9 +4,14 @@
 package main
 
 import (
+	"encoding/base64"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	cmdUtil "github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/cmd"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/userdata"
 	"github.com/spf13/cobra"
 )
@@ -32,19 +37,78 @@ var rootCmd = &cobra.Command{
 
 func init() {
 	var fetchTimeout int
+	var providers []string
 	rootCmd.PersistentFlags().BoolVarP(&versionFlag, "version", "v", false, "Print the version")
 
 	var provisionFilesCmd = &cobra.Command{
 		Use:   "provision-files",
 		Short: "Provision required files based on user data",
 		RunE: func(_ *cobra.Command, _ []string) error {
-			cfg := userdata.NewConfig(fetchTimeout)
+			cfg := userdata.NewConfig(fetchTimeout, providers)
 			return userdata.ProvisionFiles(cfg)
 		},
 		SilenceUsage: true, // Silence usage on error
 	}
 	provisionFilesCmd.Flags().IntVarP(&fetchTimeout, "user-data-fetch-timeout", "t", 180, "Timeout (in secs) for fetching user data")
+	provisionFilesCmd.Flags().StringSliceVarP(&providers, "user-data-providers", "p", nil,
+		fmt.Sprintf("Comma separated list of user data providers to detect, in order (default %s)", strings.Join(userdata.DefaultProviders, ",")))
 	rootCmd.AddCommand(provisionFilesCmd)
+
+	var keyID string
+	var decryptFilesCmd = &cobra.Command{
+		Use:   "decrypt-files",
+		Short: "Decrypt the encrypted files provisioned from user data",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			cfg := userdata.NewConfig(fetchTimeout, nil)
+			return userdata.DecryptFiles(cfg, keyID)
+		},
+		SilenceUsage: true, // Silence usage on error
+	}
+	decryptFilesCmd.Flags().IntVarP(&fetchTimeout, "key-fetch-timeout", "t", 180, "Timeout (in secs) for fetching the decryption key")
+	decryptFilesCmd.Flags().StringVarP(&keyID, "key-id", "k", userdata.DefaultEncryptionKeyID, "KBS resource path of the decryption key")
+	rootCmd.AddCommand(decryptFilesCmd)
+
+	var filesPath string
+	var validateInitdataCmd = &cobra.Command{
+		Use:   "validate-initdata [FILE]",
+		Short: "Validate initdata, read from FILE or stdin, as plain or base64 encoded TOML",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var data []byte
+			var err error
+			if len(args) == 0 || args[0] == "-" {
+				data, err = io.ReadAll(cmd.InOrStdin())
+			} else {
+				data, err = os.ReadFile(args[0])
+			}
+			if err != nil {
+				return err
+			}
+
+			encoded := strings.TrimSpace(string(data))
+			if _, err := base64.StdEncoding.DecodeString(encoded); err != nil {
+				encoded = base64.StdEncoding.EncodeToString(data)
+			}
+
+			allowlist, err := initdata.LoadAllowlist(filesPath)
+			if err != nil {
+				return err
+			}
+			id, doc, err := initdata.DecodeAndValidate(encoded, allowlist)
+			if err != nil {
+				return err
+			}
+			digest, err := initdata.Digest(id.Algorithm, doc)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "initdata is valid, digest: %s\n", digest)
+			return nil
+		},
+		SilenceUsage: true, // Silence usage on error
+	}
+	validateInitdataCmd.Flags().StringVarP(&filesPath, "initdata-files", "f", initdata.DefaultFilesPath, "YAML allowlist of the initdata files")
+	rootCmd.AddCommand(validateInitdataCmd)
 }
 
 func main() {
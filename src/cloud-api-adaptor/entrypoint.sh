@@ -18,13 +18,25 @@ optionals+=""
 [[ "${CERT_FILE}" ]] && [[ "${CERT_KEY}" ]] && optionals+="-cert-file ${CERT_FILE} -cert-key ${CERT_KEY} "
 [[ "${TLS_SKIP_VERIFY}" ]] && optionals+="-tls-skip-verify "
 [[ "${PROXY_TIMEOUT}" ]] && optionals+="-proxy-timeout ${PROXY_TIMEOUT} "
+[[ "${PROVIDER_PROFILES_DIR}" ]] && optionals+="-provider-profiles-dir ${PROVIDER_PROFILES_DIR} "
 [[ "${AA_KBC_PARAMS}" ]] && optionals+="-aa-kbc-params ${AA_KBC_PARAMS} "
+[[ "${ATTESTATION_CONFIG}" ]] && optionals+="-attestation-config ${ATTESTATION_CONFIG} "
+[[ "${INITDATA_DEFAULTS}" ]] && optionals+="-initdata-defaults ${INITDATA_DEFAULTS} "
+[[ "${INITDATA_FILES}" ]] && optionals+="-initdata-files ${INITDATA_FILES} "
+[[ "${REGISTRY_AUTH_FALLBACK}" == "true" ]] && optionals+="-registry-auth-fallback "
+[[ "${AGENT_CONFIG_ANNOTATIONS}" ]] && optionals+="-agent-config-annotations ${AGENT_CONFIG_ANNOTATIONS} "
 [[ "${FORWARDER_PORT}" ]] && optionals+="-forwarder-port ${FORWARDER_PORT} "
 [[ "${CLOUD_CONFIG_VERIFY}" == "true" ]] && optionals+="-cloud-config-verify "
 [[ "${SECURE_COMMS}" == "true" ]] && optionals+="-secure-comms "
 [[ "${SECURE_COMMS_INBOUNDS}" ]] && optionals+="-secure-comms-inbounds ${SECURE_COMMS_INBOUNDS} "
 [[ "${SECURE_COMMS_OUTBOUNDS}" ]] && optionals+="-secure-comms-outbounds ${SECURE_COMMS_OUTBOUNDS} "
 [[ "${SECURE_COMMS_KBS_ADDR}" ]] && optionals+="-secure-comms-kbs ${SECURE_COMMS_KBS_ADDR} "
+[[ "${POD_TAGS}" == "true" ]] && optionals+="-pod-tags "
+[[ "${POD_TAG_LABELS}" ]] && optionals+="-pod-tag-labels ${POD_TAG_LABELS} "
+[[ "${POD_TAG_ANNOTATIONS}" ]] && optionals+="-pod-tag-annotations ${POD_TAG_ANNOTATIONS} "
+[[ "${USERDATA_SIGNING_KEY}" ]] && optionals+="-userdata-signing-key ${USERDATA_SIGNING_KEY} "
+[[ "${USERDATA_ENCRYPTION_KEY}" ]] && optionals+="-userdata-encryption-key ${USERDATA_ENCRYPTION_KEY} "
+[[ "${USERDATA_ENCRYPTED_FILES}" ]] && optionals+="-userdata-encrypted-files ${USERDATA_ENCRYPTED_FILES} "
 
 test_vars() {
     for i in "$@"; do
@@ -71,6 +83,7 @@ azure() {
     [[ "${AZURE_INSTANCE_SIZES}" ]] && optionals+="-instance-sizes ${AZURE_INSTANCE_SIZES} "
     [[ "${TAGS}" ]] && optionals+="-tags ${TAGS} " # Custom tags applied to pod vm
     [[ "${ENABLE_SECURE_BOOT}" == "true" ]] && optionals+="-enable-secure-boot "
+    [[ "${ROOT_VOLUME_SIZE}" ]] && optionals+="-root-volume-size ${ROOT_VOLUME_SIZE} " # Specify the OS disk size for pod vm
 
     set -x
     exec cloud-api-adaptor azure \
@@ -85,6 +98,29 @@ azure() {
         ${optionals}
 }
 
+gcp() {
+    test_vars GCP_PROJECT_ID GCP_ZONE PODVM_IMAGE_NAME
+
+    [[ "${GCP_CREDENTIALS}" ]] && optionals+="-gcp-credentials ${GCP_CREDENTIALS} " # if not set the metadata server credentials are used
+    [[ "${GCP_MACHINE_TYPE}" ]] && optionals+="-machine-type ${GCP_MACHINE_TYPE} "   # default n2d-standard-2
+    [[ "${GCP_MACHINE_TYPES}" ]] && optionals+="-machine-types ${GCP_MACHINE_TYPES} "
+    [[ "${GCP_NETWORK}" ]] && optionals+="-network ${GCP_NETWORK} "
+    [[ "${GCP_SUBNETWORK}" ]] && optionals+="-subnetwork ${GCP_SUBNETWORK} "
+    [[ "${GCP_CONFIDENTIAL_TYPE}" ]] && optionals+="-confidential-type ${GCP_CONFIDENTIAL_TYPE} "
+    [[ "${TAGS}" ]] && optionals+="-tags ${TAGS} "                                     # Custom labels applied to pod vm
+    [[ "${ROOT_VOLUME_SIZE}" ]] && optionals+="-disk-size ${ROOT_VOLUME_SIZE} "        # Specify the boot disk size for pod vm
+    [[ "${DISABLECVM}" == "true" ]] && optionals+="-disable-cvm "
+
+    set -x
+    exec cloud-api-adaptor gcp \
+        -gcp-project-id "${GCP_PROJECT_ID}" \
+        -zone "${GCP_ZONE}" \
+        -image-name "${PODVM_IMAGE_NAME}" \
+        -pods-dir /run/peerpod/pods \
+        ${optionals} \
+        -socket /run/peerpod/hypervisor.sock
+}
+
 ibmcloud() {
     one_of IBMCLOUD_API_KEY IBMCLOUD_IAM_PROFILE_ID
 
@@ -142,6 +178,26 @@ libvirt() {
         -socket /run/peerpod/hypervisor.sock
 }
 
+openstack() {
+    test_vars OS_AUTH_URL OS_REGION_NAME PODVM_IMAGE_ID OPENSTACK_NETWORK_ID
+    one_of OS_PASSWORD OS_APPLICATION_CREDENTIAL_SECRET
+
+    [[ "${PODVM_INSTANCE_TYPES}" ]] && optionals+="-flavors ${PODVM_INSTANCE_TYPES} "
+    [[ "${OPENSTACK_SECURITY_GROUPS}" ]] && optionals+="-security-groups ${OPENSTACK_SECURITY_GROUPS} " # comma separated IDs
+    [[ "${SSH_KP_NAME}" ]] && optionals+="-keyname ${SSH_KP_NAME} "
+    [[ "${TAGS}" ]] && optionals+="-tags ${TAGS} "                                     # Custom metadata applied to pod vm
+    [[ "${USE_CONFIG_DRIVE}" == "true" ]] && optionals+="-use-config-drive "
+    [[ "${ROOT_VOLUME_SIZE}" ]] && optionals+="-boot-volume-size ${ROOT_VOLUME_SIZE} " # Boot from a volume of this size
+
+    # OS_* credentials, PODVM_IMAGE_ID and PODVM_INSTANCE_TYPE are read from the environment
+    set -x
+    exec cloud-api-adaptor openstack \
+        -network-id "${OPENSTACK_NETWORK_ID}" \
+        -pods-dir /run/peerpod/pods \
+        ${optionals} \
+        -socket /run/peerpod/hypervisor.sock
+}
+
 vsphere() {
     test_vars GOVC_USERNAME GOVC_PASSWORD GOVC_URL GOVC_DATACENTER
 
@@ -179,9 +235,9 @@ docker() {
 help_msg() {
     cat <<EOF
 Usage:
-	CLOUD_PROVIDER=aws|azure|ibmcloud|ibmcloud-powervs|libvirt|vsphere|docker $0
+	CLOUD_PROVIDER=aws|azure|gcp|ibmcloud|ibmcloud-powervs|libvirt|openstack|vsphere|docker $0
 or
-	$0 aws|azure|ibmcloud|ibmcloud-powervs|libvirt|vsphere|docker
+	$0 aws|azure|gcp|ibmcloud|ibmcloud-powervs|libvirt|openstack|vsphere|docker
 in addition all cloud provider specific env variables must be set and valid
 (CLOUD_PROVIDER is currently set to "$CLOUD_PROVIDER")
 EOF
@@ -191,12 +247,16 @@ if [[ "$CLOUD_PROVIDER" == "aws" ]]; then
     aws
 elif [[ "$CLOUD_PROVIDER" == "azure" ]]; then
     azure
+elif [[ "$CLOUD_PROVIDER" == "gcp" ]]; then
+    gcp
 elif [[ "$CLOUD_PROVIDER" == "ibmcloud" ]]; then
     ibmcloud
 elif [[ "$CLOUD_PROVIDER" == "ibmcloud-powervs" ]]; then
     ibmcloud_powervs
 elif [[ "$CLOUD_PROVIDER" == "libvirt" ]]; then
     libvirt
+elif [[ "$CLOUD_PROVIDER" == "openstack" ]]; then
+    openstack
 elif [[ "$CLOUD_PROVIDER" == "vsphere" ]]; then
     vsphere
 elif [[ "$CLOUD_PROVIDER" == "docker" ]]; then
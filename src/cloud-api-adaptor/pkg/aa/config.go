@@ -1,7 +1,11 @@
 package aa
 
 import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 
 	toml "github.com/pelletier/go-toml/v2"
@@ -11,15 +15,119 @@ const (
 	ConfigFilePath = "/run/peerpod/aa.toml"
 )
 
+// AAConfig is the attestation agent configuration. Each token config enables
+// the attestation agent to get a token from the respective service.
 type AAConfig struct {
-	TokenCfg struct {
-		CocoAs struct {
-			URL string `toml:"url"`
-		} `toml:"coco_as"`
-		Kbs struct {
-			URL string `toml:"url"`
-		} `toml:"kbs"`
-	} `toml:"token_configs"`
+	TokenCfg TokenConfigs `toml:"token_configs"`
+}
+
+type TokenConfigs struct {
+	CocoAs *CocoASConfig `toml:"coco_as,omitempty"`
+	Kbs    *KbsConfig    `toml:"kbs,omitempty"`
+}
+
+type CocoASConfig struct {
+	URL string `toml:"url"`
+}
+
+type KbsConfig struct {
+	URL string `toml:"url"`
+	// Cert is the PEM certificate the KBS is pinned to
+	Cert string `toml:"cert,omitempty,multiline"`
+}
+
+// NewConfig returns a configuration with a token config for each of the
+// Attestation Service and the KBS that has a URL
+func NewConfig(asURL, kbsURL, kbsCert string) *AAConfig {
+	config := &AAConfig{}
+	if asURL != "" {
+		config.TokenCfg.CocoAs = &CocoASConfig{URL: asURL}
+	}
+	if kbsURL != "" {
+		config.TokenCfg.Kbs = &KbsConfig{URL: kbsURL, Cert: kbsCert}
+	}
+	return config
+}
+
+// Validate checks that the configuration has at least one valid token config
+func (c *AAConfig) Validate() error {
+	if c.TokenCfg.CocoAs == nil && c.TokenCfg.Kbs == nil {
+		return errors.New("no token config")
+	}
+	if as := c.TokenCfg.CocoAs; as != nil {
+		if err := ValidateURL(as.URL); err != nil {
+			return fmt.Errorf("invalid Attestation Service URL: %w", err)
+		}
+	}
+	if kbs := c.TokenCfg.Kbs; kbs != nil {
+		if err := ValidateURL(kbs.URL); err != nil {
+			return fmt.Errorf("invalid KBS URL: %w", err)
+		}
+		if kbs.Cert != "" {
+			if err := ValidateCert(kbs.Cert); err != nil {
+				return fmt.Errorf("invalid KBS certificate: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Render validates the configuration and renders it as TOML
+func (c *AAConfig) Render() (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+	return c.Marshal()
+}
+
+// Marshal renders the configuration as TOML without validating it. The
+// token configs are only used with the cc_kbc KBC, the offline KBCs take
+// arbitrary parameters.
+func (c *AAConfig) Marshal() (string, error) {
+	bytes, err := toml.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// ValidateURL checks that s is an absolute http or https URL
+func ValidateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q is not an http or https URL", s)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", s)
+	}
+	return nil
+}
+
+// ValidateCert checks that s holds PEM encoded X.509 certificates
+func ValidateCert(s string) error {
+	rest := []byte(s)
+	found := false
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return fmt.Errorf("unexpected PEM block %q", block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return err
+		}
+		found = true
+	}
+	if !found {
+		return errors.New("no PEM certificate found")
+	}
+	return nil
 }
 
 func parseAAKBCParams(aaKBCParams string) (string, error) {
@@ -37,15 +145,7 @@ func CreateConfigFile(aaKBCParams string) (string, error) {
 		return "", err
 	}
 
-	config := AAConfig{}
-	// Assume KBS and AS has same endpoint
-	// Need a new parameter in addition to aaKBCParams if deploy AS and KBS separately.
-	config.TokenCfg.CocoAs.URL = url
-	config.TokenCfg.Kbs.URL = url
-
-	bytes, err := toml.Marshal(config)
-	if err != nil {
-		return "", err
-	}
-	return string(bytes), nil
+	// aa-kbc-params has a single URL, the KBS and the Attestation Service are
+	// assumed to share it. It is not necessarily a URL for the offline KBCs.
+	return NewConfig(url, url, "").Marshal()
 }
@@ -1,7 +1,13 @@
 package aa
 
 import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+
+	toml "github.com/pelletier/go-toml/v2"
 )
 
 func Test_parseAAKBCParams(t *testing.T) {
@@ -34,3 +40,72 @@ url = 'http://127.0.0.1:8080'
 		t.Errorf("Expected: \n%s, got: \n%s", refcfg, config)
 	}
 }
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func readTestCert(t *testing.T) string {
+	cert, err := os.ReadFile(filepath.Join("testdata", "kbs-cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(cert)
+}
+
+// checkGolden compares rendered with testdata/<name>.toml
+func checkGolden(t *testing.T, name, rendered string) {
+	golden := filepath.Join("testdata", name+".toml")
+	if *update {
+		if err := os.WriteFile(golden, []byte(rendered), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered != string(expected) {
+		t.Errorf("Expected: \n%s, got: \n%s", expected, rendered)
+	}
+}
+
+func TestRender(t *testing.T) {
+	cert := readTestCert(t)
+
+	for _, tc := range []struct {
+		name   string
+		config *AAConfig
+	}{
+		{"as-and-kbs", NewConfig("http://as.coco:50004", "https://kbs.coco:8080", cert)},
+		{"kbs-only", NewConfig("", "https://kbs.coco:8080", cert)},
+		{"as-only", NewConfig("http://as.coco:50004", "", "")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rendered, err := tc.config.Render()
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tc.name, rendered)
+
+			var parsed AAConfig
+			if err := toml.Unmarshal([]byte(rendered), &parsed); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&parsed, tc.config) {
+				t.Errorf("Expected %+v, got %+v", tc.config, &parsed)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for name, config := range map[string]*AAConfig{
+		"no token config": NewConfig("", "", ""),
+		"invalid AS URL":  NewConfig("as.coco:50004", "", ""),
+		"invalid KBS URL": NewConfig("", "ftp://kbs.coco", ""),
+		"invalid cert":    NewConfig("", "https://kbs.coco:8080", "not a cert"),
+	} {
+		if _, err := config.Render(); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+}
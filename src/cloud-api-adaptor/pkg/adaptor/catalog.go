@@ -0,0 +1,66 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package adaptor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// CatalogConfigMap is the ConfigMap the catalog of the providers is
+	// published in, next to the peer-pods ConfigMap
+	CatalogConfigMap = "peer-pods-catalog"
+	// CatalogKey is the key of the JSON encoded catalog in CatalogConfigMap
+	CatalogKey = "catalog.json"
+)
+
+// publishCatalog writes the catalog of the current providers to the catalog
+// ConfigMap. The adaptors of all the nodes publish the same catalog, so the
+// ConfigMap is only written when its content differs and losing a race to
+// another adaptor is not an error.
+func (s *server) publishCatalog(ctx context.Context, clientset kubernetes.Interface) error {
+	catalog, err := s.cloudService.Catalog()
+	if err != nil {
+		return fmt.Errorf("getting the catalog: %w", err)
+	}
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	configMaps := clientset.CoreV1().ConfigMaps(s.configNamespace)
+	cm, err := configMaps.Get(ctx, CatalogConfigMap, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: CatalogConfigMap, Namespace: s.configNamespace},
+			Data:       map[string]string{CatalogKey: string(data)},
+		}
+		if _, err := configMaps.Create(ctx, cm, metav1.CreateOptions{}); err != nil && !k8serrors.IsAlreadyExists(err) {
+			return fmt.Errorf("creating ConfigMap %s: %w", CatalogConfigMap, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting ConfigMap %s: %w", CatalogConfigMap, err)
+	}
+
+	if cm.Data[CatalogKey] == string(data) {
+		return nil
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[CatalogKey] = string(data)
+	if _, err := configMaps.Update(ctx, cm, metav1.UpdateOptions{}); err != nil && !k8serrors.IsConflict(err) {
+		return fmt.Errorf("updating ConfigMap %s: %w", CatalogConfigMap, err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package adaptor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/cloud"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+type catalogProvider struct {
+	mockProvider
+	catalog provider.InstanceCatalog
+}
+
+func (p *catalogProvider) InstanceCatalog() provider.InstanceCatalog {
+	return p.catalog
+}
+
+func TestPublishCatalog(t *testing.T) {
+	p := &catalogProvider{catalog: provider.InstanceCatalog{
+		DefaultInstanceType: "small",
+		InstanceTypes:       []string{"small", "large"},
+		Specs:               []provider.InstanceTypeSpec{{InstanceType: "small", VCPUs: 2, Memory: 4096}, {InstanceType: "large", VCPUs: 8, Memory: 32768}},
+	}}
+	s := NewServer(p, &ServerConfig{ConfigNamespace: "confidential-containers-system"}, &mockWorkerNode{}).(*server)
+	clientset := fake.NewSimpleClientset()
+	ctx := context.Background()
+
+	getCatalog := func() *cloud.Catalog {
+		t.Helper()
+		cm, err := clientset.CoreV1().ConfigMaps("confidential-containers-system").Get(ctx, CatalogConfigMap, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("getting the catalog ConfigMap: %v", err)
+		}
+		var catalog cloud.Catalog
+		if err := json.Unmarshal([]byte(cm.Data[CatalogKey]), &catalog); err != nil {
+			t.Fatalf("decoding the catalog: %v", err)
+		}
+		return &catalog
+	}
+
+	if err := s.publishCatalog(ctx, clientset); err != nil {
+		t.Fatalf("publishCatalog() error = %v", err)
+	}
+	catalog := getCatalog()
+	if catalog.Instances == nil || catalog.Instances.DefaultInstanceType != "small" || len(catalog.Instances.Specs) != 2 {
+		t.Errorf("published instances = %+v", catalog.Instances)
+	}
+	if catalog.Initdata.MaxSize == 0 || len(catalog.Initdata.Keys) == 0 || len(catalog.Initdata.Algorithms) == 0 {
+		t.Errorf("published initdata = %+v", catalog.Initdata)
+	}
+
+	// An unchanged catalog is not written again
+	actions := len(clientset.Actions())
+	if err := s.publishCatalog(ctx, clientset); err != nil {
+		t.Fatalf("publishCatalog() error = %v", err)
+	}
+	for _, action := range clientset.Actions()[actions:] {
+		if action.GetVerb() != "get" {
+			t.Errorf("unexpected %s of the unchanged catalog", action.GetVerb())
+		}
+	}
+
+	// A provider that does not report a catalog
+	s.cloudService.ReloadProvider(&mockProvider{})
+	if err := s.publishCatalog(ctx, clientset); err != nil {
+		t.Fatalf("publishCatalog() error = %v", err)
+	}
+	if catalog := getCatalog(); catalog.Instances != nil {
+		t.Errorf("published instances = %+v, want none", catalog.Instances)
+	}
+}
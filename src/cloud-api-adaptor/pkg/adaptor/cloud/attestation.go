@@ -0,0 +1,113 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/aa"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/cdh"
+	"gopkg.in/yaml.v2"
+)
+
+const defaultKBC = "cc_kbc"
+
+// AttestationConfig configures the attestation agent and the confidential
+// data hub of the pod VMs
+type AttestationConfig struct {
+	// KBC is the key broker client of CDH, cc_kbc by default
+	KBC string `yaml:"kbc,omitempty"`
+	// KBSURL enables the KBS token config and is the URL used by the KBC
+	KBSURL string `yaml:"kbsURL,omitempty"`
+	// KBSCert is the PEM certificate the KBS is pinned to
+	KBSCert string `yaml:"kbsCert,omitempty"`
+	// ASURL enables the Attestation Service token config
+	ASURL       string           `yaml:"asURL,omitempty"`
+	Credentials []cdh.Credential `yaml:"credentials,omitempty"`
+	Image       *cdh.ImageConfig `yaml:"image,omitempty"`
+}
+
+// LoadAttestationConfig reads an attestation config from a YAML or JSON file
+func LoadAttestationConfig(path string) (*AttestationConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading attestation config: %w", err)
+	}
+	var config AttestationConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing attestation config %s: %w", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid attestation config %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// AttestationConfigFromAAKBCParams converts and validates the <kbc>::<url>
+// aa-kbc-params, the URL of which serves both as the KBS and the Attestation
+// Service URL. The offline KBCs take other parameters than a URL.
+func AttestationConfigFromAAKBCParams(aaKBCParams string) (*AttestationConfig, error) {
+	kbc, url, ok := strings.Cut(aaKBCParams, "::")
+	if !ok {
+		return nil, fmt.Errorf("Invalid aa-kbs-params input: %s", aaKBCParams)
+	}
+	config := &AttestationConfig{KBC: kbc, KBSURL: url, ASURL: url}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid aa-kbc-params %s: %w", aaKBCParams, err)
+	}
+	return config, nil
+}
+
+func (c *AttestationConfig) kbc() string {
+	if c.KBC == "" {
+		return defaultKBC
+	}
+	return c.KBC
+}
+
+func (c *AttestationConfig) aaConfig() *aa.AAConfig {
+	return aa.NewConfig(c.ASURL, c.KBSURL, c.KBSCert)
+}
+
+func (c *AttestationConfig) cdhConfig() *cdh.Config {
+	return cdh.NewConfig(cdh.KBCConfig{Name: c.kbc(), URL: c.KBSURL, KBSCert: c.KBSCert}, c.Credentials, c.Image)
+}
+
+// usesTokens tells whether the attestation agent gets tokens from the KBS or
+// the Attestation Service, which only the cc_kbc KBC does
+func (c *AttestationConfig) usesTokens() bool {
+	return c.kbc() == defaultKBC
+}
+
+// Validate checks that valid attestation agent and CDH configurations can
+// be rendered
+func (c *AttestationConfig) Validate() error {
+	if c.usesTokens() {
+		if err := c.aaConfig().Validate(); err != nil {
+			return fmt.Errorf("attestation agent config: %w", err)
+		}
+	}
+	if err := c.cdhConfig().Validate(); err != nil {
+		return fmt.Errorf("CDH config: %w", err)
+	}
+	return nil
+}
+
+// Render returns the aa.toml and cdh.toml contents
+func (c *AttestationConfig) Render() (aaTOML, cdhTOML string, err error) {
+	if c.usesTokens() {
+		aaTOML, err = c.aaConfig().Render()
+	} else {
+		aaTOML, err = c.aaConfig().Marshal()
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("creating attestation agent config: %w", err)
+	}
+	if cdhTOML, err = c.cdhConfig().Render(); err != nil {
+		return "", "", fmt.Errorf("creating CDH config: %w", err)
+	}
+	return aaTOML, cdhTOML, nil
+}
@@ -0,0 +1,87 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/aa"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/cdh"
+)
+
+func TestLoadAttestationConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "attestation.yaml")
+
+	err := os.WriteFile(path, []byte(`
+kbsURL: https://kbs.coco:8080
+asURL: http://as.coco:50004
+credentials:
+- resourceURI: kbs:///default/credential/registry
+  path: /run/confidential-containers/cdh/credential/registry
+image:
+  imageSecurityPolicyURI: kbs:///default/security-policy/test
+`), 0o644)
+	assert.NoError(t, err)
+
+	config, err := LoadAttestationConfig(path)
+	assert.NoError(t, err)
+
+	aaTOML, cdhTOML, err := config.Render()
+	assert.NoError(t, err)
+	assert.Contains(t, aaTOML, "[token_configs.coco_as]\nurl = 'http://as.coco:50004'")
+	assert.Contains(t, aaTOML, "[token_configs.kbs]\nurl = 'https://kbs.coco:8080'")
+	assert.Contains(t, cdhTOML, "name = 'cc_kbc'")
+	assert.Contains(t, cdhTOML, "resource_uri = 'kbs:///default/credential/registry'")
+	assert.Contains(t, cdhTOML, "image_security_policy_uri = 'kbs:///default/security-policy/test'")
+
+	// Unknown fields and invalid settings are refused
+	for _, content := range []string{
+		"kbsURL: https://kbs.coco:8080\nkbsurl: https://kbs.coco:8080\n",
+		"kbc: cc_kbc\n",
+		"kbsURL: https://kbs.coco:8080\ncredentials:\n- resourceURI: https://registry\n  path: /run/cred\n",
+	} {
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		_, err = LoadAttestationConfig(path)
+		assert.Error(t, err, content)
+	}
+}
+
+func TestAttestationConfigFromAAKBCParams(t *testing.T) {
+	params := "cc_kbc::http://127.0.0.1:8080"
+
+	config, err := AttestationConfigFromAAKBCParams(params)
+	assert.NoError(t, err)
+
+	aaTOML, cdhTOML, err := config.Render()
+	assert.NoError(t, err)
+
+	// The rendered files match the ones created from aa-kbc-params
+	expectedAA, err := aa.CreateConfigFile(params)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedAA, aaTOML)
+	expectedCDH, err := cdh.CreateConfigFile(params)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedCDH, cdhTOML)
+
+	_, err = AttestationConfigFromAAKBCParams("http://127.0.0.1:8080")
+	assert.Error(t, err)
+	_, err = AttestationConfigFromAAKBCParams("cc_kbc::null")
+	assert.Error(t, err)
+
+	// The offline KBCs don't take a URL and don't use the token configs
+	params = "offline_fs_kbc::null"
+	config, err = AttestationConfigFromAAKBCParams(params)
+	assert.NoError(t, err)
+	aaTOML, cdhTOML, err = config.Render()
+	assert.NoError(t, err)
+	expectedAA, err = aa.CreateConfigFile(params)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedAA, aaTOML)
+	assert.Contains(t, cdhTOML, "name = 'offline_fs_kbc'")
+}
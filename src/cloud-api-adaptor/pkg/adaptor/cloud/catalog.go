@@ -0,0 +1,87 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"errors"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+// Catalog describes the pod VMs the adaptor can create. It is published for
+// the webhook, which rejects the pods that CreateVM would fail.
+type Catalog struct {
+	// Instances is the catalog of the default provider, nil if the provider
+	// does not report one
+	Instances *provider.InstanceCatalog `json:"instances,omitempty"`
+	// Profiles are the catalogs of the provider profiles, by name. A profile
+	// whose provider does not report a catalog maps to nil.
+	Profiles map[string]*provider.InstanceCatalog `json:"profiles,omitempty"`
+	// Initdata describes the initdata accepted in pod annotations
+	Initdata InitdataCatalog `json:"initdata"`
+}
+
+// InitdataCatalog describes the initdata documents passing initdata.Validate
+type InitdataCatalog struct {
+	// MaxSize is the maximum size of the decoded document in bytes
+	MaxSize int `json:"maxSize"`
+	// Algorithms are the supported digest algorithms
+	Algorithms []string `json:"algorithms"`
+	// Keys are the data keys in the allowlist of initdata files
+	Keys []string `json:"keys"`
+}
+
+// Catalog returns the catalog of the current providers and initdata allowlist
+func (s *cloudService) Catalog() (*Catalog, error) {
+	allowlist := initdata.DefaultAllowlist()
+	if s.initdataFiles != "" {
+		var err error
+		if allowlist, err = initdata.LoadAllowlist(s.initdataFiles); err != nil {
+			return nil, err
+		}
+	}
+
+	catalog := &Catalog{
+		Initdata: InitdataCatalog{
+			MaxSize:    initdata.MaxSize,
+			Algorithms: initdata.Algorithms,
+			Keys:       allowlist.Keys(),
+		},
+	}
+
+	cloudProvider, release := s.profiles.Default().Acquire()
+	catalog.Instances = instanceCatalog(cloudProvider)
+	release()
+
+	for _, name := range s.profiles.Names() {
+		cloudProvider, release, err := s.profiles.Acquire(name)
+		if errors.Is(err, provider.ErrUnknownProfile) {
+			// The profile was removed meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if catalog.Profiles == nil {
+			catalog.Profiles = make(map[string]*provider.InstanceCatalog)
+		}
+		catalog.Profiles[name] = instanceCatalog(cloudProvider)
+		release()
+	}
+	return catalog, nil
+}
+
+func instanceCatalog(cloudProvider provider.Provider) *provider.InstanceCatalog {
+	reporter, ok := cloudProvider.(provider.CatalogReporter)
+	if !ok {
+		return nil
+	}
+	instances := reporter.InstanceCatalog()
+	// An empty catalog is reported by plugin providers without one
+	if instances.DefaultInstanceType == "" && len(instances.InstanceTypes) == 0 && len(instances.Specs) == 0 {
+		return nil
+	}
+	return &instances
+}
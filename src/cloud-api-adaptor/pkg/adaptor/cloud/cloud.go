@@ -18,6 +18,8 @@ import (
 
 	"github.com/containerd/containerd/pkg/cri/annotations"
 	pb "github.com/kata-containers/kata-containers/src/runtime/protocols/hypervisor"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/aa"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/k8sops"
@@ -31,6 +33,7 @@ import (
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	putil "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+	peerPodV1alpha1 "github.com/confidential-containers/cloud-api-adaptor/src/peerpod-ctrl/api/v1alpha1"
 )
 
 const (
@@ -78,8 +81,8 @@ func (s *cloudService) removeSandbox(id sandboxID) error {
 	return nil
 }
 
-func NewService(provider provider.Provider, proxyFactory proxy.Factory, workerNode podnetwork.WorkerNode,
-	secureComms bool, secureCommsInbounds, secureCommsOutbounds, kbsAddress, podsDir, daemonPort, aaKBCParams, sshport string,
+func NewService(cloudProvider provider.Provider, proxyFactory proxy.Factory, workerNode podnetwork.WorkerNode,
+	secureComms bool, secureCommsInbounds, secureCommsOutbounds, kbsAddress, podsDir, daemonPort, sshport string, cfg Config,
 ) Service {
 	var err error
 	var sshClient *wnssh.SshClient
@@ -94,14 +97,20 @@ func NewService(provider provider.Provider, proxyFactory proxy.Factory, workerNo
 	}
 
 	s := &cloudService{
-		provider:     provider,
-		proxyFactory: proxyFactory,
-		sandboxes:    map[sandboxID]*sandbox{},
-		podsDir:      podsDir,
-		daemonPort:   daemonPort,
-		workerNode:   workerNode,
-		aaKBCParams:  aaKBCParams,
-		sshClient:    sshClient,
+		profiles:             provider.NewProfiles(cloudProvider),
+		proxyFactory:         proxyFactory,
+		sandboxes:            map[sandboxID]*sandbox{},
+		podsDir:              podsDir,
+		daemonPort:           daemonPort,
+		workerNode:           workerNode,
+		sshClient:            sshClient,
+		podTags:              cfg.PodTags,
+		protection:           cfg.UserDataProtection,
+		attestation:          cfg.Attestation,
+		initdataDefaults:     cfg.InitdataDefaults,
+		initdataFiles:        cfg.InitdataFiles,
+		agentOptions:         cfg.AgentOptions,
+		registryAuthFallback: cfg.RegistryAuthFallback,
 	}
 	s.cond = sync.NewCond(&s.mutex)
 	s.ppService, err = k8sops.NewPeerPodService()
@@ -113,11 +122,38 @@ func NewService(provider provider.Provider, proxyFactory proxy.Factory, workerNo
 }
 
 func (s *cloudService) Teardown() error {
-	return s.provider.Teardown()
+	return s.profiles.Teardown()
 }
 
 func (s *cloudService) ConfigVerifier() error {
-	return s.provider.ConfigVerifier()
+	p, release := s.profiles.Default().Acquire()
+	defer release()
+
+	return p.ConfigVerifier()
+}
+
+func (s *cloudService) ReloadProvider(p provider.Provider) {
+	s.profiles.Default().Swap(p)
+}
+
+func (s *cloudService) LoadProfiles(dir, defaultCloud string, env map[string]string) error {
+	return s.profiles.Load(dir, defaultCloud, env)
+}
+
+// profileOf returns the provider profile selected by the profile annotation of
+// a pod, or else by its RuntimeClass when a profile is named after it
+func (s *cloudService) profileOf(annotations map[string]string, pod *v1.Pod) (string, error) {
+	profile := annotations[peerPodV1alpha1.ProfileAnnotation]
+	if profile == "" && pod != nil {
+		profile = pod.Annotations[peerPodV1alpha1.ProfileAnnotation]
+		if profile == "" && pod.Spec.RuntimeClassName != nil && s.profiles.Has(*pod.Spec.RuntimeClassName) {
+			profile = *pod.Spec.RuntimeClassName
+		}
+	}
+	if profile != "" && !s.profiles.Has(profile) {
+		return "", fmt.Errorf("%w: %s", provider.ErrUnknownProfile, profile)
+	}
+	return profile, nil
 }
 
 func (s *cloudService) setInstance(sid sandboxID, instanceID, instanceName string) error {
@@ -200,6 +236,40 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 		InstanceType: instanceType,
 		VCPUs:        vcpus,
 		Memory:       memory,
+		PodNamespace: namespace,
+	}
+
+	// The pod object selects the pod VM tags, the default initdata and the
+	// registry credentials
+	var podObj *v1.Pod
+	if s.ppService != nil {
+		var podErr error
+		if podObj, podErr = s.ppService.GetPod(pod, namespace); podErr != nil {
+			logger.Printf("failed to get pod %s/%s, only using sandbox annotations: %v", namespace, pod, podErr)
+		}
+	}
+
+	// The remote hypervisor only passes the instance type, cpu and memory
+	// annotations, the root disk size annotation is read from the pod
+	vmSpec.RootDiskSize = util.GetRootDiskSizeFromAnnotation(req.Annotations)
+	if vmSpec.RootDiskSize == 0 && podObj != nil {
+		vmSpec.RootDiskSize = util.GetRootDiskSizeFromAnnotation(podObj.Annotations)
+	}
+
+	profile, err := s.profileOf(req.Annotations, podObj)
+	if err != nil {
+		return nil, fmt.Errorf("selecting the provider of pod %s/%s: %w", namespace, pod, err)
+	}
+	if profile != "" {
+		logger.Printf("pod %s/%s uses provider profile %s", namespace, pod, profile)
+	}
+
+	if s.podTags.Enabled {
+		var meta *metav1.ObjectMeta
+		if podObj != nil {
+			meta = &podObj.ObjectMeta
+		}
+		vmSpec.Tags = s.podTags.Tags(pod, namespace, req.Annotations, meta)
 	}
 
 	// TODO: server name is also generated in each cloud provider, and possibly inconsistent
@@ -220,21 +290,30 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 
 	agentProxy := s.proxyFactory.New(serverName, socketPath)
 
-	var authJSON []byte
-	var authFilePath string
-	_, err = os.Stat(SrcAuthfilePath)
+	authJSON, err := s.registryAuth(podObj)
 	if err != nil {
-		logger.Printf("credential file %s is not present, skipping image auth config", SrcAuthfilePath)
-	} else {
-		authJSON, err = os.ReadFile(SrcAuthfilePath)
-		if err != nil {
-			return nil, fmt.Errorf("error reading %s: %v", SrcAuthfilePath, err)
-		}
+		return nil, fmt.Errorf("registry credentials of pod %s/%s: %w", namespace, pod, err)
+	}
+	var authFilePath string
+	if authJSON != nil {
 		authFilePath = AuthFilePath
-		logger.Printf("configure agent to use credentials file %s", SrcAuthfilePath)
 	}
 
-	agentConfig, err := agent.CreateConfigFile(authFilePath)
+	// The remote hypervisor doesn't pass the pod annotations, the agent
+	// options are read from the pod
+	agentAnnotations := req.Annotations
+	if podObj != nil {
+		agentAnnotations = podObj.Annotations
+	}
+	agentOptions, err := agent.OptionsFromAnnotations(agentAnnotations, s.agentOptions)
+	if err != nil {
+		return nil, fmt.Errorf("agent config of pod %s/%s: %w", namespace, pod, err)
+	}
+	if len(agentOptions) > 0 {
+		logger.Printf("agent options of pod %s/%s: %v", namespace, pod, agentOptions)
+	}
+
+	agentConfig, err := agent.CreateConfigFile(authFilePath, agentOptions)
 	if err != nil {
 		return nil, fmt.Errorf("creating agent config: %w", err)
 	}
@@ -244,6 +323,10 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 		PodName:      pod,
 		PodNetwork:   podNetworkConfig,
 		TLSClientCA:  string(agentProxy.ClientCA()),
+		SandboxID:    string(sid),
+	}
+	if s.protection.EncryptionKey != nil {
+		daemonConfig.EncryptedFiles = s.protection.EncryptedFiles
 	}
 
 	if caService := agentProxy.CAService(); caService != nil {
@@ -282,44 +365,40 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 	}
 
 	if authJSON != nil {
-		if len(authJSON) > cloudinit.DefaultAuthfileLimit {
-			logger.Printf("Credentials file is too large to be included in cloud-config")
-		} else {
-			cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, cloudinit.WriteFile{
-				Path:    AuthFilePath,
-				Content: string(authJSON),
-			})
-		}
-	}
-
-	if s.aaKBCParams != "" { // Keep AA_KBC_PARAMS support as it is used by e2e test, KBS is dynamic k8s service in e2e test
-		logger.Printf("aaKBCParams: %s, support cc_kbc::*", s.aaKBCParams)
-		toml, err := cdh.CreateConfigFile(s.aaKBCParams)
-		if err != nil {
-			return nil, fmt.Errorf("creating CDH config: %w", err)
-		}
 		cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, cloudinit.WriteFile{
-			Path:    cdh.ConfigFilePath,
-			Content: toml,
+			Path:    AuthFilePath,
+			Content: string(authJSON),
 		})
+	}
 
-		toml, err = aa.CreateConfigFile(s.aaKBCParams)
+	attestation := s.attestation
+	if attestation != nil {
+		aaTOML, cdhTOML, err := attestation.Render()
 		if err != nil {
-			return nil, fmt.Errorf("creating attestation agent config: %w", err)
+			return nil, err
 		}
 		cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, cloudinit.WriteFile{
+			Path:    cdh.ConfigFilePath,
+			Content: cdhTOML,
+		}, cloudinit.WriteFile{
 			Path:    aa.ConfigFilePath,
-			Content: toml,
+			Content: aaTOML,
 		})
 	}
 
 	initdataStr := util.GetInitdataFromAnnotation(req.Annotations)
 	logger.Printf("initdata: %s", initdataStr)
-	if initdataStr != "" {
-		if s.aaKBCParams != "" {
-			logger.Printf("Initdata ignored because AA_KBC_PARAMS set")
-		} else {
-			logger.Printf("Set and use initdata when no AA_KBC_PARAMS")
+	var initdataDigest string
+	if attestation != nil {
+		if initdataStr != "" {
+			logger.Printf("Initdata ignored because the attestation is configured by the adaptor")
+		}
+	} else {
+		if initdataStr, initdataDigest, err = s.resolveInitdata(namespace, podObj, initdataStr); err != nil {
+			return nil, fmt.Errorf("resolving initdata of pod %s/%s: %w", namespace, pod, err)
+		}
+		if initdataStr != "" {
+			logger.Printf("Set and use initdata when the attestation is not configured by the adaptor, digest: %s", initdataDigest)
 			cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, cloudinit.WriteFile{
 				Path:    InitdataPath,
 				Content: initdataStr,
@@ -327,15 +406,33 @@ func (s *cloudService) CreateVM(ctx context.Context, req *pb.CreateVMRequest) (r
 		}
 	}
 
+	if err := s.protection.apply(cloudConfig); err != nil {
+		return nil, fmt.Errorf("protecting the cloud config of pod %s: %w", pod, err)
+	}
+
+	cloudProvider, release, err := s.profiles.Acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if limiter, ok := cloudProvider.(provider.UserDataLimiter); ok {
+		if err := cloudConfig.Fit(limiter.UserDataLimit()); err != nil {
+			return nil, fmt.Errorf("fitting the cloud config of pod %s in the userdata of the pod VM: %w", pod, err)
+		}
+	}
+
 	sandbox := &sandbox{
-		id:           sid,
-		podName:      pod,
-		podNamespace: namespace,
-		netNSPath:    netNSPath,
-		agentProxy:   agentProxy,
-		podNetwork:   podNetworkConfig,
-		cloudConfig:  cloudConfig,
-		spec:         vmSpec,
+		id:             sid,
+		podName:        pod,
+		podNamespace:   namespace,
+		netNSPath:      netNSPath,
+		agentProxy:     agentProxy,
+		podNetwork:     podNetworkConfig,
+		cloudConfig:    cloudConfig,
+		spec:           vmSpec,
+		initdataDigest: initdataDigest,
+		profile:        profile,
 	}
 
 	if err := s.addSandbox(sid, sandbox); err != nil {
@@ -361,16 +458,39 @@ func (s *cloudService) StartVM(ctx context.Context, req *pb.StartVMRequest) (res
 		return nil, fmt.Errorf("getting sandbox: %w", err)
 	}
 
-	instance, err := s.provider.CreateInstance(ctx, sandbox.podName, string(sid), sandbox.cloudConfig, sandbox.spec)
+	cloudProvider, release, err := s.profiles.Acquire(sandbox.profile)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if release != nil {
+			release()
+		}
+	}()
+
+	instance, err := cloudProvider.CreateInstance(ctx, sandbox.podName, string(sid), sandbox.cloudConfig, sandbox.spec)
 	if err != nil {
 		return nil, fmt.Errorf("creating an instance : %w", err)
 	}
 
+	// Record the failure of a pod VM that failed to start and keep its console
+	// output. Reading the console may be slow, so StartVM doesn't wait for it,
+	// StopVM does before deleting the instance. The provider is released once
+	// the console is captured.
+	defer func() {
+		if err != nil {
+			s.updatePeerPodStatus(sandbox, startFailed(err))
+			s.startConsoleCapture(cloudProvider, release, sandbox, instance.ID)
+			release = nil
+		}
+	}()
+
 	if s.ppService != nil {
-		if err := s.ppService.OwnPeerPod(sandbox.podName, sandbox.podNamespace, instance.ID); err != nil {
+		if err := s.ppService.OwnPeerPod(sandbox.podName, sandbox.podNamespace, instance.ID, sandbox.initdataDigest, sandbox.profile, s.profiles.CloudName(sandbox.profile)); err != nil {
 			logger.Printf("failed to create PeerPod: %v", err)
 		}
 	}
+	s.updatePeerPodStatus(sandbox, instanceCreated(instance))
 
 	if err := s.setInstance(sid, instance.ID, instance.Name); err != nil {
 		return nil, fmt.Errorf("setting instance: %w", err)
@@ -402,6 +522,7 @@ func (s *cloudService) StartVM(ctx context.Context, req *pb.StartVMRequest) (res
 	if err := s.workerNode.Setup(sandbox.netNSPath, instance.IPs, sandbox.podNetwork); err != nil {
 		return nil, fmt.Errorf("setting up pod network tunnel on netns %s: %w", sandbox.netNSPath, err)
 	}
+	s.updatePeerPodStatus(sandbox, networkReady)
 
 	serverURL := &url.URL{
 		Scheme: "http",
@@ -433,6 +554,7 @@ func (s *cloudService) StartVM(ctx context.Context, req *pb.StartVMRequest) (res
 	}
 
 	logger.Print("agent proxy is ready")
+	s.updatePeerPodStatus(sandbox, agentConnected)
 
 	return &pb.StartVMResponse{}, nil
 }
@@ -455,9 +577,18 @@ func (s *cloudService) StopVM(ctx context.Context, req *pb.StopVMRequest) (*pb.S
 		sandbox.sshClientInst.DisconnectPP(string(sid))
 	}
 
-	if err := s.provider.DeleteInstance(ctx, sandbox.instanceID); err != nil {
+	s.waitForConsoleCapture(sandbox)
+	s.updatePeerPodStatus(sandbox, instanceDeleting)
+
+	cloudProvider, release, err := s.profiles.Acquire(sandbox.profile)
+	if err == nil {
+		defer release()
+		err = cloudProvider.DeleteInstance(ctx, sandbox.instanceID)
+	}
+	if err != nil && !errors.Is(err, provider.ErrInstanceNotFound) {
 		logger.Printf("Error deleting an instance %s: %v", sandbox.instanceID, err)
 	} else if s.ppService != nil {
+		s.updatePeerPodStatus(sandbox, instanceDeleted)
 		if err := s.ppService.ReleasePeerPod(sandbox.podName, sandbox.podNamespace, sandbox.instanceID); err != nil {
 			logger.Printf("failed to release PeerPod %v", err)
 		}
@@ -4,17 +4,29 @@
 package cloud
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
 	"fmt"
 	"net/netip"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	cri "github.com/containerd/containerd/pkg/cri/annotations"
 	pb "github.com/kata-containers/kata-containers/src/runtime/protocols/hypervisor"
 	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/k8sops"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/adaptor/proxy"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/agent"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/podnetwork/tunneler"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/kubemgr"
@@ -23,6 +35,7 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/test/securecomms/test"
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+	peerPodV1alpha1 "github.com/confidential-containers/cloud-api-adaptor/src/peerpod-ctrl/api/v1alpha1"
 )
 
 type mockProvider struct{}
@@ -53,6 +66,42 @@ func (p *mockProvider) SelectInstanceType(ctx context.Context, vCPU int64, memor
 	return "", nil
 }
 
+type mockLimitedProvider struct {
+	mockProvider
+	limit int
+}
+
+func (p *mockLimitedProvider) UserDataLimit() int {
+	return p.limit
+}
+
+type mockConsoleProvider struct {
+	mockProvider
+	output string
+	// delay slows down reading the console
+	delay   time.Duration
+	mutex   sync.Mutex
+	deleted bool
+}
+
+func (p *mockConsoleProvider) ConsoleOutput(ctx context.Context, instanceID string) ([]byte, error) {
+	time.Sleep(p.delay)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.deleted {
+		return nil, provider.ErrInstanceNotFound
+	}
+	return []byte(p.output), nil
+}
+
+func (p *mockConsoleProvider) DeleteInstance(ctx context.Context, instanceID string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.deleted = true
+	return nil
+}
+
 type mockProxy struct {
 	readyCh    chan struct{}
 	stopCh     chan struct{}
@@ -94,6 +143,26 @@ func (f *mockProxyFactory) New(serverName, socketPath string) proxy.AgentProxy {
 	}
 }
 
+type mockFailingProxy struct {
+	mockProxy
+}
+
+func (p *mockFailingProxy) Start(ctx context.Context, serverURL *url.URL) error {
+	return fmt.Errorf("failed to connect to %s", serverURL)
+}
+
+type mockFailingProxyFactory struct{}
+
+func (f *mockFailingProxyFactory) New(serverName, socketPath string) proxy.AgentProxy {
+	return &mockFailingProxy{
+		mockProxy{
+			socketPath: socketPath,
+			readyCh:    make(chan struct{}),
+			stopCh:     make(chan struct{}),
+		},
+	}
+}
+
 type mockWorkerNode struct{}
 
 func (n mockWorkerNode) Inspect(nsPath string) (*tunneler.Config, error) {
@@ -117,7 +186,7 @@ func TestCloudService(t *testing.T) {
 		podsDir: dir,
 	}
 
-	s := NewService(&mockProvider{}, proxyFactory, &mockWorkerNode{}, false, "", "", "", dir, forwarder.DefaultListenPort, "", "")
+	s := NewService(&mockProvider{}, proxyFactory, &mockWorkerNode{}, false, "", "", "", dir, forwarder.DefaultListenPort, "", Config{})
 
 	assert.NotNil(t, s)
 
@@ -150,6 +219,326 @@ func TestCloudService(t *testing.T) {
 	assert.NotNil(t, res3)
 }
 
+func TestCloudServiceUserDataLimit(t *testing.T) {
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	proxyFactory := &mockProxyFactory{
+		podsDir: dir,
+	}
+
+	req := &pb.CreateVMRequest{
+		Id: "123",
+		Annotations: map[string]string{
+			cri.SandboxNamespace: "default",
+			cri.SandboxName:      "mypod",
+		},
+	}
+
+	s := NewService(&mockLimitedProvider{limit: 64}, proxyFactory, &mockWorkerNode{}, false, "", "", "", dir, forwarder.DefaultListenPort, "", Config{})
+	_, err := s.CreateVM(ctx, req)
+	assert.ErrorIs(t, err, cloudinit.ErrUserDataTooLarge)
+
+	s = NewService(&mockLimitedProvider{limit: 16384}, proxyFactory, &mockWorkerNode{}, false, "", "", "", dir, forwarder.DefaultListenPort, "", Config{})
+	_, err = s.CreateVM(ctx, req)
+	assert.NoError(t, err)
+}
+
+func TestCloudServiceReloadProvider(t *testing.T) {
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	proxyFactory := &mockProxyFactory{
+		podsDir: dir,
+	}
+
+	req := &pb.CreateVMRequest{
+		Id: "123",
+		Annotations: map[string]string{
+			cri.SandboxNamespace: "default",
+			cri.SandboxName:      "mypod",
+		},
+	}
+
+	s := NewService(&mockLimitedProvider{limit: 16384}, proxyFactory, &mockWorkerNode{}, false, "", "", "", dir, forwarder.DefaultListenPort, "", Config{})
+	_, err := s.CreateVM(ctx, req)
+	assert.NoError(t, err)
+
+	// New requests are served by the reloaded provider
+	s.ReloadProvider(&mockLimitedProvider{limit: 64})
+	req.Id = "456"
+	_, err = s.CreateVM(ctx, req)
+	assert.ErrorIs(t, err, cloudinit.ErrUserDataTooLarge)
+}
+
+func TestCloudServiceProfiles(t *testing.T) {
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	proxyFactory := &mockProxyFactory{
+		podsDir: dir,
+	}
+
+	s := NewService(&mockLimitedProvider{limit: 16384}, proxyFactory, &mockWorkerNode{}, false, "", "", "", dir, forwarder.DefaultListenPort, "", Config{})
+	s.(*cloudService).profiles.Set("small", &mockLimitedProvider{limit: 64})
+
+	newRequest := func(id, profile string) *pb.CreateVMRequest {
+		req := &pb.CreateVMRequest{
+			Id: id,
+			Annotations: map[string]string{
+				cri.SandboxNamespace: "default",
+				cri.SandboxName:      "mypod",
+			},
+		}
+		if profile != "" {
+			req.Annotations[peerPodV1alpha1.ProfileAnnotation] = profile
+		}
+		return req
+	}
+
+	_, err := s.CreateVM(ctx, newRequest("123", ""))
+	assert.NoError(t, err)
+
+	_, err = s.CreateVM(ctx, newRequest("456", "small"))
+	assert.ErrorIs(t, err, cloudinit.ErrUserDataTooLarge)
+
+	_, err = s.CreateVM(ctx, newRequest("789", "unknown"))
+	assert.ErrorIs(t, err, provider.ErrUnknownProfile)
+}
+
+func TestProfileOf(t *testing.T) {
+	s := &cloudService{profiles: provider.NewProfiles(&mockProvider{})}
+	s.profiles.Set("aws-us-east", &mockProvider{})
+
+	runtimeClass := func(name string) *v1.Pod {
+		return &v1.Pod{Spec: v1.PodSpec{RuntimeClassName: &name}}
+	}
+
+	for name, tc := range map[string]struct {
+		annotations map[string]string
+		pod         *v1.Pod
+		want        string
+		wantErr     bool
+	}{
+		"default":                 {},
+		"sandbox annotation":      {annotations: map[string]string{peerPodV1alpha1.ProfileAnnotation: "aws-us-east"}, want: "aws-us-east"},
+		"pod annotation":          {pod: &v1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{peerPodV1alpha1.ProfileAnnotation: "aws-us-east"}}}, want: "aws-us-east"},
+		"runtime class":           {pod: runtimeClass("aws-us-east"), want: "aws-us-east"},
+		"unrelated runtime class": {pod: runtimeClass("kata-remote")},
+		"unknown profile":         {annotations: map[string]string{peerPodV1alpha1.ProfileAnnotation: "gcp"}, wantErr: true},
+		"annotation over runtime": {annotations: map[string]string{peerPodV1alpha1.ProfileAnnotation: "gcp"}, pod: runtimeClass("aws-us-east"), wantErr: true},
+	} {
+		got, err := s.profileOf(tc.annotations, tc.pod)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("%s: profileOf() = %q, %v, want %q", name, got, err, tc.want)
+		}
+	}
+}
+
+func TestCloudServiceUserDataProtection(t *testing.T) {
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	protection := UserDataProtection{
+		SigningKey:     priv,
+		EncryptionKey:  bytes.Repeat([]byte{1}, cloudinit.EncryptionKeySize),
+		EncryptedFiles: []string{forwarder.DefaultConfigPath},
+	}
+
+	s := NewService(&mockProvider{}, &mockProxyFactory{podsDir: dir}, &mockWorkerNode{}, false, "", "", "", dir, forwarder.DefaultListenPort, "", Config{UserDataProtection: protection})
+
+	req := &pb.CreateVMRequest{
+		Id: "123",
+		Annotations: map[string]string{
+			cri.SandboxNamespace: "default",
+			cri.SandboxName:      "mypod",
+		},
+	}
+	_, err = s.CreateVM(ctx, req)
+	assert.NoError(t, err)
+
+	sandbox, err := s.(*cloudService).getSandbox("123")
+	assert.NoError(t, err)
+
+	userData, err := sandbox.cloudConfig.Generate()
+	assert.NoError(t, err)
+
+	body, err := cloudinit.Verify([]byte(userData), pub)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), forwarder.DefaultConfigPath+cloudinit.EncryptedSuffix)
+	assert.NotContains(t, string(body), "pod-network")
+}
+
+func TestCloudServiceSignedSandboxID(t *testing.T) {
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	s := NewService(&mockProvider{}, &mockProxyFactory{podsDir: dir}, &mockWorkerNode{}, false, "", "", "", dir, forwarder.DefaultListenPort, "", Config{UserDataProtection: UserDataProtection{SigningKey: priv}})
+
+	req := &pb.CreateVMRequest{
+		Id: "123",
+		Annotations: map[string]string{
+			cri.SandboxNamespace: "default",
+			cri.SandboxName:      "mypod",
+		},
+	}
+	_, err = s.CreateVM(ctx, req)
+	assert.NoError(t, err)
+
+	sandbox, err := s.(*cloudService).getSandbox("123")
+	assert.NoError(t, err)
+
+	userData, err := sandbox.cloudConfig.Generate()
+	assert.NoError(t, err)
+
+	// The forwarder only serves the sandbox named in the signed userdata
+	body, err := cloudinit.Verify([]byte(userData), pub)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"sandbox-id": "123"`)
+}
+
+func TestCloudServiceAgentOptions(t *testing.T) {
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := NewService(&mockProvider{}, &mockProxyFactory{podsDir: dir}, &mockWorkerNode{}, false, "", "", "", dir, forwarder.DefaultListenPort, "", Config{AgentOptions: []string{"log_level"}})
+
+	req := &pb.CreateVMRequest{
+		Id: "123",
+		Annotations: map[string]string{
+			cri.SandboxNamespace:                 "default",
+			cri.SandboxName:                      "mypod",
+			agent.AnnotationPrefix + "log_level": "debug",
+		},
+	}
+	_, err := s.CreateVM(ctx, req)
+	assert.NoError(t, err)
+
+	sandbox, err := s.(*cloudService).getSandbox("123")
+	assert.NoError(t, err)
+	assert.Equal(t, agent.ConfigFilePath, sandbox.cloudConfig.WriteFiles[0].Path)
+	assert.Contains(t, sandbox.cloudConfig.WriteFiles[0].Content, "log_level = 'debug'")
+
+	// Options that are not allowed by the adaptor fail the pod
+	req.Id = "456"
+	req.Annotations[agent.AnnotationPrefix+"debug_console"] = "true"
+	_, err = s.CreateVM(ctx, req)
+	assert.ErrorContains(t, err, "not allowed")
+}
+
+func TestCloudServiceAgentOptionsFromPod(t *testing.T) {
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := NewService(&mockProvider{}, &mockProxyFactory{podsDir: dir}, &mockWorkerNode{}, false, "", "", "", dir, forwarder.DefaultListenPort, "", Config{AgentOptions: []string{"log_level"}})
+
+	// The remote hypervisor doesn't pass the pod annotations to the adaptor
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        "mypod",
+		Namespace:   "default",
+		Annotations: map[string]string{agent.AnnotationPrefix + "log_level": "debug"},
+	}}
+	s.(*cloudService).ppService = k8sops.NewPeerPodServiceWithClient(fake.NewSimpleClientset(pod), "mock")
+
+	req := &pb.CreateVMRequest{
+		Id: "123",
+		Annotations: map[string]string{
+			cri.SandboxNamespace: "default",
+			cri.SandboxName:      "mypod",
+		},
+	}
+	_, err := s.CreateVM(ctx, req)
+	assert.NoError(t, err)
+
+	sandbox, err := s.(*cloudService).getSandbox("123")
+	assert.NoError(t, err)
+	assert.Contains(t, sandbox.cloudConfig.WriteFiles[0].Content, "log_level = 'debug'")
+}
+
+func TestCloudServiceConsoleCapture(t *testing.T) {
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	p := &mockConsoleProvider{output: "Booting pod VM\nkata-agent failed\n"}
+	s := NewService(p, &mockFailingProxyFactory{}, &mockWorkerNode{}, false, "", "", "", dir, forwarder.DefaultListenPort, "", Config{})
+
+	req := &pb.CreateVMRequest{
+		Id: "123",
+		Annotations: map[string]string{
+			cri.SandboxNamespace: "default",
+			cri.SandboxName:      "mypod",
+		},
+	}
+	_, err := s.CreateVM(ctx, req)
+	assert.NoError(t, err)
+
+	_, err = s.StartVM(ctx, &pb.StartVMRequest{Id: "123"})
+	assert.Error(t, err)
+
+	// The console output is captured in the background
+	path := filepath.Join(dir, "123", ConsoleLogFile)
+	assert.Eventually(t, func() bool {
+		output, err := os.ReadFile(path)
+		return err == nil && string(output) == p.output
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestCloudServiceConsoleCaptureBeforeStop(t *testing.T) {
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	p := &mockConsoleProvider{output: "kata-agent failed\n", delay: 200 * time.Millisecond}
+	s := NewService(p, &mockFailingProxyFactory{}, &mockWorkerNode{}, false, "", "", "", dir, forwarder.DefaultListenPort, "", Config{})
+
+	req := &pb.CreateVMRequest{
+		Id: "123",
+		Annotations: map[string]string{
+			cri.SandboxNamespace: "default",
+			cri.SandboxName:      "mypod",
+		},
+	}
+	_, err := s.CreateVM(ctx, req)
+	assert.NoError(t, err)
+
+	_, err = s.StartVM(ctx, &pb.StartVMRequest{Id: "123"})
+	assert.Error(t, err)
+
+	// The shim stops the pod VM right away, which waits for the console
+	_, err = s.StopVM(ctx, &pb.StopVMRequest{Id: "123"})
+	assert.NoError(t, err)
+
+	output, err := os.ReadFile(filepath.Join(dir, "123", ConsoleLogFile))
+	assert.NoError(t, err)
+	assert.Equal(t, p.output, string(output))
+	assert.True(t, p.deleted)
+}
+
+func TestConsoleExcerpt(t *testing.T) {
+	assert.Equal(t, "short output", consoleExcerpt([]byte("short output\n"), 64))
+
+	// The excerpt starts at the first complete line of the end of the output
+	output := strings.Repeat("x", 100) + "\nline 1\nline 2\n"
+	assert.Equal(t, "line 1\nline 2", consoleExcerpt([]byte(output), 20))
+
+	// A single long line is cut without splitting a UTF-8 sequence
+	assert.Equal(t, "ééé", consoleExcerpt([]byte(strings.Repeat("é", 10)), 7))
+}
+
 func TestCloudServiceWithSecureComms(t *testing.T) {
 	sshport := "6001"
 	kubemgr.InitKubeMgrMock()
@@ -172,7 +561,7 @@ func TestCloudServiceWithSecureComms(t *testing.T) {
 		podsDir: dir,
 	}
 
-	s := NewService(&mockProvider{}, proxyFactory, &mockWorkerNode{}, true, "", "", "127.0.0.1:9009", dir, forwarder.DefaultListenPort, "", sshport)
+	s := NewService(&mockProvider{}, proxyFactory, &mockWorkerNode{}, true, "", "", "127.0.0.1:9009", dir, forwarder.DefaultListenPort, sshport, Config{})
 
 	assert.NotNil(t, s)
 
@@ -0,0 +1,123 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// ConsoleLogFile is the file in the pod directory the console output of a
+	// pod VM that failed to start is written to
+	ConsoleLogFile = "console.log"
+	// consoleExcerptSize is the size of the end of the console output
+	// attached to the pod event, below the 1KB limit of event messages
+	consoleExcerptSize = 768
+	// consoleEventReason is the reason of the pod event with the console excerpt
+	consoleEventReason = "PodVMConsoleOutput"
+)
+
+// Time allowed to retrieve the console output, a variable to speed up tests
+var consoleTimeout = 30 * time.Second
+
+// startConsoleCapture captures the console output of the instance of a
+// sandbox in the background, then calls release
+func (s *cloudService) startConsoleCapture(cloudProvider provider.Provider, release func(), sandbox *sandbox, instanceID string) {
+	captured := make(chan struct{})
+	s.mutex.Lock()
+	sandbox.consoleCaptured = captured
+	s.mutex.Unlock()
+
+	go func() {
+		defer close(captured)
+		defer release()
+		s.captureConsole(cloudProvider, sandbox, instanceID)
+	}()
+}
+
+// waitForConsoleCapture waits for the console output of the instance of a
+// sandbox to be captured, if it is, so that the instance isn't deleted along
+// with its console in the meantime
+func (s *cloudService) waitForConsoleCapture(sandbox *sandbox) {
+	s.mutex.Lock()
+	captured := sandbox.consoleCaptured
+	s.mutex.Unlock()
+	if captured == nil {
+		return
+	}
+
+	select {
+	case <-captured:
+	case <-time.After(consoleTimeout):
+		logger.Printf("timed out waiting for the console output of sandbox %s", sandbox.id)
+	}
+}
+
+// captureConsole stores the console output of the instance of a sandbox in
+// the pod directory and records its end as an event on the pod, if the
+// provider can read the console of its instances. It runs with its own
+// context, since the request context of the failed StartVM may be done
+// already.
+func (s *cloudService) captureConsole(cloudProvider provider.Provider, sandbox *sandbox, instanceID string) {
+
+	reader, ok := cloudProvider.(provider.ConsoleReader)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), consoleTimeout)
+	defer cancel()
+
+	output, err := reader.ConsoleOutput(ctx, instanceID)
+	if errors.Is(err, provider.ErrNotSupported) {
+		return
+	}
+	if err != nil {
+		logger.Printf("failed to get the console output of instance %s: %v", instanceID, err)
+		return
+	}
+
+	path := filepath.Join(s.podsDir, string(sandbox.id), ConsoleLogFile)
+	if err := os.WriteFile(path, output, 0600); err != nil {
+		logger.Printf("failed to write the console output of instance %s: %v", instanceID, err)
+	} else {
+		logger.Printf("console output of instance %s written to %s", instanceID, path)
+	}
+
+	if s.ppService == nil {
+		return
+	}
+
+	message := "Pod VM failed to start, end of its console output:\n" + consoleExcerpt(output, consoleExcerptSize)
+	if err := s.ppService.RecordPodEvent(sandbox.podName, sandbox.podNamespace, v1.EventTypeWarning, consoleEventReason, message); err != nil {
+		logger.Printf("failed to record the console output of instance %s on pod %s/%s: %v", instanceID, sandbox.podNamespace, sandbox.podName, err)
+	}
+}
+
+// consoleExcerpt returns at most size bytes of the end of output, starting
+// at a line boundary when possible
+func consoleExcerpt(output []byte, size int) string {
+
+	if len(output) > size {
+		output = output[len(output)-size:]
+		// Don't start in the middle of a UTF-8 sequence or of a line
+		for len(output) > 0 && !utf8.RuneStart(output[0]) {
+			output = output[1:]
+		}
+		if i := strings.IndexByte(string(output), '\n'); i >= 0 && i < len(output)-1 {
+			output = output[i+1:]
+		}
+	}
+
+	return strings.ToValidUTF8(strings.TrimRight(string(output), "\r\n\x00"), "?")
+}
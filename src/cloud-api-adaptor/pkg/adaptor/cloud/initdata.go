@@ -0,0 +1,64 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
+)
+
+// resolveInitdata returns the initdata of a pod VM and its digest. The
+// initdata is validated here, since malformed initdata is otherwise only
+// detected by process-user-data after the pod VM has booted. The
+// default initdata rules are re-read for every pod, so that updates of the
+// mounted ConfigMap apply without restarting the adaptor. pod may be nil if
+// the pod object is not available, which is an error if any rule selects on
+// labels or the RuntimeClass, since the pod could miss its default.
+func (s *cloudService) resolveInitdata(namespace string, pod *v1.Pod, podInitdata string) (string, string, error) {
+	defaults := &initdata.Defaults{}
+	if s.initdataDefaults != "" {
+		var err error
+		if defaults, err = initdata.LoadDefaults(s.initdataDefaults); err != nil {
+			return "", "", err
+		}
+	}
+
+	if pod == nil && defaults.SelectsOnPod() {
+		return "", "", fmt.Errorf("pod in namespace %s is not available to select its default initdata", namespace)
+	}
+
+	target := &initdata.Pod{
+		Namespace: namespace,
+		Initdata:  podInitdata,
+	}
+	if pod != nil {
+		target.Labels = pod.Labels
+		if pod.Spec.RuntimeClassName != nil {
+			target.RuntimeClassName = *pod.Spec.RuntimeClassName
+		}
+	}
+
+	encoded, digest, rule, err := defaults.Resolve(target)
+	if err != nil {
+		return "", "", err
+	}
+	if rule != nil {
+		logger.Printf("applied default initdata %q to pod in namespace %s", rule.Name, namespace)
+	}
+	if encoded != "" {
+		allowlist := initdata.DefaultAllowlist()
+		if s.initdataFiles != "" {
+			if allowlist, err = initdata.LoadAllowlist(s.initdataFiles); err != nil {
+				return "", "", err
+			}
+		}
+		if _, _, err := initdata.DecodeAndValidate(encoded, allowlist); err != nil {
+			return "", "", err
+		}
+	}
+	return encoded, digest, nil
+}
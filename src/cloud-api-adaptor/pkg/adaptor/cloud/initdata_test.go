@@ -0,0 +1,141 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cri "github.com/containerd/containerd/pkg/cri/annotations"
+	pb "github.com/kata-containers/kata-containers/src/runtime/protocols/hypervisor"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
+)
+
+const testInitdataDefaults = `rules:
+- name: web
+  podSelector: app=web
+  initdata: |
+    algorithm = "sha256"
+    version = "0.1.0"
+    [data]
+    "policy.rego" = "package agent_policy # web"
+- name: kata-remote
+  runtimeClassName: kata-remote
+  initdata: |
+    algorithm = "sha384"
+    version = "0.1.0"
+    [data]
+    "policy.rego" = "package agent_policy # default"
+`
+
+func TestResolveInitdata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "initdata-defaults.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(testInitdataDefaults), 0o644))
+
+	s := &cloudService{initdataDefaults: path}
+
+	runtimeClass := "kata-remote"
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "db"}},
+		Spec:       v1.PodSpec{RuntimeClassName: &runtimeClass},
+	}
+
+	encoded, digest, err := s.resolveInitdata("default", pod, "")
+	assert.NoError(t, err)
+	decoded, doc, err := initdata.Decode(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, "package agent_policy # default", decoded.Data["policy.rego"])
+	expected, err := initdata.Digest("sha384", doc)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, digest)
+
+	pod.Labels["app"] = "web"
+	encoded, _, err = s.resolveInitdata("default", pod, "")
+	assert.NoError(t, err)
+	decoded, _, err = initdata.Decode(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, "package agent_policy # web", decoded.Data["policy.rego"])
+
+	// Without the pod object, rules selecting on the pod can't be evaluated
+	_, _, err = s.resolveInitdata("default", nil, "")
+	assert.Error(t, err)
+
+	// Without defaults, the initdata of the pod is used as is
+	s = &cloudService{}
+	encoded, digest, err = s.resolveInitdata("default", pod, initdataForTest(t))
+	assert.NoError(t, err)
+	assert.Equal(t, initdataForTest(t), encoded)
+	assert.NotEmpty(t, digest)
+}
+
+func TestCloudServiceDefaultInitdata(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "initdata-defaults.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("rules:\n- name: all\n  initdata: |\n    algorithm = \"sha256\"\n    version = \"0.1.0\"\n"), 0o644))
+
+	s := NewService(&mockProvider{}, &mockProxyFactory{podsDir: dir}, &mockWorkerNode{}, false, "", "", "", dir, forwarder.DefaultListenPort, "", Config{InitdataDefaults: path})
+
+	req := &pb.CreateVMRequest{
+		Id: "123",
+		Annotations: map[string]string{
+			cri.SandboxNamespace: "default",
+			cri.SandboxName:      "mypod",
+		},
+	}
+	_, err := s.CreateVM(context.Background(), req)
+	assert.NoError(t, err)
+
+	sandbox, err := s.(*cloudService).getSandbox("123")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, sandbox.initdataDigest)
+
+	var found bool
+	for _, wf := range sandbox.cloudConfig.WriteFiles {
+		if wf.Path == InitdataPath {
+			found = true
+			_, doc, err := initdata.Decode(wf.Content)
+			assert.NoError(t, err)
+			digest, err := initdata.Digest("sha256", doc)
+			assert.NoError(t, err)
+			assert.Equal(t, digest, sandbox.initdataDigest)
+		}
+	}
+	assert.True(t, found, "initdata is not provisioned")
+}
+
+func initdataForTest(t *testing.T) string {
+	encoded, _, err := (&initdata.InitData{Algorithm: "sha256", Version: "0.1.0"}).Encode()
+	assert.NoError(t, err)
+	return encoded
+}
+
+func TestCloudServiceInvalidInitdata(t *testing.T) {
+	dir := t.TempDir()
+
+	s := NewService(&mockProvider{}, &mockProxyFactory{podsDir: dir}, &mockWorkerNode{}, false, "", "", "", dir, forwarder.DefaultListenPort, "", Config{})
+
+	encoded, _, err := (&initdata.InitData{Algorithm: "sha256", Version: "0.1.0", Data: map[string]string{"policy.rego": "package other\n"}}).Encode()
+	assert.NoError(t, err)
+
+	req := &pb.CreateVMRequest{
+		Id: "123",
+		Annotations: map[string]string{
+			cri.SandboxNamespace:   "default",
+			cri.SandboxName:        "mypod",
+			initdata.AnnotationKey: encoded,
+		},
+	}
+	_, err = s.CreateVM(context.Background(), req)
+	assert.ErrorIs(t, err, initdata.ErrInvalid)
+
+	_, err = s.(*cloudService).getSandbox("123")
+	assert.Error(t, err, "no sandbox is created for invalid initdata")
+}
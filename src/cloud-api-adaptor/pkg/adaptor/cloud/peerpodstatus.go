@@ -0,0 +1,78 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/peerpod-ctrl/api/v1alpha1"
+)
+
+// updatePeerPodStatus applies update to the status of the PeerPod of a sandbox
+func (s *cloudService) updatePeerPodStatus(sandbox *sandbox, update func(*v1alpha1.PeerPodStatus)) {
+	if s.ppService == nil {
+		return
+	}
+	if err := s.ppService.UpdatePeerPodStatus(sandbox.podName, sandbox.podNamespace, update); err != nil {
+		logger.Printf("failed to update the PeerPod status of pod %s/%s: %v", sandbox.podNamespace, sandbox.podName, err)
+	}
+}
+
+// instanceCreated records a new instance of a pod VM that is starting
+func instanceCreated(instance *provider.Instance) func(*v1alpha1.PeerPodStatus) {
+	return func(status *v1alpha1.PeerPodStatus) {
+		now := metav1.Now()
+		status.Phase = v1alpha1.PeerPodProvisioning
+		status.InstanceName = instance.Name
+		status.InstanceType = instance.Type
+		status.ImageID = instance.ImageID
+		status.IPs = nil
+		for _, ip := range instance.IPs {
+			status.IPs = append(status.IPs, ip.String())
+		}
+		status.CreatedAt = &now
+		status.SetCondition(v1alpha1.InstanceCreated, metav1.ConditionTrue, "InstanceCreated", "instance "+instance.ID+" created")
+	}
+}
+
+// networkReady records that the pod network tunnel is set up
+func networkReady(status *v1alpha1.PeerPodStatus) {
+	status.SetCondition(v1alpha1.NetworkReady, metav1.ConditionTrue, "TunnelReady", "pod network tunnel set up")
+}
+
+// agentConnected records that the pod VM is running
+func agentConnected(status *v1alpha1.PeerPodStatus) {
+	now := metav1.Now()
+	status.Phase = v1alpha1.PeerPodRunning
+	status.ReadyAt = &now
+	status.SetCondition(v1alpha1.AgentConnected, metav1.ConditionTrue, "AgentConnected", "connected to the kata agent")
+}
+
+// startFailed records the error of a pod VM that failed to start on the
+// first condition that was not met
+func startFailed(err error) func(*v1alpha1.PeerPodStatus) {
+	return func(status *v1alpha1.PeerPodStatus) {
+		status.Phase = v1alpha1.PeerPodFailed
+		for _, condition := range []string{v1alpha1.InstanceCreated, v1alpha1.NetworkReady, v1alpha1.AgentConnected} {
+			if !meta.IsStatusConditionTrue(status.Conditions, condition) {
+				status.SetCondition(condition, metav1.ConditionFalse, "StartFailed", err.Error())
+				return
+			}
+		}
+	}
+}
+
+// instanceDeleting records that the instance of the pod VM is being deleted
+func instanceDeleting(status *v1alpha1.PeerPodStatus) {
+	status.Phase = v1alpha1.PeerPodDeleting
+}
+
+// instanceDeleted records that the instance of the pod VM has been deleted
+func instanceDeleted(status *v1alpha1.PeerPodStatus) {
+	now := metav1.Now()
+	status.Cleaned = true
+	status.DeletedAt = &now
+}
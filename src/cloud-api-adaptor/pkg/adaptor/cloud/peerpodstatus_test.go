@@ -0,0 +1,62 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/peerpod-ctrl/api/v1alpha1"
+)
+
+func TestPeerPodStatus(t *testing.T) {
+
+	var status v1alpha1.PeerPodStatus
+
+	instanceCreated(&provider.Instance{
+		ID:      "i-123",
+		Name:    "podvm-mypod-123",
+		Type:    "t3.small",
+		ImageID: "ami-123",
+		IPs:     []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+	})(&status)
+
+	assert.Equal(t, v1alpha1.PeerPodProvisioning, status.Phase)
+	assert.Equal(t, "podvm-mypod-123", status.InstanceName)
+	assert.Equal(t, "t3.small", status.InstanceType)
+	assert.Equal(t, "ami-123", status.ImageID)
+	assert.Equal(t, []string{"10.0.0.2"}, status.IPs)
+	assert.NotNil(t, status.CreatedAt)
+	assert.True(t, meta.IsStatusConditionTrue(status.Conditions, v1alpha1.InstanceCreated))
+
+	networkReady(&status)
+	assert.True(t, meta.IsStatusConditionTrue(status.Conditions, v1alpha1.NetworkReady))
+
+	// A failure is recorded on the first condition that is not met
+	failed := status.DeepCopy()
+	startFailed(errors.New("agent unreachable"))(failed)
+	assert.Equal(t, v1alpha1.PeerPodFailed, failed.Phase)
+	condition := meta.FindStatusCondition(failed.Conditions, v1alpha1.AgentConnected)
+	assert.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, "agent unreachable", condition.Message)
+
+	agentConnected(&status)
+	assert.Equal(t, v1alpha1.PeerPodRunning, status.Phase)
+	assert.NotNil(t, status.ReadyAt)
+	assert.True(t, meta.IsStatusConditionTrue(status.Conditions, v1alpha1.AgentConnected))
+
+	instanceDeleting(&status)
+	assert.Equal(t, v1alpha1.PeerPodDeleting, status.Phase)
+
+	instanceDeleted(&status)
+	assert.True(t, status.Cleaned)
+	assert.NotNil(t, status.DeletedAt)
+}
@@ -0,0 +1,108 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"strings"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// OwnerTagKey is the tag key holding the workload owning the pod as Kind/name
+	OwnerTagKey = "peerpods-owner"
+
+	// maxTagValueLen is the common denominator of the tag value lengths
+	// supported by the cloud providers
+	maxTagValueLen = 256
+
+	podTemplateHashLabel = "pod-template-hash"
+)
+
+// PodTagsConfig selects the pod metadata that is applied as tags to pod VMs
+type PodTagsConfig struct {
+	Enabled bool
+	// Labels and Annotations are the allowlisted pod label and annotation
+	// keys that are copied into the tags
+	Labels      []string
+	Annotations []string
+}
+
+// Tags derives the tags of the pod VM of a pod. Labels and the owner are taken
+// from meta, which may be nil if the pod object is not available. Annotations
+// are taken from meta or, failing that, from the sandbox annotations.
+func (c *PodTagsConfig) Tags(podName, namespace string, annotations map[string]string, meta *metav1.ObjectMeta) map[string]string {
+	if !c.Enabled {
+		return nil
+	}
+
+	tags := map[string]string{
+		provider.NamespaceTagKey: namespace,
+		provider.PodNameTagKey:   podName,
+	}
+
+	if meta != nil {
+		if owner := podOwner(meta); owner != "" {
+			tags[OwnerTagKey] = owner
+		}
+		annotations = meta.Annotations
+	}
+
+	for _, key := range c.Annotations {
+		if value, ok := annotations[key]; ok {
+			tags[tagKey(key)] = tagValue(value)
+		}
+	}
+
+	if meta != nil {
+		for _, key := range c.Labels {
+			if value, ok := meta.Labels[key]; ok {
+				tags[tagKey(key)] = tagValue(value)
+			}
+		}
+	}
+
+	return tags
+}
+
+// podOwner returns the workload controlling the pod as Kind/name. Pods created
+// by a Deployment are attributed to the Deployment rather than its ReplicaSet.
+func podOwner(meta *metav1.ObjectMeta) string {
+	ref := metav1.GetControllerOfNoCopy(meta)
+	if ref == nil {
+		return ""
+	}
+
+	kind, name := ref.Kind, ref.Name
+	if hash, ok := meta.Labels[podTemplateHashLabel]; ok && kind == "ReplicaSet" {
+		if deployment, found := strings.CutSuffix(name, "-"+hash); found {
+			kind, name = "Deployment", deployment
+		}
+	}
+
+	return kind + "/" + name
+}
+
+// tagKey converts a label or annotation key to a tag key that is accepted by
+// all cloud providers, replacing any character other than letters, digits,
+// '_', '.' and '-' with '-'
+func tagKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '_', r == '.', r == '-':
+			return r
+		}
+		return '-'
+	}, key)
+}
+
+func tagValue(value string) string {
+	if len(value) > maxTagValueLen {
+		return value[:maxTagValueLen]
+	}
+	return value
+}
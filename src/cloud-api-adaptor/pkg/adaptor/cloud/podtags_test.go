@@ -0,0 +1,104 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodTags(t *testing.T) {
+	controller := true
+	deploymentPod := &metav1.ObjectMeta{
+		Labels: map[string]string{
+			"app.kubernetes.io/name": "nginx",
+			"cost-center":            "1234",
+			"pod-template-hash":      "5d4f8c9b7",
+			"ignored":                "value",
+		},
+		Annotations: map[string]string{
+			"example.com/team": strings.Repeat("x", 300),
+		},
+		OwnerReferences: []metav1.OwnerReference{
+			{Kind: "ReplicaSet", Name: "nginx-5d4f8c9b7", Controller: &controller},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		config      PodTagsConfig
+		annotations map[string]string
+		meta        *metav1.ObjectMeta
+		want        map[string]string
+	}{
+		{
+			name:   "Disabled",
+			config: PodTagsConfig{Labels: []string{"cost-center"}},
+			meta:   deploymentPod,
+			want:   nil,
+		},
+		{
+			name: "Deployment",
+			config: PodTagsConfig{
+				Enabled:     true,
+				Labels:      []string{"app.kubernetes.io/name", "cost-center", "missing"},
+				Annotations: []string{"example.com/team"},
+			},
+			meta: deploymentPod,
+			want: map[string]string{
+				provider.NamespaceTagKey: "default",
+				provider.PodNameTagKey:   "nginx-5d4f8c9b7-abcde",
+				OwnerTagKey:              "Deployment/nginx",
+				"app.kubernetes.io-name": "nginx",
+				"cost-center":            "1234",
+				"example.com-team":       strings.Repeat("x", maxTagValueLen),
+			},
+		},
+		{
+			name: "StatefulSet",
+			config: PodTagsConfig{
+				Enabled: true,
+			},
+			meta: &metav1.ObjectMeta{
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "StatefulSet", Name: "db", Controller: &controller},
+				},
+			},
+			want: map[string]string{
+				provider.NamespaceTagKey: "default",
+				provider.PodNameTagKey:   "nginx-5d4f8c9b7-abcde",
+				OwnerTagKey:              "StatefulSet/db",
+			},
+		},
+		{
+			name: "SandboxAnnotationsOnly",
+			config: PodTagsConfig{
+				Enabled:     true,
+				Labels:      []string{"cost-center"},
+				Annotations: []string{"example.com/team"},
+			},
+			annotations: map[string]string{
+				"example.com/team": "finance",
+			},
+			want: map[string]string{
+				provider.NamespaceTagKey: "default",
+				provider.PodNameTagKey:   "nginx-5d4f8c9b7-abcde",
+				"example.com-team":       "finance",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.config.Tags("nginx-5d4f8c9b7-abcde", "default", tt.annotations, tt.meta)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+// UserDataProtection protects the cloud config sent to pod VMs. The cloud
+// config is signed with SigningKey, so that the pod VM can detect tampering
+// by the cloud provider, and the EncryptedFiles are encrypted with
+// EncryptionKey, which the pod VM can only obtain from the KBS once it is
+// attested.
+type UserDataProtection struct {
+	SigningKey     ed25519.PrivateKey
+	EncryptionKey  []byte
+	EncryptedFiles []string
+}
+
+// LoadUserDataProtection loads the signing key from a PKCS #8 PEM file and
+// the raw encryption key from a file. Either path may be empty.
+func LoadUserDataProtection(signingKeyPath, encryptionKeyPath string, encryptedFiles []string) (UserDataProtection, error) {
+	p := UserDataProtection{EncryptedFiles: encryptedFiles}
+
+	if signingKeyPath != "" {
+		key, err := cloudinit.LoadSigningKey(signingKeyPath)
+		if err != nil {
+			return p, fmt.Errorf("loading userdata signing key: %w", err)
+		}
+		p.SigningKey = key
+	}
+
+	if encryptionKeyPath != "" {
+		key, err := os.ReadFile(encryptionKeyPath)
+		if err != nil {
+			return p, fmt.Errorf("loading userdata encryption key: %w", err)
+		}
+		if len(key) != cloudinit.EncryptionKeySize {
+			return p, fmt.Errorf("userdata encryption key %s must be %d bytes, got %d", encryptionKeyPath, cloudinit.EncryptionKeySize, len(key))
+		}
+		p.EncryptionKey = key
+	}
+
+	return p, nil
+}
+
+// apply encrypts the files of cloudConfig and sets its signing key
+func (p *UserDataProtection) apply(cloudConfig *cloudinit.CloudConfig) error {
+	if p.EncryptionKey != nil && len(p.EncryptedFiles) > 0 {
+		if err := cloudConfig.Encrypt(p.EncryptedFiles, p.EncryptionKey); err != nil {
+			return err
+		}
+	}
+	cloudConfig.SigningKey = p.SigningKey
+	return nil
+}
+
+// GoString keeps the keys out of the logged server config
+func (p UserDataProtection) GoString() string {
+	return fmt.Sprintf("cloud.UserDataProtection{Signed:%t, Encrypted:%t, EncryptedFiles:%q}", p.SigningKey != nil, p.EncryptionKey != nil, p.EncryptedFiles)
+}
@@ -0,0 +1,201 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// pullSecretGetter reads the pull secrets of a pod, it is implemented by
+// k8sops.PeerPodService
+type pullSecretGetter interface {
+	GetSecret(name, namespace string) (*v1.Secret, error)
+	GetServiceAccount(name, namespace string) (*v1.ServiceAccount, error)
+}
+
+const dockerHub = "docker.io"
+
+// registryAuth is a registry credential of a containers-auth.json file
+type registryAuth struct {
+	Auth     string `json:"auth,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+type authFile struct {
+	Auths map[string]registryAuth `json:"auths"`
+}
+
+// registryAuth returns the auth.json of the pod VM of a pod, or nil if the pod
+// VM has no registry credentials. The credentials are taken from the pull
+// secrets of the pod and its service account, restricted to the registries of
+// the pod images. The node-wide auth.json is used if the pod has none and the
+// fallback is enabled.
+func (s *cloudService) registryAuth(pod *v1.Pod) ([]byte, error) {
+	if pod != nil && s.ppService != nil {
+		authJSON, err := podRegistryAuth(pod, s.ppService)
+		if err != nil {
+			return nil, err
+		}
+		if authJSON != nil {
+			logger.Printf("configure agent to use the pull secrets of pod %s/%s", pod.Namespace, pod.Name)
+			return authJSON, nil
+		}
+	}
+
+	if !s.registryAuthFallback {
+		return nil, nil
+	}
+
+	authJSON, err := os.ReadFile(SrcAuthfilePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			logger.Printf("credential file %s is not present, skipping image auth config", SrcAuthfilePath)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading %s: %v", SrcAuthfilePath, err)
+	}
+	logger.Printf("configure agent to use credentials file %s", SrcAuthfilePath)
+	return authJSON, nil
+}
+
+// podRegistryAuth builds an auth.json with the credentials of the pull secrets
+// of pod for the registries of its images. The pull secrets of the pod take
+// precedence over those of its service account, as with the kubelet. Missing
+// or malformed secrets are skipped.
+func podRegistryAuth(pod *v1.Pod, getter pullSecretGetter) ([]byte, error) {
+	secretRefs := append([]v1.LocalObjectReference(nil), pod.Spec.ImagePullSecrets...)
+
+	saName := pod.Spec.ServiceAccountName
+	if saName == "" {
+		saName = "default"
+	}
+	if sa, err := getter.GetServiceAccount(saName, pod.Namespace); err != nil {
+		logger.Printf("failed to get service account %s/%s, skipping its pull secrets: %v", pod.Namespace, saName, err)
+	} else {
+		secretRefs = append(secretRefs, sa.ImagePullSecrets...)
+	}
+
+	images := podImages(pod)
+	auths := map[string]registryAuth{}
+
+	for _, ref := range secretRefs {
+		secret, err := getter.GetSecret(ref.Name, pod.Namespace)
+		if err != nil {
+			logger.Printf("failed to get pull secret %s/%s: %v", pod.Namespace, ref.Name, err)
+			continue
+		}
+		secretAuths, err := secretRegistryAuths(secret)
+		if err != nil {
+			logger.Printf("skipping pull secret %s/%s: %v", pod.Namespace, ref.Name, err)
+			continue
+		}
+		for key, auth := range secretAuths {
+			key = normalizeRegistryKey(key)
+			if _, ok := auths[key]; ok || !matchesAnyImage(key, images) {
+				continue
+			}
+			if auth.Auth == "" && auth.Username != "" {
+				auth.Auth = base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+			}
+			if auth.Auth == "" {
+				continue
+			}
+			auths[key] = registryAuth{Auth: auth.Auth}
+		}
+	}
+
+	if len(auths) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(authFile{Auths: auths})
+}
+
+// secretRegistryAuths returns the credentials of a dockerconfigjson or a
+// legacy dockercfg secret
+func secretRegistryAuths(secret *v1.Secret) (map[string]registryAuth, error) {
+	switch secret.Type {
+	case v1.SecretTypeDockerConfigJson:
+		var config authFile
+		if err := json.Unmarshal(secret.Data[v1.DockerConfigJsonKey], &config); err != nil {
+			return nil, err
+		}
+		return config.Auths, nil
+	case v1.SecretTypeDockercfg:
+		var auths map[string]registryAuth
+		if err := json.Unmarshal(secret.Data[v1.DockerConfigKey], &auths); err != nil {
+			return nil, err
+		}
+		return auths, nil
+	}
+	return nil, fmt.Errorf("type %s is not a pull secret type", secret.Type)
+}
+
+// podImages returns the registry host and repository of the pod images
+func podImages(pod *v1.Pod) []string {
+	var images []string
+	for _, c := range pod.Spec.InitContainers {
+		images = append(images, imageRepository(c.Image))
+	}
+	for _, c := range pod.Spec.Containers {
+		images = append(images, imageRepository(c.Image))
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		images = append(images, imageRepository(c.Image))
+	}
+	return images
+}
+
+// imageRepository returns the repository of an image reference, prefixed
+// with the registry host, e.g. docker.io/library/nginx for nginx:latest
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+
+	host, rest, found := strings.Cut(image, "/")
+	if !found || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		host, rest = dockerHub, image
+		if !strings.Contains(rest, "/") {
+			rest = "library/" + rest
+		}
+	}
+	if host == "index.docker.io" {
+		host = dockerHub
+	}
+	return host + "/" + rest
+}
+
+// normalizeRegistryKey strips the scheme and the docker hub API path from a
+// credential key, e.g. https://index.docker.io/v1/ becomes docker.io
+func normalizeRegistryKey(key string) string {
+	key = strings.TrimPrefix(key, "https://")
+	key = strings.TrimPrefix(key, "http://")
+	key = strings.TrimSuffix(key, "/")
+	if key == "index.docker.io/v1" || key == "index.docker.io" || key == "registry-1.docker.io" {
+		return dockerHub
+	}
+	return key
+}
+
+// matchesAnyImage returns whether a credential key, a registry host optionally
+// followed by a repository path, applies to one of the images
+func matchesAnyImage(key string, images []string) bool {
+	for _, image := range images {
+		if image == key || strings.HasPrefix(image, key+"/") {
+			return true
+		}
+	}
+	return false
+}
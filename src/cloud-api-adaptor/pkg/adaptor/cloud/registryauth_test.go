@@ -0,0 +1,117 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type mockSecretGetter struct {
+	secrets         map[string]*v1.Secret
+	serviceAccounts map[string]*v1.ServiceAccount
+}
+
+func (m *mockSecretGetter) GetSecret(name, namespace string) (*v1.Secret, error) {
+	if secret, ok := m.secrets[namespace+"/"+name]; ok {
+		return secret, nil
+	}
+	return nil, fmt.Errorf("secret %s/%s not found", namespace, name)
+}
+
+func (m *mockSecretGetter) GetServiceAccount(name, namespace string) (*v1.ServiceAccount, error) {
+	if sa, ok := m.serviceAccounts[namespace+"/"+name]; ok {
+		return sa, nil
+	}
+	return nil, fmt.Errorf("service account %s/%s not found", namespace, name)
+}
+
+func dockerConfigJSONSecret(auths string) *v1.Secret {
+	return &v1.Secret{
+		Type: v1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{v1.DockerConfigJsonKey: []byte(`{"auths":` + auths + `}`)},
+	}
+}
+
+func basicAuth(user, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+}
+
+func TestPodRegistryAuth(t *testing.T) {
+	getter := &mockSecretGetter{
+		secrets: map[string]*v1.Secret{
+			"tenant/quay": dockerConfigJSONSecret(`{
+				"quay.io/tenant": {"auth": "` + basicAuth("tenant", "quay") + `"},
+				"quay.io/other": {"auth": "` + basicAuth("other", "quay") + `"},
+				"registry.example.com:5000": {"username": "tenant", "password": "example"}
+			}`),
+			"tenant/hub": {
+				Type: v1.SecretTypeDockercfg,
+				Data: map[string][]byte{v1.DockerConfigKey: []byte(`{"https://index.docker.io/v1/": {"auth": "` + basicAuth("tenant", "hub") + `"}}`)},
+			},
+			"tenant/override": dockerConfigJSONSecret(`{"quay.io/tenant": {"auth": "` + basicAuth("sa", "quay") + `"}}`),
+			"tenant/opaque":   {Type: v1.SecretTypeOpaque},
+		},
+		serviceAccounts: map[string]*v1.ServiceAccount{
+			"tenant/builder": {ImagePullSecrets: []v1.LocalObjectReference{{Name: "override"}, {Name: "hub"}}},
+		},
+	}
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "tenant"},
+		Spec: v1.PodSpec{
+			ServiceAccountName: "builder",
+			ImagePullSecrets:   []v1.LocalObjectReference{{Name: "quay"}, {Name: "missing"}, {Name: "opaque"}},
+			InitContainers:     []v1.Container{{Image: "registry.example.com:5000/init@sha256:0123"}},
+			Containers:         []v1.Container{{Image: "quay.io/tenant/app:v1"}, {Image: "nginx"}},
+		},
+	}
+
+	authJSON, err := podRegistryAuth(pod, getter)
+	assert.NoError(t, err)
+
+	var got authFile
+	assert.NoError(t, json.Unmarshal(authJSON, &got))
+	assert.Equal(t, map[string]registryAuth{
+		// The pull secrets of the pod win over those of the service account
+		"quay.io/tenant":            {Auth: basicAuth("tenant", "quay")},
+		"registry.example.com:5000": {Auth: basicAuth("tenant", "example")},
+		"docker.io":                 {Auth: basicAuth("tenant", "hub")},
+	}, got.Auths)
+
+	// No credentials for the images of the pod
+	pod.Spec.InitContainers = nil
+	pod.Spec.Containers = []v1.Container{{Image: "ghcr.io/tenant/app"}}
+	authJSON, err = podRegistryAuth(pod, getter)
+	assert.NoError(t, err)
+	assert.Nil(t, authJSON)
+}
+
+func TestImageRepository(t *testing.T) {
+	for image, want := range map[string]string{
+		"nginx":                      "docker.io/library/nginx",
+		"nginx:1.25":                 "docker.io/library/nginx",
+		"tenant/app":                 "docker.io/tenant/app",
+		"index.docker.io/tenant/app": "docker.io/tenant/app",
+		"quay.io/tenant/app:v1":      "quay.io/tenant/app",
+		"localhost/app":              "localhost/app",
+		"registry.example.com:5000/app@sha256:0123": "registry.example.com:5000/app",
+	} {
+		assert.Equal(t, want, imageRepository(image), image)
+	}
+}
+
+func TestRegistryAuthFallback(t *testing.T) {
+	// Without the pod object, only the node-wide auth.json can be used
+	s := &cloudService{registryAuthFallback: false}
+	authJSON, err := s.registryAuth(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, authJSON)
+}
@@ -23,10 +23,35 @@ type Service interface {
 	GetInstanceID(ctx context.Context, podNamespace, podName string, wait bool) (string, error)
 	ConfigVerifier() error
 	Teardown() error
+	// ReloadProvider replaces the cloud provider, e.g. after the cloud
+	// credentials were rotated. Operations in progress complete with the
+	// previous provider.
+	ReloadProvider(p provider.Provider)
+	// LoadProfiles creates or reloads the providers of the profiles found in
+	// dir, which pods select instead of the default provider
+	LoadProfiles(dir, defaultCloud string, env map[string]string) error
+	// Catalog describes the pod VMs the current providers can create
+	Catalog() (*Catalog, error)
+}
+
+// Config holds the settings of the pod VMs created by the cloud service
+type Config struct {
+	PodTags            PodTagsConfig
+	UserDataProtection UserDataProtection
+	Attestation        *AttestationConfig
+	// InitdataDefaults is the path of the default initdata rules
+	InitdataDefaults string
+	// InitdataFiles is the path of the allowlist of initdata files
+	InitdataFiles string
+	// AgentOptions are the agent options that pods may set with annotations
+	AgentOptions []string
+	// RegistryAuthFallback provides the node-wide auth.json to the pod VMs
+	// of pods without pull secrets
+	RegistryAuthFallback bool
 }
 
 type cloudService struct {
-	provider     provider.Provider
+	profiles     *provider.Profiles
 	proxyFactory proxy.Factory
 	workerNode   podnetwork.WorkerNode
 	sandboxes    map[sandboxID]*sandbox
@@ -35,8 +60,15 @@ type cloudService struct {
 	daemonPort   string
 	mutex        sync.Mutex
 	ppService    *k8sops.PeerPodService
-	aaKBCParams  string
 	sshClient    *wnssh.SshClient
+	podTags      PodTagsConfig
+	protection   UserDataProtection
+	attestation  *AttestationConfig
+	// The other settings of Config
+	initdataDefaults     string
+	initdataFiles        string
+	agentOptions         []string
+	registryAuthFallback bool
 }
 
 type sandboxID string
@@ -53,4 +85,12 @@ type sandbox struct {
 	netNSPath     string
 	spec          provider.InstanceTypeSpec
 	sshClientInst *wnssh.SshClientInstance
+	// initdataDigest is the digest of the initdata of the pod VM, if any
+	initdataDigest string
+	// profile is the provider profile creating the pod VM, empty for the
+	// default provider
+	profile string
+	// consoleCaptured is closed once the console output of a pod VM that
+	// failed to start is captured, nil if there is no capture
+	consoleCaptured chan struct{}
 }
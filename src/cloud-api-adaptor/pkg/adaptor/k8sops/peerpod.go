@@ -5,10 +5,12 @@ package k8sops
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sync"
 
 	peerPodV1alpha1 "github.com/confidential-containers/cloud-api-adaptor/src/peerpod-ctrl/api/v1alpha1"
 
@@ -26,10 +28,17 @@ var logger = log.New(log.Writer(), "[util/k8sops] ", log.LstdFlags|log.Lmsgprefi
 var ppFinalizer string = "peer.pod/finalizer"
 
 type PeerPodService struct {
-	client        *kubernetes.Clientset
+	client        kubernetes.Interface
 	uclient       *rest.RESTClient // use generated client instaed
 	cloudProvider string
-	podToPP       map[string]string // map Pod UID to owned PeerPod Name
+	mutex         sync.Mutex
+	podToPP       map[string]*ownedPeerPod // map Pod UID to owned PeerPod
+}
+
+// ownedPeerPod is a PeerPod owned by a pod and the status last written to it
+type ownedPeerPod struct {
+	name   string
+	status peerPodV1alpha1.PeerPodStatus
 }
 
 func NewPeerPodService() (*PeerPodService, error) {
@@ -55,10 +64,20 @@ func NewPeerPodService() (*PeerPodService, error) {
 		return nil, fmt.Errorf("NewPeerPodService: failed to create UnversionedRESTClient: %s", err)
 	}
 	logger.Printf("initialized PeerPodService")
-	return &PeerPodService{client: clientset, uclient: restClient, cloudProvider: cloudProvider, podToPP: make(map[string]string)}, nil
+	return &PeerPodService{client: clientset, uclient: restClient, cloudProvider: cloudProvider, podToPP: make(map[string]*ownedPeerPod)}, nil
 }
 
-func (s *PeerPodService) newPeerPod(pod *v1.Pod, instanceId string) *peerPodV1alpha1.PeerPod {
+// NewPeerPodServiceWithClient returns a PeerPodService reading pods, secrets
+// and service accounts and recording events through client. It doesn't
+// manage PeerPod objects.
+func NewPeerPodServiceWithClient(client kubernetes.Interface, cloudProvider string) *PeerPodService {
+	return &PeerPodService{client: client, cloudProvider: cloudProvider, podToPP: make(map[string]*ownedPeerPod)}
+}
+
+func (s *PeerPodService) newPeerPod(pod *v1.Pod, instanceId, initdataDigest, profile, cloudName string) *peerPodV1alpha1.PeerPod {
+	if cloudName == "" {
+		cloudName = s.cloudProvider
+	}
 	pp := peerPodV1alpha1.PeerPod{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: peerPodV1alpha1.GroupVersion.Group + "/" + peerPodV1alpha1.GroupVersion.Version,
@@ -73,11 +92,17 @@ func (s *PeerPodService) newPeerPod(pod *v1.Pod, instanceId string) *peerPodV1al
 			},
 		},
 		Spec: peerPodV1alpha1.PeerPodSpec{
-			InstanceID:    string(instanceId),
-			CloudProvider: s.cloudProvider,
+			InstanceID:     string(instanceId),
+			CloudProvider:  cloudName,
+			InitdataDigest: initdataDigest,
+			Profile:        profile,
 		},
 	}
 	*pp.ObjectMeta.OwnerReferences[0].BlockOwnerDeletion = true // needed?
+	// peerpod-ctrl reads the delete policy from the PeerPod, which outlives the pod
+	if policy, ok := pod.Annotations[peerPodV1alpha1.DeletePolicyAnnotation]; ok {
+		pp.Annotations = map[string]string{peerPodV1alpha1.DeletePolicyAnnotation: policy}
+	}
 	return &pp
 }
 
@@ -89,19 +114,69 @@ func (s *PeerPodService) getPod(podname string, podns string) (*v1.Pod, error) {
 	return pod, nil
 }
 
-// make the pod an owner of a PeerPod
-func (s *PeerPodService) OwnPeerPod(podname string, podns string, instanceID string) error {
+// GetPod returns a pod
+func (s *PeerPodService) GetPod(podname string, podns string) (*v1.Pod, error) {
+	return s.getPod(podname, podns)
+}
+
+// GetSecret returns a secret
+func (s *PeerPodService) GetSecret(name string, namespace string) (*v1.Secret, error) {
+	return s.client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// GetServiceAccount returns a service account
+func (s *PeerPodService) GetServiceAccount(name string, namespace string) (*v1.ServiceAccount, error) {
+	return s.client.CoreV1().ServiceAccounts(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// RecordPodEvent records an event of the given type and reason on a pod
+func (s *PeerPodService) RecordPodEvent(podname string, podns string, eventType string, reason string, message string) error {
 	pod, err := s.getPod(podname, podns)
 	if err != nil {
 		return err
 	}
-	pp := s.newPeerPod(pod, instanceID)
+	now := metav1.Now()
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: pod.Name + ".",
+			Namespace:    pod.Namespace,
+		},
+		InvolvedObject: v1.ObjectReference{
+			APIVersion:      "v1",
+			Kind:            "Pod",
+			Name:            pod.Name,
+			Namespace:       pod.Namespace,
+			UID:             pod.UID,
+			ResourceVersion: pod.ResourceVersion,
+		},
+		Type:           eventType,
+		Reason:         reason,
+		Message:        message,
+		Source:         v1.EventSource{Component: "cloud-api-adaptor", Host: pod.Spec.NodeName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err = s.client.CoreV1().Events(podns).Create(context.TODO(), event, metav1.CreateOptions{})
+	return err
+}
+
+// make the pod an owner of a PeerPod, recording the initdata digest of the pod VM if any
+// and the provider profile that created it. cloudName defaults to CLOUD_PROVIDER.
+func (s *PeerPodService) OwnPeerPod(podname string, podns string, instanceID string, initdataDigest string, profile string, cloudName string) error {
+	pod, err := s.getPod(podname, podns)
+	if err != nil {
+		return err
+	}
+	pp := s.newPeerPod(pod, instanceID, initdataDigest, profile, cloudName)
 	result := peerPodV1alpha1.PeerPod{}
 	err = s.uclient.Post().Namespace(pod.Namespace).Resource("peerPods").Body(pp).Do(context.TODO()).Into(&result)
 	if err != nil {
 		return err
 	}
-	s.podToPP[string(pod.UID)] = string(pp.Name)
+	s.mutex.Lock()
+	s.podToPP[string(pod.UID)] = &ownedPeerPod{name: pp.Name}
+	s.mutex.Unlock()
 	logger.Printf("%s is now owning a PeerPod object", podname)
 	return nil
 }
@@ -113,17 +188,46 @@ func (s *PeerPodService) ReleasePeerPod(podname string, podns string, instanceID
 		return err
 	}
 
-	ownedPPName, ok := s.podToPP[string(pod.UID)]
+	s.mutex.Lock()
+	owned, ok := s.podToPP[string(pod.UID)]
+	s.mutex.Unlock()
 	if !ok {
 		return errors.New("pod to PeerPod mapping not found")
 	}
 	result := peerPodV1alpha1.PeerPod{}
 	patch := []byte(`[{"op": "remove", "path": "/metadata/finalizers"}]`)
-	err = s.uclient.Patch(types.JSONPatchType).Name(ownedPPName).Namespace(podns).Resource("peerPods").Body(patch).Do(context.TODO()).Into(&result)
+	err = s.uclient.Patch(types.JSONPatchType).Name(owned.name).Namespace(podns).Resource("peerPods").Body(patch).Do(context.TODO()).Into(&result)
 	if err != nil {
 		return err
 	}
+	s.mutex.Lock()
 	delete(s.podToPP, string(pod.UID))
+	s.mutex.Unlock()
 	logger.Printf("%s's owned PeerPod object can now be deleted", podname)
 	return nil
 }
+
+// UpdatePeerPodStatus applies update to the status of the PeerPod owned by a pod
+func (s *PeerPodService) UpdatePeerPodStatus(podname string, podns string, update func(*peerPodV1alpha1.PeerPodStatus)) error {
+	pod, err := s.getPod(podname, podns)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	owned, ok := s.podToPP[string(pod.UID)]
+	if !ok {
+		s.mutex.Unlock()
+		return errors.New("pod to PeerPod mapping not found")
+	}
+	update(&owned.status)
+	// The whole status is sent since a merge patch replaces the conditions list
+	patch, err := json.Marshal(map[string]interface{}{"status": owned.status})
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	result := peerPodV1alpha1.PeerPod{}
+	return s.uclient.Patch(types.MergePatchType).Name(owned.name).Namespace(podns).Resource("peerPods").SubResource("status").Body(patch).Do(context.TODO()).Into(&result)
+}
@@ -0,0 +1,134 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package adaptor
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
+)
+
+const (
+	peerPodsConfigMap = "peer-pods-cm"
+	peerPodsSecret    = "peer-pods-secret"
+)
+
+// watchProviderConfig reloads the cloud provider and the provider profiles
+// each time the peer-pods ConfigMap or Secret changes, until ctx is done. The
+// catalog is published at start and after each reload.
+func (s *server) watchProviderConfig(ctx context.Context) {
+	clientset, err := newClientset()
+	if err != nil {
+		logger.Printf("cannot watch the cloud provider configs: %v", err)
+		return
+	}
+
+	if err := s.publishCatalog(ctx, clientset); err != nil {
+		logger.Printf("failed to publish the catalog: %v", err)
+	}
+
+	// The provider was created from the configs found in the pod environment
+	// at startup, they only need to be reloaded if they changed since then
+	initial := true
+	err = util.WatchProviderConfig(ctx, clientset, s.configNamespace, peerPodsConfigMap, peerPodsSecret, func(env map[string]string) {
+		if initial {
+			initial = false
+			if inEnviron(env) {
+				return
+			}
+			logger.Printf("the cloud provider configs changed before the watch started")
+		}
+
+		p, err := provider.NewProviderWithEnv(s.cloudName, env)
+		if err != nil {
+			logger.Printf("failed to reload the cloud provider, keeping the current one: %v", err)
+			return
+		}
+		s.cloudService.ReloadProvider(p)
+		logger.Printf("reloaded the %s cloud provider", s.cloudName)
+
+		// Profiles take the configs they don't set from the default provider
+		s.configMutex.Lock()
+		s.configEnv = env
+		s.configMutex.Unlock()
+		s.reloadProfiles()
+
+		if err := s.publishCatalog(ctx, clientset); err != nil {
+			logger.Printf("failed to publish the catalog: %v", err)
+		}
+	})
+	if err != nil {
+		logger.Printf("watching the cloud provider configs: %v", err)
+	}
+}
+
+// watchProfiles reloads the provider profiles each time the profiles directory
+// changes, until ctx is done. The volumes mounted in it are updated without any
+// change of the peer-pods ConfigMap or Secret.
+func (s *server) watchProfiles(ctx context.Context) {
+	s.watchProfilesEvery(ctx, provider.ProfilesPollInterval)
+}
+
+func (s *server) watchProfilesEvery(ctx context.Context, interval time.Duration) {
+	var clientset kubernetes.Interface
+	if s.configNamespace != "" {
+		var err error
+		if clientset, err = newClientset(); err != nil {
+			logger.Printf("cannot publish the catalog of the provider profiles: %v", err)
+		}
+	}
+
+	provider.WatchProfiles(ctx, s.profilesDir, interval, func() {
+		s.reloadProfiles()
+
+		if clientset == nil {
+			return
+		}
+		if err := s.publishCatalog(ctx, clientset); err != nil {
+			logger.Printf("failed to publish the catalog: %v", err)
+		}
+	})
+}
+
+// reloadProfiles creates or reloads the providers of the profiles, and removes
+// the profiles that are gone
+func (s *server) reloadProfiles() {
+	if s.profilesDir == "" {
+		return
+	}
+
+	s.configMutex.Lock()
+	defer s.configMutex.Unlock()
+
+	if err := s.cloudService.LoadProfiles(s.profilesDir, s.cloudName, s.configEnv); err != nil {
+		logger.Printf("failed to reload the provider profiles: %v", err)
+		return
+	}
+	logger.Printf("reloaded the provider profiles")
+}
+
+func newClientset() (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// inEnviron returns true if the process environment holds all the variables
+// of env with the same values
+func inEnviron(env map[string]string) bool {
+	for name, val := range env {
+		if os.Getenv(name) != val {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package adaptor
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+type reloadCloud struct{}
+
+func (c *reloadCloud) ParseCmd(flags *flag.FlagSet) {}
+
+func (c *reloadCloud) LoadEnv() {}
+
+func (c *reloadCloud) NewProvider() (provider.Provider, error) {
+	return &mockProvider{}, nil
+}
+
+func TestInEnviron(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	if !inEnviron(map[string]string{"AWS_REGION": "us-east-1"}) {
+		t.Error("inEnviron() = false, want true for the configs of the environment")
+	}
+	// Configs changed or added before the watch started need a reload
+	if inEnviron(map[string]string{"AWS_REGION": "eu-west-1"}) {
+		t.Error("inEnviron() = true, want false for a changed config")
+	}
+	if inEnviron(map[string]string{"AWS_REGION": "us-east-1", "PODVM_AMI_ID": "ami-new"}) {
+		t.Error("inEnviron() = true, want false for an added config")
+	}
+}
+
+func TestWatchProfiles(t *testing.T) {
+	provider.AddCloudProvider("reloadtest", &reloadCloud{})
+
+	dir := t.TempDir()
+	writeProfile := func(name string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name, "REGION"), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeProfile("east")
+
+	s := NewServer(&mockProvider{}, &ServerConfig{CloudName: "reloadtest", ProfilesDir: dir}, &mockWorkerNode{}).(*server)
+	s.reloadProfiles()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.watchProfilesEvery(ctx, 10*time.Millisecond)
+
+	waitForProfiles := func(want ...string) {
+		t.Helper()
+		var names []string
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			catalog, err := s.cloudService.Catalog()
+			if err != nil {
+				t.Fatalf("Catalog() error = %v", err)
+			}
+			names = nil
+			for name := range catalog.Profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if reflect.DeepEqual(names, want) {
+				return
+			}
+		}
+		t.Fatalf("profiles = %v, want %v", names, want)
+	}
+
+	waitForProfiles("east")
+	// Let the watch read the initial profiles
+	time.Sleep(100 * time.Millisecond)
+
+	// Profiles added or removed in the mounted volume are picked up
+	writeProfile("west")
+	waitForProfiles("east", "west")
+
+	if err := os.RemoveAll(filepath.Join(dir, "east")); err != nil {
+		t.Fatal(err)
+	}
+	waitForProfiles("west")
+}
@@ -45,6 +45,20 @@ type ServerConfig struct {
 	SecureCommsInbounds     string
 	SecureCommsOutbounds    string
 	SecureCommsKbsAddress   string
+	PodTags                 cloud.PodTagsConfig
+	UserDataProtection      cloud.UserDataProtection
+	Attestation             *cloud.AttestationConfig
+	InitdataDefaults        string
+	InitdataFiles           string
+	AgentOptions            []string
+	RegistryAuthFallback    bool
+	// CloudName is the name of the cloud provider, used to reload it
+	CloudName string
+	// ConfigNamespace is the namespace of the peer-pods ConfigMap and Secret,
+	// watched to reload the cloud provider when set
+	ConfigNamespace string
+	// ProfilesDir is the directory of the provider profiles pods can select
+	ProfilesDir string
 }
 
 type Server interface {
@@ -63,6 +77,13 @@ type server struct {
 	socketPath              string
 	stopOnce                sync.Once
 	enableCloudConfigVerify bool
+	cloudName               string
+	configNamespace         string
+	profilesDir             string
+	// configMutex serializes the loading of the profiles, which take the
+	// configs they don't set from configEnv, the configs of the default provider
+	configMutex sync.Mutex
+	configEnv   map[string]string
 }
 
 func NewServer(provider provider.Provider, cfg *ServerConfig, workerNode podnetwork.WorkerNode) Server {
@@ -71,7 +92,15 @@ func NewServer(provider provider.Provider, cfg *ServerConfig, workerNode podnetw
 
 	agentFactory := proxy.NewFactory(cfg.PauseImage, cfg.TLSConfig, cfg.ProxyTimeout)
 	cloudService := cloud.NewService(provider, agentFactory, workerNode,
-		cfg.SecureComms, cfg.SecureCommsInbounds, cfg.SecureCommsOutbounds, cfg.SecureCommsKbsAddress, cfg.PodsDir, cfg.ForwarderPort, cfg.AAKBCParams, sshutil.SSHPORT)
+		cfg.SecureComms, cfg.SecureCommsInbounds, cfg.SecureCommsOutbounds, cfg.SecureCommsKbsAddress, cfg.PodsDir, cfg.ForwarderPort, sshutil.SSHPORT, cloud.Config{
+			PodTags:              cfg.PodTags,
+			UserDataProtection:   cfg.UserDataProtection,
+			Attestation:          cfg.Attestation,
+			InitdataDefaults:     cfg.InitdataDefaults,
+			InitdataFiles:        cfg.InitdataFiles,
+			AgentOptions:         cfg.AgentOptions,
+			RegistryAuthFallback: cfg.RegistryAuthFallback,
+		})
 	vmInfoService := vminfo.NewService(cloudService)
 
 	return &server{
@@ -82,10 +111,19 @@ func NewServer(provider provider.Provider, cfg *ServerConfig, workerNode podnetw
 		readyCh:                 make(chan struct{}),
 		stopCh:                  make(chan struct{}),
 		enableCloudConfigVerify: cfg.EnableCloudConfigVerify,
+		cloudName:               cfg.CloudName,
+		configNamespace:         cfg.ConfigNamespace,
+		profilesDir:             cfg.ProfilesDir,
 	}
 }
 
 func (s *server) Start(ctx context.Context) (err error) {
+	if s.profilesDir != "" {
+		if err := s.cloudService.LoadProfiles(s.profilesDir, s.cloudName, nil); err != nil {
+			return err
+		}
+	}
+
 	if s.enableCloudConfigVerify {
 		verifierErr := s.cloudService.ConfigVerifier()
 		if verifierErr != nil {
@@ -126,6 +164,13 @@ func (s *server) Start(ctx context.Context) (err error) {
 		}
 	}()
 
+	if s.configNamespace != "" {
+		go s.watchProviderConfig(ctx)
+	}
+	if s.profilesDir != "" {
+		go s.watchProfiles(ctx)
+	}
+
 	close(s.readyCh)
 
 	logger.Printf("server started")
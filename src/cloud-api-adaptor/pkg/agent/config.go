@@ -1,6 +1,11 @@
 package agent
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/pelletier/go-toml/v2"
 )
 
@@ -8,15 +13,104 @@ const (
 	ConfigFilePath       = "/run/peerpod/agent-config.toml"
 	ServerAddr           = "unix:///run/kata-containers/agent.sock"
 	GuestComponentsProcs = "none"
+
+	// AnnotationPrefix is the prefix of the pod annotations setting agent
+	// options, e.g. io.confidentialcontainers.org.peerpods.agent.log_level
+	AnnotationPrefix = "io.confidentialcontainers.org.peerpods.agent."
 )
 
 type agentConfig struct {
 	ServerAddr           string `toml:"server_addr"`
 	GuestComponentsProcs string `toml:"guest_components_procs"`
 	ImageRegistryAuth    string `toml:"image_registry_auth,omitempty"`
+
+	// Options set from pod annotations
+	LogLevel                    string `toml:"log_level,omitempty"`
+	DebugConsole                *bool  `toml:"debug_console,omitempty"`
+	DevMode                     *bool  `toml:"dev_mode,omitempty"`
+	HotplugTimeout              *int   `toml:"hotplug_timeout,omitempty"`
+	ImagePullTimeout            *int   `toml:"image_pull_timeout,omitempty"`
+	CDHAPITimeout               *int   `toml:"cdh_api_timeout,omitempty"`
+	GuestComponentsRestAPI      string `toml:"guest_components_rest_api,omitempty"`
+	EnableSignatureVerification *bool  `toml:"enable_signature_verification,omitempty"`
+	ImagePolicyFile             string `toml:"image_policy_file,omitempty"`
+	HTTPSProxy                  string `toml:"https_proxy,omitempty"`
+	NoProxy                     string `toml:"no_proxy,omitempty"`
+}
+
+// Options are agent options set from pod annotations, keyed by their name in
+// agent-config.toml
+type Options map[string]string
+
+// setters parse and set the agent options that can be set from annotations
+var setters = map[string]func(*agentConfig, string) error{
+	"log_level": func(c *agentConfig, v string) error {
+		return setEnum(&c.LogLevel, v, "trace", "debug", "info", "warn", "error", "critical")
+	},
+	"debug_console": func(c *agentConfig, v string) error { return setBool(&c.DebugConsole, v) },
+	"dev_mode":      func(c *agentConfig, v string) error { return setBool(&c.DevMode, v) },
+	"hotplug_timeout": func(c *agentConfig, v string) error {
+		return setSeconds(&c.HotplugTimeout, v)
+	},
+	"image_pull_timeout": func(c *agentConfig, v string) error {
+		return setSeconds(&c.ImagePullTimeout, v)
+	},
+	"cdh_api_timeout": func(c *agentConfig, v string) error {
+		return setSeconds(&c.CDHAPITimeout, v)
+	},
+	"guest_components_procs": func(c *agentConfig, v string) error {
+		return setEnum(&c.GuestComponentsProcs, v, "none", "attestation-agent", "confidential-data-hub", "api-server-rest")
+	},
+	"guest_components_rest_api": func(c *agentConfig, v string) error {
+		return setEnum(&c.GuestComponentsRestAPI, v, "none", "resource", "all")
+	},
+	"enable_signature_verification": func(c *agentConfig, v string) error {
+		return setBool(&c.EnableSignatureVerification, v)
+	},
+	"image_policy_file": func(c *agentConfig, v string) error { c.ImagePolicyFile = v; return nil },
+	"https_proxy":       func(c *agentConfig, v string) error { c.HTTPSProxy = v; return nil },
+	"no_proxy":          func(c *agentConfig, v string) error { c.NoProxy = v; return nil },
+}
+
+// OptionNames returns the names of the agent options that can be set from
+// pod annotations
+func OptionNames() []string {
+	names := make([]string, 0, len(setters))
+	for name := range setters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-func CreateConfigFile(authJsonPath string) (string, error) {
+// OptionsFromAnnotations returns the agent options set by the annotations
+// with AnnotationPrefix. Only the allowed options may be set, so that pods
+// can't weaken the agent config, e.g. by enabling the debug console.
+func OptionsFromAnnotations(annotations map[string]string, allowed []string) (Options, error) {
+	options := Options{}
+	for key, value := range annotations {
+		name, ok := strings.CutPrefix(key, AnnotationPrefix)
+		if !ok {
+			continue
+		}
+		setter, ok := setters[name]
+		if !ok {
+			return nil, fmt.Errorf("annotation %s: unknown agent option %q", key, name)
+		}
+		if !contains(allowed, name) {
+			return nil, fmt.Errorf("annotation %s: agent option %q is not allowed", key, name)
+		}
+		if err := setter(&agentConfig{}, value); err != nil {
+			return nil, fmt.Errorf("annotation %s: %w", key, err)
+		}
+		options[name] = value
+	}
+	return options, nil
+}
+
+// CreateConfigFile returns the agent config, with the options set from pod
+// annotations
+func CreateConfigFile(authJsonPath string, options Options) (string, error) {
 	var imageRegistryAuth string
 	if authJsonPath != "" {
 		imageRegistryAuth = "file://" + authJsonPath
@@ -28,9 +122,54 @@ func CreateConfigFile(authJsonPath string) (string, error) {
 		ImageRegistryAuth:    imageRegistryAuth,
 	}
 
+	for name, value := range options {
+		setter, ok := setters[name]
+		if !ok {
+			return "", fmt.Errorf("unknown agent option %q", name)
+		}
+		if err := setter(&config, value); err != nil {
+			return "", err
+		}
+	}
+
 	bytes, err := toml.Marshal(config)
 	if err != nil {
 		return "", err
 	}
 	return string(bytes), nil
 }
+
+func setBool(field **bool, value string) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%q is not a boolean", value)
+	}
+	*field = &b
+	return nil
+}
+
+func setSeconds(field **int, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("%q is not a positive number of seconds", value)
+	}
+	*field = &n
+	return nil
+}
+
+func setEnum(field *string, value string, values ...string) error {
+	if !contains(values, value) {
+		return fmt.Errorf("%q is not one of %s", value, strings.Join(values, ", "))
+	}
+	*field = value
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
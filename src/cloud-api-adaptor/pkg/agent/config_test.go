@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/pelletier/go-toml/v2"
@@ -23,7 +24,7 @@ guest_components_procs = 'none'
 		t.Errorf("Expected %s, got %s", GuestComponentsProcs, refcfg.GuestComponentsProcs)
 	}
 
-	configstr, err := CreateConfigFile("")
+	configstr, err := CreateConfigFile("", nil)
 	if err != nil {
 		panic(err)
 	}
@@ -39,7 +40,7 @@ image_registry_auth = 'file:///run/peerpod/auth.json'
 `
 	authJsonFile := "/run/peerpod/auth.json"
 
-	configstr, err := CreateConfigFile(authJsonFile)
+	configstr, err := CreateConfigFile(authJsonFile, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -57,3 +58,94 @@ image_registry_auth = 'file:///run/peerpod/auth.json'
 		t.Errorf("Expected %s, got %s", config.ImageRegistryAuth, authJsonFile)
 	}
 }
+
+func TestAgentConfigFileWithOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		refdoc  string
+	}{
+		{
+			name:    "LogLevelAndTimeouts",
+			options: Options{"log_level": "debug", "image_pull_timeout": "600", "hotplug_timeout": "10"},
+			refdoc: `server_addr = 'unix:///run/kata-containers/agent.sock'
+guest_components_procs = 'none'
+log_level = 'debug'
+hotplug_timeout = 10
+image_pull_timeout = 600
+`,
+		},
+		{
+			name:    "DebugConsole",
+			options: Options{"debug_console": "true", "dev_mode": "false"},
+			refdoc: `server_addr = 'unix:///run/kata-containers/agent.sock'
+guest_components_procs = 'none'
+debug_console = true
+dev_mode = false
+`,
+		},
+		{
+			name:    "GuestComponents",
+			options: Options{"guest_components_procs": "api-server-rest", "guest_components_rest_api": "resource", "cdh_api_timeout": "50"},
+			refdoc: `server_addr = 'unix:///run/kata-containers/agent.sock'
+guest_components_procs = 'api-server-rest'
+cdh_api_timeout = 50
+guest_components_rest_api = 'resource'
+`,
+		},
+		{
+			name:    "ImageVerificationAndProxy",
+			options: Options{"enable_signature_verification": "true", "image_policy_file": "kbs:///default/security-policy/test", "https_proxy": "http://proxy:3128", "no_proxy": "10.0.0.0/8"},
+			refdoc: `server_addr = 'unix:///run/kata-containers/agent.sock'
+guest_components_procs = 'none'
+enable_signature_verification = true
+image_policy_file = 'kbs:///default/security-policy/test'
+https_proxy = 'http://proxy:3128'
+no_proxy = '10.0.0.0/8'
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configstr, err := CreateConfigFile("", tt.options)
+			if err != nil {
+				t.Fatalf("CreateConfigFile() error = %v", err)
+			}
+			if tt.refdoc != configstr {
+				t.Errorf("Expected %s, got %s", tt.refdoc, configstr)
+			}
+		})
+	}
+
+	if _, err := CreateConfigFile("", Options{"server_addr": "vsock://1:1024"}); err == nil {
+		t.Errorf("CreateConfigFile() expected an error for an unknown option")
+	}
+}
+
+func TestOptionsFromAnnotations(t *testing.T) {
+	allowed := []string{"log_level", "image_pull_timeout"}
+
+	options, err := OptionsFromAnnotations(map[string]string{
+		AnnotationPrefix + "log_level":          "debug",
+		AnnotationPrefix + "image_pull_timeout": "600",
+		"io.kubernetes.cri.sandbox-name":        "nginx",
+	}, allowed)
+	if err != nil {
+		t.Fatalf("OptionsFromAnnotations() error = %v", err)
+	}
+	if want := (Options{"log_level": "debug", "image_pull_timeout": "600"}); !reflect.DeepEqual(options, want) {
+		t.Errorf("OptionsFromAnnotations() = %v, want %v", options, want)
+	}
+
+	for name, annotations := range map[string]map[string]string{
+		"not allowed":   {AnnotationPrefix + "debug_console": "true"},
+		"unknown":       {AnnotationPrefix + "server_addr": "vsock://1:1024"},
+		"invalid enum":  {AnnotationPrefix + "log_level": "verbose"},
+		"invalid value": {AnnotationPrefix + "image_pull_timeout": "-1"},
+	} {
+		if _, err := OptionsFromAnnotations(annotations, allowed); err == nil {
+			t.Errorf("OptionsFromAnnotations() expected an error for %s", name)
+		}
+	}
+}
@@ -2,27 +2,140 @@ package cdh
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/aa"
 	"github.com/pelletier/go-toml/v2"
 )
 
 const (
 	ConfigFilePath = "/run/peerpod/cdh.toml"
 	Socket         = "unix:///run/confidential-containers/cdh.sock"
+
+	// ResourceURIPrefix prefixes the URIs of the KBS resources
+	ResourceURIPrefix = "kbs:///"
 )
 
-type Credential struct{}
+// kbcURLRequired holds the KBCs that connect to a KBS
+var kbcURLRequired = map[string]bool{
+	"cc_kbc":          true,
+	"offline_fs_kbc":  false,
+	"offline_sev_kbc": false,
+}
+
+// Credential is a KBS resource that CDH fetches to path at startup
+type Credential struct {
+	ResourceURI string `toml:"resource_uri" yaml:"resourceURI"`
+	Path        string `toml:"path" yaml:"path"`
+}
 
 type Config struct {
 	Socket      string       `toml:"socket"`
 	KBC         KBCConfig    `toml:"kbc"`
 	Credentials []Credential `toml:"credentials"`
+	Image       *ImageConfig `toml:"image,omitempty"`
 }
 
 type KBCConfig struct {
 	Name string `toml:"name"`
 	URL  string `toml:"url"`
+	// KBSCert is the PEM certificate the KBS is pinned to
+	KBSCert string `toml:"kbs_cert,omitempty,multiline"`
+}
+
+// ImageConfig holds the image security settings of the image pulls done by CDH
+type ImageConfig struct {
+	MaxConcurrentLayerDownloadsPerImage int      `toml:"max_concurrent_layer_downloads_per_image,omitempty" yaml:"maxConcurrentLayerDownloadsPerImage,omitempty"`
+	SigstoreConfigURI                   string   `toml:"sigstore_config_uri,omitempty" yaml:"sigstoreConfigURI,omitempty"`
+	ImageSecurityPolicyURI              string   `toml:"image_security_policy_uri,omitempty" yaml:"imageSecurityPolicyURI,omitempty"`
+	AuthenticatedRegistryCredentialsURI string   `toml:"authenticated_registry_credentials_uri,omitempty" yaml:"authenticatedRegistryCredentialsURI,omitempty"`
+	ExtraRootCertificates               []string `toml:"extra_root_certificates,omitempty" yaml:"extraRootCertificates,omitempty"`
+}
+
+// NewConfig returns a configuration for the given KBC
+func NewConfig(kbc KBCConfig, credentials []Credential, image *ImageConfig) *Config {
+	if credentials == nil {
+		credentials = []Credential{}
+	}
+	return &Config{Socket, kbc, credentials, image}
+}
+
+// Validate checks the KBC, the credentials and the image settings
+func (c *Config) Validate() error {
+	urlRequired, ok := kbcURLRequired[c.KBC.Name]
+	if !ok {
+		return fmt.Errorf("unsupported KBC %q", c.KBC.Name)
+	}
+	if urlRequired {
+		if err := aa.ValidateURL(c.KBC.URL); err != nil {
+			return fmt.Errorf("invalid KBS URL: %w", err)
+		}
+	}
+	if c.KBC.KBSCert != "" {
+		if err := aa.ValidateCert(c.KBC.KBSCert); err != nil {
+			return fmt.Errorf("invalid KBS certificate: %w", err)
+		}
+	}
+
+	paths := make(map[string]bool)
+	for _, cred := range c.Credentials {
+		if err := validateResourceURI(cred.ResourceURI); err != nil {
+			return fmt.Errorf("invalid credential: %w", err)
+		}
+		if !filepath.IsAbs(cred.Path) || filepath.Clean(cred.Path) != cred.Path {
+			return fmt.Errorf("invalid credential path %q, must be a clean absolute path", cred.Path)
+		}
+		if paths[cred.Path] {
+			return fmt.Errorf("duplicate credential path %q", cred.Path)
+		}
+		paths[cred.Path] = true
+	}
+
+	if c.Image != nil {
+		if c.Image.MaxConcurrentLayerDownloadsPerImage < 0 {
+			return fmt.Errorf("invalid max concurrent layer downloads %d", c.Image.MaxConcurrentLayerDownloadsPerImage)
+		}
+		for _, uri := range []string{c.Image.SigstoreConfigURI, c.Image.ImageSecurityPolicyURI, c.Image.AuthenticatedRegistryCredentialsURI} {
+			if uri == "" {
+				continue
+			}
+			if err := validateResourceURI(uri); err != nil {
+				return fmt.Errorf("invalid image config: %w", err)
+			}
+		}
+		for _, cert := range c.Image.ExtraRootCertificates {
+			if err := aa.ValidateCert(cert); err != nil {
+				return fmt.Errorf("invalid extra root certificate: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Render validates the configuration and renders it as TOML
+func (c *Config) Render() (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+	bytes, err := toml.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// validateResourceURI checks that uri is a kbs:///<repository>/<type>/<tag> URI
+func validateResourceURI(uri string) error {
+	path, ok := strings.CutPrefix(uri, ResourceURIPrefix)
+	if !ok {
+		return fmt.Errorf("resource URI %q does not start with %s", uri, ResourceURIPrefix)
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return fmt.Errorf("resource URI %q is not of the form %s<repository>/<type>/<tag>", uri, ResourceURIPrefix)
+	}
+	return nil
 }
 
 func parseAAKBCParams(aaKBCParams string) (*Config, error) {
@@ -31,8 +144,7 @@ func parseAAKBCParams(aaKBCParams string) (*Config, error) {
 		return nil, fmt.Errorf("Invalid aa-kbs-params input: %s", aaKBCParams)
 	}
 	name, url := parts[0], parts[1]
-	kbcConfig := KBCConfig{name, url}
-	return &Config{Socket, kbcConfig, []Credential{}}, nil
+	return NewConfig(KBCConfig{Name: name, URL: url}, nil, nil), nil
 }
 
 func CreateConfigFile(aaKBCParams string) (string, error) {
@@ -40,9 +152,5 @@ func CreateConfigFile(aaKBCParams string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	bytes, err := toml.Marshal(config)
-	if err != nil {
-		return "", err
-	}
-	return string(bytes), nil
+	return config.Render()
 }
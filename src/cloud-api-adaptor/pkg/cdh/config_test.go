@@ -1,7 +1,11 @@
 package cdh
 
 import (
+	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/pelletier/go-toml/v2"
@@ -40,3 +44,96 @@ url = "http://1.2.3.4:8080"
 		t.Errorf("Expected empty credentials array")
 	}
 }
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// checkGolden compares rendered with testdata/<name>.toml
+func checkGolden(t *testing.T, name, rendered string) {
+	golden := filepath.Join("testdata", name+".toml")
+	if *update {
+		if err := os.WriteFile(golden, []byte(rendered), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered != string(expected) {
+		t.Errorf("Expected: \n%s, got: \n%s", expected, rendered)
+	}
+}
+
+func TestRender(t *testing.T) {
+	cert, err := os.ReadFile(filepath.Join("testdata", "kbs-cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		config *Config
+	}{
+		{
+			name:   "aa-kbc-params",
+			config: NewConfig(KBCConfig{Name: "cc_kbc", URL: "http://1.2.3.4:8080"}, nil, nil),
+		},
+		{
+			name: "full",
+			config: NewConfig(
+				KBCConfig{Name: "cc_kbc", URL: "https://kbs.coco:8080", KBSCert: string(cert)},
+				[]Credential{
+					{ResourceURI: "kbs:///default/credential/registry", Path: "/run/confidential-containers/cdh/credential/registry"},
+					{ResourceURI: "kbs:///default/credential/ssh", Path: "/run/confidential-containers/cdh/credential/ssh"},
+				},
+				&ImageConfig{
+					MaxConcurrentLayerDownloadsPerImage: 3,
+					SigstoreConfigURI:                   "kbs:///default/sigstore-config/test",
+					ImageSecurityPolicyURI:              "kbs:///default/security-policy/test",
+					AuthenticatedRegistryCredentialsURI: "kbs:///default/credential/registry",
+					ExtraRootCertificates:               []string{string(cert)},
+				},
+			),
+		},
+		{
+			name:   "offline-fs-kbc",
+			config: NewConfig(KBCConfig{Name: "offline_fs_kbc"}, nil, nil),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rendered, err := tc.config.Render()
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tc.name, rendered)
+
+			var parsed Config
+			if err := toml.Unmarshal([]byte(rendered), &parsed); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&parsed, tc.config) {
+				t.Errorf("Expected %+v, got %+v", tc.config, &parsed)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	kbc := KBCConfig{Name: "cc_kbc", URL: "https://kbs.coco:8080"}
+
+	for name, config := range map[string]*Config{
+		"unsupported KBC":    NewConfig(KBCConfig{Name: "foo_kbc"}, nil, nil),
+		"missing KBS URL":    NewConfig(KBCConfig{Name: "cc_kbc"}, nil, nil),
+		"invalid cert":       NewConfig(KBCConfig{Name: "cc_kbc", URL: "https://kbs.coco:8080", KBSCert: "cert"}, nil, nil),
+		"invalid credential": NewConfig(kbc, []Credential{{ResourceURI: "kbs:///default/credential", Path: "/run/cred"}}, nil),
+		"relative path":      NewConfig(kbc, []Credential{{ResourceURI: "kbs:///default/credential/a", Path: "run/cred"}}, nil),
+		"duplicate path":     NewConfig(kbc, []Credential{{ResourceURI: "kbs:///default/credential/a", Path: "/run/cred"}, {ResourceURI: "kbs:///default/credential/b", Path: "/run/cred"}}, nil),
+		"invalid policy URI": NewConfig(kbc, nil, &ImageConfig{ImageSecurityPolicyURI: "https://policy"}),
+		"invalid root cert":  NewConfig(kbc, nil, &ImageConfig{ExtraRootCertificates: []string{"cert"}}),
+		"negative downloads": NewConfig(kbc, nil, &ImageConfig{MaxConcurrentLayerDownloadsPerImage: -1}),
+	} {
+		if _, err := config.Render(); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+}
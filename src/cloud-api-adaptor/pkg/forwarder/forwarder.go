@@ -38,6 +38,10 @@ type Config struct {
 	PodNetwork   *tunneler.Config `json:"pod-network"`
 	PodNamespace string           `json:"pod-namespace"`
 	PodName      string           `json:"pod-name"`
+	// SandboxID is the sandbox the pod VM was created for
+	SandboxID string `json:"sandbox-id,omitempty"`
+	// EncryptedFiles are the userdata files encrypted by cloud-api-adaptor
+	EncryptedFiles []string `json:"encrypted-files,omitempty"`
 
 	TLSServerKey  string `json:"tls-server-key,omitempty"`
 	TLSServerCert string `json:"tls-server-cert,omitempty"`
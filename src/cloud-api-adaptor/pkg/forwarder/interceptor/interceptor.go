@@ -25,6 +25,16 @@ const (
 	volumeTargetPathKey = "io.confidentialcontainers.org.peerpodvolumes.target_path"
 	volumeCheckInterval = 5 * time.Second
 	volumeCheckTimeout  = 3 * time.Minute
+
+	// encryptedSuffix is appended to the path of the userdata files that are
+	// still encrypted, see cloudinit.EncryptedSuffix
+	encryptedSuffix = ".enc"
+)
+
+// Time allowed to decrypt the userdata files, variables to speed up tests
+var (
+	decryptCheckInterval = time.Second
+	decryptCheckTimeout  = 5 * time.Minute
 )
 
 var logger = log.New(log.Writer(), "[forwarder/interceptor] ", log.LstdFlags|log.Lmsgprefix)
@@ -36,7 +46,9 @@ type Interceptor interface {
 type interceptor struct {
 	agentproto.Redirector
 
-	nsPath string
+	nsPath         string
+	sandboxID      string
+	encryptedFiles []string
 }
 
 func dial(ctx context.Context, agentSocket string) (net.Conn, error) {
@@ -66,7 +78,12 @@ func dial(ctx context.Context, agentSocket string) (net.Conn, error) {
 	return conn, nil
 }
 
-func NewInterceptor(agentSocket, nsPath string) Interceptor {
+// NewInterceptor returns an interceptor forwarding requests to the kata-agent
+// at agentSocket. CreateSandbox is rejected for sandboxes other than
+// sandboxID, unless it is empty, and CreateContainer waits until the
+// encryptedFiles are decrypted, since the image may be pulled with the
+// credentials they hold.
+func NewInterceptor(agentSocket, nsPath, sandboxID string, encryptedFiles []string) Interceptor {
 
 	agentDialer := func(ctx context.Context) (net.Conn, error) {
 		return dial(ctx, agentSocket)
@@ -75,15 +92,44 @@ func NewInterceptor(agentSocket, nsPath string) Interceptor {
 	redirector := agentproto.NewRedirector(agentDialer)
 
 	return &interceptor{
-		Redirector: redirector,
-		nsPath:     nsPath,
+		Redirector:     redirector,
+		nsPath:         nsPath,
+		sandboxID:      sandboxID,
+		encryptedFiles: encryptedFiles,
+	}
+}
+
+// waitForDecryption waits until the encrypted files are replaced with their
+// decrypted content
+func (i *interceptor) waitForDecryption(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, decryptCheckTimeout)
+	defer cancel()
+
+	for _, path := range i.encryptedFiles {
+		for {
+			if _, err := os.Stat(path + encryptedSuffix); os.IsNotExist(err) {
+				break
+			}
+			logger.Printf("waiting for %s to be decrypted", path)
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%s was not decrypted: %w", path, ctx.Err())
+			case <-time.After(decryptCheckInterval):
+			}
+		}
 	}
+	return nil
 }
 
 func (i *interceptor) CreateContainer(ctx context.Context, req *pb.CreateContainerRequest) (*emptypb.Empty, error) {
 
 	logger.Printf("CreateContainer: containerID:%s", req.ContainerId)
 
+	if err := i.waitForDecryption(ctx); err != nil {
+		logger.Printf("CreateContainer failed with error: %v", err)
+		return nil, err
+	}
+
 	// Specify the network namespace path in the container spec
 	req.OCI.Linux.Namespaces = append(req.OCI.Linux.Namespaces, &pb.LinuxNamespace{
 		Type: string(specs.NetworkNamespace),
@@ -196,6 +242,14 @@ func (i *interceptor) CreateSandbox(ctx context.Context, req *pb.CreateSandboxRe
 
 	logger.Printf("CreateSandbox: hostname:%s sandboxId:%s", req.Hostname, req.SandboxId)
 
+	// The pod VM configuration is bound to a sandbox, so that signed
+	// userdata replayed on another pod VM can't serve a different sandbox
+	if i.sandboxID != "" && req.SandboxId != i.sandboxID {
+		err := fmt.Errorf("pod VM was created for sandbox %s, not %s", i.sandboxID, req.SandboxId)
+		logger.Printf("CreateSandbox failed with error: %v", err)
+		return nil, err
+	}
+
 	if len(req.Dns) > 0 {
 		logger.Print("    dns:")
 		for _, d := range req.Dns {
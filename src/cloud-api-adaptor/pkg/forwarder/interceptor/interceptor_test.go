@@ -4,8 +4,13 @@
 package interceptor
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	pb "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/agent/protocols/grpc"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -13,7 +18,7 @@ func TestNewInterceptor(t *testing.T) {
 
 	socketName := "dummy.sock"
 
-	i := NewInterceptor(socketName, "")
+	i := NewInterceptor(socketName, "", "", nil)
 	if i == nil {
 		t.Fatal("Expect non nil, got nil")
 	}
@@ -27,3 +32,31 @@ func TestIsTargetPath(t *testing.T) {
 	assert.False(t, isTargetPath(path, "mock path"))
 	assert.True(t, isTargetPath(path, "/path/to/target"))
 }
+
+func TestCreateSandboxOtherSandbox(t *testing.T) {
+	i := NewInterceptor("dummy.sock", "", "sandbox-1", nil)
+
+	_, err := i.CreateSandbox(context.Background(), &pb.CreateSandboxRequest{SandboxId: "sandbox-2"})
+	assert.ErrorContains(t, err, "sandbox-1")
+}
+
+func TestWaitForDecryption(t *testing.T) {
+	decryptCheckInterval = 10 * time.Millisecond
+	decryptCheckTimeout = 100 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "auth.json")
+	i := &interceptor{encryptedFiles: []string{path}}
+
+	// Nothing to wait for when the file was not encrypted
+	assert.NoError(t, i.waitForDecryption(context.Background()))
+
+	assert.NoError(t, os.WriteFile(path+encryptedSuffix, []byte("ciphertext"), 0600))
+	assert.Error(t, i.waitForDecryption(context.Background()))
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = os.WriteFile(path, []byte("{}"), 0600)
+		_ = os.Remove(path + encryptedSuffix)
+	}()
+	assert.NoError(t, i.waitForDecryption(context.Background()))
+}
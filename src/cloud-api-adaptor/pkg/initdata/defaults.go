@@ -0,0 +1,176 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package initdata
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Rule selects the default initdata of pods. Empty selectors match all pods.
+type Rule struct {
+	Name string `yaml:"name"`
+	// Namespaces restricts the rule to pods of these namespaces
+	Namespaces []string `yaml:"namespaces,omitempty"`
+	// PodSelector is a label selector, e.g. "app=nginx,tier in (web)"
+	PodSelector string `yaml:"podSelector,omitempty"`
+	// RuntimeClassName restricts the rule to pods of this RuntimeClass
+	RuntimeClassName string `yaml:"runtimeClassName,omitempty"`
+	// Initdata is the default initdata TOML document
+	Initdata string `yaml:"initdata"`
+	// MergePodInitdata merges the initdata of pods that have their own with
+	// the default, entries of the default take precedence. It defaults to
+	// true, set it to false to let the initdata of the pod replace the
+	// default, including its policy.
+	MergePodInitdata *bool `yaml:"mergePodInitdata,omitempty"`
+
+	selector labels.Selector
+	initdata *InitData
+}
+
+// Defaults holds the default initdata rules, the first matching rule applies
+type Defaults struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Pod holds the pod attributes that rules select on
+type Pod struct {
+	Namespace        string
+	Labels           map[string]string
+	RuntimeClassName string
+	// Initdata is the base64 encoded initdata of the pod, if any
+	Initdata string
+}
+
+// LoadDefaults reads the default initdata rules from a YAML file, typically
+// mounted from a ConfigMap. A missing file means there are no defaults.
+func LoadDefaults(path string) (*Defaults, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Defaults{}, nil
+		}
+		return nil, fmt.Errorf("reading default initdata: %w", err)
+	}
+	return ParseDefaults(data)
+}
+
+// ParseDefaults parses and validates the default initdata rules
+func ParseDefaults(data []byte) (*Defaults, error) {
+	var defaults Defaults
+	if err := yaml.UnmarshalStrict(data, &defaults); err != nil {
+		return nil, fmt.Errorf("parsing default initdata: %w", err)
+	}
+
+	for i := range defaults.Rules {
+		rule := &defaults.Rules[i]
+		selector, err := labels.Parse(rule.PodSelector)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: invalid pod selector: %w", rule.Name, err)
+		}
+		rule.selector = selector
+
+		if rule.initdata, err = Parse([]byte(rule.Initdata)); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		if _, err := Digest(rule.initdata.Algorithm, nil); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+	}
+	return &defaults, nil
+}
+
+func (r *Rule) mergesPodInitdata() bool {
+	return r.MergePodInitdata == nil || *r.MergePodInitdata
+}
+
+func (r *Rule) matches(pod *Pod) bool {
+	if len(r.Namespaces) > 0 && !contains(r.Namespaces, pod.Namespace) {
+		return false
+	}
+	if r.RuntimeClassName != "" && r.RuntimeClassName != pod.RuntimeClassName {
+		return false
+	}
+	return r.selector.Matches(labels.Set(pod.Labels))
+}
+
+// SelectsOnPod returns true if any rule selects on the labels or the
+// RuntimeClass of pods
+func (d *Defaults) SelectsOnPod() bool {
+	for i := range d.Rules {
+		if d.Rules[i].PodSelector != "" || d.Rules[i].RuntimeClassName != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns the first rule matching the pod, or nil
+func (d *Defaults) Match(pod *Pod) *Rule {
+	for i := range d.Rules {
+		if d.Rules[i].matches(pod) {
+			return &d.Rules[i]
+		}
+	}
+	return nil
+}
+
+// Resolve returns the base64 encoded initdata to provision for the pod and
+// its digest. The initdata of the pod is merged with the default of the
+// matching rule, unless the rule disables merging, in which case it replaces
+// the default. An empty initdata is returned if the pod has
+// none and no rule matches.
+func (d *Defaults) Resolve(pod *Pod) (encoded, digest string, rule *Rule, err error) {
+	rule = d.Match(pod)
+	if rule != nil && pod.Initdata != "" && !rule.mergesPodInitdata() {
+		// The initdata of the pod replaces the default
+		rule = nil
+	}
+
+	var initdata *InitData
+	var doc []byte
+
+	switch {
+	case rule == nil:
+		if pod.Initdata == "" {
+			return "", "", nil, nil
+		}
+		if initdata, doc, err = Decode(pod.Initdata); err != nil {
+			return "", "", nil, err
+		}
+		encoded = pod.Initdata
+	case pod.Initdata == "":
+		initdata = rule.initdata
+		if encoded, doc, err = initdata.Encode(); err != nil {
+			return "", "", nil, err
+		}
+	default:
+		podInitdata, _, err := Decode(pod.Initdata)
+		if err != nil {
+			return "", "", nil, err
+		}
+		initdata = Merge(rule.initdata, podInitdata)
+		if encoded, doc, err = initdata.Encode(); err != nil {
+			return "", "", nil, err
+		}
+	}
+
+	if digest, err = Digest(initdata.Algorithm, doc); err != nil {
+		return "", "", nil, err
+	}
+	return encoded, digest, rule, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
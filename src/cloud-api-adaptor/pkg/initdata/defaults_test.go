@@ -0,0 +1,177 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package initdata
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testDefaults = `rules:
+- name: restricted
+  namespaces: [prod]
+  podSelector: tier in (web)
+  initdata: |
+    algorithm = "sha384"
+    version = "0.1.0"
+    [data]
+    "policy.rego" = "restricted"
+- name: kata-remote
+  runtimeClassName: kata-remote
+  mergePodInitdata: false
+  initdata: |
+    algorithm = "sha256"
+    version = "0.1.0"
+    [data]
+    "policy.rego" = "default"
+`
+
+func TestParseDefaults(t *testing.T) {
+	if _, err := ParseDefaults([]byte(testDefaults)); err != nil {
+		t.Fatalf("ParseDefaults() error = %v", err)
+	}
+
+	for name, doc := range map[string]string{
+		"unknown field":     "rules:\n- name: a\n  namespace: prod\n  initdata: 'algorithm = \"sha256\"'\n",
+		"invalid selector":  "rules:\n- name: a\n  podSelector: 'a in ('\n  initdata: 'algorithm = \"sha256\"'\n",
+		"invalid initdata":  "rules:\n- name: a\n  initdata: 'algorithm ='\n",
+		"unknown algorithm": "rules:\n- name: a\n  initdata: 'algorithm = \"md5\"'\n",
+	} {
+		if _, err := ParseDefaults([]byte(doc)); err == nil {
+			t.Errorf("ParseDefaults() expected an error for %s", name)
+		}
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	dir := t.TempDir()
+
+	defaults, err := LoadDefaults(filepath.Join(dir, "missing.yaml"))
+	if err != nil || len(defaults.Rules) != 0 {
+		t.Fatalf("LoadDefaults() = %+v, %v, want no rules", defaults, err)
+	}
+
+	path := filepath.Join(dir, "defaults.yaml")
+	if err := os.WriteFile(path, []byte(testDefaults), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if defaults, err = LoadDefaults(path); err != nil || len(defaults.Rules) != 2 {
+		t.Fatalf("LoadDefaults() = %+v, %v, want 2 rules", defaults, err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	defaults, err := ParseDefaults([]byte(testDefaults))
+	if err != nil {
+		t.Fatalf("ParseDefaults() error = %v", err)
+	}
+
+	podInitdata := base64.StdEncoding.EncodeToString([]byte(testInitdata))
+
+	tests := []struct {
+		name       string
+		pod        Pod
+		wantRule   string
+		wantPolicy string
+		wantData   int
+		wantPodDoc bool
+	}{
+		{
+			name: "NoMatchNoInitdata",
+			pod:  Pod{Namespace: "default"},
+		},
+		{
+			name:       "NoMatchPodInitdata",
+			pod:        Pod{Namespace: "default", Initdata: podInitdata},
+			wantPolicy: "package agent_policy\n",
+			wantData:   1,
+			wantPodDoc: true,
+		},
+		{
+			name:       "RuntimeClassDefault",
+			pod:        Pod{Namespace: "default", RuntimeClassName: "kata-remote"},
+			wantRule:   "kata-remote",
+			wantPolicy: "default",
+			wantData:   1,
+		},
+		{
+			// With merging disabled, the pod initdata replaces the default
+			name:       "RuntimeClassPodInitdata",
+			pod:        Pod{Namespace: "default", RuntimeClassName: "kata-remote", Initdata: podInitdata},
+			wantPolicy: "package agent_policy\n",
+			wantData:   1,
+			wantPodDoc: true,
+		},
+		{
+			name:       "SelectorDefault",
+			pod:        Pod{Namespace: "prod", Labels: map[string]string{"tier": "web"}},
+			wantRule:   "restricted",
+			wantPolicy: "restricted",
+			wantData:   1,
+		},
+		{
+			// The namespace matches, but not the selector
+			name:       "SelectorMismatch",
+			pod:        Pod{Namespace: "prod", Labels: map[string]string{"tier": "db"}, RuntimeClassName: "kata-remote"},
+			wantRule:   "kata-remote",
+			wantPolicy: "default",
+			wantData:   1,
+		},
+		{
+			// Merging is the default, the default policy wins over the pod policy
+			name:       "SelectorMerge",
+			pod:        Pod{Namespace: "prod", Labels: map[string]string{"tier": "web"}, Initdata: base64.StdEncoding.EncodeToString([]byte("algorithm = \"sha256\"\nversion = \"0.1.0\"\n[data]\n\"policy.rego\" = \"pod\"\n\"cdh.toml\" = \"pod\"\n"))},
+			wantRule:   "restricted",
+			wantPolicy: "restricted",
+			wantData:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, digest, rule, err := defaults.Resolve(&tt.pod)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+
+			ruleName := ""
+			if rule != nil {
+				ruleName = rule.Name
+			}
+			if ruleName != tt.wantRule {
+				t.Errorf("Resolve() rule = %q, want %q", ruleName, tt.wantRule)
+			}
+
+			if tt.wantPolicy == "" {
+				if encoded != "" || digest != "" {
+					t.Errorf("Resolve() = %q, %q, want no initdata", encoded, digest)
+				}
+				return
+			}
+			if tt.wantPodDoc && encoded != tt.pod.Initdata {
+				t.Errorf("Resolve() = %q, want the pod initdata unchanged", encoded)
+			}
+
+			initdata, doc, err := Decode(encoded)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if got := initdata.Data["policy.rego"]; got != tt.wantPolicy {
+				t.Errorf("policy = %q, want %q", got, tt.wantPolicy)
+			}
+			if len(initdata.Data) != tt.wantData {
+				t.Errorf("data = %v, want %d entries", initdata.Data, tt.wantData)
+			}
+			if want, _ := Digest(initdata.Algorithm, doc); digest != want {
+				t.Errorf("Resolve() digest = %q, want %q", digest, want)
+			}
+		})
+	}
+
+	if _, _, _, err := defaults.Resolve(&Pod{Namespace: "default", Initdata: "%%%"}); err == nil {
+		t.Errorf("Resolve() expected an error for invalid pod initdata")
+	}
+}
@@ -0,0 +1,204 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package initdata
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v2"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/aa"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/cdh"
+)
+
+const (
+	PolicyPath = "/run/peerpod/policy.rego"
+
+	// DefaultFilesPath is the allowlist of initdata files, the same file is
+	// read by the adaptor and baked into the pod VM image
+	DefaultFilesPath = "/etc/peerpod/initdata-files.yaml"
+
+	// DefaultMode is the mode of initdata files without an explicit mode
+	DefaultMode os.FileMode = 0o644
+)
+
+// Formats of the initdata files, checked by Validate
+const (
+	FormatTOML = "toml"
+	FormatJSON = "json"
+	FormatPEM  = "pem"
+	FormatRego = "rego"
+)
+
+// File maps an initdata data key to the file provisioned in the pod VM
+type File struct {
+	Key  string `yaml:"key"`
+	Path string `yaml:"path"`
+	// Mode is the octal file mode, DefaultMode if empty
+	Mode string `yaml:"mode,omitempty"`
+	// Owner is user[:group], by name or ID. The file is owned by root if
+	// empty, and by the primary group of the user if the group is omitted.
+	Owner string `yaml:"owner,omitempty"`
+	// Format is one of toml, json, pem or rego. The content is not checked
+	// if empty.
+	Format string `yaml:"format,omitempty"`
+}
+
+// Allowlist is the set of initdata files provisioned in the pod VM. Data
+// entries with other keys are not provisioned, and rejected by the adaptor.
+type Allowlist struct {
+	Files []File `yaml:"files"`
+}
+
+// DefaultFiles are the guest component configs that are always allowed
+var DefaultFiles = []File{
+	{Key: AAConfigKey, Path: aa.ConfigFilePath, Format: FormatTOML},
+	{Key: CDHConfigKey, Path: cdh.ConfigFilePath, Format: FormatTOML},
+	{Key: PolicyKey, Path: PolicyPath, Format: FormatRego},
+}
+
+// DefaultAllowlist returns the allowlist of DefaultFiles
+func DefaultAllowlist() *Allowlist {
+	return &Allowlist{Files: append([]File(nil), DefaultFiles...)}
+}
+
+// LoadAllowlist reads the allowlist at path, which extends DefaultFiles. A
+// missing file is not an error, DefaultFiles are allowed then.
+func LoadAllowlist(path string) (*Allowlist, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return DefaultAllowlist(), nil
+		}
+		return nil, fmt.Errorf("reading initdata files: %w", err)
+	}
+	return ParseAllowlist(data)
+}
+
+// ParseAllowlist parses a YAML allowlist. Files extend DefaultFiles, a file
+// with the key of a default file replaces it.
+func ParseAllowlist(data []byte) (*Allowlist, error) {
+	var configured Allowlist
+	if err := yaml.UnmarshalStrict(data, &configured); err != nil {
+		return nil, fmt.Errorf("parsing initdata files: %w", err)
+	}
+
+	allowlist := DefaultAllowlist()
+	keys := make(map[string]bool)
+	for _, f := range configured.Files {
+		if err := f.validate(); err != nil {
+			return nil, fmt.Errorf("initdata file %q: %w", f.Key, err)
+		}
+		if keys[f.Key] {
+			return nil, fmt.Errorf("initdata file %q: duplicate key", f.Key)
+		}
+		keys[f.Key] = true
+		allowlist.set(f)
+	}
+
+	paths := make(map[string]bool)
+	for _, f := range allowlist.Files {
+		if paths[f.Path] {
+			return nil, fmt.Errorf("initdata file %q: duplicate path %s", f.Key, f.Path)
+		}
+		paths[f.Path] = true
+	}
+	return allowlist, nil
+}
+
+func (a *Allowlist) set(file File) {
+	for i := range a.Files {
+		if a.Files[i].Key == file.Key {
+			a.Files[i] = file
+			return
+		}
+	}
+	a.Files = append(a.Files, file)
+}
+
+// Lookup returns the file of an initdata key
+func (a *Allowlist) Lookup(key string) (*File, bool) {
+	for i := range a.Files {
+		if a.Files[i].Key == key {
+			return &a.Files[i], true
+		}
+	}
+	return nil, false
+}
+
+// Keys returns the allowed initdata keys
+func (a *Allowlist) Keys() []string {
+	keys := make([]string, 0, len(a.Files))
+	for _, f := range a.Files {
+		keys = append(keys, f.Key)
+	}
+	return keys
+}
+
+func (f *File) validate() error {
+	if f.Key == "" || strings.ContainsAny(f.Key, "/\\") {
+		return errors.New("key must be a non-empty file name")
+	}
+	if !filepath.IsAbs(f.Path) || filepath.Clean(f.Path) != f.Path {
+		return fmt.Errorf("path %q must be absolute and clean", f.Path)
+	}
+	if _, err := f.FileMode(); err != nil {
+		return err
+	}
+	if strings.Count(f.Owner, ":") > 1 || strings.HasPrefix(f.Owner, ":") {
+		return fmt.Errorf("owner %q must be user[:group]", f.Owner)
+	}
+	switch f.Format {
+	case "", FormatTOML, FormatJSON, FormatPEM, FormatRego:
+	default:
+		return fmt.Errorf("format %q is not one of %s, %s, %s or %s", f.Format, FormatTOML, FormatJSON, FormatPEM, FormatRego)
+	}
+	return nil
+}
+
+// FileMode returns the permissions of the file
+func (f *File) FileMode() (os.FileMode, error) {
+	if f.Mode == "" {
+		return DefaultMode, nil
+	}
+	mode, err := strconv.ParseUint(f.Mode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("mode %q must be octal permissions", f.Mode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// checkFormat checks that content is in the format of the file
+func (f *File) checkFormat(content string) error {
+	switch f.Format {
+	case FormatTOML:
+		var v map[string]interface{}
+		return toml.Unmarshal([]byte(content), &v)
+	case FormatJSON:
+		var v interface{}
+		return json.Unmarshal([]byte(content), &v)
+	case FormatPEM:
+		rest := []byte(content)
+		var block *pem.Block
+		for n := 0; ; n++ {
+			if block, rest = pem.Decode(rest); block == nil {
+				if n == 0 || strings.TrimSpace(string(rest)) != "" {
+					return errors.New("invalid PEM data")
+				}
+				return nil
+			}
+		}
+	case FormatRego:
+		return ValidatePolicy(content)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package initdata
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testAllowlist = `files:
+- key: registry-ca.pem
+  path: /etc/pki/ca-trust/source/anchors/registry-ca.pem
+  format: pem
+- key: registries.conf
+  path: /etc/containers/registries.conf
+  format: toml
+- key: policy.json
+  path: /etc/containers/policy.json
+  mode: "0600"
+  owner: root:root
+  format: json
+- key: policy.rego
+  path: /run/peerpod/policy.rego
+  mode: "0400"
+  format: rego
+`
+
+const testCert = `-----BEGIN CERTIFICATE-----
+MIIBszCCAVmgAwIBAgIUT5sYg0qzWZ3dNEVuMVC3Y2qS0S0wCgYIKoZIzj0EAwIw
+-----END CERTIFICATE-----
+`
+
+func TestParseAllowlist(t *testing.T) {
+	allowlist, err := ParseAllowlist([]byte(testAllowlist))
+	if err != nil {
+		t.Fatalf("ParseAllowlist() error = %v", err)
+	}
+
+	want := []string{AAConfigKey, CDHConfigKey, PolicyKey, "registry-ca.pem", "registries.conf", "policy.json"}
+	if got := allowlist.Keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+
+	// The configured policy file replaces the default one
+	policy, ok := allowlist.Lookup(PolicyKey)
+	if !ok {
+		t.Fatalf("Lookup(%q) not found", PolicyKey)
+	}
+	if mode, err := policy.FileMode(); err != nil || mode != 0o400 {
+		t.Errorf("FileMode() = %o, %v, want 400", mode, err)
+	}
+	ca, _ := allowlist.Lookup("registry-ca.pem")
+	if mode, err := ca.FileMode(); err != nil || mode != DefaultMode {
+		t.Errorf("FileMode() = %o, %v, want %o", mode, err, DefaultMode)
+	}
+
+	for name, doc := range map[string]string{
+		"unknown field":  "files:\n- key: a\n  path: /a\n  perm: '0600'\n",
+		"key with slash": "files:\n- key: a/b\n  path: /a\n",
+		"relative path":  "files:\n- key: a\n  path: a\n",
+		"unclean path":   "files:\n- key: a\n  path: /etc/../a\n",
+		"invalid mode":   "files:\n- key: a\n  path: /a\n  mode: '0800'\n",
+		"invalid owner":  "files:\n- key: a\n  path: /a\n  owner: ':root'\n",
+		"unknown format": "files:\n- key: a\n  path: /a\n  format: xml\n",
+		"duplicate key":  "files:\n- key: a\n  path: /a\n- key: a\n  path: /b\n",
+		"duplicate path": "files:\n- key: a\n  path: /run/peerpod/aa.toml\n",
+	} {
+		if _, err := ParseAllowlist([]byte(doc)); err == nil {
+			t.Errorf("ParseAllowlist() expected an error for %s", name)
+		}
+	}
+}
+
+func TestLoadAllowlist(t *testing.T) {
+	dir := t.TempDir()
+
+	allowlist, err := LoadAllowlist(filepath.Join(dir, "missing.yaml"))
+	if err != nil || !reflect.DeepEqual(allowlist, DefaultAllowlist()) {
+		t.Fatalf("LoadAllowlist() = %+v, %v, want the default allowlist", allowlist, err)
+	}
+
+	path := filepath.Join(dir, "initdata-files.yaml")
+	if err := os.WriteFile(path, []byte(testAllowlist), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if allowlist, err = LoadAllowlist(path); err != nil || len(allowlist.Files) != 6 {
+		t.Fatalf("LoadAllowlist() = %+v, %v", allowlist, err)
+	}
+}
+
+func TestValidateWithAllowlist(t *testing.T) {
+	allowlist, err := ParseAllowlist([]byte(testAllowlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initdata := &InitData{Algorithm: "sha256", Version: "0.1.0", Data: map[string]string{
+		"registry-ca.pem": testCert,
+		"registries.conf": "unqualified-search-registries = [\"quay.io\"]\n",
+		"policy.json":     `{"default": [{"type": "reject"}]}`,
+	}}
+	encoded, _, err := initdata.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := DecodeAndValidate(encoded, allowlist); err != nil {
+		t.Errorf("DecodeAndValidate() error = %v", err)
+	}
+	if _, _, err := DecodeAndValidate(encoded, nil); !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "registry-ca.pem") {
+		t.Errorf("DecodeAndValidate() error = %v, want the extra files rejected by the default allowlist", err)
+	}
+
+	for key, content := range map[string]string{
+		"registry-ca.pem": "not a certificate",
+		"policy.json":     "{",
+	} {
+		invalid := &InitData{Algorithm: "sha256", Version: "0.1.0", Data: map[string]string{key: content}}
+		encoded, _, err := invalid.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := DecodeAndValidate(encoded, allowlist); !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), key) {
+			t.Errorf("DecodeAndValidate() error = %v, want an invalid %s", err, key)
+		}
+	}
+}
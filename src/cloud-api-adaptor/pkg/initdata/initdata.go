@@ -0,0 +1,94 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package initdata
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+// AnnotationKey is the pod annotation carrying the base64 encoded initdata
+const AnnotationKey = "io.katacontainers.config.runtime.cc_init_data"
+
+// InitData is an initdata document, see
+// https://github.com/confidential-containers/trustee/blob/main/kbs/docs/initdata.md
+type InitData struct {
+	Algorithm string            `toml:"algorithm"`
+	Version   string            `toml:"version"`
+	Data      map[string]string `toml:"data,omitempty"`
+}
+
+// Parse parses a TOML initdata document
+func Parse(doc []byte) (*InitData, error) {
+	var initdata InitData
+	if err := toml.Unmarshal(doc, &initdata); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling initdata: %w", err)
+	}
+	return &initdata, nil
+}
+
+// Decode decodes base64 encoded initdata. The decoded document is returned
+// along with the parsed initdata, since the digest is computed over it.
+func Decode(encoded string) (*InitData, []byte, error) {
+	doc, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error base64 decode initdata: %w", err)
+	}
+	initdata, err := Parse(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return initdata, doc, nil
+}
+
+// Encode renders the initdata as a TOML document and base64 encodes it
+func (i *InitData) Encode() (string, []byte, error) {
+	doc, err := toml.Marshal(i)
+	if err != nil {
+		return "", nil, fmt.Errorf("Error marshalling initdata: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(doc), doc, nil
+}
+
+// Algorithms are the digest algorithms supported by Digest
+var Algorithms = []string{"sha256", "sha384", "sha512"}
+
+// Digest returns the hex encoded digest of the initdata document doc with the
+// algorithm of the initdata
+func Digest(algorithm string, doc []byte) (string, error) {
+	switch algorithm {
+	case "sha256":
+		hash := sha256.Sum256(doc)
+		return hex.EncodeToString(hash[:]), nil
+	case "sha384":
+		hash := sha512.Sum384(doc)
+		return hex.EncodeToString(hash[:]), nil
+	case "sha512":
+		hash := sha512.Sum512(doc)
+		return hex.EncodeToString(hash[:]), nil
+	}
+	return "", fmt.Errorf("Error creating initdata hash, the Algorithm %s not supported", algorithm)
+}
+
+// Merge adds the data entries of overlay that base doesn't set. The
+// algorithm and version of base are kept.
+func Merge(base, overlay *InitData) *InitData {
+	merged := &InitData{
+		Algorithm: base.Algorithm,
+		Version:   base.Version,
+		Data:      make(map[string]string, len(base.Data)+len(overlay.Data)),
+	}
+	for k, v := range overlay.Data {
+		merged.Data[k] = v
+	}
+	for k, v := range base.Data {
+		merged.Data[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,77 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package initdata
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+const testInitdata = `algorithm = "sha256"
+version = "0.1.0"
+
+[data]
+"policy.rego" = "package agent_policy\n"
+`
+
+func TestDecodeAndDigest(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString([]byte(testInitdata))
+
+	initdata, doc, err := Decode(encoded)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if string(doc) != testInitdata {
+		t.Errorf("Decode() doc = %q, want %q", doc, testInitdata)
+	}
+	if initdata.Algorithm != "sha256" || initdata.Data["policy.rego"] != "package agent_policy\n" {
+		t.Errorf("Decode() = %+v", initdata)
+	}
+
+	digest, err := Digest(initdata.Algorithm, doc)
+	if err != nil {
+		t.Fatalf("Digest() error = %v", err)
+	}
+	if len(digest) != 64 {
+		t.Errorf("Digest() = %q, want a sha256 hex digest", digest)
+	}
+	for algorithm, length := range map[string]int{"sha384": 96, "sha512": 128} {
+		if digest, _ := Digest(algorithm, doc); len(digest) != length {
+			t.Errorf("Digest(%s) = %q", algorithm, digest)
+		}
+	}
+	if _, err := Digest("md5", doc); err == nil {
+		t.Errorf("Digest() expected an error for an unsupported algorithm")
+	}
+
+	if _, _, err := Decode("%%%"); err == nil {
+		t.Errorf("Decode() expected an error for invalid base64")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	initdata := &InitData{Algorithm: "sha384", Version: "0.1.0", Data: map[string]string{"aa.toml": "[token_configs]\n"}}
+	encoded, doc, err := initdata.Encode()
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	decoded, decodedDoc, err := Decode(encoded)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(decoded, initdata) || string(decodedDoc) != string(doc) {
+		t.Errorf("Decode(Encode()) = %+v, want %+v", decoded, initdata)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := &InitData{Algorithm: "sha384", Version: "0.1.0", Data: map[string]string{"policy.rego": "default", "aa.toml": "default"}}
+	overlay := &InitData{Algorithm: "sha256", Version: "0.2.0", Data: map[string]string{"policy.rego": "pod", "cdh.toml": "pod"}}
+
+	want := &InitData{Algorithm: "sha384", Version: "0.1.0", Data: map[string]string{"policy.rego": "default", "aa.toml": "default", "cdh.toml": "pod"}}
+	if got := Merge(base, overlay); !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package initdata
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+const (
+	AAConfigKey  = "aa.toml"
+	CDHConfigKey = "cdh.toml"
+	PolicyKey    = "policy.rego"
+
+	// MaxSize is the largest initdata document accepted. It has to fit in
+	// the userdata of the pod VM along with the other provisioned files.
+	MaxSize = 64 * 1024
+
+	// PolicyPackage is the package of the kata-agent policy
+	PolicyPackage = "agent_policy"
+)
+
+var ErrInvalid = errors.New("invalid initdata")
+
+// Validate checks the initdata document doc, as parsed into initdata, against
+// the initdata schema and the size limit. The data keys have to be in the
+// allowlist, DefaultAllowlist if nil, and their content in the format of the
+// file.
+func Validate(initdata *InitData, doc []byte, allowlist *Allowlist) error {
+	if allowlist == nil {
+		allowlist = DefaultAllowlist()
+	}
+
+	var errs []error
+
+	if len(doc) > MaxSize {
+		errs = append(errs, fmt.Errorf("size %d exceeds the limit of %d bytes", len(doc), MaxSize))
+	}
+	if _, err := Digest(initdata.Algorithm, nil); err != nil {
+		errs = append(errs, fmt.Errorf("algorithm %q is not one of sha256, sha384 or sha512", initdata.Algorithm))
+	}
+	if initdata.Version == "" {
+		errs = append(errs, errors.New("version is missing"))
+	}
+
+	for key, value := range initdata.Data {
+		file, ok := allowlist.Lookup(key)
+		if !ok {
+			errs = append(errs, fmt.Errorf("data key %q is not one of %s", key, strings.Join(allowlist.Keys(), ", ")))
+			continue
+		}
+		if err := file.checkFormat(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	return nil
+}
+
+// DecodeAndValidate decodes base64 encoded initdata and validates it
+func DecodeAndValidate(encoded string, allowlist *Allowlist) (*InitData, []byte, error) {
+	initdata, doc, err := Decode(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	if err := Validate(initdata, doc, allowlist); err != nil {
+		return nil, nil, err
+	}
+	return initdata, doc, nil
+}
+
+// ValidatePolicy checks that src is a rego module of the agent_policy package
+// that compiles
+func ValidatePolicy(src string) error {
+	module, err := ast.ParseModule(PolicyKey, src)
+	if err != nil {
+		return err
+	}
+	if module == nil {
+		return fmt.Errorf("policy must start with %q", "package "+PolicyPackage)
+	}
+	if pkg := strings.TrimPrefix(module.Package.Path.String(), "data."); pkg != PolicyPackage {
+		return fmt.Errorf("policy package is %q, not %q", pkg, PolicyPackage)
+	}
+	if _, err := ast.CompileModules(map[string]string{PolicyKey: src}); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package initdata
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `# Allow everything but exec
+package agent_policy
+
+import future.keywords.in
+
+default AllowRequestsFailingPolicy := false
+default ExecProcessRequest := false
+
+CreateContainerRequest {
+	some c in input.OCI.Annotations
+	c != "{"
+	regex.match(` + "`^[a-z]+$`" + `, "abc")
+}
+`
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		initdata InitData
+		wantErr  string
+	}{
+		{
+			name: "Valid",
+			initdata: InitData{Algorithm: "sha256", Version: "0.1.0", Data: map[string]string{
+				AAConfigKey:  "[token_configs.kbs]\nurl = \"http://kbs:8080\"\n",
+				CDHConfigKey: "socket = \"unix:///run/confidential-containers/cdh.sock\"\n",
+				PolicyKey:    testPolicy,
+			}},
+		},
+		{
+			name:     "UnsupportedAlgorithm",
+			initdata: InitData{Algorithm: "md5", Version: "0.1.0"},
+			wantErr:  `algorithm "md5"`,
+		},
+		{
+			name:     "MissingVersion",
+			initdata: InitData{Algorithm: "sha256"},
+			wantErr:  "version is missing",
+		},
+		{
+			name:     "UnknownKey",
+			initdata: InitData{Algorithm: "sha256", Version: "0.1.0", Data: map[string]string{"agent.toml": ""}},
+			wantErr:  `data key "agent.toml"`,
+		},
+		{
+			name:     "InvalidTOML",
+			initdata: InitData{Algorithm: "sha256", Version: "0.1.0", Data: map[string]string{CDHConfigKey: "socket ="}},
+			wantErr:  "cdh.toml",
+		},
+		{
+			name:     "InvalidPolicy",
+			initdata: InitData{Algorithm: "sha256", Version: "0.1.0", Data: map[string]string{PolicyKey: "package agent_policy\nfoo {\n"}},
+			wantErr:  "policy.rego",
+		},
+		{
+			name:     "TooLarge",
+			initdata: InitData{Algorithm: "sha256", Version: "0.1.0", Data: map[string]string{AAConfigKey: "# " + strings.Repeat("a", MaxSize)}},
+			wantErr:  "exceeds the limit",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, _, err := tt.initdata.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, err = DecodeAndValidate(encoded, nil)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("DecodeAndValidate() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("DecodeAndValidate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, _, err := DecodeAndValidate(base64.StdEncoding.EncodeToString([]byte("algorithm =")), nil); !errors.Is(err, ErrInvalid) {
+		t.Errorf("DecodeAndValidate() error = %v, want ErrInvalid for malformed TOML", err)
+	}
+	if _, _, err := DecodeAndValidate("not base64", nil); !errors.Is(err, ErrInvalid) {
+		t.Errorf("DecodeAndValidate() error = %v, want ErrInvalid for malformed base64", err)
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	if err := ValidatePolicy(testPolicy); err != nil {
+		t.Errorf("ValidatePolicy() error = %v", err)
+	}
+
+	for name, policy := range map[string]string{
+		"missing package":     "default allow := true\n",
+		"other package":       "package other\n",
+		"unclosed brace":      "package agent_policy\nallow {\n  true\n",
+		"unbalanced brackets": "package agent_policy\nallow { x := [1, 2) }\n",
+		"unterminated string": "package agent_policy\nallow { x := \"a }\n",
+		"unterminated raw":    "package agent_policy\nallow { x := `a }\n",
+		"empty":               "",
+		"unsafe variable":     "package agent_policy\nallow { x == 1 }\n",
+		"undefined function":  "package agent_policy\nallow { undefined_fn(1) }\n",
+	} {
+		if err := ValidatePolicy(policy); err == nil {
+			t.Errorf("ValidatePolicy() expected an error for %s", name)
+		}
+	}
+}
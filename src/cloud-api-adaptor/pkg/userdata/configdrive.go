@@ -0,0 +1,77 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package userdata
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// configDrive describes an ISO or disk attached to the VM that carries the user data
+type configDrive struct {
+	labels       []string
+	userDataPath string
+}
+
+var configDrives = []configDrive{
+	// NoCloud, as created by the libvirt provider
+	{labels: []string{"cidata", "CIDATA"}, userDataPath: "user-data"},
+	// OpenStack config drive format, as used by PowerVS
+	{labels: []string{"config-2", "CONFIG-2"}, userDataPath: "openstack/latest/user_data"},
+}
+
+var diskByLabelDir = "/dev/disk/by-label"
+
+// findConfigDrive returns the block device of the first config drive found
+// and the path of the user data on it
+func findConfigDrive() (string, string) {
+	for _, drive := range configDrives {
+		for _, label := range drive.labels {
+			device := filepath.Join(diskByLabelDir, label)
+			if _, err := os.Stat(device); err == nil {
+				return device, drive.userDataPath
+			}
+		}
+	}
+	return "", ""
+}
+
+func isConfigDrive(ctx context.Context) bool {
+	device, _ := findConfigDrive()
+	return device != ""
+}
+
+type ConfigDriveUserDataProvider struct{ DefaultRetry }
+
+func (a ConfigDriveUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	device, path := findConfigDrive()
+	if device == "" {
+		return nil, fmt.Errorf("no config drive found")
+	}
+	logger.Printf("provider: ConfigDrive, device: %s\n", device)
+
+	mountPoint, err := os.MkdirTemp("", "config-drive")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mount point: %w", err)
+	}
+	defer os.Remove(mountPoint)
+
+	if out, err := exec.CommandContext(ctx, "mount", "-o", "ro", device, mountPoint).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to mount config drive %s: %w: %s", device, err, out)
+	}
+	defer func() {
+		if out, err := exec.Command("umount", mountPoint).CombinedOutput(); err != nil {
+			logger.Printf("failed to unmount config drive: %s: %s\n", err, out)
+		}
+	}()
+
+	data, err := os.ReadFile(filepath.Join(mountPoint, path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user data from config drive: %w", err)
+	}
+	return data, nil
+}
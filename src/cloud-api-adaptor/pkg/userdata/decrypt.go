@@ -0,0 +1,91 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package userdata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/avast/retry-go/v4"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/securecomms/apic"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+const (
+	// DefaultEncryptionKeyID is the KBS resource holding the key of the
+	// encrypted userdata files
+	DefaultEncryptionKeyID = "peerpods/userdata-key"
+
+	apiServerRestPort = 8006
+	keyRetryDelay     = 5 * time.Second
+)
+
+// KeyGetter fetches a resource from the KBS
+type KeyGetter func(key string) ([]byte, error)
+
+// DecryptFiles decrypts the encrypted files written by ProvisionFiles. The
+// key is requested from the KBS through the confidential data hub, which
+// only releases it once the pod VM is attested.
+func DecryptFiles(cfg *Config, keyID string) error {
+	client := apic.NewApiClient(apiServerRestPort, forwarder.DefaultKataAgentNamespace)
+	return decryptFiles(cfg, client.GetKey, keyID)
+}
+
+func decryptFiles(cfg *Config, getKey KeyGetter, keyID string) error {
+	var encrypted []string
+	for _, path := range cfg.writeFiles {
+		if _, err := os.Stat(path + cloudinit.EncryptedSuffix); err == nil {
+			encrypted = append(encrypted, path)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to stat %s: %w", path+cloudinit.EncryptedSuffix, err)
+		}
+	}
+	if len(encrypted) == 0 {
+		logger.Printf("No encrypted files found, skipped decryption.\n")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.fetchTimeout)*time.Second)
+	defer cancel()
+
+	// The confidential data hub is not necessarily up yet
+	key, err := retry.DoWithData(
+		func() ([]byte, error) {
+			return getKey(keyID)
+		},
+		retry.Context(ctx),
+		retry.Delay(keyRetryDelay),
+		retry.LastErrorOnly(true),
+		retry.DelayType(retry.FixedDelay),
+		retry.OnRetry(func(n uint, err error) {
+			logger.Printf("Retry attempt %d: %v\n", n, err)
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get userdata encryption key %s: %w", keyID, err)
+	}
+
+	for _, path := range encrypted {
+		ciphertext, err := os.ReadFile(path + cloudinit.EncryptedSuffix)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path+cloudinit.EncryptedSuffix, err)
+		}
+		plaintext, err := cloudinit.Decrypt(path, ciphertext, key)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", path, err)
+		}
+		if err := writeFile(path, plaintext); err != nil {
+			return err
+		}
+		if err := os.Remove(path + cloudinit.EncryptedSuffix); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path+cloudinit.EncryptedSuffix, err)
+		}
+	}
+
+	return nil
+}
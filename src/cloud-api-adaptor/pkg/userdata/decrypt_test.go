@@ -0,0 +1,96 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package userdata
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+func TestDecryptFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	authPath := filepath.Join(tempDir, "auth.json")
+	daemonPath := filepath.Join(tempDir, "daemon.json")
+	key := bytes.Repeat([]byte{7}, cloudinit.EncryptionKeySize)
+
+	generated := &cloudinit.CloudConfig{
+		WriteFiles: []cloudinit.WriteFile{
+			{Path: daemonPath, Content: testDaemonConfig},
+			{Path: authPath, Content: testAuthJson},
+		},
+	}
+	if err := generated.Encrypt([]string{authPath}, key); err != nil {
+		t.Fatalf("failed to encrypt cloud config: %v", err)
+	}
+	content, err := generated.Generate()
+	if err != nil {
+		t.Fatalf("failed to generate cloud config: %v", err)
+	}
+
+	provider := TestProvider{content: content}
+	cc, err := retrieveCloudConfig(context.TODO(), &provider, nil)
+	if err != nil {
+		t.Fatalf("couldn't retrieve cloud config: %v", err)
+	}
+	cfg := Config{fetchTimeout: 1, writeFiles: []string{authPath, daemonPath}}
+	if err := processCloudConfig(&cfg, cc); err != nil {
+		t.Fatalf("failed to process cloud config file: %v", err)
+	}
+	if _, err := os.Stat(authPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected %s not to be written before decryption, got %v", authPath, err)
+	}
+	ciphertext, err := os.ReadFile(authPath + cloudinit.EncryptedSuffix)
+	if err != nil {
+		t.Fatalf("failed to read encrypted file: %v", err)
+	}
+
+	// A tampered ciphertext is refused
+	tampered := bytes.Clone(ciphertext)
+	tampered[len(tampered)-1] ^= 1
+	if err := os.WriteFile(authPath+cloudinit.EncryptedSuffix, tampered, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	getKey := func(id string) ([]byte, error) {
+		if id != DefaultEncryptionKeyID {
+			return nil, errors.New("unknown key")
+		}
+		return key, nil
+	}
+	if err := decryptFiles(&cfg, getKey, DefaultEncryptionKeyID); err == nil {
+		t.Fatalf("expected decryption of a tampered file to fail")
+	}
+	if _, err := os.Stat(authPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected %s not to be written for a tampered file, got %v", authPath, err)
+	}
+
+	if err := os.WriteFile(authPath+cloudinit.EncryptedSuffix, ciphertext, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := decryptFiles(&cfg, getKey, DefaultEncryptionKeyID); err != nil {
+		t.Fatalf("failed to decrypt files: %v", err)
+	}
+	data, _ := os.ReadFile(authPath)
+	if string(data) != testAuthJson {
+		t.Fatalf("file %s: %s does not match %s", authPath, string(data), testAuthJson)
+	}
+	if _, err := os.Stat(authPath + cloudinit.EncryptedSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected %s to be removed, got %v", authPath+cloudinit.EncryptedSuffix, err)
+	}
+	data, _ = os.ReadFile(daemonPath)
+	if string(data) != testDaemonConfig {
+		t.Fatalf("file %s: %s does not match %s", daemonPath, string(data), testDaemonConfig)
+	}
+
+	// Nothing left to decrypt, the key is not requested
+	noKey := func(string) ([]byte, error) { return nil, errors.New("unexpected key request") }
+	if err := decryptFiles(&cfg, noKey, DefaultEncryptionKeyID); err != nil {
+		t.Fatalf("expected no error without encrypted files, got %v", err)
+	}
+}
@@ -2,15 +2,15 @@ package userdata
 
 import (
 	"context"
-	"crypto/sha256"
-	"crypto/sha512"
-	"encoding/base64"
-	"encoding/hex"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/avast/retry-go/v4"
@@ -19,58 +19,76 @@ import (
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/agent"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/cdh"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/forwarder"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/aws"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/azure"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/docker"
-	toml "github.com/pelletier/go-toml/v2"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/gcp"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/ibmcloud"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/openstack"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/vsphere"
 	"gopkg.in/yaml.v2"
 )
 
 const (
 	ConfigParent = "/run/peerpod"
 	DigestPath   = "/run/peerpod/initdata.digest"
-	PolicyPath   = "/run/peerpod/policy.rego"
+	PolicyPath   = initdata.PolicyPath
+
+	// DefaultVerificationKeyPath is the public key baked into the pod VM image
+	// that verifies the userdata signature. Unsigned userdata is accepted if
+	// the key doesn't exist.
+	DefaultVerificationKeyPath = "/etc/peerpod/userdata-signing.pub"
 )
 
 var logger = log.New(log.Writer(), "[userdata/provision] ", log.LstdFlags|log.Lmsgprefix)
 var WriteFilesList = []string{aa.ConfigFilePath, cdh.ConfigFilePath, agent.ConfigFilePath, forwarder.DefaultConfigPath, cloud.AuthFilePath, cloud.InitdataPath}
-var InitdDataFilesList = []string{aa.ConfigFilePath, cdh.ConfigFilePath, PolicyPath}
+
+// DefaultProviders is the default detection order of the user data providers.
+// Providers that are detected without network access come first.
+var DefaultProviders = []string{"docker", "vsphere", "config-drive", "azure", "aws", "gcp", "openstack", "ibmcloud"}
 
 type Config struct {
 	fetchTimeout  int
+	providers     []string
 	digestPath    string
 	initdataPath  string
-	parentPath    string
 	writeFiles    []string
-	initdataFiles []string
+	verifyKeyPath string
+	// initdataFiles is the allowlist of initdata files, read from
+	// initdataFilesPath if nil
+	initdataFiles     *initdata.Allowlist
+	initdataFilesPath string
 }
 
-func NewConfig(fetchTimeout int) *Config {
+// NewConfig returns a config that detects the user data providers in the
+// given order, or in the order of DefaultProviders if providers is empty
+func NewConfig(fetchTimeout int, providers []string) *Config {
+	if len(providers) == 0 {
+		providers = DefaultProviders
+	}
 	return &Config{
-		fetchTimeout:  fetchTimeout,
-		parentPath:    ConfigParent,
-		initdataPath:  cloud.InitdataPath,
-		digestPath:    DigestPath,
-		writeFiles:    WriteFilesList,
-		initdataFiles: InitdDataFilesList,
+		fetchTimeout:      fetchTimeout,
+		providers:         providers,
+		initdataPath:      cloud.InitdataPath,
+		digestPath:        DigestPath,
+		writeFiles:        WriteFilesList,
+		verifyKeyPath:     DefaultVerificationKeyPath,
+		initdataFilesPath: initdata.DefaultFilesPath,
 	}
 }
 
 type WriteFile struct {
-	Path    string `yaml:"path"`
-	Content string `yaml:"content"`
+	Path     string `yaml:"path"`
+	Content  string `yaml:"content"`
+	Encoding string `yaml:"encoding,omitempty"`
 }
 
 type CloudConfig struct {
 	WriteFiles []WriteFile `yaml:"write_files"`
 }
 
-type InitData struct {
-	Algorithm string            `toml:"algorithm"`
-	Version   string            `toml:"version"`
-	Data      map[string]string `toml:"data,omitempty"`
-}
-
 type UserDataProvider interface {
 	GetUserData(ctx context.Context) ([]byte, error)
 	GetRetryDelay() time.Duration
@@ -98,6 +116,41 @@ func (a AWSUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
 	return aws.GetUserData(ctx, url)
 }
 
+type GCPUserDataProvider struct{ DefaultRetry }
+
+func (a GCPUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	url := gcp.GCPUserDataUrl
+	logger.Printf("provider: GCP, userDataUrl: %s\n", url)
+	return gcp.GetUserData(ctx, url)
+}
+
+type OpenStackUserDataProvider struct{ DefaultRetry }
+
+// GetUserData reads the user data from the metadata service. Pod VMs created
+// with -use-config-drive are served by ConfigDriveUserDataProvider, which
+// comes first in DefaultProviders.
+func (a OpenStackUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	url := openstack.OpenStackUserDataUrl
+	logger.Printf("provider: OpenStack, userDataUrl: %s\n", url)
+	return openstack.GetUserData(ctx, url)
+}
+
+type IBMCloudUserDataProvider struct{ DefaultRetry }
+
+func (a IBMCloudUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	url := ibmcloud.IBMCloudUserDataUrl
+	logger.Printf("provider: IBMCloud, userDataUrl: %s\n", url)
+	return ibmcloud.GetUserData(ctx, url)
+}
+
+type VSphereUserDataProvider struct{ DefaultRetry }
+
+func (a VSphereUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	key := vsphere.VSphereUserDataKey
+	logger.Printf("provider: vSphere, guestinfo: %s\n", key)
+	return vsphere.GetUserData(ctx, key)
+}
+
 type DockerUserDataProvider struct{ DefaultRetry }
 
 func (a DockerUserDataProvider) GetUserData(ctx context.Context) ([]byte, error) {
@@ -106,25 +159,64 @@ func (a DockerUserDataProvider) GetUserData(ctx context.Context) ([]byte, error)
 	return docker.GetUserData(ctx, url)
 }
 
-func newProvider(ctx context.Context) (UserDataProvider, error) {
+type userDataSource struct {
+	detect   func(ctx context.Context) bool
+	provider UserDataProvider
+}
 
-	// This checks for the presence of a file and doesn't rely on http req like the
-	// azure, aws ones, thereby making it faster and hence checking this first
-	if docker.IsDocker(ctx) {
-		return DockerUserDataProvider{}, nil
-	}
-	if azure.IsAzure(ctx) {
-		return AzureUserDataProvider{}, nil
+var userDataSources = map[string]userDataSource{
+	"docker":       {docker.IsDocker, DockerUserDataProvider{}},
+	"vsphere":      {vsphere.IsVSphere, VSphereUserDataProvider{}},
+	"config-drive": {isConfigDrive, ConfigDriveUserDataProvider{}},
+	"azure":        {azure.IsAzure, AzureUserDataProvider{}},
+	"aws":          {aws.IsAWS, AWSUserDataProvider{}},
+	"gcp":          {gcp.IsGCP, GCPUserDataProvider{}},
+	"openstack":    {openstack.IsOpenStack, OpenStackUserDataProvider{}},
+	"ibmcloud":     {ibmcloud.IsIBMCloud, IBMCloudUserDataProvider{}},
+}
+
+// ValidateProviders checks that all the named user data providers are known
+func ValidateProviders(providers []string) error {
+	for _, name := range providers {
+		if _, ok := userDataSources[name]; !ok {
+			return fmt.Errorf("unknown user data provider %q", name)
+		}
 	}
+	return nil
+}
 
-	if aws.IsAWS(ctx) {
-		return AWSUserDataProvider{}, nil
+// newProvider returns the first of the named user data providers that is
+// detected on this VM
+func newProvider(ctx context.Context, providers []string) (UserDataProvider, error) {
+
+	for _, name := range providers {
+		source, ok := userDataSources[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown user data provider %q", name)
+		}
+		if source.detect(ctx) {
+			return source.provider, nil
+		}
 	}
 
 	return nil, fmt.Errorf("unsupported user data provider")
 }
 
-func retrieveCloudConfig(ctx context.Context, provider UserDataProvider) (*CloudConfig, error) {
+// loadVerificationKey returns nil if there is no key at path
+func loadVerificationKey(path string) (ed25519.PublicKey, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		logger.Printf("Verification key %s not found, userdata signature is not checked.\n", path)
+		return nil, nil
+	}
+	return cloudinit.LoadVerificationKey(path)
+}
+
+// retrieveCloudConfig fetches and parses the cloud config. If key is set, the
+// cloud config has to be signed with the matching private key.
+func retrieveCloudConfig(ctx context.Context, provider UserDataProvider, key ed25519.PublicKey) (*CloudConfig, error) {
 	var cc CloudConfig
 
 	// Use retry.Do to retry the getUserData function until it succeeds
@@ -136,6 +228,13 @@ func retrieveCloudConfig(ctx context.Context, provider UserDataProvider) (*Cloud
 				return fmt.Errorf("failed to get user data: %w", err)
 			}
 
+			if key != nil {
+				// A bad signature won't fix itself, don't retry
+				if ud, err = cloudinit.Verify(ud, key); err != nil {
+					return retry.Unrecoverable(fmt.Errorf("failed to verify user data: %w", err))
+				}
+			}
+
 			// We parse user data now, b/c we want to retry if it's not valid
 			parsed, err := parseUserData(ud)
 			if err != nil {
@@ -182,6 +281,85 @@ func writeFile(path string, bytes []byte) error {
 	return nil
 }
 
+// writeInitdataFile writes an initdata file with its mode and owner. The file
+// is created with its final mode, so that credentials are never readable by
+// others.
+func writeInitdataFile(file *initdata.File, bytes []byte) error {
+	mode, err := file.FileMode()
+	if err != nil {
+		return err
+	}
+	uid, gid, err := lookupOwner(file.Owner)
+	if err != nil {
+		return fmt.Errorf("owner of %s: %w", file.Path, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	f, err := os.OpenFile(file.Path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return fmt.Errorf("failed to write file %s: %w", file.Path, err)
+	}
+	defer f.Close()
+
+	// The mode of an existing file, and the umask, are not applied by OpenFile
+	if err := f.Chmod(mode); err != nil {
+		return fmt.Errorf("failed to chmod file %s: %w", file.Path, err)
+	}
+	if uid >= 0 {
+		if err := f.Chown(uid, gid); err != nil {
+			return fmt.Errorf("failed to chown file %s: %w", file.Path, err)
+		}
+	}
+	if _, err := f.Write(bytes); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", file.Path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", file.Path, err)
+	}
+	logger.Printf("Wrote %s\n", file.Path)
+	return nil
+}
+
+// lookupOwner returns the IDs of a user[:group] owner, by name or ID. -1 is
+// returned for an empty owner, leaving the file owned by the process user.
+func lookupOwner(owner string) (int, int, error) {
+	if owner == "" {
+		return -1, -1, nil
+	}
+	userName, groupName, hasGroup := strings.Cut(owner, ":")
+
+	uid, err := strconv.Atoi(userName)
+	gid := -1
+	if err != nil {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			return 0, 0, err
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+		gid, _ = strconv.Atoi(u.Gid)
+	} else if !hasGroup {
+		u, err := user.LookupId(userName)
+		if err != nil {
+			return 0, 0, err
+		}
+		gid, _ = strconv.Atoi(u.Gid)
+	}
+
+	if hasGroup {
+		if gid, err = strconv.Atoi(groupName); err != nil {
+			g, err := user.LookupGroup(groupName)
+			if err != nil {
+				return 0, 0, err
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
+
 func isAllowed(path string, filesList []string) bool {
 	for _, listedFile := range filesList {
 		if listedFile == path {
@@ -194,8 +372,12 @@ func isAllowed(path string, filesList []string) bool {
 func processCloudConfig(cfg *Config, cc *CloudConfig) error {
 	for _, wf := range cc.WriteFiles {
 		path := wf.Path
-		bytes := []byte(wf.Content)
-		if isAllowed(path, cfg.writeFiles) {
+		// Encrypted files are decrypted to their path by DecryptFiles
+		if isAllowed(strings.TrimSuffix(path, cloudinit.EncryptedSuffix), cfg.writeFiles) {
+			bytes, err := cloudinit.DecodeContent(wf.Content, wf.Encoding)
+			if err != nil {
+				return fmt.Errorf("failed to decode config file %s: %w", path, err)
+			}
 			if err := writeFile(path, bytes); err != nil {
 				return fmt.Errorf("failed to write config file %s: %w", path, err)
 			}
@@ -223,40 +405,32 @@ func extractInitdataAndHash(cfg *Config) error {
 		return fmt.Errorf("Error read initdata file: %w", err)
 	}
 
-	decodedBytes, err := base64.StdEncoding.DecodeString(string(dataBytes))
+	initData, decodedBytes, err := initdata.Decode(string(dataBytes))
 	if err != nil {
-		return fmt.Errorf("Error base64 decode initdata: %w", err)
+		return err
 	}
-	initdata := InitData{}
-	err = toml.Unmarshal(decodedBytes, &initdata)
-	if err != nil {
-		return fmt.Errorf("Error unmarshalling initdata: %w", err)
+
+	allowlist := cfg.initdataFiles
+	if allowlist == nil {
+		if allowlist, err = initdata.LoadAllowlist(cfg.initdataFilesPath); err != nil {
+			return err
+		}
 	}
 
-	for key, value := range initdata.Data {
-		path := filepath.Join(cfg.parentPath, key)
-		if isAllowed(path, cfg.initdataFiles) {
-			if err := writeFile(path, []byte(value)); err != nil {
-				return fmt.Errorf("Error write a file in initdata: %w", err)
-			}
-		} else {
+	for key, value := range initData.Data {
+		file, ok := allowlist.Lookup(key)
+		if !ok {
 			logger.Printf("File: %s is not allowed in initdata.\n", key)
+			continue
+		}
+		if err := writeInitdataFile(file, []byte(value)); err != nil {
+			return fmt.Errorf("Error write a file in initdata: %w", err)
 		}
 	}
 
-	checksumStr := ""
-	switch initdata.Algorithm {
-	case "sha256":
-		hash := sha256.Sum256(decodedBytes)
-		checksumStr = hex.EncodeToString(hash[:])
-	case "sha384":
-		hash := sha512.Sum384(decodedBytes)
-		checksumStr = hex.EncodeToString(hash[:])
-	case "sha512":
-		hash := sha512.Sum512(decodedBytes)
-		checksumStr = hex.EncodeToString(hash[:])
-	default:
-		return fmt.Errorf("Error creating initdata hash, the Algorithm %s not supported", initdata.Algorithm)
+	checksumStr, err := initdata.Digest(initData.Algorithm, decodedBytes)
+	if err != nil {
+		return err
 	}
 
 	err = writeFile(cfg.digestPath, []byte(checksumStr)) // the hash in digestPath will also be used by attester
@@ -276,9 +450,23 @@ func ProvisionFiles(cfg *Config) error {
 	// some providers provision config files via process-user-data
 	// some providers rely on cloud-init provision config files
 	// all providers need extract files from initdata and calculate the hash value for attesters usage
-	provider, _ := newProvider(ctx)
+	if err := ValidateProviders(cfg.providers); err != nil {
+		return err
+	}
+
+	key, err := loadVerificationKey(cfg.verifyKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load verification key: %w", err)
+	}
+
+	provider, err := newProvider(ctx, cfg.providers)
+	if provider == nil && key != nil {
+		// Files written by cloud-init can't be trusted without verifying the
+		// signature of the user data
+		return fmt.Errorf("a verification key is set but the user data can't be retrieved: %w", err)
+	}
 	if provider != nil {
-		cc, err := retrieveCloudConfig(ctx, provider)
+		cc, err := retrieveCloudConfig(ctx, provider, key)
 		if err != nil {
 			return fmt.Errorf("failed to retrieve cloud config: %w", err)
 		}
@@ -1,19 +1,28 @@
 package userdata
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/azure"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/gcp"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 )
 
 var testAgentConfig string = `server_addr = 'unix:///run/kata-containers/agent.sock'
@@ -281,6 +290,30 @@ func TestInvalidGetUserDataEmptyUrl(t *testing.T) {
 	}
 }
 
+// TestGetUserDataGCP tests that the GCP user data is fetched with the metadata flavor header
+func TestGetUserDataGCP(t *testing.T) {
+	// Start a temporary HTTP server for the test simulating
+	// the GCE metadata server, which rejects requests without the header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "Missing Metadata-Flavor header.", http.StatusForbidden)
+			return
+		}
+		if _, err := io.WriteString(w, "test data"); err != nil {
+			http.Error(w, "Error writing response.", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	userData, err := gcp.GetUserData(context.Background(), srv.URL+"/computeMetadata/v1/instance/attributes/user-data")
+	if err != nil {
+		t.Fatalf("getUserData returned error: %v", err)
+	}
+	if string(userData) != "test data" {
+		t.Fatalf("getUserData returned %q", userData)
+	}
+}
+
 type TestProvider struct {
 	content  string
 	failNext bool
@@ -303,13 +336,13 @@ func TestRetrieveCloudConfig(t *testing.T) {
 	var provider TestProvider
 
 	provider = TestProvider{content: "write_files: []"}
-	_, err := retrieveCloudConfig(context.TODO(), &provider)
+	_, err := retrieveCloudConfig(context.TODO(), &provider, nil)
 	if err != nil {
 		t.Fatalf("couldn't retrieve and parse empty cloud config: %v", err)
 	}
 
 	provider = TestProvider{failNext: true, content: "write_files: []"}
-	_, err = retrieveCloudConfig(context.TODO(), &provider)
+	_, err = retrieveCloudConfig(context.TODO(), &provider, nil)
 	if err != nil {
 		t.Fatalf("retry failed: %v", err)
 	}
@@ -320,7 +353,7 @@ write_files:
   content: |
     test
     test`}
-	_, err = retrieveCloudConfig(context.TODO(), &provider)
+	_, err = retrieveCloudConfig(context.TODO(), &provider, nil)
 	if err != nil {
 		t.Fatalf("couldn't retrieve valid cloud config: %v", err)
 	}
@@ -384,7 +417,7 @@ write_files:
 
 	provider := TestProvider{content: content}
 
-	cc, err := retrieveCloudConfig(context.TODO(), &provider)
+	cc, err := retrieveCloudConfig(context.TODO(), &provider, nil)
 	if err != nil {
 		t.Fatalf("couldn't retrieve cloud config: %v", err)
 	}
@@ -393,7 +426,6 @@ write_files:
 		fetchTimeout:  180,
 		digestPath:    "",
 		initdataPath:  initdataPath,
-		parentPath:    tempDir,
 		writeFiles:    writeFilesList,
 		initdataFiles: nil,
 	}
@@ -487,7 +519,7 @@ write_files:
 
 	provider := TestProvider{content: content}
 
-	cc, err := retrieveCloudConfig(context.TODO(), &provider)
+	cc, err := retrieveCloudConfig(context.TODO(), &provider, nil)
 	if err != nil {
 		t.Fatalf("couldn't retrieve cloud config: %v", err)
 	}
@@ -496,7 +528,6 @@ write_files:
 		fetchTimeout:  180,
 		digestPath:    "",
 		initdataPath:  "",
-		parentPath:    tempDir,
 		writeFiles:    writeFilesList,
 		initdataFiles: nil,
 	}
@@ -572,15 +603,18 @@ func TestExtractInitdataAndHash(t *testing.T) {
 	var cdhPath = filepath.Join(tempDir, "cdh.toml")
 	var policyPath = filepath.Join(tempDir, "policy.rego")
 	var digestPath = filepath.Join(tempDir, "initdata.digest")
-	var initdDataFilesList = []string{aaPath, cdhPath, policyPath}
+	var initdDataFiles = &initdata.Allowlist{Files: []initdata.File{
+		{Key: "aa.toml", Path: aaPath},
+		{Key: "cdh.toml", Path: cdhPath},
+		{Key: filepath.Base(policyPath), Path: policyPath},
+	}}
 
 	cfg := Config{
 		fetchTimeout:  180,
 		digestPath:    digestPath,
 		initdataPath:  initdataPath,
-		parentPath:    tempDir,
 		writeFiles:    nil,
-		initdataFiles: initdDataFilesList,
+		initdataFiles: initdDataFiles,
 	}
 
 	_ = writeFile(initdataPath, []byte(cc_init_data))
@@ -614,14 +648,98 @@ func TestExtractInitdataAndHash(t *testing.T) {
 	}
 }
 
+func TestExtractInitdataFiles(t *testing.T) {
+	tempDir := t.TempDir()
+
+	var initdataPath = filepath.Join(tempDir, "initdata")
+	var caPath = filepath.Join(tempDir, "certs", "registry-ca.pem")
+	var policyPath = filepath.Join(tempDir, "containers", "policy.json")
+	var digestPath = filepath.Join(tempDir, "initdata.digest")
+
+	allowlist, err := initdata.ParseAllowlist([]byte(fmt.Sprintf(`files:
+- key: registry-ca.pem
+  path: %s
+- key: policy.json
+  path: %s
+  mode: "0600"
+  owner: "%d:%d"
+`, caPath, policyPath, os.Getuid(), os.Getgid())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{
+		digestPath:    digestPath,
+		initdataPath:  initdataPath,
+		initdataFiles: allowlist,
+	}
+
+	id := &initdata.InitData{Algorithm: "sha384", Version: "0.1.0", Data: map[string]string{
+		"registry-ca.pem": "ca",
+		"policy.json":     "{}",
+		"unknown.conf":    "unknown",
+	}}
+	encoded, doc, err := id.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An existing file keeps its mode when written by os.WriteFile
+	_ = writeFile(policyPath, []byte("old"))
+	_ = writeFile(initdataPath, []byte(encoded))
+
+	if err := extractInitdataAndHash(&cfg); err != nil {
+		t.Fatalf("extractInitdataAndHash returned err: %v", err)
+	}
+
+	for path, want := range map[string]os.FileMode{caPath: initdata.DefaultMode, policyPath: 0o600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("initdata file %s is not written: %v", path, err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("mode of %s = %o, want %o", path, info.Mode().Perm(), want)
+		}
+	}
+	if bytes, _ := os.ReadFile(policyPath); string(bytes) != "{}" {
+		t.Errorf("content of %s = %q, want %q", policyPath, bytes, "{}")
+	}
+
+	// The digest covers the whole document, including the files that are
+	// not provisioned
+	want, err := initdata.Digest("sha384", doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes, _ := os.ReadFile(digestPath); string(bytes) != want {
+		t.Errorf("digest = %s, want %s", bytes, want)
+	}
+}
+
+func TestLookupOwner(t *testing.T) {
+	uid, gid, err := lookupOwner("")
+	if err != nil || uid != -1 || gid != -1 {
+		t.Errorf("lookupOwner(\"\") = %d, %d, %v, want -1, -1", uid, gid, err)
+	}
+	uid, gid, err = lookupOwner("1000:2000")
+	if err != nil || uid != 1000 || gid != 2000 {
+		t.Errorf("lookupOwner(\"1000:2000\") = %d, %d, %v, want 1000, 2000", uid, gid, err)
+	}
+	uid, gid, err = lookupOwner("root")
+	if err != nil || uid != 0 || gid != 0 {
+		t.Errorf("lookupOwner(\"root\") = %d, %d, %v, want 0, 0", uid, gid, err)
+	}
+	if _, _, err := lookupOwner("no-such-user"); err == nil {
+		t.Errorf("lookupOwner() expected an error for an unknown user")
+	}
+}
+
 func TestWithoutInitdata(t *testing.T) {
 	cfg := Config{
 		fetchTimeout:  0,
 		digestPath:    "",
 		initdataPath:  "/does/not/exist",
-		parentPath:    "",
 		writeFiles:    nil,
-		initdataFiles: []string{},
+		initdataFiles: &initdata.Allowlist{},
 	}
 
 	err := extractInitdataAndHash(&cfg)
@@ -639,15 +757,18 @@ func TestExtractInitdataWithMalicious(t *testing.T) {
 	var cdhPath = filepath.Join(tempDir, "cdh.toml")
 	var policyPath = filepath.Join(tempDir, "malicious.rego")
 	var digestPath = filepath.Join(tempDir, "initdata.digest")
-	var initdDataFilesList = []string{aaPath, cdhPath, policyPath}
+	var initdDataFiles = &initdata.Allowlist{Files: []initdata.File{
+		{Key: "aa.toml", Path: aaPath},
+		{Key: "cdh.toml", Path: cdhPath},
+		{Key: filepath.Base(policyPath), Path: policyPath},
+	}}
 
 	cfg := Config{
 		fetchTimeout:  180,
 		digestPath:    digestPath,
 		initdataPath:  initdataPath,
-		parentPath:    tempDir,
 		writeFiles:    nil,
-		initdataFiles: initdDataFilesList,
+		initdataFiles: initdDataFiles,
 	}
 
 	_ = writeFile(initdataPath, []byte(cc_init_data))
@@ -673,3 +794,220 @@ func TestExtractInitdataWithMalicious(t *testing.T) {
 		t.Fatalf("Should not read malicious file but got %s", string(bytes))
 	}
 }
+
+func TestNewProviderOrder(t *testing.T) {
+	first := &TestProvider{content: "first"}
+	second := &TestProvider{content: "second"}
+	userDataSources["test-undetected"] = userDataSource{func(context.Context) bool { return false }, &TestProvider{}}
+	userDataSources["test-first"] = userDataSource{func(context.Context) bool { return true }, first}
+	userDataSources["test-second"] = userDataSource{func(context.Context) bool { return true }, second}
+	defer func() {
+		delete(userDataSources, "test-undetected")
+		delete(userDataSources, "test-first")
+		delete(userDataSources, "test-second")
+	}()
+
+	provider, err := newProvider(context.Background(), []string{"test-undetected", "test-second", "test-first"})
+	if err != nil {
+		t.Fatalf("newProvider returned err: %v", err)
+	}
+	if provider != second {
+		t.Fatalf("newProvider returned %v, want the first detected provider", provider)
+	}
+
+	if _, err := newProvider(context.Background(), []string{"test-undetected"}); err == nil {
+		t.Fatalf("newProvider should fail when no provider is detected")
+	}
+}
+
+func TestValidateProviders(t *testing.T) {
+	if err := ValidateProviders(DefaultProviders); err != nil {
+		t.Fatalf("ValidateProviders(DefaultProviders) returned err: %v", err)
+	}
+	if err := ValidateProviders([]string{"aws", "unknown"}); err == nil {
+		t.Fatalf("ValidateProviders should fail for an unknown provider")
+	}
+	if cfg := NewConfig(180, nil); !reflect.DeepEqual(cfg.providers, DefaultProviders) {
+		t.Fatalf("NewConfig providers = %v, want %v", cfg.providers, DefaultProviders)
+	}
+}
+
+func TestFindConfigDrive(t *testing.T) {
+	byLabel := t.TempDir()
+	defer func(dir string) { diskByLabelDir = dir }(diskByLabelDir)
+	diskByLabelDir = byLabel
+
+	if device, _ := findConfigDrive(); device != "" {
+		t.Fatalf("findConfigDrive returned %s, want none", device)
+	}
+
+	_ = writeFile(filepath.Join(byLabel, "CONFIG-2"), nil)
+	device, path := findConfigDrive()
+	if device != filepath.Join(byLabel, "CONFIG-2") || path != "openstack/latest/user_data" {
+		t.Fatalf("findConfigDrive returned %s, %s", device, path)
+	}
+
+	// NoCloud takes precedence
+	_ = writeFile(filepath.Join(byLabel, "cidata"), nil)
+	device, path = findConfigDrive()
+	if device != filepath.Join(byLabel, "cidata") || path != "user-data" {
+		t.Fatalf("findConfigDrive returned %s, %s", device, path)
+	}
+}
+
+func TestProcessCloudConfigWithEncoding(t *testing.T) {
+	tempDir := t.TempDir()
+	authPath := filepath.Join(tempDir, "auth.json")
+	daemonPath := filepath.Join(tempDir, "daemon.json")
+	largeAuthJson := strings.Repeat(testAuthJson, 200)
+
+	generated := &cloudinit.CloudConfig{
+		WriteFiles: []cloudinit.WriteFile{
+			{Path: daemonPath, Content: testDaemonConfig},
+			{Path: authPath, Content: largeAuthJson},
+		},
+	}
+	if err := generated.Fit(len(largeAuthJson) / 2); err != nil {
+		t.Fatalf("failed to fit cloud config: %v", err)
+	}
+	content, err := generated.Generate()
+	if err != nil {
+		t.Fatalf("failed to generate cloud config: %v", err)
+	}
+
+	provider := TestProvider{content: content}
+	cc, err := retrieveCloudConfig(context.TODO(), &provider, nil)
+	if err != nil {
+		t.Fatalf("couldn't retrieve cloud config: %v", err)
+	}
+
+	cfg := Config{writeFiles: []string{authPath, daemonPath}}
+	if err := processCloudConfig(&cfg, cc); err != nil {
+		t.Fatalf("failed to process cloud config file: %v", err)
+	}
+
+	bytes, _ := os.ReadFile(authPath)
+	if string(bytes) != largeAuthJson {
+		t.Fatalf("file %s does not match the original content", authPath)
+	}
+	bytes, _ = os.ReadFile(daemonPath)
+	if string(bytes) != testDaemonConfig {
+		t.Fatalf("file %s: %s does not match %s", daemonPath, string(bytes), testDaemonConfig)
+	}
+}
+
+func TestRetrieveSignedCloudConfig(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	newConfig := func() *cloudinit.CloudConfig {
+		return &cloudinit.CloudConfig{
+			WriteFiles: []cloudinit.WriteFile{
+				{Path: "/run/peerpod/agent-config.toml", Content: testAgentConfig},
+				{Path: "/run/peerpod/daemon.json", Content: testDaemonConfig},
+				{Path: "/run/peerpod/auth.json", Content: testAuthJson},
+			},
+			SigningKey: priv,
+		}
+	}
+	signed, err := newConfig().Generate()
+	if err != nil {
+		t.Fatalf("failed to generate cloud config: %v", err)
+	}
+	signature := signed[strings.LastIndex(signed, cloudinit.SignaturePrefix):]
+
+	provider := TestProvider{content: signed}
+	cc, err := retrieveCloudConfig(context.TODO(), &provider, pub)
+	if err != nil {
+		t.Fatalf("couldn't retrieve signed cloud config: %v", err)
+	}
+	if len(cc.WriteFiles) != 3 {
+		t.Fatalf("expected 3 files, got %d", len(cc.WriteFiles))
+	}
+
+	// Tamper with each file and keep the original signature
+	for i := range newConfig().WriteFiles {
+		for name, tamper := range map[string]func(wf *cloudinit.WriteFile){
+			"content": func(wf *cloudinit.WriteFile) { wf.Content = strings.Replace(wf.Content, "a", "b", 1) },
+			"path":    func(wf *cloudinit.WriteFile) { wf.Path += "x" },
+		} {
+			tampered := newConfig()
+			tampered.SigningKey = nil
+			tamper(&tampered.WriteFiles[i])
+			content, err := tampered.Generate()
+			if err != nil {
+				t.Fatalf("failed to generate cloud config: %v", err)
+			}
+
+			provider := TestProvider{content: content + signature}
+			if _, err := retrieveCloudConfig(context.TODO(), &provider, pub); !errors.Is(err, cloudinit.ErrInvalidSignature) {
+				t.Fatalf("expected %v for tampered %s of %s, got %v", cloudinit.ErrInvalidSignature, name, tampered.WriteFiles[i].Path, err)
+			}
+		}
+	}
+
+	unsigned := newConfig()
+	unsigned.SigningKey = nil
+	content, err := unsigned.Generate()
+	if err != nil {
+		t.Fatalf("failed to generate cloud config: %v", err)
+	}
+	provider = TestProvider{content: content}
+	if _, err := retrieveCloudConfig(context.TODO(), &provider, pub); !errors.Is(err, cloudinit.ErrMissingSignature) {
+		t.Fatalf("expected %v, got %v", cloudinit.ErrMissingSignature, err)
+	}
+}
+
+func TestProvisionFilesVerificationKeyWithoutProvider(t *testing.T) {
+	userDataSources["test-undetected"] = userDataSource{func(context.Context) bool { return false }, &TestProvider{}}
+	defer delete(userDataSources, "test-undetected")
+
+	tempDir := t.TempDir()
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	keyPath := filepath.Join(tempDir, "userdata-signing.pub")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	cfg := NewConfig(1, []string{"test-undetected"})
+	cfg.verifyKeyPath = keyPath
+	cfg.initdataPath = filepath.Join(tempDir, "initdata")
+	cfg.digestPath = filepath.Join(tempDir, "initdata.digest")
+
+	// The files written by cloud-init must not be trusted unverified
+	if err := ProvisionFiles(cfg); err == nil {
+		t.Fatalf("ProvisionFiles should fail when the signed user data can't be retrieved")
+	}
+}
+
+func TestLoadVerificationKey(t *testing.T) {
+	tempDir := t.TempDir()
+
+	key, err := loadVerificationKey(filepath.Join(tempDir, "missing.pub"))
+	if err != nil || key != nil {
+		t.Fatalf("expected no key and no error for a missing key, got %v, %v", key, err)
+	}
+
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	keyPath := filepath.Join(tempDir, "userdata-signing.pub")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	key, err = loadVerificationKey(keyPath)
+	if err != nil {
+		t.Fatalf("failed to load key: %v", err)
+	}
+	if !bytes.Equal(key, pub) {
+		t.Fatalf("loaded key does not match")
+	}
+}
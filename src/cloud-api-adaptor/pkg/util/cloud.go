@@ -5,10 +5,15 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-api-adaptor/pkg/initdata"
 	cri "github.com/containerd/containerd/pkg/cri/annotations"
 	hypannotations "github.com/kata-containers/kata-containers/src/runtime/virtcontainers/pkg/annotations"
 )
 
+// RootDiskSizeAnnotation is the root disk size of the pod VM in GiB, set by
+// the peer pods webhook from the ephemeral storage of the pod
+const RootDiskSizeAnnotation = "kata.peerpods.io.root_disk_size"
+
 func GetPodName(annotations map[string]string) string {
 
 	sandboxName := annotations[cri.SandboxName]
@@ -69,9 +74,26 @@ func GetCPUAndMemoryFromAnnotation(annotations map[string]string) (int64, int64)
 	return vcpuInt, memoryInt
 }
 
+// Method to get the root disk size in GiB from annotations
+func GetRootDiskSizeFromAnnotation(annotations map[string]string) int64 {
+
+	size, ok := annotations[RootDiskSizeAnnotation]
+	if !ok {
+		return 0
+	}
+
+	sizeInt, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || sizeInt < 0 {
+		fmt.Printf("Error converting root disk size %q to a positive int64. Defaulting to 0: %v\n", size, err)
+		return 0
+	}
+
+	return sizeInt
+}
+
 // Method to get initdata from annotation
 func GetInitdataFromAnnotation(annotations map[string]string) string {
-	return annotations["io.katacontainers.config.runtime.cc_init_data"]
+	return annotations[initdata.AnnotationKey]
 }
 
 // Method to check if a string exists in a slice
@@ -114,3 +114,39 @@ func TestGetInstanceTypeFromAnnotation(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRootDiskSizeFromAnnotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        int64
+	}{
+		{
+			name:        "root disk size",
+			annotations: map[string]string{RootDiskSizeAnnotation: "50"},
+			want:        50,
+		},
+		{
+			name:        "no root disk size",
+			annotations: map[string]string{hypannotations.MachineType: "t2.small"},
+			want:        0,
+		},
+		{
+			name:        "invalid root disk size",
+			annotations: map[string]string{RootDiskSizeAnnotation: "50Gi"},
+			want:        0,
+		},
+		{
+			name:        "negative root disk size",
+			annotations: map[string]string{RootDiskSizeAnnotation: "-1"},
+			want:        0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetRootDiskSizeFromAnnotation(tt.annotations); got != tt.want {
+				t.Errorf("GetRootDiskSizeFromAnnotation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -11,10 +11,30 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/servicequotas"
 )
 
 // TODO: Use IAM role
 func NewEC2Client(cloudCfg Config) (*ec2.Client, error) {
+	cfg, err := loadConfig(cloudCfg)
+	if err != nil {
+		return nil, err
+	}
+	client := ec2.NewFromConfig(cfg)
+	return client, nil
+}
+
+// NewServiceQuotasClient creates a Service Quotas client with the credentials
+// of the EC2 client
+func NewServiceQuotasClient(cloudCfg Config) (*servicequotas.Client, error) {
+	cfg, err := loadConfig(cloudCfg)
+	if err != nil {
+		return nil, err
+	}
+	return servicequotas.NewFromConfig(cfg), nil
+}
+
+func loadConfig(cloudCfg Config) (aws.Config, error) {
 
 	var cfg aws.Config
 	var err error
@@ -23,7 +43,7 @@ func NewEC2Client(cloudCfg Config) (*ec2.Client, error) {
 		cfg, err = config.LoadDefaultConfig(context.TODO(),
 			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cloudCfg.AccessKeyId, cloudCfg.SecretKey, "")), config.WithRegion(cloudCfg.Region))
 		if err != nil {
-			return nil, fmt.Errorf("configuration error when using creds: %s", err)
+			return cfg, fmt.Errorf("configuration error when using creds: %s", err)
 		}
 
 	} else {
@@ -32,9 +52,8 @@ func NewEC2Client(cloudCfg Config) (*ec2.Client, error) {
 			config.WithRegion(cloudCfg.Region),
 			config.WithSharedConfigProfile(cloudCfg.LoginProfile))
 		if err != nil {
-			return nil, fmt.Errorf("configuration error when using shared profile: %s", err)
+			return cfg, fmt.Errorf("configuration error when using shared profile: %s", err)
 		}
 	}
-	client := ec2.NewFromConfig(cfg)
-	return client, nil
+	return cfg, nil
 }
@@ -22,7 +22,7 @@ func (_ *Manager) ParseCmd(flags *flag.FlagSet) {
 	flags.StringVar(&awscfg.AccessKeyId, "aws-access-key-id", "", "Access Key ID, defaults to `AWS_ACCESS_KEY_ID`")
 	flags.StringVar(&awscfg.SecretKey, "aws-secret-key", "", "Secret Key, defaults to `AWS_SECRET_ACCESS_KEY`")
 	flags.StringVar(&awscfg.Region, "aws-region", "", "Region")
-	flags.StringVar(&awscfg.LoginProfile, "aws-profile", "", "AWS Login Profile")
+	flags.StringVar(&awscfg.LoginProfile, "aws-profile", "", "AWS Login Profile, defaults to `AWS_PROFILE`")
 	flags.StringVar(&awscfg.LaunchTemplateName, "aws-lt-name", "kata", "AWS Launch Template Name")
 	flags.BoolVar(&awscfg.UseLaunchTemplate, "use-lt", false, "Use EC2 Launch Template for the Pod VMs")
 	flags.StringVar(&awscfg.ImageId, "imageid", "", "Pod VM ami id")
@@ -39,19 +39,50 @@ func (_ *Manager) ParseCmd(flags *flag.FlagSet) {
 	// Default is 30GiBs for free tier. Hence use it as default
 	flags.IntVar(&awscfg.RootVolumeSize, "root-volume-size", 30, "Root volume size (in GiB) for the Pod VMs")
 	flags.BoolVar(&awscfg.DisableCVM, "disable-cvm", false, "Use non-CVMs for peer pods")
+	flags.StringVar(&awscfg.ClusterID, "cluster-id", "", "Cluster ID tagged on the Pod VMs to allow garbage collection of orphaned instances, defaults to `PEERPODS_CLUSTER_ID`")
 
 }
 
 func (_ *Manager) LoadEnv() {
-	provider.DefaultToEnv(&awscfg.AccessKeyId, "AWS_ACCESS_KEY_ID", "")
-	provider.DefaultToEnv(&awscfg.SecretKey, "AWS_SECRET_ACCESS_KEY", "")
-	provider.DefaultToEnv(&awscfg.InstanceType, "PODVM_INSTANCE_TYPE", "m6a.large")
+	loadEnv(&awscfg, provider.DefaultToEnv)
+}
+
+func loadEnv(cfg *Config, load provider.EnvLoadFunc) {
+	load(&cfg.AccessKeyId, "AWS_ACCESS_KEY_ID", "")
+	load(&cfg.SecretKey, "AWS_SECRET_ACCESS_KEY", "")
+	load(&cfg.Region, "AWS_REGION", "")
+	load(&cfg.LoginProfile, "AWS_PROFILE", "")
+	load(&cfg.ImageId, "PODVM_AMI_ID", "")
+	load(&cfg.InstanceType, "PODVM_INSTANCE_TYPE", "m6a.large")
+	provider.LoadListFromEnv(load, (*[]string)(&cfg.InstanceTypes), "PODVM_INSTANCE_TYPES")
+	provider.LoadListFromEnv(load, (*[]string)(&cfg.SecurityGroupIds), "AWS_SG_IDS")
+	load(&cfg.KeyName, "SSH_KP_NAME", "")
+	load(&cfg.SubnetId, "AWS_SUBNET_ID", "")
+	provider.LoadTagsFromEnv(load, &cfg.Tags, "TAGS")
+	provider.LoadBoolFromEnv(load, &cfg.UsePublicIP, "USE_PUBLIC_IP")
+	provider.LoadIntFromEnv(load, &cfg.RootVolumeSize, "ROOT_VOLUME_SIZE")
+	provider.LoadBoolFromEnv(load, &cfg.DisableCVM, "DISABLECVM")
+	load(&cfg.ClusterID, "PEERPODS_CLUSTER_ID", "")
+
+	// Setting a launch template enables its use, as in entrypoint.sh
+	var launchTemplate string
+	load(&launchTemplate, "PODVM_LAUNCHTEMPLATE_NAME", "")
+	if launchTemplate != "" {
+		cfg.LaunchTemplateName = launchTemplate
+		cfg.UseLaunchTemplate = true
+	}
 }
 
 func (_ *Manager) NewProvider() (provider.Provider, error) {
 	return NewProvider(&awscfg)
 }
 
+func (_ *Manager) NewProviderWithEnv(env map[string]string) (provider.Provider, error) {
+	cfg := awscfg
+	loadEnv(&cfg, provider.OverrideFromEnv(env))
+	return NewProvider(&cfg)
+}
+
 func (_ *Manager) GetConfig() (config *Config) {
 	return &awscfg
 }
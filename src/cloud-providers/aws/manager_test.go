@@ -7,6 +7,8 @@ import (
 	"flag"
 	"fmt"
 	"testing"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 )
 
 func TestManager_ParseCmd(t *testing.T) {
@@ -34,6 +36,7 @@ func TestManager_ParseCmd(t *testing.T) {
 				"-tags=key1=value1,key2=value2",
 				"-root-volume-size=60",
 				"-disable-cvm=false",
+				"-cluster-id=test-cluster",
 			},
 			expected: Config{
 				AccessKeyId:        "test-access-key",
@@ -52,6 +55,7 @@ func TestManager_ParseCmd(t *testing.T) {
 				UsePublicIP:        true,
 				RootVolumeSize:     60,
 				DisableCVM:         false,
+				ClusterID:          "test-cluster",
 			},
 		},
 		{
@@ -233,6 +237,48 @@ func comparestructs(expected, actual Config) bool {
 		fmt.Printf("Expected DisableCVM: %t, but got: %t\n", expected.DisableCVM, actual.DisableCVM)
 		return false
 	}
+	if expected.ClusterID != actual.ClusterID {
+		// Print the expected and actual values to the console if they do not match
+		fmt.Printf("Expected ClusterID: %s, but got: %s\n", expected.ClusterID, actual.ClusterID)
+		return false
+	}
 
 	return true
 }
+
+func TestLoadEnvProfile(t *testing.T) {
+	cfg := Config{
+		Region:         "eu-west-1",
+		ImageId:        "ami-default",
+		InstanceType:   "m6a.large",
+		RootVolumeSize: 30,
+	}
+
+	// The aws-us-east profile of docs/provider-profiles.md
+	profile := map[string]string{
+		"CLOUD_PROVIDER":        "aws",
+		"AWS_REGION":            "us-east-1",
+		"AWS_ACCESS_KEY_ID":     "access-key",
+		"AWS_SECRET_ACCESS_KEY": "secret-key",
+		"PODVM_AMI_ID":          "ami-us-east",
+		"AWS_SG_IDS":            "sg-1,sg-2",
+		"TAGS":                  "team=a",
+		"USE_PUBLIC_IP":         "true",
+		"ROOT_VOLUME_SIZE":      "60",
+	}
+	loadEnv(&cfg, provider.OverrideFromEnv(profile))
+
+	if cfg.Region != "us-east-1" || cfg.ImageId != "ami-us-east" {
+		t.Errorf("Expected the region and image of the profile, got %q and %q", cfg.Region, cfg.ImageId)
+	}
+	if cfg.AccessKeyId != "access-key" || cfg.SecretKey != "secret-key" {
+		t.Errorf("Expected the credentials of the profile, got %+v", cfg.Redact())
+	}
+	if len(cfg.SecurityGroupIds) != 2 || cfg.Tags["team"] != "a" || !cfg.UsePublicIP || cfg.RootVolumeSize != 60 {
+		t.Errorf("Expected the options of the profile, got %+v", cfg.Redact())
+	}
+	// Variables that the profile doesn't set keep their value
+	if cfg.InstanceType != "m6a.large" || cfg.UseLaunchTemplate {
+		t.Errorf("Expected the default instance type without launch template, got %+v", cfg.Redact())
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
 
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
@@ -49,6 +50,10 @@ type ec2Client interface {
 	DescribeImages(ctx context.Context,
 		params *ec2.DescribeImagesInput,
 		optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error)
+	// Add GetConsoleOutput method
+	GetConsoleOutput(ctx context.Context,
+		params *ec2.GetConsoleOutputInput,
+		optFns ...func(*ec2.Options)) (*ec2.GetConsoleOutputOutput, error)
 }
 
 // Make instanceRunningWaiter as an interface
@@ -64,6 +69,7 @@ type awsProvider struct {
 	ec2Client ec2Client
 	// Make waiter a mockable interface
 	waiter        instanceRunningWaiter
+	quotasClient  quotasClient
 	serviceConfig *Config
 }
 
@@ -82,9 +88,15 @@ func NewProvider(config *Config) (provider.Provider, error) {
 
 	waiter := ec2.NewInstanceRunningWaiter(ec2Client)
 
+	quotasClient, err := NewServiceQuotasClient(*config)
+	if err != nil {
+		return nil, err
+	}
+
 	provider := &awsProvider{
 		ec2Client:     ec2Client,
 		waiter:        waiter,
+		quotasClient:  quotasClient,
 		serviceConfig: config,
 	}
 
@@ -173,6 +185,23 @@ func (p *awsProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 		})
 	}
 
+	// Add ownership tags so that orphaned instances can be garbage collected
+	ownershipTags := provider.OwnershipTags(p.serviceConfig.ClusterID, podName, spec.PodNamespace)
+	for k, v := range ownershipTags {
+		instanceTags = append(instanceTags, types.Tag{
+			Key:   aws.String(k),
+			Value: aws.String(v),
+		})
+	}
+
+	// Add tags derived from the pod metadata
+	for k, v := range provider.PodTags(spec, map[string]string{"Name": instanceName}, p.serviceConfig.Tags, ownershipTags) {
+		instanceTags = append(instanceTags, types.Tag{
+			Key:   aws.String(k),
+			Value: aws.String(v),
+		})
+	}
+
 	// Create TagSpecifications for the instance
 	tagSpecifications := []types.TagSpecification{
 		{
@@ -243,13 +272,18 @@ func (p *awsProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 
 	}
 
+	rootDeviceName, rootVolumeSize, err := p.rootVolume(spec)
+	if err != nil {
+		return nil, err
+	}
+
 	// Add block device mappings to the instance to set the root volume size
-	if p.serviceConfig.RootVolumeSize > 0 {
+	if rootVolumeSize > 0 {
 		input.BlockDeviceMappings = []types.BlockDeviceMapping{
 			{
-				DeviceName: aws.String(p.serviceConfig.RootDeviceName),
+				DeviceName: aws.String(rootDeviceName),
 				Ebs: &types.EbsBlockDevice{
-					VolumeSize: aws.Int32(int32(p.serviceConfig.RootVolumeSize)),
+					VolumeSize: aws.Int32(int32(rootVolumeSize)),
 				},
 			},
 		}
@@ -286,14 +320,23 @@ func (p *awsProvider) CreateInstance(ctx context.Context, podName, sandboxID str
 	}
 
 	instance := &provider.Instance{
-		ID:   instanceID,
-		Name: instanceName,
-		IPs:  ips,
+		ID:      instanceID,
+		Name:    instanceName,
+		IPs:     ips,
+		Type:    instanceType,
+		ImageID: p.serviceConfig.ImageId,
 	}
 
 	return instance, nil
 }
 
+// AWS limits the userData to 16KB before it is base64 encoded
+const maxUserDataSize = 16384
+
+func (p *awsProvider) UserDataLimit() int {
+	return maxUserDataSize
+}
+
 func (p *awsProvider) DeleteInstance(ctx context.Context, instanceID string) error {
 	terminateInput := &ec2.TerminateInstancesInput{
 		InstanceIds: []string{
@@ -305,6 +348,10 @@ func (p *awsProvider) DeleteInstance(ctx context.Context, instanceID string) err
 
 	resp, err := p.ec2Client.TerminateInstances(ctx, terminateInput)
 
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidInstanceID.NotFound" {
+		return fmt.Errorf("%w: %s", provider.ErrInstanceNotFound, instanceID)
+	}
 	if err != nil {
 		logger.Printf("failed to delete an instance: %v and the response is %v", err, resp)
 		return err
@@ -314,6 +361,64 @@ func (p *awsProvider) DeleteInstance(ctx context.Context, instanceID string) err
 
 }
 
+// ConsoleOutput returns the latest serial console output of an instance
+func (p *awsProvider) ConsoleOutput(ctx context.Context, instanceID string) ([]byte, error) {
+	result, err := p.ec2Client.GetConsoleOutput(ctx, &ec2.GetConsoleOutputInput{
+		InstanceId: aws.String(instanceID),
+		Latest:     aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting console output of instance %s: %w", instanceID, err)
+	}
+	if result.Output == nil {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(*result.Output)
+}
+
+// ListInstances returns the instances tagged with the given cluster ID that are not terminated
+func (p *awsProvider) ListInstances(ctx context.Context, clusterID string) ([]*provider.Instance, error) {
+	input := &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("tag:" + provider.ClusterIDTagKey),
+				Values: []string{clusterID},
+			},
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"pending", "running", "stopping", "stopped"},
+			},
+		},
+	}
+
+	var instances []*provider.Instance
+	paginator := ec2.NewDescribeInstancesPaginator(p.ec2Client, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing instances of cluster %q: %w", clusterID, err)
+		}
+		for _, reservation := range output.Reservations {
+			for _, inst := range reservation.Instances {
+				instance := &provider.Instance{
+					ID:   aws.ToString(inst.InstanceId),
+					Tags: make(map[string]string),
+				}
+				for _, tag := range inst.Tags {
+					instance.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+				}
+				instance.Name = instance.Tags["Name"]
+				if inst.LaunchTime != nil {
+					instance.CreatedAt = *inst.LaunchTime
+				}
+				instances = append(instances, instance)
+			}
+		}
+	}
+
+	return instances, nil
+}
+
 func (p *awsProvider) Teardown() error {
 	return nil
 }
@@ -332,6 +437,15 @@ func (p *awsProvider) selectInstanceType(ctx context.Context, spec provider.Inst
 	return provider.SelectInstanceTypeToUse(spec, p.serviceConfig.InstanceTypeSpecList, p.serviceConfig.InstanceTypes, p.serviceConfig.InstanceType)
 }
 
+// InstanceCatalog implements provider.CatalogReporter
+func (p *awsProvider) InstanceCatalog() provider.InstanceCatalog {
+	return provider.InstanceCatalog{
+		DefaultInstanceType: p.serviceConfig.InstanceType,
+		InstanceTypes:       p.serviceConfig.InstanceTypes,
+		Specs:               p.serviceConfig.InstanceTypeSpecList,
+	}
+}
+
 // Add a method to populate InstanceTypeSpecList for all the instanceTypes
 func (p *awsProvider) updateInstanceTypeSpecList() error {
 
@@ -348,11 +462,11 @@ func (p *awsProvider) updateInstanceTypeSpecList() error {
 
 	// Iterate over the instance types and populate the instanceTypeSpecList
 	for _, instanceType := range instanceTypes {
-		vcpus, memory, err := p.getInstanceTypeInformation(instanceType)
+		vcpus, memory, gpus, err := p.getInstanceTypeInformation(instanceType)
 		if err != nil {
 			return err
 		}
-		instanceTypeSpecList = append(instanceTypeSpecList, provider.InstanceTypeSpec{InstanceType: instanceType, VCPUs: vcpus, Memory: memory})
+		instanceTypeSpecList = append(instanceTypeSpecList, provider.InstanceTypeSpec{InstanceType: instanceType, VCPUs: vcpus, Memory: memory, GPUs: gpus})
 	}
 
 	// Sort the instanceTypeSpecList by Memory and update the serviceConfig
@@ -361,8 +475,8 @@ func (p *awsProvider) updateInstanceTypeSpecList() error {
 	return nil
 }
 
-// Add a method to retrieve cpu, memory, and storage from the instance type
-func (p *awsProvider) getInstanceTypeInformation(instanceType string) (vcpu int64, memory int64, err error) {
+// Add a method to retrieve cpu, memory, and gpus from the instance type
+func (p *awsProvider) getInstanceTypeInformation(instanceType string) (vcpu int64, memory int64, gpus int64, err error) {
 
 	// Get the instance type information from the instance type using AWS API
 	input := &ec2.DescribeInstanceTypesInput{
@@ -373,16 +487,23 @@ func (p *awsProvider) getInstanceTypeInformation(instanceType string) (vcpu int6
 	// Get the instance type information from the instance type using AWS API
 	result, err := p.ec2Client.DescribeInstanceTypes(context.Background(), input)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, 0, err
 	}
 
-	// Get the vcpu and memory from the result
+	// Get the vcpu, memory and gpus from the result
 	if len(result.InstanceTypes) > 0 {
 		vcpu = int64(*result.InstanceTypes[0].VCpuInfo.DefaultVCpus)
 		memory = int64(*result.InstanceTypes[0].MemoryInfo.SizeInMiB)
-		return vcpu, memory, nil
+		if gpuInfo := result.InstanceTypes[0].GpuInfo; gpuInfo != nil {
+			for _, gpu := range gpuInfo.Gpus {
+				if gpu.Count != nil {
+					gpus += int64(*gpu.Count)
+				}
+			}
+		}
+		return vcpu, memory, gpus, nil
 	}
-	return 0, 0, fmt.Errorf("instance type %s not found", instanceType)
+	return 0, 0, 0, fmt.Errorf("instance type %s not found", instanceType)
 
 }
 
@@ -435,6 +556,34 @@ func (p *awsProvider) getPublicIP(ctx context.Context, instanceID string) (netip
 	return publicIPAddr, nil
 }
 
+// rootVolume returns the root device name and the root volume size in GiB of
+// a pod VM, zero to keep the size of the image. The size requested by the pod
+// is used when it is larger than the configured size, which is at least the
+// size of the image.
+func (p *awsProvider) rootVolume(spec provider.InstanceTypeSpec) (string, int, error) {
+	if spec.RootDiskSize <= int64(p.serviceConfig.RootVolumeSize) {
+		return p.serviceConfig.RootDeviceName, p.serviceConfig.RootVolumeSize, nil
+	}
+	if p.serviceConfig.RootDeviceName != "" {
+		return p.serviceConfig.RootDeviceName, int(spec.RootDiskSize), nil
+	}
+
+	// The root device of the image is only looked up at startup when a root
+	// volume size is configured
+	if p.serviceConfig.ImageId == "" {
+		logger.Printf("the image of the launch template is unknown, ignoring the root volume size %d of the pod", spec.RootDiskSize)
+		return "", 0, nil
+	}
+	deviceName, deviceSize, err := p.getDeviceNameAndSize(p.serviceConfig.ImageId)
+	if err != nil {
+		return "", 0, err
+	}
+	if spec.RootDiskSize <= int64(deviceSize) {
+		return "", 0, nil
+	}
+	return deviceName, int(spec.RootDiskSize), nil
+}
+
 func (p *awsProvider) getDeviceNameAndSize(imageID string) (string, int32, error) {
 	// Add describe images input
 	describeImagesInput := &ec2.DescribeImagesInput{
@@ -5,6 +5,8 @@ package aws
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/netip"
 	"reflect"
@@ -14,6 +16,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 )
@@ -58,6 +61,10 @@ func (m mockEC2Client) TerminateInstances(ctx context.Context,
 	params *ec2.TerminateInstancesInput,
 	optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
 
+	if params.InstanceIds[0] == "i-unknown" {
+		return nil, &smithy.GenericAPIError{Code: "InvalidInstanceID.NotFound", Message: "instance not found"}
+	}
+
 	// Return a mock TerminateInstancesOutput
 	return &ec2.TerminateInstancesOutput{}, nil
 }
@@ -106,6 +113,13 @@ func (m mockEC2Client) DescribeInstances(ctx context.Context,
 				Instances: []types.Instance{
 					{
 						InstanceId: &mockInstanceID,
+						// Add launch time and tags to mock instance
+						LaunchTime: aws.Time(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+						Tags: []types.Tag{
+							{Key: aws.String("Name"), Value: aws.String("podvm-test-12345678")},
+							{Key: aws.String(provider.ClusterIDTagKey), Value: aws.String("test-cluster")},
+							{Key: aws.String(provider.PodNameTagKey), Value: aws.String("test")},
+						},
 						// Add private IP address to mock instance
 						PrivateIpAddress: aws.String("10.0.0.2"),
 						// Add private IP address to network interface
@@ -151,12 +165,31 @@ func (m mockEC2Client) DescribeImages(ctx context.Context,
 	return &ec2.DescribeImagesOutput{
 		Images: []types.Image{
 			{
-				ImageId: &mockImageID,
+				ImageId:        &mockImageID,
+				RootDeviceName: aws.String("/dev/xvda"),
+				BlockDeviceMappings: []types.BlockDeviceMapping{
+					{
+						DeviceName: aws.String("/dev/xvda"),
+						Ebs:        &types.EbsBlockDevice{VolumeSize: aws.Int32(8)},
+					},
+				},
 			},
 		},
 	}, nil
 }
 
+// Create a mock EC2 GetConsoleOutput method
+func (m mockEC2Client) GetConsoleOutput(ctx context.Context,
+	params *ec2.GetConsoleOutputInput,
+	optFns ...func(*ec2.Options)) (*ec2.GetConsoleOutputOutput, error) {
+
+	output := base64.StdEncoding.EncodeToString([]byte("console of " + *params.InstanceId))
+	return &ec2.GetConsoleOutputOutput{
+		InstanceId: params.InstanceId,
+		Output:     &output,
+	}, nil
+}
+
 // Create a serviceConfig struct without public IP
 var serviceConfig = &Config{
 	Region: "us-east-1",
@@ -280,9 +313,11 @@ func TestCreateInstance(t *testing.T) {
 				spec:        provider.InstanceTypeSpec{InstanceType: "t2.small"},
 			},
 			want: &provider.Instance{
-				ID:   "i-1234567890abcdef0",
-				Name: "podvm-podtest-123",
-				IPs:  []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+				ID:      "i-1234567890abcdef0",
+				Name:    "podvm-podtest-123",
+				IPs:     []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+				Type:    "t2.small",
+				ImageID: "ami-1234567890abcdef0",
 			},
 			// Test should not return an error
 			wantErr: false,
@@ -307,9 +342,11 @@ func TestCreateInstance(t *testing.T) {
 				spec:        provider.InstanceTypeSpec{InstanceType: "t2.small"},
 			},
 			want: &provider.Instance{
-				ID:   "i-1234567890abcdef0",
-				Name: "podvm-podpublicip-123",
-				IPs:  []netip.Addr{netip.MustParseAddr("192.168.100.1")},
+				ID:      "i-1234567890abcdef0",
+				Name:    "podvm-podpublicip-123",
+				IPs:     []netip.Addr{netip.MustParseAddr("192.168.100.1")},
+				Type:    "t2.small",
+				ImageID: "ami-1234567890abcdef0",
 			},
 			// Test should not return an error
 			wantErr: false,
@@ -380,9 +417,11 @@ func TestCreateInstance(t *testing.T) {
 				spec:        provider.InstanceTypeSpec{InstanceType: ""},
 			},
 			want: &provider.Instance{
-				ID:   "i-1234567890abcdef0",
-				Name: "podvm-podemptyinstance-123",
-				IPs:  []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+				ID:      "i-1234567890abcdef0",
+				Name:    "podvm-podemptyinstance-123",
+				IPs:     []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+				Type:    "t2.small",
+				ImageID: "ami-1234567890abcdef0",
 			},
 			// Test should not return an error
 			wantErr: false,
@@ -408,9 +447,11 @@ func TestCreateInstance(t *testing.T) {
 				spec:        provider.InstanceTypeSpec{InstanceType: ""},
 			},
 			want: &provider.Instance{
-				ID:   "i-1234567890abcdef0",
-				Name: "podvm-podemptyinstance-123",
-				IPs:  []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+				ID:      "i-1234567890abcdef0",
+				Name:    "podvm-podemptyinstance-123",
+				IPs:     []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+				Type:    "t2.small",
+				ImageID: "ami-1234567890abcdef0",
 			},
 			// Test should not return an error
 			wantErr: false,
@@ -448,10 +489,11 @@ func TestDeleteInstance(t *testing.T) {
 		instanceID string
 	}
 	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		wantErr bool
+		name         string
+		fields       fields
+		args         args
+		wantErr      bool
+		wantNotFound bool
 	}{
 		// Test deleting an instance
 		{
@@ -467,6 +509,21 @@ func TestDeleteInstance(t *testing.T) {
 			// Test should not return an error
 			wantErr: false,
 		},
+		// Test deleting an instance that doesn't exist
+		{
+			name: "DeleteMissingInstance",
+			fields: fields{
+				ec2Client:     newMockEC2Client(),
+				serviceConfig: serviceConfig,
+			},
+			args: args{
+				ctx:        context.Background(),
+				instanceID: "i-unknown",
+			},
+			// Test should return ErrInstanceNotFound
+			wantErr:      true,
+			wantNotFound: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -474,9 +531,99 @@ func TestDeleteInstance(t *testing.T) {
 				ec2Client:     tt.fields.ec2Client,
 				serviceConfig: tt.fields.serviceConfig,
 			}
-			if err := p.DeleteInstance(tt.args.ctx, tt.args.instanceID); (err != nil) != tt.wantErr {
+			err := p.DeleteInstance(tt.args.ctx, tt.args.instanceID)
+			if (err != nil) != tt.wantErr {
 				t.Errorf("awsProvider.DeleteInstance() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if errors.Is(err, provider.ErrInstanceNotFound) != tt.wantNotFound {
+				t.Errorf("awsProvider.DeleteInstance() error = %v, wantNotFound %v", err, tt.wantNotFound)
+			}
+		})
+	}
+}
+
+func TestListInstances(t *testing.T) {
+	p := &awsProvider{
+		ec2Client:     newMockEC2Client(),
+		serviceConfig: serviceConfig,
+	}
+
+	instances, err := p.ListInstances(context.Background(), "test-cluster")
+	if err != nil {
+		t.Fatalf("awsProvider.ListInstances() error = %v", err)
+	}
+
+	want := []*provider.Instance{
+		{
+			ID:   "i-1234567890abcdef0",
+			Name: "podvm-test-12345678",
+			Tags: map[string]string{
+				"Name":                   "podvm-test-12345678",
+				provider.ClusterIDTagKey: "test-cluster",
+				provider.PodNameTagKey:   "test",
+			},
+			CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	if !reflect.DeepEqual(instances, want) {
+		t.Errorf("awsProvider.ListInstances() = %v, want %v", instances, want)
+	}
+}
+
+func TestRootVolume(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		diskSize   int64
+		wantDevice string
+		wantSize   int
+	}{
+		{
+			name:       "configured size",
+			config:     &Config{ImageId: "ami-1234567890abcdef0", RootVolumeSize: 30, RootDeviceName: "/dev/sda1"},
+			diskSize:   20,
+			wantDevice: "/dev/sda1",
+			wantSize:   30,
+		},
+		{
+			name:       "pod size larger than the configured size",
+			config:     &Config{ImageId: "ami-1234567890abcdef0", RootVolumeSize: 30, RootDeviceName: "/dev/sda1"},
+			diskSize:   50,
+			wantDevice: "/dev/sda1",
+			wantSize:   50,
+		},
+		{
+			name:   "size of the image",
+			config: &Config{ImageId: "ami-1234567890abcdef0"},
+		},
+		{
+			name:     "pod size smaller than the image",
+			config:   &Config{ImageId: "ami-1234567890abcdef0"},
+			diskSize: 4,
+		},
+		{
+			name:       "pod size larger than the image",
+			config:     &Config{ImageId: "ami-1234567890abcdef0"},
+			diskSize:   20,
+			wantDevice: "/dev/xvda",
+			wantSize:   20,
+		},
+		{
+			name:     "launch template",
+			config:   &Config{UseLaunchTemplate: true, LaunchTemplateName: "template"},
+			diskSize: 20,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &awsProvider{ec2Client: newMockEC2Client(), serviceConfig: tt.config}
+			device, size, err := p.rootVolume(provider.InstanceTypeSpec{RootDiskSize: tt.diskSize})
+			if err != nil {
+				t.Fatalf("awsProvider.rootVolume() error = %v", err)
+			}
+			if device != tt.wantDevice || size != tt.wantSize {
+				t.Errorf("awsProvider.rootVolume() = %s, %d, want %s, %d", device, size, tt.wantDevice, tt.wantSize)
+			}
 		})
 	}
 }
@@ -495,6 +642,7 @@ func TestGetInstanceTypeInformation(t *testing.T) {
 		args       args
 		wantVcpu   int64
 		wantMemory int64
+		wantGPUs   int64
 		wantErr    bool
 	}{
 		// Test getting instance type information for a valid instance type
@@ -509,6 +657,7 @@ func TestGetInstanceTypeInformation(t *testing.T) {
 			},
 			wantVcpu:   2,
 			wantMemory: 4096,
+			wantGPUs:   0,
 			// Test should not return an error
 			wantErr: false,
 		},
@@ -534,7 +683,7 @@ func TestGetInstanceTypeInformation(t *testing.T) {
 				ec2Client:     tt.fields.ec2Client,
 				serviceConfig: tt.fields.serviceConfig,
 			}
-			gotVcpu, gotMemory, err := p.getInstanceTypeInformation(tt.args.instanceType)
+			gotVcpu, gotMemory, gotGPUs, err := p.getInstanceTypeInformation(tt.args.instanceType)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("awsProvider.getInstanceTypeInformation() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -545,10 +694,27 @@ func TestGetInstanceTypeInformation(t *testing.T) {
 			if gotMemory != tt.wantMemory {
 				t.Errorf("awsProvider.getInstanceTypeInformation() gotMemory = %v, want %v", gotMemory, tt.wantMemory)
 			}
+			if gotGPUs != tt.wantGPUs {
+				t.Errorf("awsProvider.getInstanceTypeInformation() gotGPUs = %v, want %v", gotGPUs, tt.wantGPUs)
+			}
 		})
 	}
 }
 
+func TestConsoleOutput(t *testing.T) {
+	p := &awsProvider{
+		ec2Client:     newMockEC2Client(),
+		serviceConfig: serviceConfig,
+	}
+	output, err := p.ConsoleOutput(context.Background(), "i-1234567890abcdef0")
+	if err != nil {
+		t.Fatalf("ConsoleOutput() error = %v", err)
+	}
+	if string(output) != "console of i-1234567890abcdef0" {
+		t.Errorf("ConsoleOutput() = %q", output)
+	}
+}
+
 func TestConfigVerifier(t *testing.T) {
 	type fields struct {
 		serviceConfig *Config
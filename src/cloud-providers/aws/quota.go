@@ -0,0 +1,156 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/servicequotas"
+)
+
+// Make quotasClient a mockable interface
+type quotasClient interface {
+	GetServiceQuota(ctx context.Context,
+		params *servicequotas.GetServiceQuotaInput,
+		optFns ...func(*servicequotas.Options)) (*servicequotas.GetServiceQuotaOutput, error)
+}
+
+const standardVCPUsQuota = "L-1216C47A"
+
+// vcpuQuotaCodes maps the instance families to the code of their "Running
+// On-Demand instances" vCPUs quota. Families not listed here are looked up by
+// their first letter.
+var vcpuQuotaCodes = map[string]string{
+	"a":   standardVCPUsQuota,
+	"c":   standardVCPUsQuota,
+	"d":   standardVCPUsQuota,
+	"h":   standardVCPUsQuota,
+	"i":   standardVCPUsQuota,
+	"m":   standardVCPUsQuota,
+	"r":   standardVCPUsQuota,
+	"t":   standardVCPUsQuota,
+	"z":   standardVCPUsQuota,
+	"f":   "L-74FC7D96",
+	"g":   "L-DB2E81BA",
+	"vt":  "L-DB2E81BA",
+	"p":   "L-417A185B",
+	"x":   "L-7295265B",
+	"u":   "L-43DA4232",
+	"inf": "L-1945791B",
+	"dl":  "L-6E869C2A",
+	"trn": "L-2C3B7624",
+	"hpc": "L-F7808C92",
+}
+
+// vcpuQuotaCode returns the code of the vCPUs quota counting instanceType,
+// e.g. L-1216C47A for m5.large
+func vcpuQuotaCode(instanceType string) (string, bool) {
+	family := strings.ToLower(instanceType)
+	if i := strings.IndexFunc(family, func(r rune) bool { return r < 'a' || r > 'z' }); i >= 0 {
+		family = family[:i]
+	}
+	if family == "" {
+		return "", false
+	}
+	if code, ok := vcpuQuotaCodes[family]; ok {
+		return code, true
+	}
+	code, ok := vcpuQuotaCodes[family[:1]]
+	return code, ok
+}
+
+// AvailableInstances returns how many more instances of the default instance
+// type fit in the regional vCPUs quota of its family, for On-Demand instances
+func (p *awsProvider) AvailableInstances(ctx context.Context) (int64, error) {
+	instanceType := p.serviceConfig.InstanceType
+	quotaCode, ok := vcpuQuotaCode(instanceType)
+	if !ok {
+		return 0, fmt.Errorf("no vCPUs quota known for instance type %q", instanceType)
+	}
+
+	vcpus, err := p.instanceTypeVCPUs(instanceType)
+	if err != nil {
+		return 0, err
+	}
+
+	quota, err := p.quotasClient.GetServiceQuota(ctx, &servicequotas.GetServiceQuotaInput{
+		ServiceCode: aws.String("ec2"),
+		QuotaCode:   aws.String(quotaCode),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("getting the vCPUs quota %s: %w", quotaCode, err)
+	}
+	if quota.Quota == nil || quota.Quota.Value == nil {
+		return 0, fmt.Errorf("no value for the vCPUs quota %s", quotaCode)
+	}
+
+	used, err := p.runningVCPUs(ctx, quotaCode)
+	if err != nil {
+		return 0, err
+	}
+	return availableInstances(int64(*quota.Quota.Value), used, vcpus)
+}
+
+// availableInstances returns how many instances of vcpus fit in the quota left
+func availableInstances(limit, used, vcpus int64) (int64, error) {
+	if vcpus <= 0 {
+		return 0, fmt.Errorf("invalid number of vCPUs %d", vcpus)
+	}
+	left := limit - used
+	if left < 0 {
+		return 0, nil
+	}
+	return left / vcpus, nil
+}
+
+// instanceTypeVCPUs returns the number of vCPUs of an instance type
+func (p *awsProvider) instanceTypeVCPUs(instanceType string) (int64, error) {
+	for _, spec := range p.serviceConfig.InstanceTypeSpecList {
+		if spec.InstanceType == instanceType && spec.VCPUs > 0 {
+			return spec.VCPUs, nil
+		}
+	}
+	vcpus, _, _, err := p.getInstanceTypeInformation(instanceType)
+	return vcpus, err
+}
+
+// runningVCPUs returns the vCPUs of the On-Demand instances of the region
+// counted by the quota, whether they are pod VMs or not
+func (p *awsProvider) runningVCPUs(ctx context.Context, quotaCode string) (int64, error) {
+	input := &ec2.DescribeInstancesInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"pending", "running"},
+			},
+		},
+	}
+
+	var used int64
+	paginator := ec2.NewDescribeInstancesPaginator(p.ec2Client, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("listing the running instances: %w", err)
+		}
+		for _, reservation := range output.Reservations {
+			for _, inst := range reservation.Instances {
+				// Spot instances have their own quotas
+				if inst.InstanceLifecycle == types.InstanceLifecycleTypeSpot || inst.CpuOptions == nil {
+					continue
+				}
+				if code, ok := vcpuQuotaCode(string(inst.InstanceType)); !ok || code != quotaCode {
+					continue
+				}
+				used += int64(aws.ToInt32(inst.CpuOptions.CoreCount) * aws.ToInt32(inst.CpuOptions.ThreadsPerCore))
+			}
+		}
+	}
+	return used, nil
+}
@@ -0,0 +1,106 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/servicequotas"
+	sqtypes "github.com/aws/aws-sdk-go-v2/service/servicequotas/types"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+// Mock Service Quotas API
+type mockQuotasClient struct {
+	quotas map[string]float64
+}
+
+func (m *mockQuotasClient) GetServiceQuota(ctx context.Context,
+	params *servicequotas.GetServiceQuotaInput,
+	optFns ...func(*servicequotas.Options)) (*servicequotas.GetServiceQuotaOutput, error) {
+
+	value := m.quotas[aws.ToString(params.QuotaCode)]
+	return &servicequotas.GetServiceQuotaOutput{
+		Quota: &sqtypes.ServiceQuota{QuotaCode: params.QuotaCode, Value: &value},
+	}, nil
+}
+
+// Mock EC2 API returning the running instances of the region
+type runningEC2Client struct {
+	mockEC2Client
+	instances []types.Instance
+}
+
+func (m *runningEC2Client) DescribeInstances(ctx context.Context,
+	params *ec2.DescribeInstancesInput,
+	optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+
+	return &ec2.DescribeInstancesOutput{
+		Reservations: []types.Reservation{{Instances: m.instances}},
+	}, nil
+}
+
+func runningInstance(instanceType string, cores, threads int32, lifecycle types.InstanceLifecycleType) types.Instance {
+	return types.Instance{
+		InstanceType:      types.InstanceType(instanceType),
+		InstanceLifecycle: lifecycle,
+		CpuOptions:        &types.CpuOptions{CoreCount: aws.Int32(cores), ThreadsPerCore: aws.Int32(threads)},
+	}
+}
+
+func TestVCPUQuotaCode(t *testing.T) {
+	tests := map[string]string{
+		"t2.medium":    standardVCPUsQuota,
+		"m6a.xlarge":   standardVCPUsQuota,
+		"im4gn.large":  standardVCPUsQuota,
+		"g5.xlarge":    "L-DB2E81BA",
+		"inf2.xlarge":  "L-1945791B",
+		"u-6tb1.metal": "L-43DA4232",
+	}
+	for instanceType, want := range tests {
+		if code, ok := vcpuQuotaCode(instanceType); !ok || code != want {
+			t.Errorf("vcpuQuotaCode(%q) = %q, %v, want %q", instanceType, code, ok, want)
+		}
+	}
+	if code, ok := vcpuQuotaCode(""); ok {
+		t.Errorf("vcpuQuotaCode(\"\") = %q, want no quota", code)
+	}
+}
+
+func TestAvailableInstances(t *testing.T) {
+	p := &awsProvider{
+		ec2Client: &runningEC2Client{instances: []types.Instance{
+			// 8 vCPUs counted by the standard quota
+			runningInstance("m5.xlarge", 2, 2, ""),
+			runningInstance("c5.large", 2, 2, ""),
+			// Not counted by the standard quota
+			runningInstance("g5.xlarge", 2, 2, ""),
+			runningInstance("m5.xlarge", 2, 2, types.InstanceLifecycleTypeSpot),
+		}},
+		quotasClient: &mockQuotasClient{quotas: map[string]float64{standardVCPUsQuota: 32}},
+		serviceConfig: &Config{
+			InstanceType:         "t3.medium",
+			InstanceTypeSpecList: []provider.InstanceTypeSpec{{InstanceType: "t3.medium", VCPUs: 2, Memory: 4096}},
+		},
+	}
+
+	available, err := p.AvailableInstances(context.Background())
+	if err != nil {
+		t.Fatalf("AvailableInstances() error = %v", err)
+	}
+	if available != 12 {
+		t.Errorf("AvailableInstances() = %d, want 12", available)
+	}
+
+	// A quota already exceeded leaves no room
+	p.quotasClient = &mockQuotasClient{quotas: map[string]float64{standardVCPUsQuota: 4}}
+	if available, err := p.AvailableInstances(context.Background()); err != nil || available != 0 {
+		t.Errorf("AvailableInstances() = %d, %v, want 0", available, err)
+	}
+}
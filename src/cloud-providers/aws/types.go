@@ -55,6 +55,7 @@ type Config struct {
 	RootVolumeSize       int
 	RootDeviceName       string
 	DisableCVM           bool
+	ClusterID            string
 }
 
 func (c Config) Redact() Config {
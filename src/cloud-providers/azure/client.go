@@ -9,10 +9,15 @@ import (
 )
 
 func NewAzureClient(config Config) (azcore.TokenCredential, error) {
-	// Use workload identity if the client secret is empty.
+	// Use workload identity if the client secret is empty. The client and
+	// tenant are passed explicitly, since the reloaded ones are not in the
+	// process environment the SDK reads by default.
 	if config.ClientSecret == "" {
 		logger.Printf("using workload identity")
-		return azidentity.NewWorkloadIdentityCredential(nil)
+		return azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+			ClientID: config.ClientId,
+			TenantID: config.TenantId,
+		})
 	}
 
 	return azidentity.NewClientSecretCredential(config.TenantId, config.ClientId, config.ClientSecret, nil)
@@ -37,22 +37,44 @@ func (_ *Manager) ParseCmd(flags *flag.FlagSet) {
 	// Add a key value list parameter to indicate custom tags to be used for the Pod VMs
 	flags.Var(&azurecfg.Tags, "tags", "Custom tags (key=value pairs) to be used for the Pod VMs, comma separated")
 	flags.BoolVar(&azurecfg.EnableSecureBoot, "enable-secure-boot", false, "Enable secure boot for the VMs")
+	flags.IntVar(&azurecfg.RootVolumeSize, "root-volume-size", 0, "OS disk size (in GiB) for the Pod VMs, defaults to the size of the image")
+	flags.StringVar(&azurecfg.ClusterID, "cluster-id", "", "Cluster ID tagged on the Pod VMs to allow garbage collection of orphaned instances, defaults to `PEERPODS_CLUSTER_ID`")
 }
 
 func (_ *Manager) LoadEnv() {
-	provider.DefaultToEnv(&azurecfg.ClientId, "AZURE_CLIENT_ID", "")
-	provider.DefaultToEnv(&azurecfg.ClientSecret, "AZURE_CLIENT_SECRET", "")
-	provider.DefaultToEnv(&azurecfg.TenantId, "AZURE_TENANT_ID", "")
-	provider.DefaultToEnv(&azurecfg.SubscriptionId, "AZURE_SUBSCRIPTION_ID", "")
-	provider.DefaultToEnv(&azurecfg.Region, "AZURE_REGION", "")
-	provider.DefaultToEnv(&azurecfg.ResourceGroupName, "AZURE_RESOURCE_GROUP", "")
-	provider.DefaultToEnv(&azurecfg.Size, "AZURE_INSTANCE_SIZE", "Standard_DC2as_v5")
+	loadEnv(&azurecfg, provider.DefaultToEnv)
+}
+
+func loadEnv(cfg *Config, load provider.EnvLoadFunc) {
+	load(&cfg.ClientId, "AZURE_CLIENT_ID", "")
+	load(&cfg.ClientSecret, "AZURE_CLIENT_SECRET", "")
+	load(&cfg.TenantId, "AZURE_TENANT_ID", "")
+	load(&cfg.SubscriptionId, "AZURE_SUBSCRIPTION_ID", "")
+	load(&cfg.Region, "AZURE_REGION", "")
+	load(&cfg.ResourceGroupName, "AZURE_RESOURCE_GROUP", "")
+	load(&cfg.SubnetId, "AZURE_SUBNET_ID", "")
+	load(&cfg.SecurityGroupId, "AZURE_NSG_ID", "")
+	load(&cfg.ImageId, "AZURE_IMAGE_ID", "")
+	load(&cfg.Size, "AZURE_INSTANCE_SIZE", "Standard_DC2as_v5")
+	provider.LoadListFromEnv(load, (*[]string)(&cfg.InstanceSizes), "AZURE_INSTANCE_SIZES")
+	load(&cfg.SSHUserName, "SSH_USERNAME", "peerpod")
+	provider.LoadTagsFromEnv(load, &cfg.Tags, "TAGS")
+	provider.LoadBoolFromEnv(load, &cfg.DisableCVM, "DISABLECVM")
+	provider.LoadBoolFromEnv(load, &cfg.EnableSecureBoot, "ENABLE_SECURE_BOOT")
+	provider.LoadIntFromEnv(load, &cfg.RootVolumeSize, "ROOT_VOLUME_SIZE")
+	load(&cfg.ClusterID, "PEERPODS_CLUSTER_ID", "")
 }
 
 func (_ *Manager) NewProvider() (provider.Provider, error) {
 	return NewProvider(&azurecfg)
 }
 
+func (_ *Manager) NewProviderWithEnv(env map[string]string) (provider.Provider, error) {
+	cfg := azurecfg
+	loadEnv(&cfg, provider.OverrideFromEnv(env))
+	return NewProvider(&cfg)
+}
+
 func (_ *Manager) GetConfig() (config *Config) {
 	return &azurecfg
 }
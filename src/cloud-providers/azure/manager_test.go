@@ -0,0 +1,44 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"testing"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+func TestLoadEnvProfile(t *testing.T) {
+	cfg := Config{
+		Region:      "westeurope",
+		ImageId:     "/images/default",
+		SubnetId:    "/subnets/default",
+		Size:        "Standard_DC2as_v5",
+		SSHUserName: "peerpod",
+	}
+
+	profile := map[string]string{
+		"AZURE_REGION":         "eastus",
+		"AZURE_IMAGE_ID":       "/images/eastus",
+		"AZURE_SUBNET_ID":      "/subnets/eastus",
+		"AZURE_NSG_ID":         "/nsg/eastus",
+		"AZURE_INSTANCE_SIZES": "Standard_DC2as_v5,Standard_DC4as_v5",
+		"ENABLE_SECURE_BOOT":   "true",
+	}
+	loadEnv(&cfg, provider.OverrideFromEnv(profile))
+
+	if cfg.Region != "eastus" || cfg.ImageId != "/images/eastus" {
+		t.Errorf("Expected the region and image of the profile, got %q and %q", cfg.Region, cfg.ImageId)
+	}
+	if cfg.SubnetId != "/subnets/eastus" || cfg.SecurityGroupId != "/nsg/eastus" {
+		t.Errorf("Expected the network of the profile, got %q and %q", cfg.SubnetId, cfg.SecurityGroupId)
+	}
+	if len(cfg.InstanceSizes) != 2 || !cfg.EnableSecureBoot {
+		t.Errorf("Expected the options of the profile, got %+v", cfg.Redact())
+	}
+	// Variables that the profile doesn't set keep their value
+	if cfg.Size != "Standard_DC2as_v5" || cfg.SSHUserName != "peerpod" || cfg.DisableCVM {
+		t.Errorf("Expected the default size and user, got %+v", cfg.Redact())
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"net/netip"
 	"os"
 	"regexp"
@@ -189,11 +191,23 @@ func (p *azureProvider) CreateInstance(ctx context.Context, podName, sandboxID s
 		return nil, err
 	}
 
-	vmParameters, err := p.getVMParameters(instanceSize, diskName, cloudConfigData, sshBytes, instanceName, vmNIC)
+	vmParameters, err := p.getVMParameters(instanceSize, diskName, cloudConfigData, sshBytes, instanceName, vmNIC, p.osDiskSize(spec))
 	if err != nil {
 		return nil, err
 	}
 
+	// Add ownership tags so that orphaned VMs can be garbage collected
+	for k, v := range provider.OwnershipTags(p.serviceConfig.ClusterID, podName, spec.PodNamespace) {
+		vmParameters.Tags[k] = to.Ptr(v)
+	}
+
+	// Add tags derived from the pod metadata without overriding the ones above
+	for k, v := range spec.Tags {
+		if _, ok := vmParameters.Tags[k]; !ok {
+			vmParameters.Tags[k] = to.Ptr(v)
+		}
+	}
+
 	logger.Printf("CreateInstance: name: %q", instanceName)
 
 	result, err := p.create(ctx, vmParameters)
@@ -216,31 +230,38 @@ func (p *azureProvider) CreateInstance(ctx context.Context, podName, sandboxID s
 	}
 
 	instance := &provider.Instance{
-		ID:   instanceID,
-		Name: instanceName,
-		IPs:  ips,
+		ID:      instanceID,
+		Name:    instanceName,
+		IPs:     ips,
+		Type:    instanceSize,
+		ImageID: p.serviceConfig.ImageId,
 	}
 
 	return instance, nil
 }
 
+// Azure limits the base64 encoded userData to 64KB
+const maxUserDataSize = 65536 / 4 * 3
+
+func (p *azureProvider) UserDataLimit() int {
+	return maxUserDataSize
+}
+
 func (p *azureProvider) DeleteInstance(ctx context.Context, instanceID string) error {
 	vmClient, err := armcompute.NewVirtualMachinesClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
 	if err != nil {
 		return fmt.Errorf("creating VM client: %w", err)
 	}
 
-	// instanceID in the form of /subscriptions/<subID>/resourceGroups/<resource_name>/providers/Microsoft.Compute/virtualMachines/<VM_Name>.
-	re := regexp.MustCompile(`^/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.Compute/virtualMachines/(.*)$`)
-	match := re.FindStringSubmatch(instanceID)
-	if len(match) < 1 {
-		logger.Print("finding VM name using regexp:", match)
-		return errNotFound
+	vmName, err := vmNameFromID(instanceID)
+	if err != nil {
+		return err
 	}
 
-	vmName := match[1]
-
 	pollerResponse, err := vmClient.BeginDelete(ctx, p.serviceConfig.ResourceGroupName, vmName, nil)
+	if isNotFound(err) {
+		return fmt.Errorf("%w: %s", provider.ErrInstanceNotFound, vmName)
+	}
 	if err != nil {
 		return fmt.Errorf("beginning VM deletion: %w", err)
 	}
@@ -253,6 +274,172 @@ func (p *azureProvider) DeleteInstance(ctx context.Context, instanceID string) e
 	return nil
 }
 
+// isNotFound returns true when err is a 404 response of the Azure API
+func isNotFound(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+// vmNameFromID returns the VM name of an instanceID in the form of
+// /subscriptions/<subID>/resourceGroups/<resource_name>/providers/Microsoft.Compute/virtualMachines/<VM_Name>.
+func vmNameFromID(instanceID string) (string, error) {
+	re := regexp.MustCompile(`^/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.Compute/virtualMachines/(.*)$`)
+	match := re.FindStringSubmatch(instanceID)
+	if len(match) < 1 {
+		logger.Print("finding VM name using regexp:", match)
+		return "", errNotFound
+	}
+	return match[1], nil
+}
+
+// ConsoleOutput returns the serial log of a VM, captured by the boot diagnostics
+func (p *azureProvider) ConsoleOutput(ctx context.Context, instanceID string) ([]byte, error) {
+	vmClient, err := armcompute.NewVirtualMachinesClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating VM client: %w", err)
+	}
+
+	vmName, err := vmNameFromID(instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := vmClient.RetrieveBootDiagnosticsData(ctx, p.serviceConfig.ResourceGroupName, vmName, &armcompute.VirtualMachinesClientRetrieveBootDiagnosticsDataOptions{
+		SasURIExpirationTimeInMinutes: to.Ptr[int32](5),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("retrieving boot diagnostics of VM %s: %w", vmName, err)
+	}
+	if result.SerialConsoleLogBlobURI == nil {
+		return nil, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, *result.SerialConsoleLogBlobURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("downloading serial log of VM %s: %w", vmName, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading serial log of VM %s: %s", vmName, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// ListInstances returns the VMs in the resource group that are tagged with the given cluster ID
+func (p *azureProvider) ListInstances(ctx context.Context, clusterID string) ([]*provider.Instance, error) {
+	vmClient, err := armcompute.NewVirtualMachinesClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating VM client: %w", err)
+	}
+
+	var instances []*provider.Instance
+	pager := vmClient.NewListPager(p.serviceConfig.ResourceGroupName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting next page of VMs: %w", err)
+		}
+		for _, vm := range page.Value {
+			if tag, ok := vm.Tags[provider.ClusterIDTagKey]; !ok || tag == nil || *tag != clusterID {
+				continue
+			}
+			instance := &provider.Instance{
+				ID:   *vm.ID,
+				Name: *vm.Name,
+				Tags: make(map[string]string),
+			}
+			for k, v := range vm.Tags {
+				if v != nil {
+					instance.Tags[k] = *v
+				}
+			}
+			if vm.Properties != nil && vm.Properties.TimeCreated != nil {
+				instance.CreatedAt = *vm.Properties.TimeCreated
+			}
+			instances = append(instances, instance)
+		}
+	}
+
+	return instances, nil
+}
+
+// regionalCoresUsage is the name of the usage of the total regional vCPUs quota
+const regionalCoresUsage = "cores"
+
+// AvailableInstances returns how many more VMs of the configured size fit in
+// the total regional vCPUs quota of the subscription. The quotas of the VM
+// families are not taken into account.
+func (p *azureProvider) AvailableInstances(ctx context.Context) (int64, error) {
+	usageClient, err := armcompute.NewUsageClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
+	if err != nil {
+		return 0, fmt.Errorf("creating usage client: %w", err)
+	}
+
+	var usages []*armcompute.Usage
+	pager := usageClient.NewListPager(p.serviceConfig.Region, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("getting next page of usages: %w", err)
+		}
+		usages = append(usages, page.Value...)
+	}
+
+	vcpus, err := p.sizeCores(ctx, p.serviceConfig.Size)
+	if err != nil {
+		return 0, err
+	}
+	return availableInstances(usages, vcpus)
+}
+
+// availableInstances returns how many VMs of vcpus fit in the regional vCPUs
+// quota left
+func availableInstances(usages []*armcompute.Usage, vcpus int64) (int64, error) {
+	if vcpus <= 0 {
+		return 0, fmt.Errorf("invalid number of vCPUs %d", vcpus)
+	}
+	for _, usage := range usages {
+		if usage == nil || usage.Name == nil || usage.Name.Value == nil || *usage.Name.Value != regionalCoresUsage {
+			continue
+		}
+		if usage.Limit == nil || usage.CurrentValue == nil {
+			break
+		}
+		left := *usage.Limit - int64(*usage.CurrentValue)
+		if left < 0 {
+			return 0, nil
+		}
+		return left / vcpus, nil
+	}
+	return 0, fmt.Errorf("no %q usage found", regionalCoresUsage)
+}
+
+// sizeCores returns the number of vCPUs of a VM size
+func (p *azureProvider) sizeCores(ctx context.Context, size string) (int64, error) {
+	sizesClient, err := armcompute.NewVirtualMachineSizesClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
+	if err != nil {
+		return 0, fmt.Errorf("creating VM sizes client: %w", err)
+	}
+
+	pager := sizesClient.NewListPager(p.serviceConfig.Region, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("getting next page of VM sizes: %w", err)
+		}
+		for _, vmSize := range page.Value {
+			if vmSize.Name != nil && strings.EqualFold(*vmSize.Name, size) && vmSize.NumberOfCores != nil {
+				return int64(*vmSize.NumberOfCores), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("VM size %s not found in %s", size, p.serviceConfig.Region)
+}
+
 func (p *azureProvider) deleteDisk(ctx context.Context, diskName string) error {
 	diskClient, err := armcompute.NewDisksClient(p.serviceConfig.SubscriptionId, p.azureClient, nil)
 	if err != nil {
@@ -327,6 +514,15 @@ func (p *azureProvider) selectInstanceType(ctx context.Context, spec provider.In
 	return provider.SelectInstanceTypeToUse(spec, p.serviceConfig.InstanceSizeSpecList, p.serviceConfig.InstanceSizes, p.serviceConfig.Size)
 }
 
+// InstanceCatalog implements provider.CatalogReporter
+func (p *azureProvider) InstanceCatalog() provider.InstanceCatalog {
+	return provider.InstanceCatalog{
+		DefaultInstanceType: p.serviceConfig.Size,
+		InstanceTypes:       p.serviceConfig.InstanceSizes,
+		Specs:               p.serviceConfig.InstanceSizeSpecList,
+	}
+}
+
 // Add a method to populate InstanceSizeSpecList for all the instanceSizes
 // available in Azure
 func (p *azureProvider) updateInstanceSizeSpecList() error {
@@ -380,7 +576,17 @@ func (p *azureProvider) getResourceTags() map[string]*string {
 	return tags
 }
 
-func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig string, sshBytes []byte, instanceName string, vmNIC *armnetwork.Interface) (*armcompute.VirtualMachine, error) {
+// osDiskSize returns the OS disk size in GiB of a pod VM, zero for the size of
+// the image. Azure fails to create a disk smaller than the image, so the size
+// requested by the pod is only used when it is larger than the configured one.
+func (p *azureProvider) osDiskSize(spec provider.InstanceTypeSpec) int32 {
+	if spec.RootDiskSize > int64(p.serviceConfig.RootVolumeSize) {
+		return int32(spec.RootDiskSize)
+	}
+	return int32(p.serviceConfig.RootVolumeSize)
+}
+
+func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig string, sshBytes []byte, instanceName string, vmNIC *armnetwork.Interface, diskSize int32) (*armcompute.VirtualMachine, error) {
 	userDataB64 := base64.StdEncoding.EncodeToString([]byte(cloudConfig))
 
 	// Azure limits the base64 encrypted userData to 64KB.
@@ -474,5 +680,9 @@ func (p *azureProvider) getVMParameters(instanceSize, diskName, cloudConfig stri
 		Tags: p.getResourceTags(),
 	}
 
+	if diskSize > 0 {
+		vmParameters.Properties.StorageProfile.OSDisk.DiskSizeGB = to.Ptr(diskSize)
+	}
+
 	return &vmParameters, nil
 }
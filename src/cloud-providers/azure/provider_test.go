@@ -0,0 +1,70 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package azure
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v4"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v2"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+func TestAvailableInstances(t *testing.T) {
+	usage := func(name string, current int32, limit int64) *armcompute.Usage {
+		return &armcompute.Usage{
+			Name:         &armcompute.UsageName{Value: to.Ptr(name)},
+			CurrentValue: to.Ptr(current),
+			Limit:        to.Ptr(limit),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		usages  []*armcompute.Usage
+		vcpus   int64
+		want    int64
+		wantErr bool
+	}{
+		{"quota left", []*armcompute.Usage{usage("availabilitySets", 1, 2500), usage("cores", 10, 100)}, 4, 22, false},
+		{"quota exhausted", []*armcompute.Usage{usage("cores", 100, 100)}, 2, 0, false},
+		{"quota lowered below usage", []*armcompute.Usage{usage("cores", 120, 100)}, 2, 0, false},
+		{"no cores usage", []*armcompute.Usage{usage("availabilitySets", 1, 2500)}, 2, 0, true},
+		{"unknown size", []*armcompute.Usage{usage("cores", 10, 100)}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := availableInstances(tt.usages, tt.vcpus)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: availableInstances() = %d, %v, want %d, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestGetVMParametersDiskSize(t *testing.T) {
+	tests := []struct {
+		name           string
+		rootVolumeSize int
+		podDiskSize    int64
+		want           *int32
+	}{
+		{"size of the image", 0, 0, nil},
+		{"configured size", 50, 0, to.Ptr(int32(50))},
+		{"pod size", 0, 40, to.Ptr(int32(40))},
+		{"pod size smaller than the configured size", 50, 40, to.Ptr(int32(50))},
+		{"pod size larger than the configured size", 50, 60, to.Ptr(int32(60))},
+	}
+	for _, tt := range tests {
+		p := &azureProvider{serviceConfig: &Config{ImageId: "image", RootVolumeSize: tt.rootVolumeSize}}
+		vmNIC := &armnetwork.Interface{ID: to.Ptr("nic")}
+		vm, err := p.getVMParameters("Standard_DC2as_v5", "disk", "cloud config", []byte("key"), "vm", vmNIC, p.osDiskSize(provider.InstanceTypeSpec{RootDiskSize: tt.podDiskSize}))
+		if err != nil {
+			t.Fatalf("%s: getVMParameters() error = %v", tt.name, err)
+		}
+		got := vm.Properties.StorageProfile.OSDisk.DiskSizeGB
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("%s: DiskSizeGB = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -44,10 +44,14 @@ type Config struct {
 	InstanceSizes        instanceSizes
 	InstanceSizeSpecList []provider.InstanceTypeSpec
 	Tags                 provider.KeyValueFlag
+	ClusterID            string
 	DisableCloudConfig   bool
 	// Disabled by default, we want to do measured boot.
 	// Secure boot brings no additional security.
 	EnableSecureBoot bool
+	// RootVolumeSize is the OS disk size in GiB, zero for the size of the
+	// image. Pods can only request a larger disk.
+	RootVolumeSize int
 }
 
 func (c Config) Redact() Config {
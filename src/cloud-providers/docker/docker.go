@@ -4,6 +4,7 @@
 package docker
 
 import (
+	"bytes"
 	"context"
 
 	// Ensure you explicitly get the specific docker module version
@@ -15,6 +16,7 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 )
 
@@ -28,7 +30,7 @@ const defaultDockerNetworkName = "bridge"
 // Returns the container ID and the IP address of the container
 func createContainer(ctx context.Context, client *client.Client,
 	instanceName string, volumeBinding []string,
-	podvmImage string, networkName string) (string, string, error) {
+	podvmImage string, networkName string, labels map[string]string) (string, string, error) {
 
 	// No need to bind the port to the host
 	portBinding := nat.PortMap{}
@@ -37,7 +39,8 @@ func createContainer(ctx context.Context, client *client.Client,
 	resp, err := client.ContainerCreate(
 		ctx,
 		&container.Config{
-			Image: podvmImage,
+			Image:  podvmImage,
+			Labels: labels,
 			ExposedPorts: nat.PortSet{
 				"15150/tcp": struct{}{},
 			},
@@ -87,3 +90,24 @@ func deleteContainer(ctx context.Context, client *client.Client, containerID str
 		Force: true,
 	})
 }
+
+// Method to get the last lines of the output of a container, which is the
+// console of the systemd in the podvm image
+func containerLogs(ctx context.Context, client *client.Client, containerID string, tail string) ([]byte, error) {
+	logs, err := client.ContainerLogs(ctx, containerID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       tail,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer logs.Close()
+
+	// The container has no TTY, hence stdout and stderr are multiplexed
+	var output bytes.Buffer
+	if _, err := stdcopy.StdCopy(&output, &output, logs); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
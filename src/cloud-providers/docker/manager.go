@@ -5,7 +5,6 @@ package docker
 
 import (
 	"flag"
-	"os"
 
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 )
@@ -32,14 +31,19 @@ func (_ *Manager) ParseCmd(flags *flag.FlagSet) {
 }
 
 func (m *Manager) LoadEnv() {
-	provider.DefaultToEnv(&dockerCfg.DockerHost, "DOCKER_HOST", "unix:///var/run/docker.sock")
-	provider.DefaultToEnv(&dockerCfg.DockerAPIVersion, "DOCKER_API_VERSION", "1.40")
-	provider.DefaultToEnv(&dockerCfg.DockerCertPath, "DOCKER_CERT_PATH", "")
-	dockerTLSVerify := os.Getenv("DOCKER_TLS_VERIFY")
+	loadEnv(&dockerCfg, provider.DefaultToEnv)
+}
+
+func loadEnv(cfg *Config, load provider.EnvLoadFunc) {
+	load(&cfg.DockerHost, "DOCKER_HOST", "unix:///var/run/docker.sock")
+	load(&cfg.DockerAPIVersion, "DOCKER_API_VERSION", "1.40")
+	load(&cfg.DockerCertPath, "DOCKER_CERT_PATH", "")
+	var dockerTLSVerify string
+	load(&dockerTLSVerify, "DOCKER_TLS_VERIFY", "")
 	if dockerTLSVerify == "1" || dockerTLSVerify == "true" {
-		dockerCfg.DockerTLSVerify = true
+		cfg.DockerTLSVerify = true
 	} else {
-		dockerCfg.DockerTLSVerify = false
+		cfg.DockerTLSVerify = false
 	}
 }
 
@@ -47,6 +51,12 @@ func (_ *Manager) NewProvider() (provider.Provider, error) {
 	return NewProvider(&dockerCfg)
 }
 
+func (_ *Manager) NewProviderWithEnv(env map[string]string) (provider.Provider, error) {
+	cfg := dockerCfg
+	loadEnv(&cfg, provider.OverrideFromEnv(env))
+	return NewProvider(&cfg)
+}
+
 func (_ *Manager) GetConfig() (config *Config) {
 	return &dockerCfg
 }
@@ -90,8 +90,9 @@ func (p *dockerProvider) CreateInstance(ctx context.Context, podName, sandboxID
 	volumeBinding = append(volumeBinding, fmt.Sprintf("%s:%s",
 		filepath.Join(p.DataDir, "image"), "/image"))
 
+	// Pod tags are applied as container labels
 	instanceID, ip, err := createContainer(ctx, p.Client, instanceName, volumeBinding,
-		p.PodVMDockerImage, p.NetworkName)
+		p.PodVMDockerImage, p.NetworkName, spec.Tags)
 	if err != nil {
 		return nil, err
 	}
@@ -105,9 +106,10 @@ func (p *dockerProvider) CreateInstance(ctx context.Context, podName, sandboxID
 	}
 
 	return &provider.Instance{
-		ID:   instanceID,
-		Name: instanceName,
-		IPs:  []netip.Addr{ipAddr}, // Convert ipAddr to a slice of netip.Addr
+		ID:      instanceID,
+		Name:    instanceName,
+		IPs:     []netip.Addr{ipAddr}, // Convert ipAddr to a slice of netip.Addr
+		ImageID: p.PodVMDockerImage,
 	}, nil
 
 }
@@ -118,6 +120,9 @@ func (p *dockerProvider) DeleteInstance(ctx context.Context, instanceID string)
 
 	// Delete the container
 	err := deleteContainer(ctx, p.Client, instanceID)
+	if client.IsErrNotFound(err) {
+		return fmt.Errorf("%w: %s", provider.ErrInstanceNotFound, instanceID)
+	}
 	if err != nil {
 		return err
 	}
@@ -125,6 +130,17 @@ func (p *dockerProvider) DeleteInstance(ctx context.Context, instanceID string)
 	return nil
 }
 
+// consoleTailLines is the number of log lines returned by ConsoleOutput
+const consoleTailLines = "1000"
+
+func (p *dockerProvider) ConsoleOutput(ctx context.Context, instanceID string) ([]byte, error) {
+	output, err := containerLogs(ctx, p.Client, instanceID, consoleTailLines)
+	if err != nil {
+		return nil, fmt.Errorf("getting logs of container %s: %w", instanceID, err)
+	}
+	return output, nil
+}
+
 func (p *dockerProvider) Teardown() error {
 	return nil
 }
@@ -0,0 +1,179 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	compute "cloud.google.com/go/compute/apiv1"
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/proto"
+)
+
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// operationError returns the error of a failed operation
+func operationError(op *computepb.Operation) error {
+	if op.GetError() == nil {
+		return nil
+	}
+	errs := op.GetError().GetErrors()
+	if len(errs) == 0 {
+		return errors.New("unknown operation error")
+	}
+	return fmt.Errorf("%s: %s", errs[0].GetCode(), errs[0].GetMessage())
+}
+
+// Make computeClient a mockable interface
+type computeClient interface {
+	InsertInstance(ctx context.Context, project, zone string, instance *computepb.Instance) (*computepb.Operation, error)
+	GetInstance(ctx context.Context, project, zone, name string) (*computepb.Instance, error)
+	// ListInstances returns the instances of the zone matching filter
+	ListInstances(ctx context.Context, project, zone, filter string) ([]*computepb.Instance, error)
+	DeleteInstance(ctx context.Context, project, zone, name string) (*computepb.Operation, error)
+	GetMachineType(ctx context.Context, project, zone, name string) (*computepb.MachineType, error)
+	// WaitZoneOperation blocks until the operation is done or the context expires
+	WaitZoneOperation(ctx context.Context, project, zone, name string) (*computepb.Operation, error)
+	Close() error
+}
+
+// sdkComputeClient implements computeClient with the Compute Engine client library
+type sdkComputeClient struct {
+	instances    *compute.InstancesClient
+	machineTypes *compute.MachineTypesClient
+	operations   *compute.ZoneOperationsClient
+}
+
+func NewComputeClient(cfg Config) (*sdkComputeClient, error) {
+
+	// Without a key file, the application default credentials are used, e.g.
+	// the service account attached to the VM running the adaptor
+	var opts []option.ClientOption
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+
+	return newComputeClient(context.Background(), opts...)
+}
+
+func newComputeClient(ctx context.Context, opts ...option.ClientOption) (*sdkComputeClient, error) {
+	instances, err := compute.NewInstancesRESTClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating instances client: %w", err)
+	}
+	machineTypes, err := compute.NewMachineTypesRESTClient(ctx, opts...)
+	if err != nil {
+		instances.Close()
+		return nil, fmt.Errorf("creating machine types client: %w", err)
+	}
+	operations, err := compute.NewZoneOperationsRESTClient(ctx, opts...)
+	if err != nil {
+		instances.Close()
+		machineTypes.Close()
+		return nil, fmt.Errorf("creating zone operations client: %w", err)
+	}
+
+	return &sdkComputeClient{
+		instances:    instances,
+		machineTypes: machineTypes,
+		operations:   operations,
+	}, nil
+}
+
+func (c *sdkComputeClient) InsertInstance(ctx context.Context, project, zone string, instance *computepb.Instance) (*computepb.Operation, error) {
+	op, err := c.instances.Insert(ctx, &computepb.InsertInstanceRequest{
+		Project:          project,
+		Zone:             zone,
+		InstanceResource: instance,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return op.Proto(), nil
+}
+
+func (c *sdkComputeClient) GetInstance(ctx context.Context, project, zone, name string) (*computepb.Instance, error) {
+	return c.instances.Get(ctx, &computepb.GetInstanceRequest{
+		Project:  project,
+		Zone:     zone,
+		Instance: name,
+	})
+}
+
+func (c *sdkComputeClient) ListInstances(ctx context.Context, project, zone, filter string) ([]*computepb.Instance, error) {
+	it := c.instances.List(ctx, &computepb.ListInstancesRequest{
+		Project: project,
+		Zone:    zone,
+		Filter:  proto.String(filter),
+	})
+
+	var instances []*computepb.Instance
+	for {
+		instance, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return instances, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+}
+
+func (c *sdkComputeClient) DeleteInstance(ctx context.Context, project, zone, name string) (*computepb.Operation, error) {
+	op, err := c.instances.Delete(ctx, &computepb.DeleteInstanceRequest{
+		Project:  project,
+		Zone:     zone,
+		Instance: name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return op.Proto(), nil
+}
+
+func (c *sdkComputeClient) GetMachineType(ctx context.Context, project, zone, name string) (*computepb.MachineType, error) {
+	return c.machineTypes.Get(ctx, &computepb.GetMachineTypeRequest{
+		Project:     project,
+		Zone:        zone,
+		MachineType: name,
+	})
+}
+
+func (c *sdkComputeClient) WaitZoneOperation(ctx context.Context, project, zone, name string) (*computepb.Operation, error) {
+	for {
+		// The wait method returns when the operation is done or after about two minutes
+		op, err := c.operations.Wait(ctx, &computepb.WaitZoneOperationRequest{
+			Project:   project,
+			Zone:      zone,
+			Operation: name,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if op.GetStatus() == computepb.Operation_DONE {
+			return op, operationError(op)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (c *sdkComputeClient) Close() error {
+	return errors.Join(c.instances.Close(), c.machineTypes.Close(), c.operations.Close())
+}
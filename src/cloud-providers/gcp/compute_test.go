@@ -0,0 +1,117 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestComputeClient(t *testing.T, handler http.HandlerFunc) *sdkComputeClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := newComputeClient(context.Background(),
+		option.WithEndpoint(server.URL),
+		option.WithHTTPClient(server.Client()),
+		option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("newComputeClient() error = %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestSDKComputeClient(t *testing.T) {
+	waits := 0
+	client := newTestComputeClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/compute/v1/projects/p/zones/z/instances/missing":
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]interface{}{"code": 404, "message": "instance not found"},
+			})
+		case r.Method == http.MethodPost && r.URL.Path == "/compute/v1/projects/p/zones/z/instances":
+			var instance map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&instance); err != nil || instance["name"] != "podvm" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"name": "op-1", "status": "RUNNING"})
+		case r.Method == http.MethodPost && r.URL.Path == "/compute/v1/projects/p/zones/z/operations/op-1/wait":
+			// Report the operation as done on the second wait call
+			waits++
+			status := "RUNNING"
+			if waits > 1 {
+				status = "DONE"
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"name": "op-1", "status": status})
+		case r.Method == http.MethodGet && r.URL.Path == "/compute/v1/projects/p/zones/z/instances":
+			// Return the instances in two pages
+			if r.URL.Query().Get("filter") != `labels.team = "peerpods"` {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if r.URL.Query().Get("pageToken") == "" {
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"items": []map[string]string{{"name": "podvm-1"}}, "nextPageToken": "next"})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"items": []map[string]string{{"name": "podvm-2"}}})
+		case r.Method == http.MethodGet && r.URL.Path == "/compute/v1/projects/p/zones/z/machineTypes/n2d-standard-2":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": "n2d-standard-2", "guestCpus": 2, "memoryMb": 8192})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+
+	ctx := context.Background()
+
+	if _, err := client.GetInstance(ctx, "p", "z", "missing"); !isNotFound(err) {
+		t.Errorf("GetInstance() error = %v, want a not found error", err)
+	}
+
+	op, err := client.InsertInstance(ctx, "p", "z", &computepb.Instance{Name: proto.String("podvm")})
+	if err != nil {
+		t.Fatalf("InsertInstance() error = %v", err)
+	}
+
+	op, err = client.WaitZoneOperation(ctx, "p", "z", op.GetName())
+	if err != nil {
+		t.Fatalf("WaitZoneOperation() error = %v", err)
+	}
+	if op.GetStatus() != computepb.Operation_DONE || waits != 2 {
+		t.Errorf("WaitZoneOperation() = %v after %d calls", op, waits)
+	}
+
+	instances, err := client.ListInstances(ctx, "p", "z", `labels.team = "peerpods"`)
+	if err != nil || len(instances) != 2 || instances[0].GetName() != "podvm-1" || instances[1].GetName() != "podvm-2" {
+		t.Errorf("ListInstances() = %v, %v", instances, err)
+	}
+
+	mt, err := client.GetMachineType(ctx, "p", "z", "n2d-standard-2")
+	if err != nil || mt.GetGuestCpus() != 2 || mt.GetMemoryMb() != 8192 {
+		t.Errorf("GetMachineType() = %v, %v", mt, err)
+	}
+	if _, err := client.GetMachineType(ctx, "p", "z", "unknown"); err == nil || isNotFound(err) {
+		t.Errorf("GetMachineType() error = %v, want a bad request error", err)
+	}
+}
+
+func TestWaitZoneOperationError(t *testing.T) {
+	client := newTestComputeClient(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"name":"op-1","status":"DONE","error":{"errors":[{"code":"QUOTA_EXCEEDED","message":"quota exceeded"}]}}`))
+	})
+
+	_, err := client.WaitZoneOperation(context.Background(), "p", "z", "op-1")
+	if err == nil || err.Error() != "QUOTA_EXCEEDED: quota exceeded" {
+		t.Errorf("WaitZoneOperation() error = %v, want the operation error", err)
+	}
+}
@@ -0,0 +1,66 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package gcp
+
+import (
+	"flag"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+var gcpcfg Config
+
+type Manager struct{}
+
+func init() {
+	provider.AddCloudProvider("gcp", &Manager{})
+}
+
+func (_ *Manager) ParseCmd(flags *flag.FlagSet) {
+
+	flags.StringVar(&gcpcfg.ProjectID, "gcp-project-id", "", "GCP Project ID, defaults to `GCP_PROJECT_ID`")
+	flags.StringVar(&gcpcfg.Zone, "zone", "", "Zone of the Pod VMs, defaults to `GCP_ZONE`")
+	flags.StringVar(&gcpcfg.CredentialsFile, "gcp-credentials", "", "Path to a service account key file, defaults to `GCP_CREDENTIALS`. The metadata server credentials are used if unset")
+	flags.StringVar(&gcpcfg.ImageName, "image-name", "", "Pod VM image name or self link, defaults to `PODVM_IMAGE_NAME`")
+	flags.StringVar(&gcpcfg.MachineType, "machine-type", "n2d-standard-2", "Pod VM machine type, defaults to `GCP_MACHINE_TYPE`")
+	// Add a List parameter to indicate different machine types to be used for the Pod VMs
+	flags.Var(&gcpcfg.MachineTypes, "machine-types", "Machine types to be used for the Pod VMs, comma separated")
+	flags.StringVar(&gcpcfg.Network, "network", "", "Network of the Pod VMs, defaults to `GCP_NETWORK`")
+	flags.StringVar(&gcpcfg.Subnetwork, "subnetwork", "", "Subnetwork of the Pod VMs")
+	// Add a key value list parameter to indicate custom labels to be used for the Pod VMs
+	flags.Var(&gcpcfg.Tags, "tags", "Custom labels (key=value pairs) to be used for the Pod VMs, comma separated")
+	flags.IntVar(&gcpcfg.DiskSizeGB, "disk-size", 0, "Boot disk size (in GiB) for the Pod VMs, the image size is used if unset")
+	flags.StringVar(&gcpcfg.ConfidentialType, "confidential-type", "SEV", "Confidential computing technology of the Pod VMs (SEV, SEV_SNP or TDX)")
+	flags.BoolVar(&gcpcfg.DisableCVM, "disable-cvm", false, "Use non-CVMs for peer pods")
+	flags.StringVar(&gcpcfg.ClusterID, "cluster-id", "", "Cluster ID labeled on the Pod VMs to allow garbage collection of orphaned instances, defaults to `PEERPODS_CLUSTER_ID`")
+
+}
+
+func (_ *Manager) LoadEnv() {
+	loadEnv(&gcpcfg, provider.DefaultToEnv)
+}
+
+func loadEnv(cfg *Config, load provider.EnvLoadFunc) {
+	load(&cfg.ProjectID, "GCP_PROJECT_ID", "")
+	load(&cfg.Zone, "GCP_ZONE", "")
+	load(&cfg.CredentialsFile, "GCP_CREDENTIALS", "")
+	load(&cfg.ImageName, "PODVM_IMAGE_NAME", "")
+	load(&cfg.MachineType, "GCP_MACHINE_TYPE", "n2d-standard-2")
+	load(&cfg.Network, "GCP_NETWORK", "")
+	load(&cfg.ClusterID, "PEERPODS_CLUSTER_ID", "")
+}
+
+func (_ *Manager) NewProvider() (provider.Provider, error) {
+	return NewProvider(&gcpcfg)
+}
+
+func (_ *Manager) NewProviderWithEnv(env map[string]string) (provider.Provider, error) {
+	cfg := gcpcfg
+	loadEnv(&cfg, provider.OverrideFromEnv(env))
+	return NewProvider(&cfg)
+}
+
+func (_ *Manager) GetConfig() (config *Config) {
+	return &gcpcfg
+}
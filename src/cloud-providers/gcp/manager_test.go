@@ -0,0 +1,97 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package gcp
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestManager_ParseCmd(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected Config
+	}{
+		{
+			name: "AllFlagsSet",
+			args: []string{
+				"-gcp-project-id=test-project",
+				"-zone=us-central1-a",
+				"-gcp-credentials=/etc/gcp/key.json",
+				"-image-name=test-image",
+				"-machine-type=n2d-standard-4",
+				"-machine-types=n2d-standard-2,n2d-standard-4",
+				"-network=test-network",
+				"-subnetwork=test-subnetwork",
+				"-tags=key1=value1,key2=value2",
+				"-disk-size=20",
+				"-confidential-type=TDX",
+				"-disable-cvm=true",
+			},
+			expected: Config{
+				ProjectID:        "test-project",
+				Zone:             "us-central1-a",
+				CredentialsFile:  "/etc/gcp/key.json",
+				ImageName:        "test-image",
+				MachineType:      "n2d-standard-4",
+				MachineTypes:     machineTypes{"n2d-standard-2", "n2d-standard-4"},
+				Network:          "test-network",
+				Subnetwork:       "test-subnetwork",
+				Tags:             map[string]string{"key1": "value1", "key2": "value2"},
+				DiskSizeGB:       20,
+				ConfidentialType: "TDX",
+				DisableCVM:       true,
+			},
+		},
+		{
+			name: "DefaultValues",
+			args: []string{},
+			expected: Config{
+				MachineType:      "n2d-standard-2",
+				ConfidentialType: "SEV",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+
+			manager := &Manager{}
+			manager.ParseCmd(flags)
+
+			if err := flags.Parse(test.args); err != nil {
+				t.Errorf("Failed to parse flags: %v", err)
+			}
+
+			if !reflect.DeepEqual(test.expected, gcpcfg) {
+				t.Errorf("Expected config: %+v, but got: %+v", test.expected, gcpcfg)
+			}
+
+			// Reset the gcpcfg
+			gcpcfg = Config{}
+		})
+	}
+}
+
+func TestManager_LoadEnv(t *testing.T) {
+	t.Setenv("GCP_PROJECT_ID", "env-project")
+	t.Setenv("GCP_ZONE", "env-zone")
+	t.Setenv("PODVM_IMAGE_NAME", "env-image")
+
+	// Flags take precedence over the environment
+	gcpcfg = Config{Zone: "flag-zone"}
+	defer func() { gcpcfg = Config{} }()
+
+	(&Manager{}).LoadEnv()
+
+	if gcpcfg.ProjectID != "env-project" || gcpcfg.Zone != "flag-zone" || gcpcfg.ImageName != "env-image" {
+		t.Errorf("unexpected config after LoadEnv: %+v", gcpcfg)
+	}
+	if gcpcfg.MachineType != "n2d-standard-2" {
+		t.Errorf("MachineType = %q, want the default n2d-standard-2", gcpcfg.MachineType)
+	}
+}
@@ -0,0 +1,81 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// Ref: https://cloud.google.com/compute/docs/metadata/querying-metadata
+	GCPMetadataUrl     = "http://metadata.google.internal/computeMetadata/v1/instance/id"
+	GCPUserDataUrl     = "http://metadata.google.internal/computeMetadata/v1/instance/attributes/" + userDataKey
+	metadataFlavorName = "Metadata-Flavor"
+	metadataFlavor     = "Google"
+)
+
+// Method to check if the VM is running on GCP
+// by checking if the GCE metadata server is reachable
+// If the VM is running on GCP, return true
+func IsGCP(ctx context.Context) bool {
+
+	client := &http.Client{}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, GCPMetadataUrl, nil)
+	if err != nil {
+		fmt.Printf("failed to create request: %s\n", err)
+		return false
+	}
+	req.Header.Set(metadataFlavorName, metadataFlavor)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Printf("failed to send request: %s\n", err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	// The metadata server echoes the flavor header in its responses
+	return resp.StatusCode == http.StatusOK && resp.Header.Get(metadataFlavorName) == metadataFlavor
+}
+
+// Method to retrieve userData from the GCE metadata server
+// and return it as a string
+func GetUserData(ctx context.Context, url string) ([]byte, error) {
+
+	// If url is empty then return empty string
+	if url == "" {
+		return nil, fmt.Errorf("url is empty")
+	}
+
+	client := &http.Client{}
+
+	// Example request for GCP.
+	// curl -H "Metadata-Flavor: Google" http://metadata.google.internal/computeMetadata/v1/instance/attributes/user-data
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %s", err)
+	}
+	req.Header.Set(metadataFlavorName, metadataFlavor)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to retrieve userData: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %s", err)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,378 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"google.golang.org/protobuf/proto"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+var logger = log.New(log.Writer(), "[adaptor/cloud/gcp] ", log.LstdFlags|log.Lmsgprefix)
+
+const (
+	maxInstanceNameLen = 63
+	maxWaitTime        = 5 * time.Minute
+	// userDataKey is the instance metadata key read by process-user-data
+	userDataKey = "user-data"
+)
+
+// Ref: https://cloud.google.com/confidential-computing/confidential-vm/docs/supported-configurations
+var confidentialTypes = []string{"SEV", "SEV_SNP", "TDX"}
+
+type gcpProvider struct {
+	// Make client a mockable interface
+	client        computeClient
+	serviceConfig *Config
+}
+
+func NewProvider(config *Config) (provider.Provider, error) {
+
+	logger.Printf("gcp config: %#v", config.Redact())
+
+	if !config.DisableCVM && !util.Contains(confidentialTypes, config.ConfidentialType) {
+		return nil, fmt.Errorf("unsupported confidential type %q, must be one of %v", config.ConfidentialType, confidentialTypes)
+	}
+
+	client, err := NewComputeClient(*config)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &gcpProvider{
+		client:        client,
+		serviceConfig: config,
+	}
+
+	if err = provider.updateInstanceTypeSpecList(); err != nil {
+		return nil, err
+	}
+
+	return provider, nil
+}
+
+func getIPs(instance *computepb.Instance) ([]netip.Addr, error) {
+
+	var podNodeIPs []netip.Addr
+	for i, nic := range instance.GetNetworkInterfaces() {
+		if nic.GetNetworkIP() == "" {
+			return nil, fmt.Errorf("network interface %d of instance %s has no IP address", i, instance.GetName())
+		}
+
+		ip, err := netip.ParseAddr(nic.GetNetworkIP())
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pod node IP %q: %w", nic.GetNetworkIP(), err)
+		}
+		podNodeIPs = append(podNodeIPs, ip)
+
+		logger.Printf("podNodeIP[%d]=%s", i, ip.String())
+	}
+
+	return podNodeIPs, nil
+}
+
+// sourceImage returns the image self link, accepting either a full path or an image name of the project
+func (p *gcpProvider) sourceImage() string {
+	if strings.Contains(p.serviceConfig.ImageName, "/") {
+		return p.serviceConfig.ImageName
+	}
+	return fmt.Sprintf("projects/%s/global/images/%s", p.serviceConfig.ProjectID, p.serviceConfig.ImageName)
+}
+
+func (p *gcpProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
+
+	instanceName := util.GenerateInstanceName(podName, sandboxID, maxInstanceNameLen)
+
+	cloudConfigData, err := cloudConfig.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	machineType, err := p.selectInstanceType(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	network := p.serviceConfig.Network
+	if network == "" && p.serviceConfig.Subnetwork == "" {
+		network = "global/networks/default"
+	}
+
+	initializeParams := &computepb.AttachedDiskInitializeParams{
+		SourceImage: proto.String(p.sourceImage()),
+	}
+	if p.serviceConfig.DiskSizeGB > 0 {
+		initializeParams.DiskSizeGb = proto.Int64(int64(p.serviceConfig.DiskSizeGB))
+	}
+
+	nic := &computepb.NetworkInterface{}
+	if network != "" {
+		nic.Network = proto.String(network)
+	}
+	if p.serviceConfig.Subnetwork != "" {
+		nic.Subnetwork = proto.String(p.serviceConfig.Subnetwork)
+	}
+
+	instance := &computepb.Instance{
+		Name:        proto.String(instanceName),
+		MachineType: proto.String(fmt.Sprintf("zones/%s/machineTypes/%s", p.serviceConfig.Zone, machineType)),
+		Metadata: &computepb.Metadata{
+			Items: []*computepb.Items{
+				{
+					Key:   proto.String(userDataKey),
+					Value: proto.String(cloudConfigData),
+				},
+			},
+		},
+		Disks: []*computepb.AttachedDisk{
+			{
+				Boot:             proto.Bool(true),
+				AutoDelete:       proto.Bool(true),
+				InitializeParams: initializeParams,
+			},
+		},
+		NetworkInterfaces: []*computepb.NetworkInterface{nic},
+	}
+
+	// Add custom labels (k=v) from serviceConfig.Tags and the pod tags to
+	// the instance. Pod tags don't override the configured labels.
+	ownershipTags := provider.OwnershipTags(p.serviceConfig.ClusterID, podName, spec.PodNamespace)
+	if len(p.serviceConfig.Tags) > 0 || len(spec.Tags) > 0 || len(ownershipTags) > 0 {
+		instance.Labels = make(map[string]string)
+		for k, v := range spec.Tags {
+			instance.Labels[labelKey(k)] = labelValue(v)
+		}
+		for k, v := range p.serviceConfig.Tags {
+			instance.Labels[k] = v
+		}
+	}
+
+	// Add ownership labels so that orphaned instances can be garbage collected.
+	// Labels are lowercased and truncated, so the exact values are kept in the
+	// instance metadata as well.
+	for k, v := range ownershipTags {
+		instance.Labels[k] = labelValue(v)
+		instance.Metadata.Items = append(instance.Metadata.Items, &computepb.Items{
+			Key:   proto.String(k),
+			Value: proto.String(v),
+		})
+	}
+
+	if !p.serviceConfig.DisableCVM {
+		instance.ConfidentialInstanceConfig = &computepb.ConfidentialInstanceConfig{
+			ConfidentialInstanceType: proto.String(p.serviceConfig.ConfidentialType),
+		}
+		// Confidential VMs do not support live migration
+		instance.Scheduling = &computepb.Scheduling{
+			OnHostMaintenance: proto.String(computepb.Scheduling_TERMINATE.String()),
+		}
+	}
+
+	logger.Printf("CreateInstance: name: %q", instanceName)
+
+	op, err := p.client.InsertInstance(ctx, p.serviceConfig.ProjectID, p.serviceConfig.Zone, instance)
+	if err != nil {
+		return nil, fmt.Errorf("creating instance %s: %w", instanceName, err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, maxWaitTime)
+	defer cancel()
+
+	if _, err := p.client.WaitZoneOperation(waitCtx, p.serviceConfig.ProjectID, p.serviceConfig.Zone, op.GetName()); err != nil {
+		return nil, fmt.Errorf("waiting for instance %s creation: %w", instanceName, err)
+	}
+
+	created, err := p.client.GetInstance(ctx, p.serviceConfig.ProjectID, p.serviceConfig.Zone, instanceName)
+	if err != nil {
+		return nil, fmt.Errorf("getting instance %s: %w", instanceName, err)
+	}
+
+	logger.Printf("created an instance %s for sandbox %s", instanceName, sandboxID)
+
+	ips, err := getIPs(created)
+	if err != nil {
+		logger.Printf("failed to get IPs for the instance : %v ", err)
+		return nil, err
+	}
+
+	// Instances are addressed by name in the Compute Engine API, hence use it as the ID
+	return &provider.Instance{
+		ID:      instanceName,
+		Name:    instanceName,
+		IPs:     ips,
+		Type:    machineType,
+		ImageID: p.sourceImage(),
+	}, nil
+}
+
+// GCP limits a metadata value to 256KB
+const maxUserDataSize = 262144
+
+func (p *gcpProvider) UserDataLimit() int {
+	return maxUserDataSize
+}
+
+func (p *gcpProvider) DeleteInstance(ctx context.Context, instanceID string) error {
+
+	logger.Printf("Deleting instance (%s)", instanceID)
+
+	op, err := p.client.DeleteInstance(ctx, p.serviceConfig.ProjectID, p.serviceConfig.Zone, instanceID)
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("%w: %s", provider.ErrInstanceNotFound, instanceID)
+		}
+		logger.Printf("failed to delete an instance: %v", err)
+		return err
+	}
+
+	// The deletion is asynchronous, the instance still runs until the operation is done
+	waitCtx, cancel := context.WithTimeout(ctx, maxWaitTime)
+	defer cancel()
+
+	if _, err := p.client.WaitZoneOperation(waitCtx, p.serviceConfig.ProjectID, p.serviceConfig.Zone, op.GetName()); err != nil {
+		logger.Printf("failed to delete an instance: %v", err)
+		return fmt.Errorf("waiting for instance %s deletion: %w", instanceID, err)
+	}
+
+	logger.Printf("deleted an instance %s", instanceID)
+	return nil
+}
+
+// ListInstances returns the instances of the zone labeled with the given cluster ID
+func (p *gcpProvider) ListInstances(ctx context.Context, clusterID string) ([]*provider.Instance, error) {
+
+	filter := fmt.Sprintf("labels.%s = %q", provider.ClusterIDTagKey, labelValue(clusterID))
+	result, err := p.client.ListInstances(ctx, p.serviceConfig.ProjectID, p.serviceConfig.Zone, filter)
+	if err != nil {
+		return nil, fmt.Errorf("listing instances of cluster %q: %w", clusterID, err)
+	}
+
+	var instances []*provider.Instance
+	for _, inst := range result {
+		instance := &provider.Instance{
+			ID:   inst.GetName(),
+			Name: inst.GetName(),
+			Tags: make(map[string]string),
+		}
+		for k, v := range inst.GetLabels() {
+			instance.Tags[k] = v
+		}
+		// Prefer the exact ownership values of the metadata to the labels
+		for _, item := range inst.GetMetadata().GetItems() {
+			switch item.GetKey() {
+			case provider.ClusterIDTagKey, provider.PodNameTagKey, provider.NamespaceTagKey:
+				instance.Tags[item.GetKey()] = item.GetValue()
+			}
+		}
+		// Different cluster IDs can map to the same label value
+		if instance.Tags[provider.ClusterIDTagKey] != clusterID {
+			continue
+		}
+		if createdAt, err := time.Parse(time.RFC3339, inst.GetCreationTimestamp()); err == nil {
+			instance.CreatedAt = createdAt
+		}
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
+
+func (p *gcpProvider) Teardown() error {
+	return p.client.Close()
+}
+
+func (p *gcpProvider) ConfigVerifier() error {
+	if len(p.serviceConfig.ProjectID) == 0 {
+		return fmt.Errorf("ProjectID is empty")
+	}
+	if len(p.serviceConfig.Zone) == 0 {
+		return fmt.Errorf("Zone is empty")
+	}
+	if len(p.serviceConfig.ImageName) == 0 {
+		return fmt.Errorf("ImageName is empty")
+	}
+	return nil
+}
+
+// Select a machine type based on the memory and vcpu requirements
+func (p *gcpProvider) selectInstanceType(ctx context.Context, spec provider.InstanceTypeSpec) (string, error) {
+
+	return provider.SelectInstanceTypeToUse(spec, p.serviceConfig.MachineTypeSpecList, p.serviceConfig.MachineTypes, p.serviceConfig.MachineType)
+}
+
+// InstanceCatalog implements provider.CatalogReporter
+func (p *gcpProvider) InstanceCatalog() provider.InstanceCatalog {
+	return provider.InstanceCatalog{
+		DefaultInstanceType: p.serviceConfig.MachineType,
+		InstanceTypes:       p.serviceConfig.MachineTypes,
+		Specs:               p.serviceConfig.MachineTypeSpecList,
+	}
+}
+
+// Populate MachineTypeSpecList for all the machine types
+func (p *gcpProvider) updateInstanceTypeSpecList() error {
+
+	machineTypes := p.serviceConfig.MachineTypes
+
+	// If machineTypes is empty then populate it with the default machine type
+	if len(machineTypes) == 0 {
+		machineTypes = append(machineTypes, p.serviceConfig.MachineType)
+	}
+
+	var machineTypeSpecList []provider.InstanceTypeSpec
+
+	for _, name := range machineTypes {
+		mt, err := p.client.GetMachineType(context.Background(), p.serviceConfig.ProjectID, p.serviceConfig.Zone, name)
+		if err != nil {
+			return fmt.Errorf("getting machine type %s: %w", name, err)
+		}
+		machineTypeSpecList = append(machineTypeSpecList, provider.InstanceTypeSpec{InstanceType: name, VCPUs: int64(mt.GetGuestCpus()), Memory: int64(mt.GetMemoryMb())})
+	}
+
+	// Sort the machineTypeSpecList by Memory and update the serviceConfig
+	p.serviceConfig.MachineTypeSpecList = provider.SortInstanceTypesOnMemory(machineTypeSpecList)
+	logger.Printf("MachineTypeSpecList (%v)", p.serviceConfig.MachineTypeSpecList)
+	return nil
+}
+
+// maxLabelLen is the longest label key or value accepted by GCP
+const maxLabelLen = 63
+
+// labelValue converts s to a valid label value, which may only contain
+// lowercase letters, digits, '_' and '-'
+func labelValue(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, s)
+	if len(s) > maxLabelLen {
+		s = s[:maxLabelLen]
+	}
+	return s
+}
+
+// labelKey converts s to a valid label key, which additionally has to start
+// with a lowercase letter
+func labelKey(s string) string {
+	s = labelValue(s)
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		s = labelValue("k" + s)
+	}
+	return s
+}
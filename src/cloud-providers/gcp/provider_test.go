@@ -0,0 +1,402 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/protobuf/proto"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+// Mock Compute Engine API
+type mockComputeClient struct {
+	inserted *computepb.Instance
+	deleted  string
+	// waited records the operations waited for
+	waited []string
+	// instances are returned by ListInstances, filter records its filter
+	instances []*computepb.Instance
+	filter    string
+}
+
+func (m *mockComputeClient) InsertInstance(ctx context.Context, project, zone string, instance *computepb.Instance) (*computepb.Operation, error) {
+	m.inserted = instance
+	return &computepb.Operation{Name: proto.String("op-insert"), Status: computepb.Operation_RUNNING.Enum()}, nil
+}
+
+func (m *mockComputeClient) GetInstance(ctx context.Context, project, zone, name string) (*computepb.Instance, error) {
+	return &computepb.Instance{
+		Name: proto.String(name),
+		NetworkInterfaces: []*computepb.NetworkInterface{
+			{
+				NetworkIP: proto.String("10.0.0.2"),
+			},
+		},
+	}, nil
+}
+
+func (m *mockComputeClient) ListInstances(ctx context.Context, project, zone, filter string) ([]*computepb.Instance, error) {
+	m.filter = filter
+	return m.instances, nil
+}
+
+func (m *mockComputeClient) DeleteInstance(ctx context.Context, project, zone, name string) (*computepb.Operation, error) {
+	if name == "unknown" {
+		return nil, &googleapi.Error{Code: http.StatusNotFound, Message: "not found"}
+	}
+	if name == "forbidden" {
+		return nil, &googleapi.Error{Code: http.StatusForbidden, Message: "forbidden"}
+	}
+	m.deleted = name
+	return &computepb.Operation{Name: proto.String("op-delete-" + name), Status: computepb.Operation_RUNNING.Enum()}, nil
+}
+
+func (m *mockComputeClient) GetMachineType(ctx context.Context, project, zone, name string) (*computepb.MachineType, error) {
+	switch name {
+	case "n2d-standard-2":
+		return &computepb.MachineType{Name: proto.String(name), GuestCpus: proto.Int32(2), MemoryMb: proto.Int32(8192)}, nil
+	case "n2d-standard-4":
+		return &computepb.MachineType{Name: proto.String(name), GuestCpus: proto.Int32(4), MemoryMb: proto.Int32(16384)}, nil
+	}
+	return nil, &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("machine type %s not found", name)}
+}
+
+func (m *mockComputeClient) WaitZoneOperation(ctx context.Context, project, zone, name string) (*computepb.Operation, error) {
+	m.waited = append(m.waited, name)
+	op := &computepb.Operation{Name: proto.String(name), Status: computepb.Operation_DONE.Enum()}
+	if name == "op-delete-stuck" {
+		op.Error = &computepb.Error{Errors: []*computepb.Errors{{Code: proto.String("RESOURCE_IN_USE"), Message: proto.String("in use")}}}
+	}
+	return op, operationError(op)
+}
+
+func (m *mockComputeClient) Close() error {
+	return nil
+}
+
+type mockCloudConfig struct{}
+
+func (c *mockCloudConfig) Generate() (string, error) {
+	return "cloud config", nil
+}
+
+func TestCreateInstance(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         Config
+		spec           provider.InstanceTypeSpec
+		wantConfidType string
+		wantMachine    string
+		wantLabels     map[string]string
+		// wantItems are the metadata items besides the user data
+		wantItems map[string]string
+	}{
+		{
+			name: "CreateConfidentialInstance",
+			config: Config{
+				ProjectID:        "test-project",
+				Zone:             "us-central1-a",
+				ImageName:        "podvm-image",
+				MachineType:      "n2d-standard-2",
+				ConfidentialType: "SEV_SNP",
+				Tags:             provider.KeyValueFlag{"team": "peerpods"},
+			},
+			spec: provider.InstanceTypeSpec{
+				Tags: map[string]string{
+					"peerpods-namespace":     "Default",
+					"app.kubernetes.io/name": "nginx",
+					"team":                   "other",
+				},
+			},
+			wantConfidType: "SEV_SNP",
+			wantMachine:    "zones/us-central1-a/machineTypes/n2d-standard-2",
+			wantLabels: map[string]string{
+				"team":                   "peerpods",
+				"peerpods-namespace":     "default",
+				"app-kubernetes-io-name": "nginx",
+			},
+		},
+		{
+			name: "CreateNonConfidentialInstanceWithMachineTypeSelection",
+			config: Config{
+				ProjectID:    "test-project",
+				Zone:         "us-central1-a",
+				ImageName:    "projects/other/global/images/podvm-image",
+				MachineType:  "n2d-standard-2",
+				MachineTypes: machineTypes{"n2d-standard-2", "n2d-standard-4"},
+				DisableCVM:   true,
+			},
+			spec:        provider.InstanceTypeSpec{VCPUs: 4, Memory: 16384},
+			wantMachine: "zones/us-central1-a/machineTypes/n2d-standard-4",
+		},
+		{
+			name: "CreateInstanceWithOwnershipLabels",
+			config: Config{
+				ProjectID:   "test-project",
+				Zone:        "us-central1-a",
+				ImageName:   "podvm-image",
+				MachineType: "n2d-standard-2",
+				DisableCVM:  true,
+				ClusterID:   "Cluster.1",
+			},
+			spec: provider.InstanceTypeSpec{
+				PodNamespace: "default",
+				Tags:         map[string]string{"peerpods-pod-name": "other"},
+			},
+			wantMachine: "zones/us-central1-a/machineTypes/n2d-standard-2",
+			wantLabels: map[string]string{
+				"peerpods-cluster-id": "cluster-1",
+				"peerpods-pod-name":   "test",
+				"peerpods-namespace":  "default",
+			},
+			wantItems: map[string]string{
+				"peerpods-cluster-id": "Cluster.1",
+				"peerpods-pod-name":   "test",
+				"peerpods-namespace":  "default",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockComputeClient{}
+			p := &gcpProvider{
+				client:        client,
+				serviceConfig: &tt.config,
+			}
+			if err := p.updateInstanceTypeSpecList(); err != nil {
+				t.Fatalf("updateInstanceTypeSpecList() error = %v", err)
+			}
+
+			instance, err := p.CreateInstance(context.Background(), "test", "123", &mockCloudConfig{}, tt.spec)
+			if err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+
+			want := &provider.Instance{
+				ID:      "podvm-test-123",
+				Name:    "podvm-test-123",
+				IPs:     []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+				Type:    path.Base(tt.wantMachine),
+				ImageID: p.sourceImage(),
+			}
+			if !reflect.DeepEqual(instance, want) {
+				t.Errorf("CreateInstance() = %+v, want %+v", instance, want)
+			}
+
+			inserted := client.inserted
+			if inserted.GetMachineType() != tt.wantMachine {
+				t.Errorf("machine type = %q, want %q", inserted.GetMachineType(), tt.wantMachine)
+			}
+			items := inserted.GetMetadata().GetItems()
+			if len(items) != len(tt.wantItems)+1 || items[0].GetKey() != "user-data" || items[0].GetValue() != "cloud config" {
+				t.Errorf("unexpected metadata %+v", items)
+			}
+			for _, item := range items[1:] {
+				if want, ok := tt.wantItems[item.GetKey()]; !ok || item.GetValue() != want {
+					t.Errorf("unexpected metadata item %s=%s", item.GetKey(), item.GetValue())
+				}
+			}
+			if got := inserted.GetDisks()[0].GetInitializeParams().GetSourceImage(); got != p.sourceImage() {
+				t.Errorf("source image = %q, want %q", got, p.sourceImage())
+			}
+			if !reflect.DeepEqual(inserted.GetLabels(), tt.wantLabels) {
+				t.Errorf("labels = %v, want %v", inserted.GetLabels(), tt.wantLabels)
+			}
+
+			if tt.config.DisableCVM {
+				if inserted.ConfidentialInstanceConfig != nil {
+					t.Errorf("unexpected confidential instance config %+v", inserted.ConfidentialInstanceConfig)
+				}
+			} else {
+				if got := inserted.GetConfidentialInstanceConfig().GetConfidentialInstanceType(); got != tt.wantConfidType {
+					t.Errorf("confidential instance type = %q, want %q", got, tt.wantConfidType)
+				}
+				if got := inserted.GetScheduling().GetOnHostMaintenance(); got != "TERMINATE" {
+					t.Errorf("onHostMaintenance = %q, want TERMINATE", got)
+				}
+			}
+		})
+	}
+}
+
+func TestListInstances(t *testing.T) {
+	ownership := func(clusterID string) *computepb.Metadata {
+		return &computepb.Metadata{
+			Items: []*computepb.Items{
+				{Key: proto.String("user-data"), Value: proto.String("cloud config")},
+				{Key: proto.String(provider.ClusterIDTagKey), Value: proto.String(clusterID)},
+				{Key: proto.String(provider.PodNameTagKey), Value: proto.String("web.0")},
+				{Key: proto.String(provider.NamespaceTagKey), Value: proto.String("default")},
+			},
+		}
+	}
+
+	client := &mockComputeClient{
+		instances: []*computepb.Instance{
+			{
+				Name:              proto.String("podvm-web-0-123"),
+				CreationTimestamp: proto.String("2026-10-19T01:00:00.000-07:00"),
+				Labels: map[string]string{
+					provider.ClusterIDTagKey: "cluster-1",
+					provider.PodNameTagKey:   "web-0",
+					"team":                   "peerpods",
+				},
+				Metadata: ownership("Cluster.1"),
+			},
+			{
+				// Labeled with the same value by another cluster
+				Name:     proto.String("podvm-web-0-456"),
+				Labels:   map[string]string{provider.ClusterIDTagKey: "cluster-1"},
+				Metadata: ownership("cluster-1"),
+			},
+		},
+	}
+	p := &gcpProvider{
+		client:        client,
+		serviceConfig: &Config{ProjectID: "test-project", Zone: "us-central1-a"},
+	}
+
+	instances, err := p.ListInstances(context.Background(), "Cluster.1")
+	if err != nil {
+		t.Fatalf("ListInstances() error = %v", err)
+	}
+	if want := `labels.peerpods-cluster-id = "cluster-1"`; client.filter != want {
+		t.Errorf("filter = %q, want %q", client.filter, want)
+	}
+
+	want := []*provider.Instance{
+		{
+			ID:   "podvm-web-0-123",
+			Name: "podvm-web-0-123",
+			Tags: map[string]string{
+				provider.ClusterIDTagKey: "Cluster.1",
+				provider.PodNameTagKey:   "web.0",
+				provider.NamespaceTagKey: "default",
+				"team":                   "peerpods",
+			},
+			CreatedAt: time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC),
+		},
+	}
+	if len(instances) != 1 || !instances[0].CreatedAt.Equal(want[0].CreatedAt) {
+		t.Fatalf("ListInstances() = %+v, want %+v", instances, want)
+	}
+	instances[0].CreatedAt = want[0].CreatedAt
+	if !reflect.DeepEqual(instances, want) {
+		t.Errorf("ListInstances() = %+v, want %+v", instances, want)
+	}
+}
+
+func TestLabelKey(t *testing.T) {
+	tests := map[string]string{
+		"peerpods-namespace":     "peerpods-namespace",
+		"App.Kubernetes.io/Name": "app-kubernetes-io-name",
+		"1st":                    "k1st",
+		"":                       "k",
+		strings.Repeat("a", 70):  strings.Repeat("a", 63),
+	}
+	for in, want := range tests {
+		if got := labelKey(in); got != want {
+			t.Errorf("labelKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSourceImage(t *testing.T) {
+	p := &gcpProvider{serviceConfig: &Config{ProjectID: "test-project", ImageName: "podvm-image"}}
+	if got, want := p.sourceImage(), "projects/test-project/global/images/podvm-image"; got != want {
+		t.Errorf("sourceImage() = %q, want %q", got, want)
+	}
+}
+
+func TestDeleteInstance(t *testing.T) {
+	tests := []struct {
+		name         string
+		instanceID   string
+		wantErr      bool
+		wantNotFound bool
+	}{
+		{
+			name:       "DeleteInstance",
+			instanceID: "podvm-test-123",
+		},
+		{
+			// A missing instance is reported as not found
+			name:         "DeleteMissingInstance",
+			instanceID:   "unknown",
+			wantErr:      true,
+			wantNotFound: true,
+		},
+		{
+			name:       "DeleteInstanceFailure",
+			instanceID: "forbidden",
+			wantErr:    true,
+		},
+		{
+			// The deletion operation fails
+			name:       "DeleteInstanceOperationFailure",
+			instanceID: "stuck",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockComputeClient{}
+			p := &gcpProvider{
+				client:        client,
+				serviceConfig: &Config{ProjectID: "test-project", Zone: "us-central1-a"},
+			}
+			err := p.DeleteInstance(context.Background(), tt.instanceID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DeleteInstance() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, provider.ErrInstanceNotFound) != tt.wantNotFound {
+				t.Errorf("DeleteInstance() error = %v, wantNotFound %v", err, tt.wantNotFound)
+			}
+			// The deletion operation is waited for
+			if client.deleted != "" && !reflect.DeepEqual(client.waited, []string{"op-delete-" + tt.instanceID}) {
+				t.Errorf("waited for %v, want the deletion operation", client.waited)
+			}
+		})
+	}
+}
+
+func TestUpdateInstanceTypeSpecList(t *testing.T) {
+	p := &gcpProvider{
+		client: &mockComputeClient{},
+		serviceConfig: &Config{
+			MachineType:  "n2d-standard-2",
+			MachineTypes: machineTypes{"n2d-standard-4", "n2d-standard-2"},
+		},
+	}
+	if err := p.updateInstanceTypeSpecList(); err != nil {
+		t.Fatalf("updateInstanceTypeSpecList() error = %v", err)
+	}
+	want := []provider.InstanceTypeSpec{
+		{InstanceType: "n2d-standard-2", VCPUs: 2, Memory: 8192},
+		{InstanceType: "n2d-standard-4", VCPUs: 4, Memory: 16384},
+	}
+	if !reflect.DeepEqual(p.serviceConfig.MachineTypeSpecList, want) {
+		t.Errorf("MachineTypeSpecList = %+v, want %+v", p.serviceConfig.MachineTypeSpecList, want)
+	}
+
+	p.serviceConfig.MachineTypes = machineTypes{"unknown"}
+	if err := p.updateInstanceTypeSpecList(); err == nil {
+		t.Errorf("updateInstanceTypeSpecList() expected an error for an unknown machine type")
+	}
+}
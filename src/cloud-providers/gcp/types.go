@@ -0,0 +1,47 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package gcp
+
+import (
+	"strings"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
+)
+
+type machineTypes []string
+
+func (i *machineTypes) String() string {
+	return strings.Join(*i, ", ")
+}
+
+func (i *machineTypes) Set(value string) error {
+	if len(value) == 0 {
+		*i = make(machineTypes, 0)
+	} else {
+		*i = append(*i, strings.Split(value, ",")...)
+	}
+	return nil
+}
+
+type Config struct {
+	ProjectID           string
+	Zone                string
+	CredentialsFile     string
+	ImageName           string
+	MachineType         string
+	MachineTypes        machineTypes
+	MachineTypeSpecList []provider.InstanceTypeSpec
+	Network             string
+	Subnetwork          string
+	Tags                provider.KeyValueFlag
+	DiskSizeGB          int
+	ConfidentialType    string
+	DisableCVM          bool
+	ClusterID           string
+}
+
+func (c Config) Redact() Config {
+	return *util.RedactStruct(&c, "CredentialsFile").(*Config)
+}
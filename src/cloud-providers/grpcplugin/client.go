@@ -0,0 +1,363 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package grpcplugin
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+const dialTimeout = 30 * time.Second
+
+type launcher struct{}
+
+func init() {
+	provider.SetExternalPluginLauncher(launcher{})
+}
+
+// Launch spawns the plugin binary at path and connects to it
+func (launcher) Launch(name, path string) (provider.CloudProvider, error) {
+	// The socket is created in a private directory, so that no other user can
+	// listen on it before the plugin does
+	socketDir, err := os.MkdirTemp("", name+"-plugin-")
+	if err != nil {
+		return nil, fmt.Errorf("creating the socket directory of plugin %s: %w", name, err)
+	}
+	if err := os.Chmod(socketDir, 0700); err != nil {
+		os.RemoveAll(socketDir)
+		return nil, fmt.Errorf("creating the socket directory of plugin %s: %w", name, err)
+	}
+	socketPath := filepath.Join(socketDir, "plugin.sock")
+
+	cmd := exec.Command(path)
+	cmd.Env = append(os.Environ(), SocketEnv+"="+socketPath)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(socketDir)
+		return nil, fmt.Errorf("starting plugin %s: %w", path, err)
+	}
+	logger.Printf("started plugin %s (pid %d)", path, cmd.Process.Pid)
+
+	cloud, err := dial(name, "unix://"+socketPath)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		os.RemoveAll(socketDir)
+		return nil, err
+	}
+	cloud.cmd = cmd
+	cloud.socketDir = socketDir
+
+	return cloud, nil
+}
+
+// cloudProvider is a provider.CloudProvider proxy for a plugin
+type cloudProvider struct {
+	name string
+	conn *grpc.ClientConn
+	cmd  *exec.Cmd
+	// socketDir is the private directory holding the socket of a spawned plugin
+	socketDir string
+	schema    []FlagSpec
+	flags     *flag.FlagSet
+	// generation counts the providers created by the plugin, only the latest
+	// one is live
+	mutex      sync.Mutex
+	generation int
+}
+
+func dial(name, address string) (*cloudProvider, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, address,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(jsonCodec{})),
+		grpc.WithBlock())
+	if err != nil {
+		return nil, fmt.Errorf("connecting to plugin %s at %s: %w", name, address, err)
+	}
+
+	var res GetConfigSchemaResponse
+	if err := conn.Invoke(ctx, fullMethod("GetConfigSchema"), &GetConfigSchemaRequest{}, &res); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("getting config schema of plugin %s: %w", name, err)
+	}
+
+	logger.Printf("connected to plugin %s at %s", name, address)
+
+	return &cloudProvider{
+		name:   name,
+		conn:   conn,
+		schema: res.Flags,
+	}, nil
+}
+
+// ParseCmd registers the flags advertised by the plugin
+func (c *cloudProvider) ParseCmd(flags *flag.FlagSet) {
+	for _, spec := range c.schema {
+		if flags.Lookup(spec.Name) != nil {
+			logger.Printf("plugin %s flag %q conflicts with an existing flag, ignoring it", c.name, spec.Name)
+			continue
+		}
+		if spec.IsBool {
+			def, _ := strconv.ParseBool(spec.Default)
+			flags.Bool(spec.Name, def, spec.Usage)
+		} else {
+			flags.String(spec.Name, spec.Default, spec.Usage)
+		}
+	}
+	c.flags = flags
+}
+
+// LoadEnv is a no-op, the plugin process inherits the environment and loads it itself
+func (c *cloudProvider) LoadEnv() {
+}
+
+func (c *cloudProvider) NewProvider() (provider.Provider, error) {
+	return c.newProvider(nil)
+}
+
+// NewProviderWithEnv forwards env to the plugin, which replaces its provider.
+// The provider returned earlier keeps working until its in-flight calls
+// complete.
+func (c *cloudProvider) NewProviderWithEnv(env map[string]string) (provider.Provider, error) {
+	return c.newProvider(env)
+}
+
+func (c *cloudProvider) newProvider(env map[string]string) (provider.Provider, error) {
+	req := NewProviderRequest{
+		Flags: make(map[string]string),
+		Env:   env,
+	}
+
+	// Only forward the plugin flags that were explicitly set
+	if c.flags != nil {
+		known := make(map[string]bool, len(c.schema))
+		for _, spec := range c.schema {
+			known[spec.Name] = true
+		}
+		c.flags.Visit(func(f *flag.Flag) {
+			if known[f.Name] {
+				req.Flags[f.Name] = f.Value.String()
+			}
+		})
+	}
+
+	var res NewProviderResponse
+	if err := c.conn.Invoke(context.Background(), fullMethod("NewProvider"), &req, &res); err != nil {
+		return nil, fmt.Errorf("creating provider of plugin %s: %w", c.name, err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+
+	return &remoteProvider{
+		cloud:         c,
+		generation:    c.generation,
+		userDataLimit: res.UserDataLimit,
+		catalog:       res.InstanceCatalog,
+	}, nil
+}
+
+// remoteProvider is a provider.Provider proxy for a plugin. It implements all
+// the optional provider interfaces, the methods the plugin provider does not
+// support return provider.ErrNotSupported or a zero value.
+type remoteProvider struct {
+	cloud      *cloudProvider
+	generation int
+	// userDataLimit and catalog are reported by the plugin when the provider is created
+	userDataLimit int
+	catalog       *provider.InstanceCatalog
+}
+
+func (p *remoteProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
+	cloudConfigData, err := cloudConfig.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	req := CreateInstanceRequest{
+		PodName:     podName,
+		SandboxID:   sandboxID,
+		CloudConfig: cloudConfigData,
+		Spec: InstanceTypeSpec{
+			InstanceType: spec.InstanceType,
+			VCPUs:        spec.VCPUs,
+			Memory:       spec.Memory,
+			Arch:         spec.Arch,
+			GPUs:         spec.GPUs,
+			RootDiskSize: spec.RootDiskSize,
+			PodNamespace: spec.PodNamespace,
+			Tags:         spec.Tags,
+		},
+	}
+
+	var res CreateInstanceResponse
+	if err := p.cloud.conn.Invoke(ctx, fullMethod("CreateInstance"), &req, &res); err != nil {
+		return nil, err
+	}
+
+	ips, err := parseIPs(res.IPs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &provider.Instance{
+		ID:      res.ID,
+		Name:    res.Name,
+		IPs:     ips,
+		Type:    res.Type,
+		ImageID: res.ImageID,
+	}, nil
+}
+
+func (p *remoteProvider) DeleteInstance(ctx context.Context, instanceID string) error {
+	req := DeleteInstanceRequest{
+		InstanceID: instanceID,
+	}
+	return convertError(p.cloud.conn.Invoke(ctx, fullMethod("DeleteInstance"), &req, &DeleteInstanceResponse{}))
+}
+
+// ListInstances implements provider.InstanceLister
+func (p *remoteProvider) ListInstances(ctx context.Context, clusterID string) ([]*provider.Instance, error) {
+	req := ListInstancesRequest{
+		ClusterID: clusterID,
+	}
+	var res ListInstancesResponse
+	if err := p.cloud.conn.Invoke(ctx, fullMethod("ListInstances"), &req, &res); err != nil {
+		return nil, convertError(err)
+	}
+
+	var instances []*provider.Instance
+	for _, instance := range res.Instances {
+		ips, err := parseIPs(instance.IPs)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, &provider.Instance{
+			ID:        instance.ID,
+			Name:      instance.Name,
+			IPs:       ips,
+			Type:      instance.Type,
+			ImageID:   instance.ImageID,
+			Tags:      instance.Tags,
+			CreatedAt: instance.CreatedAt,
+		})
+	}
+	return instances, nil
+}
+
+// ConsoleOutput implements provider.ConsoleReader
+func (p *remoteProvider) ConsoleOutput(ctx context.Context, instanceID string) ([]byte, error) {
+	req := ConsoleOutputRequest{
+		InstanceID: instanceID,
+	}
+	var res ConsoleOutputResponse
+	if err := p.cloud.conn.Invoke(ctx, fullMethod("ConsoleOutput"), &req, &res); err != nil {
+		return nil, convertError(err)
+	}
+	return res.Output, nil
+}
+
+// AvailableInstances implements provider.QuotaReporter
+func (p *remoteProvider) AvailableInstances(ctx context.Context) (int64, error) {
+	var res AvailableInstancesResponse
+	if err := p.cloud.conn.Invoke(ctx, fullMethod("AvailableInstances"), &AvailableInstancesRequest{}, &res); err != nil {
+		return 0, convertError(err)
+	}
+	return res.Available, nil
+}
+
+// UserDataLimit implements provider.UserDataLimiter, 0 means no limit
+func (p *remoteProvider) UserDataLimit() int {
+	return p.userDataLimit
+}
+
+// InstanceCatalog implements provider.CatalogReporter. The catalog is empty
+// if the plugin provider does not report one.
+func (p *remoteProvider) InstanceCatalog() provider.InstanceCatalog {
+	if p.catalog == nil {
+		return provider.InstanceCatalog{}
+	}
+	return *p.catalog
+}
+
+func (p *remoteProvider) ConfigVerifier() error {
+	return p.cloud.conn.Invoke(context.Background(), fullMethod("ConfigVerifier"), &ConfigVerifierRequest{}, &ConfigVerifierResponse{})
+}
+
+// Teardown tears down the plugin provider and stops the plugin process if it was spawned by us
+func (p *remoteProvider) Teardown() error {
+	p.cloud.mutex.Lock()
+	replaced := p.generation != p.cloud.generation
+	p.cloud.mutex.Unlock()
+
+	// The plugin tears down a replaced provider by itself
+	if replaced {
+		return nil
+	}
+
+	err := p.cloud.conn.Invoke(context.Background(), fullMethod("Teardown"), &TeardownRequest{}, &TeardownResponse{})
+
+	p.cloud.conn.Close()
+
+	if cmd := p.cloud.cmd; cmd != nil {
+		if sigErr := cmd.Process.Signal(syscall.SIGTERM); sigErr != nil {
+			logger.Printf("stopping plugin %s: %v", p.cloud.name, sigErr)
+		}
+		_ = cmd.Wait()
+	}
+	if p.cloud.socketDir != "" {
+		os.RemoveAll(p.cloud.socketDir)
+	}
+
+	return err
+}
+
+// convertError maps the status codes returned by a plugin to the provider
+// errors. Plugins built before an optional method was added to the protocol
+// return codes.Unimplemented too.
+func convertError(err error) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return fmt.Errorf("%w: %s", provider.ErrInstanceNotFound, status.Convert(err).Message())
+	case codes.Unimplemented:
+		return fmt.Errorf("%w: %s", provider.ErrNotSupported, status.Convert(err).Message())
+	}
+	return err
+}
+
+// parseIPs converts the IP addresses returned by a plugin
+func parseIPs(addrs []string) ([]netip.Addr, error) {
+	var ips []netip.Addr
+	for _, addr := range addrs {
+		ip, err := netip.ParseAddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing instance IP %q: %w", addr, err)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
@@ -0,0 +1,22 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// docker-plugin is a reference out-of-process cloud provider plugin wrapping
+// the docker provider. Build it as a binary named "docker" and point
+// CLOUD_PROVIDER_EXTERNAL_PLUGIN_PATH to it.
+package main
+
+import (
+	"log"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/docker"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/grpcplugin"
+)
+
+func main() {
+	// Use the manager directly rather than provider.Get, which would try to
+	// load the external plugin again from the inherited environment
+	if err := grpcplugin.Serve("docker", &docker.Manager{}); err != nil {
+		log.Fatalf("docker plugin: %v", err)
+	}
+}
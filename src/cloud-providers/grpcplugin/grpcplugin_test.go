@@ -0,0 +1,368 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package grpcplugin
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+// Mock cloud provider served by the plugin
+type mockCloudProvider struct {
+	imageID    string
+	disableCVM bool
+	provider   *mockProvider
+}
+
+func (m *mockCloudProvider) ParseCmd(flags *flag.FlagSet) {
+	flags.StringVar(&m.imageID, "imageid", "default-image", "Image ID")
+	flags.BoolVar(&m.disableCVM, "disable-cvm", false, "Disable CVM")
+}
+
+func (m *mockCloudProvider) LoadEnv() {
+}
+
+func (m *mockCloudProvider) NewProvider() (provider.Provider, error) {
+	m.provider = &mockProvider{imageID: m.imageID, disableCVM: m.disableCVM}
+	return m.provider, nil
+}
+
+func (m *mockCloudProvider) NewProviderWithEnv(env map[string]string) (provider.Provider, error) {
+	m.provider = &mockProvider{imageID: env["PODVM_IMAGE_ID"], disableCVM: m.disableCVM}
+	return m.provider, nil
+}
+
+type mockProvider struct {
+	imageID     string
+	disableCVM  bool
+	cloudConfig string
+	spec        provider.InstanceTypeSpec
+	deleted     string
+	tornDown    bool
+}
+
+func (p *mockProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
+	data, err := cloudConfig.Generate()
+	if err != nil {
+		return nil, err
+	}
+	p.cloudConfig = data
+	p.spec = spec
+	return &provider.Instance{
+		ID:   "i-" + sandboxID,
+		Name: "podvm-" + podName,
+		IPs:  []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+	}, nil
+}
+
+func (p *mockProvider) DeleteInstance(ctx context.Context, instanceID string) error {
+	if instanceID == "unknown" {
+		return fmt.Errorf("%w: %s", provider.ErrInstanceNotFound, instanceID)
+	}
+	p.deleted = instanceID
+	return nil
+}
+
+func (p *mockProvider) Teardown() error {
+	p.tornDown = true
+	return nil
+}
+
+func (p *mockProvider) ConfigVerifier() error {
+	if p.imageID == "" {
+		return errors.New("ImageId is empty")
+	}
+	return nil
+}
+
+func (p *mockProvider) ListInstances(ctx context.Context, clusterID string) ([]*provider.Instance, error) {
+	return []*provider.Instance{{
+		ID:        "i-1",
+		Name:      "podvm-test",
+		IPs:       []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+		Tags:      map[string]string{provider.ClusterIDTagKey: clusterID},
+		CreatedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	}}, nil
+}
+
+func (p *mockProvider) ConsoleOutput(ctx context.Context, instanceID string) ([]byte, error) {
+	return []byte("console of " + instanceID), nil
+}
+
+func (p *mockProvider) AvailableInstances(ctx context.Context) (int64, error) {
+	return 7, nil
+}
+
+func (p *mockProvider) UserDataLimit() int {
+	return 16384
+}
+
+func (p *mockProvider) InstanceCatalog() provider.InstanceCatalog {
+	return provider.InstanceCatalog{DefaultInstanceType: "t2.small", InstanceTypes: []string{"t2.small", "t2.large"}}
+}
+
+// Mock cloud provider whose provider implements none of the optional interfaces
+type basicCloudProvider struct{}
+
+func (*basicCloudProvider) ParseCmd(flags *flag.FlagSet) {}
+
+func (*basicCloudProvider) LoadEnv() {}
+
+func (*basicCloudProvider) NewProvider() (provider.Provider, error) {
+	return &basicProvider{}, nil
+}
+
+type basicProvider struct{}
+
+func (*basicProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (*basicProvider) DeleteInstance(ctx context.Context, instanceID string) error {
+	return nil
+}
+
+func (*basicProvider) Teardown() error {
+	return nil
+}
+
+func (*basicProvider) ConfigVerifier() error {
+	return nil
+}
+
+type mockCloudConfig struct{}
+
+func (c *mockCloudConfig) Generate() (string, error) {
+	return "cloud config", nil
+}
+
+func startPlugin(t *testing.T, cloud provider.CloudProvider) string {
+	socketPath := filepath.Join(t.TempDir(), "plugin.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := NewGRPCServer("mock", cloud)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return "unix://" + socketPath
+}
+
+func TestPlugin(t *testing.T) {
+	cloud := &mockCloudProvider{}
+	address := startPlugin(t, cloud)
+
+	remote, err := dial("mock", address)
+	if err != nil {
+		t.Fatalf("dial() error = %v", err)
+	}
+
+	// The plugin flags are registered next to the adaptor flags
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.String("socket", "", "adaptor flag")
+	remote.ParseCmd(flags)
+	if err := flags.Parse([]string{"-imageid=test-image", "-disable-cvm"}); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if f := flags.Lookup("imageid"); f == nil || f.DefValue != "default-image" {
+		t.Errorf("imageid flag not registered with its default: %+v", f)
+	}
+
+	remote.LoadEnv()
+	p, err := remote.NewProvider()
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	if cloud.imageID != "test-image" || !cloud.disableCVM {
+		t.Errorf("flags not forwarded to plugin: imageID = %q, disableCVM = %v", cloud.imageID, cloud.disableCVM)
+	}
+
+	if err := p.ConfigVerifier(); err != nil {
+		t.Errorf("ConfigVerifier() error = %v", err)
+	}
+
+	spec := provider.InstanceTypeSpec{InstanceType: "t2.small", VCPUs: 2, Memory: 2048, RootDiskSize: 20, PodNamespace: "default", Tags: map[string]string{"peerpods-namespace": "default"}}
+	instance, err := p.CreateInstance(context.Background(), "test", "123", &mockCloudConfig{}, spec)
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	want := &provider.Instance{
+		ID:   "i-123",
+		Name: "podvm-test",
+		IPs:  []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+	}
+	if !reflect.DeepEqual(instance, want) {
+		t.Errorf("CreateInstance() = %+v, want %+v", instance, want)
+	}
+	if cloud.provider.cloudConfig != "cloud config" {
+		t.Errorf("plugin got cloud config %q", cloud.provider.cloudConfig)
+	}
+	if !reflect.DeepEqual(cloud.provider.spec, spec) {
+		t.Errorf("plugin got spec %+v, want %+v", cloud.provider.spec, spec)
+	}
+
+	if err := p.DeleteInstance(context.Background(), "i-123"); err != nil {
+		t.Errorf("DeleteInstance() error = %v", err)
+	}
+	if cloud.provider.deleted != "i-123" {
+		t.Errorf("plugin deleted %q", cloud.provider.deleted)
+	}
+	if err := p.DeleteInstance(context.Background(), "unknown"); !errors.Is(err, provider.ErrInstanceNotFound) {
+		t.Errorf("DeleteInstance() error = %v, want %v", err, provider.ErrInstanceNotFound)
+	}
+
+	if err := p.Teardown(); err != nil {
+		t.Errorf("Teardown() error = %v", err)
+	}
+}
+
+func TestPluginReload(t *testing.T) {
+	cloud := &mockCloudProvider{}
+	address := startPlugin(t, cloud)
+
+	remote, err := dial("mock", address)
+	if err != nil {
+		t.Fatalf("dial() error = %v", err)
+	}
+
+	old, err := remote.NewProvider()
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	replaced := cloud.provider
+
+	var reloadable provider.ReloadableCloudProvider = remote
+	p, err := reloadable.NewProviderWithEnv(map[string]string{"PODVM_IMAGE_ID": "new-image"})
+	if err != nil {
+		t.Fatalf("NewProviderWithEnv() error = %v", err)
+	}
+	if cloud.provider.imageID != "new-image" {
+		t.Errorf("env not forwarded to plugin: imageID = %q", cloud.provider.imageID)
+	}
+	if !replaced.tornDown {
+		t.Errorf("replaced provider not torn down by the plugin")
+	}
+
+	// Tearing down the replaced provider leaves the plugin running
+	if err := old.Teardown(); err != nil {
+		t.Errorf("Teardown() error = %v", err)
+	}
+	if err := p.ConfigVerifier(); err != nil {
+		t.Errorf("ConfigVerifier() error = %v", err)
+	}
+	if cloud.provider.tornDown {
+		t.Errorf("current provider torn down along with the replaced one")
+	}
+}
+
+func TestLaunchCleansUpSocketDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+
+	if _, err := (launcher{}).Launch("mock", filepath.Join(tmpDir, "missing")); err == nil {
+		t.Fatalf("Launch() expected an error for a missing plugin binary")
+	}
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("socket directory %s left behind", entries[0].Name())
+	}
+}
+
+func TestPluginNotInitialized(t *testing.T) {
+	address := startPlugin(t, &mockCloudProvider{})
+
+	remote, err := dial("mock", address)
+	if err != nil {
+		t.Fatalf("dial() error = %v", err)
+	}
+
+	p := &remoteProvider{cloud: remote}
+	if err := p.ConfigVerifier(); err == nil {
+		t.Errorf("ConfigVerifier() expected an error before NewProvider")
+	}
+}
+
+func TestPluginCapabilities(t *testing.T) {
+	remote, err := dial("mock", startPlugin(t, &mockCloudProvider{}))
+	if err != nil {
+		t.Fatalf("dial() error = %v", err)
+	}
+	p, err := remote.NewProvider()
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	ctx := context.Background()
+
+	instances, err := p.(provider.InstanceLister).ListInstances(ctx, "cluster")
+	if err != nil {
+		t.Fatalf("ListInstances() error = %v", err)
+	}
+	wantInstances := []*provider.Instance{{
+		ID:        "i-1",
+		Name:      "podvm-test",
+		IPs:       []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+		Tags:      map[string]string{provider.ClusterIDTagKey: "cluster"},
+		CreatedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	}}
+	if !reflect.DeepEqual(instances, wantInstances) {
+		t.Errorf("ListInstances() = %+v, want %+v", instances, wantInstances)
+	}
+
+	if output, err := p.(provider.ConsoleReader).ConsoleOutput(ctx, "i-1"); err != nil || string(output) != "console of i-1" {
+		t.Errorf("ConsoleOutput() = %q, %v", output, err)
+	}
+	if available, err := p.(provider.QuotaReporter).AvailableInstances(ctx); err != nil || available != 7 {
+		t.Errorf("AvailableInstances() = %d, %v", available, err)
+	}
+	if limit := p.(provider.UserDataLimiter).UserDataLimit(); limit != 16384 {
+		t.Errorf("UserDataLimit() = %d, want 16384", limit)
+	}
+	if catalog := p.(provider.CatalogReporter).InstanceCatalog(); catalog.DefaultInstanceType != "t2.small" || len(catalog.InstanceTypes) != 2 {
+		t.Errorf("InstanceCatalog() = %+v", catalog)
+	}
+}
+
+func TestPluginCapabilitiesNotSupported(t *testing.T) {
+	remote, err := dial("basic", startPlugin(t, &basicCloudProvider{}))
+	if err != nil {
+		t.Fatalf("dial() error = %v", err)
+	}
+	p, err := remote.NewProvider()
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := p.(provider.InstanceLister).ListInstances(ctx, "cluster"); !errors.Is(err, provider.ErrNotSupported) {
+		t.Errorf("ListInstances() error = %v, want %v", err, provider.ErrNotSupported)
+	}
+	if _, err := p.(provider.ConsoleReader).ConsoleOutput(ctx, "i-1"); !errors.Is(err, provider.ErrNotSupported) {
+		t.Errorf("ConsoleOutput() error = %v, want %v", err, provider.ErrNotSupported)
+	}
+	if _, err := p.(provider.QuotaReporter).AvailableInstances(ctx); !errors.Is(err, provider.ErrNotSupported) {
+		t.Errorf("AvailableInstances() error = %v, want %v", err, provider.ErrNotSupported)
+	}
+	if limit := p.(provider.UserDataLimiter).UserDataLimit(); limit != 0 {
+		t.Errorf("UserDataLimit() = %d, want 0", limit)
+	}
+	if catalog := p.(provider.CatalogReporter).InstanceCatalog(); !reflect.DeepEqual(catalog, provider.InstanceCatalog{}) {
+		t.Errorf("InstanceCatalog() = %+v, want an empty catalog", catalog)
+	}
+}
@@ -0,0 +1,212 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package grpcplugin implements out-of-process cloud provider plugins.
+//
+// A plugin is a standalone binary that calls Serve with a provider.CloudProvider.
+// The adaptor (or peerpod-ctrl) spawns the binary, or dials an already running
+// one, and registers a proxy CloudProvider in the provider table. Unlike Go
+// plugins loaded with plugin.Open, the plugin binary does not have to be built
+// with the same toolchain and dependency versions as the adaptor.
+//
+// The protocol is plain gRPC over a unix domain socket. Messages are encoded as
+// JSON so that plugins can be implemented without generated protobuf code.
+package grpcplugin
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"google.golang.org/grpc"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+const (
+	serviceName = "cloudprovider.v1.CloudProviderPlugin"
+
+	// SocketEnv is the environment variable holding the unix socket path a
+	// spawned plugin must listen on
+	SocketEnv = "CLOUD_PROVIDER_PLUGIN_SOCKET"
+)
+
+// FlagSpec describes a configuration flag of the plugin provider, as
+// registered by its ParseCmd method
+type FlagSpec struct {
+	Name    string `json:"name"`
+	Usage   string `json:"usage"`
+	Default string `json:"default"`
+	IsBool  bool   `json:"isBool,omitempty"`
+}
+
+type GetConfigSchemaRequest struct{}
+
+type GetConfigSchemaResponse struct {
+	Flags []FlagSpec `json:"flags"`
+}
+
+type NewProviderRequest struct {
+	// Flags holds the flags explicitly set on the adaptor command line
+	Flags map[string]string `json:"flags"`
+	// Env holds the environment variables replacing the plugin process
+	// environment, when the adaptor reloads its configuration
+	Env map[string]string `json:"env,omitempty"`
+}
+
+type NewProviderResponse struct {
+	// UserDataLimit is set when the provider implements provider.UserDataLimiter
+	UserDataLimit int `json:"userDataLimit,omitempty"`
+	// InstanceCatalog is set when the provider implements provider.CatalogReporter
+	InstanceCatalog *provider.InstanceCatalog `json:"instanceCatalog,omitempty"`
+}
+
+type InstanceTypeSpec struct {
+	InstanceType string            `json:"instanceType,omitempty"`
+	VCPUs        int64             `json:"vcpus,omitempty"`
+	Memory       int64             `json:"memory,omitempty"`
+	Arch         string            `json:"arch,omitempty"`
+	GPUs         int64             `json:"gpus,omitempty"`
+	RootDiskSize int64             `json:"rootDiskSize,omitempty"`
+	PodNamespace string            `json:"podNamespace,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+}
+
+type CreateInstanceRequest struct {
+	PodName   string `json:"podName"`
+	SandboxID string `json:"sandboxID"`
+	// CloudConfig is the cloud-config document generated by the adaptor
+	CloudConfig string           `json:"cloudConfig"`
+	Spec        InstanceTypeSpec `json:"spec"`
+}
+
+type CreateInstanceResponse struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	IPs     []string `json:"ips"`
+	Type    string   `json:"type,omitempty"`
+	ImageID string   `json:"imageID,omitempty"`
+}
+
+type DeleteInstanceRequest struct {
+	InstanceID string `json:"instanceID"`
+}
+
+type DeleteInstanceResponse struct{}
+
+// Instance is an instance returned by ListInstances
+type Instance struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	IPs       []string          `json:"ips,omitempty"`
+	Type      string            `json:"type,omitempty"`
+	ImageID   string            `json:"imageID,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// The optional methods below return codes.Unimplemented when the plugin
+// provider does not implement the matching interface
+
+type ListInstancesRequest struct {
+	ClusterID string `json:"clusterID"`
+}
+
+type ListInstancesResponse struct {
+	Instances []Instance `json:"instances"`
+}
+
+type ConsoleOutputRequest struct {
+	InstanceID string `json:"instanceID"`
+}
+
+type ConsoleOutputResponse struct {
+	Output []byte `json:"output"`
+}
+
+type AvailableInstancesRequest struct{}
+
+type AvailableInstancesResponse struct {
+	Available int64 `json:"available"`
+}
+
+type ConfigVerifierRequest struct{}
+
+type ConfigVerifierResponse struct{}
+
+type TeardownRequest struct{}
+
+type TeardownResponse struct{}
+
+// pluginServer is implemented by the plugin side of the protocol
+type pluginServer interface {
+	GetConfigSchema(context.Context, *GetConfigSchemaRequest) (*GetConfigSchemaResponse, error)
+	NewProvider(context.Context, *NewProviderRequest) (*NewProviderResponse, error)
+	CreateInstance(context.Context, *CreateInstanceRequest) (*CreateInstanceResponse, error)
+	DeleteInstance(context.Context, *DeleteInstanceRequest) (*DeleteInstanceResponse, error)
+	ConfigVerifier(context.Context, *ConfigVerifierRequest) (*ConfigVerifierResponse, error)
+	Teardown(context.Context, *TeardownRequest) (*TeardownResponse, error)
+	ListInstances(context.Context, *ListInstancesRequest) (*ListInstancesResponse, error)
+	ConsoleOutput(context.Context, *ConsoleOutputRequest) (*ConsoleOutputResponse, error)
+	AvailableInstances(context.Context, *AvailableInstancesRequest) (*AvailableInstancesResponse, error)
+}
+
+// jsonCodec encodes gRPC messages as JSON
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func fullMethod(method string) string {
+	return "/" + serviceName + "/" + method
+}
+
+// unaryHandler adapts a typed pluginServer method to a grpc.MethodDesc handler
+func unaryHandler[Req, Resp any](method string, call func(pluginServer, context.Context, *Req) (*Resp, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := new(Req)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(pluginServer), ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: fullMethod(method),
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(pluginServer), ctx, req.(*Req))
+			}
+			return interceptor(ctx, req, info, handler)
+		},
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*pluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryHandler("GetConfigSchema", pluginServer.GetConfigSchema),
+		unaryHandler("NewProvider", pluginServer.NewProvider),
+		unaryHandler("CreateInstance", pluginServer.CreateInstance),
+		unaryHandler("DeleteInstance", pluginServer.DeleteInstance),
+		unaryHandler("ConfigVerifier", pluginServer.ConfigVerifier),
+		unaryHandler("Teardown", pluginServer.Teardown),
+		unaryHandler("ListInstances", pluginServer.ListInstances),
+		unaryHandler("ConsoleOutput", pluginServer.ConsoleOutput),
+		unaryHandler("AvailableInstances", pluginServer.AvailableInstances),
+	},
+	Streams: []grpc.StreamDesc{},
+}
@@ -0,0 +1,330 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package grpcplugin
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+var logger = log.New(log.Writer(), "[adaptor/cloud/grpcplugin] ", log.LstdFlags|log.Lmsgprefix)
+
+var errNoProvider = errors.New("provider is not initialized, NewProvider must be called first")
+
+// server exposes a provider.CloudProvider over the plugin protocol
+type server struct {
+	cloud    provider.CloudProvider
+	flags    *flag.FlagSet
+	mutex    sync.Mutex
+	provider *provider.SwappableProvider
+}
+
+func newServer(name string, cloud provider.CloudProvider) *server {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	cloud.ParseCmd(flags)
+
+	return &server{
+		cloud: cloud,
+		flags: flags,
+	}
+}
+
+// Serve serves cloud on the unix socket named by the CLOUD_PROVIDER_PLUGIN_SOCKET
+// environment variable until the process receives SIGINT or SIGTERM. It is meant
+// to be called from the main function of a plugin binary.
+func Serve(name string, cloud provider.CloudProvider) error {
+	socketPath := os.Getenv(SocketEnv)
+	if socketPath == "" {
+		return fmt.Errorf("%s is not set", SocketEnv)
+	}
+
+	if err := os.RemoveAll(socketPath); err != nil {
+		return fmt.Errorf("removing stale socket %s: %w", socketPath, err)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", socketPath, err)
+	}
+
+	grpcServer := NewGRPCServer(name, cloud)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		grpcServer.GracefulStop()
+	}()
+
+	logger.Printf("serving cloud provider %s on %s", name, socketPath)
+
+	return grpcServer.Serve(listener)
+}
+
+// NewGRPCServer returns a gRPC server with the plugin service for cloud registered
+func NewGRPCServer(name string, cloud provider.CloudProvider) *grpc.Server {
+	grpcServer := grpc.NewServer(grpc.ForceServerCodec(jsonCodec{}))
+	grpcServer.RegisterService(&serviceDesc, newServer(name, cloud))
+	return grpcServer
+}
+
+func (s *server) GetConfigSchema(ctx context.Context, req *GetConfigSchemaRequest) (*GetConfigSchemaResponse, error) {
+	var res GetConfigSchemaResponse
+
+	s.flags.VisitAll(func(f *flag.Flag) {
+		spec := FlagSpec{
+			Name:    f.Name,
+			Usage:   f.Usage,
+			Default: f.DefValue,
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok {
+			spec.IsBool = b.IsBoolFlag()
+		}
+		res.Flags = append(res.Flags, spec)
+	})
+
+	return &res, nil
+}
+
+func (s *server) NewProvider(ctx context.Context, req *NewProviderRequest) (*NewProviderResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for name, value := range req.Flags {
+		if err := s.flags.Set(name, value); err != nil {
+			return nil, fmt.Errorf("setting flag %q: %w", name, err)
+		}
+	}
+
+	var p provider.Provider
+	var err error
+	if reloadable, ok := s.cloud.(provider.ReloadableCloudProvider); ok && req.Env != nil {
+		p, err = reloadable.NewProviderWithEnv(req.Env)
+	} else {
+		// The plugin process inherits the environment of the adaptor
+		s.cloud.LoadEnv()
+		p, err = s.cloud.NewProvider()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// In-flight calls complete with the provider they started with
+	if s.provider == nil {
+		s.provider = provider.NewSwappableProvider(p)
+	} else {
+		s.provider.Swap(p)
+	}
+
+	res := &NewProviderResponse{}
+	if limiter, ok := p.(provider.UserDataLimiter); ok {
+		res.UserDataLimit = limiter.UserDataLimit()
+	}
+	if reporter, ok := p.(provider.CatalogReporter); ok {
+		catalog := reporter.InstanceCatalog()
+		res.InstanceCatalog = &catalog
+	}
+
+	return res, nil
+}
+
+// getProvider returns the current provider and a function to call once the
+// request using it completes
+func (s *server) getProvider() (provider.Provider, func(), error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.provider == nil {
+		return nil, nil, errNoProvider
+	}
+	p, release := s.provider.Acquire()
+	return p, release, nil
+}
+
+// cloudConfig returns a cloud-config document generated by the adaptor
+type cloudConfig string
+
+func (c cloudConfig) Generate() (string, error) {
+	return string(c), nil
+}
+
+func (s *server) CreateInstance(ctx context.Context, req *CreateInstanceRequest) (*CreateInstanceResponse, error) {
+	p, release, err := s.getProvider()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	spec := provider.InstanceTypeSpec{
+		InstanceType: req.Spec.InstanceType,
+		VCPUs:        req.Spec.VCPUs,
+		Memory:       req.Spec.Memory,
+		Arch:         req.Spec.Arch,
+		GPUs:         req.Spec.GPUs,
+		RootDiskSize: req.Spec.RootDiskSize,
+		PodNamespace: req.Spec.PodNamespace,
+		Tags:         req.Spec.Tags,
+	}
+
+	instance, err := p.CreateInstance(ctx, req.PodName, req.SandboxID, cloudConfig(req.CloudConfig), spec)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &CreateInstanceResponse{
+		ID:      instance.ID,
+		Name:    instance.Name,
+		IPs:     formatIPs(instance.IPs),
+		Type:    instance.Type,
+		ImageID: instance.ImageID,
+	}
+
+	return res, nil
+}
+
+func (s *server) DeleteInstance(ctx context.Context, req *DeleteInstanceRequest) (*DeleteInstanceResponse, error) {
+	p, release, err := s.getProvider()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if err := p.DeleteInstance(ctx, req.InstanceID); err != nil {
+		if errors.Is(err, provider.ErrInstanceNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, err
+	}
+
+	return &DeleteInstanceResponse{}, nil
+}
+
+func (s *server) ConfigVerifier(ctx context.Context, req *ConfigVerifierRequest) (*ConfigVerifierResponse, error) {
+	p, release, err := s.getProvider()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if err := p.ConfigVerifier(); err != nil {
+		return nil, err
+	}
+
+	return &ConfigVerifierResponse{}, nil
+}
+
+func (s *server) Teardown(ctx context.Context, req *TeardownRequest) (*TeardownResponse, error) {
+	s.mutex.Lock()
+	providers := s.provider
+	s.mutex.Unlock()
+
+	if providers == nil {
+		return nil, errNoProvider
+	}
+
+	if err := providers.Teardown(); err != nil {
+		return nil, err
+	}
+
+	return &TeardownResponse{}, nil
+}
+
+func (s *server) ListInstances(ctx context.Context, req *ListInstancesRequest) (*ListInstancesResponse, error) {
+	p, release, err := s.getProvider()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	lister, ok := p.(provider.InstanceLister)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "provider does not list instances")
+	}
+
+	instances, err := lister.ListInstances(ctx, req.ClusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ListInstancesResponse{}
+	for _, instance := range instances {
+		res.Instances = append(res.Instances, Instance{
+			ID:        instance.ID,
+			Name:      instance.Name,
+			IPs:       formatIPs(instance.IPs),
+			Type:      instance.Type,
+			ImageID:   instance.ImageID,
+			Tags:      instance.Tags,
+			CreatedAt: instance.CreatedAt,
+		})
+	}
+
+	return res, nil
+}
+
+func (s *server) ConsoleOutput(ctx context.Context, req *ConsoleOutputRequest) (*ConsoleOutputResponse, error) {
+	p, release, err := s.getProvider()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	reader, ok := p.(provider.ConsoleReader)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "provider does not read the console output")
+	}
+
+	output, err := reader.ConsoleOutput(ctx, req.InstanceID)
+	if err != nil {
+		if errors.Is(err, provider.ErrInstanceNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, err
+	}
+
+	return &ConsoleOutputResponse{Output: output}, nil
+}
+
+func (s *server) AvailableInstances(ctx context.Context, req *AvailableInstancesRequest) (*AvailableInstancesResponse, error) {
+	p, release, err := s.getProvider()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	reporter, ok := p.(provider.QuotaReporter)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "provider does not report the quota")
+	}
+
+	available, err := reporter.AvailableInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AvailableInstancesResponse{Available: available}, nil
+}
+
+func formatIPs(ips []netip.Addr) []string {
+	var addrs []string
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+	return addrs
+}
@@ -35,26 +35,30 @@ func (_ *Manager) ParseCmd(flags *flag.FlagSet) {
 }
 
 func (_ *Manager) LoadEnv() {
+	loadEnv(&ibmcloudPowerVSConfig, provider.DefaultToEnv)
+}
+
+func loadEnv(cfg *Config, load provider.EnvLoadFunc) {
 	// overwrite config set by cmd parameters in oci image with env might come from orchastration platform
-	provider.DefaultToEnv(&ibmcloudPowerVSConfig.ApiKey, "IBMCLOUD_API_KEY", "")
+	load(&cfg.ApiKey, "IBMCLOUD_API_KEY", "")
 
-	provider.DefaultToEnv(&ibmcloudPowerVSConfig.Zone, "POWERVS_ZONE", "")
-	provider.DefaultToEnv(&ibmcloudPowerVSConfig.ServiceInstanceID, "POWERVS_SERVICE_INSTANCE_ID", "")
-	provider.DefaultToEnv(&ibmcloudPowerVSConfig.NetworkID, "POWERVS_NETWORK_ID", "")
-	provider.DefaultToEnv(&ibmcloudPowerVSConfig.ImageID, "POWERVS_IMAGE_ID", "")
-	provider.DefaultToEnv(&ibmcloudPowerVSConfig.SSHKey, "POWERVS_SSH_KEY_NAME", "")
-	provider.DefaultToEnv(&ibmcloudPowerVSConfig.ProcessorType, "POWERVS_PROCESSOR_TYPE", "")
-	provider.DefaultToEnv(&ibmcloudPowerVSConfig.SystemType, "POWERVS_SYSTEM_TYPE", "")
+	load(&cfg.Zone, "POWERVS_ZONE", "")
+	load(&cfg.ServiceInstanceID, "POWERVS_SERVICE_INSTANCE_ID", "")
+	load(&cfg.NetworkID, "POWERVS_NETWORK_ID", "")
+	load(&cfg.ImageID, "POWERVS_IMAGE_ID", "")
+	load(&cfg.SSHKey, "POWERVS_SSH_KEY_NAME", "")
+	load(&cfg.ProcessorType, "POWERVS_PROCESSOR_TYPE", "")
+	load(&cfg.SystemType, "POWERVS_SYSTEM_TYPE", "")
 
 	var memoryStr, processorsStr string
-	provider.DefaultToEnv(&memoryStr, "POWERVS_MEMORY", "")
+	load(&memoryStr, "POWERVS_MEMORY", "")
 	if memoryStr != "" {
-		ibmcloudPowerVSConfig.Memory, _ = strconv.ParseFloat(memoryStr, 64)
+		cfg.Memory, _ = strconv.ParseFloat(memoryStr, 64)
 	}
 
-	provider.DefaultToEnv(&processorsStr, "POWERVS_MEMORY", "")
+	load(&processorsStr, "POWERVS_MEMORY", "")
 	if processorsStr != "" {
-		ibmcloudPowerVSConfig.Processors, _ = strconv.ParseFloat(processorsStr, 64)
+		cfg.Processors, _ = strconv.ParseFloat(processorsStr, 64)
 	}
 }
 
@@ -62,6 +66,12 @@ func (_ *Manager) NewProvider() (provider.Provider, error) {
 	return NewProvider(&ibmcloudPowerVSConfig)
 }
 
+func (_ *Manager) NewProviderWithEnv(env map[string]string) (provider.Provider, error) {
+	cfg := ibmcloudPowerVSConfig
+	loadEnv(&cfg, provider.OverrideFromEnv(env))
+	return NewProvider(&cfg)
+}
+
 func (_ *Manager) GetConfig() (config *Config) {
 	return &ibmcloudPowerVSConfig
 }
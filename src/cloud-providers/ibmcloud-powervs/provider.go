@@ -6,11 +6,13 @@ package ibmcloud_powervs
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"net/netip"
 	"time"
 
+	"github.com/IBM-Cloud/power-go-client/power/client/p_cloud_p_vm_instances"
 	"github.com/IBM-Cloud/power-go-client/power/models"
 	"github.com/IBM/go-sdk-core/v5/core"
 	"github.com/avast/retry-go/v4"
@@ -120,15 +122,21 @@ func (p *ibmcloudPowerVSProvider) CreateInstance(ctx context.Context, podName, s
 	}
 
 	return &provider.Instance{
-		ID:   instanceID,
-		Name: instanceName,
-		IPs:  ips,
+		ID:      instanceID,
+		Name:    instanceName,
+		IPs:     ips,
+		Type:    p.serviceConfig.SystemType,
+		ImageID: p.serviceConfig.ImageID,
 	}, nil
 }
 
 func (p *ibmcloudPowerVSProvider) DeleteInstance(ctx context.Context, instanceID string) error {
 
 	err := p.powervsService.instanceClient(ctx).Delete(instanceID)
+	var notFound *p_cloud_p_vm_instances.PcloudPvminstancesDeleteNotFound
+	if errors.As(err, &notFound) {
+		return fmt.Errorf("%w: %s", provider.ErrInstanceNotFound, instanceID)
+	}
 	if err != nil {
 		logger.Printf("failed to delete an instance: %v", err)
 		return err
@@ -5,6 +5,7 @@ package ibmcloud
 
 import (
 	"flag"
+	"slices"
 
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 )
@@ -35,34 +36,40 @@ func (_ *Manager) ParseCmd(flags *flag.FlagSet) {
 	flags.StringVar(&ibmcloudVPCConfig.SecondarySecurityGroupID, "secondary-security-group-id", "", "Secondary security group ID")
 	flags.StringVar(&ibmcloudVPCConfig.KeyID, "key-id", "", "SSH Key ID")
 	flags.StringVar(&ibmcloudVPCConfig.VpcID, "vpc-id", "", "VPC ID")
+	flags.StringVar(&ibmcloudVPCConfig.ClusterID, "cluster-id", "", "Cluster ID attached as a user tag to the Pod VMs to allow garbage collection of orphaned instances, defaults to `PEERPODS_CLUSTER_ID`")
 
 }
 
 func (_ *Manager) LoadEnv() {
+	loadEnv(&ibmcloudVPCConfig, provider.DefaultToEnv)
+}
+
+func loadEnv(cfg *Config, load provider.EnvLoadFunc) {
 	// overwrite config set by cmd parameters in oci image with env might come from orchastration platform
-	provider.DefaultToEnv(&ibmcloudVPCConfig.ApiKey, "IBMCLOUD_API_KEY", "")
-	provider.DefaultToEnv(&ibmcloudVPCConfig.IAMProfileID, "IBMCLOUD_IAM_PROFILE_ID", "")
-
-	provider.DefaultToEnv(&ibmcloudVPCConfig.IamServiceURL, "IBMCLOUD_IAM_ENDPOINT", "")
-	provider.DefaultToEnv(&ibmcloudVPCConfig.VpcServiceURL, "IBMCLOUD_VPC_ENDPOINT", "")
-	provider.DefaultToEnv(&ibmcloudVPCConfig.ResourceGroupID, "IBMCLOUD_RESOURCE_GROUP_ID", "")
-	provider.DefaultToEnv(&ibmcloudVPCConfig.ProfileName, "IBMCLOUD_PODVM_INSTANCE_PROFILE_NAME", "")
-	provider.DefaultToEnv(&ibmcloudVPCConfig.ZoneName, "IBMCLOUD_ZONE", "")
-	provider.DefaultToEnv(&ibmcloudVPCConfig.PrimarySubnetID, "IBMCLOUD_VPC_SUBNET_ID", "")
-	provider.DefaultToEnv(&ibmcloudVPCConfig.PrimarySecurityGroupID, "IBMCLOUD_VPC_SG_ID", "")
-	provider.DefaultToEnv(&ibmcloudVPCConfig.KeyID, "IBMCLOUD_SSH_KEY_ID", "")
-	provider.DefaultToEnv(&ibmcloudVPCConfig.VpcID, "IBMCLOUD_VPC_ID", "")
+	load(&cfg.ApiKey, "IBMCLOUD_API_KEY", "")
+	load(&cfg.IAMProfileID, "IBMCLOUD_IAM_PROFILE_ID", "")
+
+	load(&cfg.IamServiceURL, "IBMCLOUD_IAM_ENDPOINT", "")
+	load(&cfg.VpcServiceURL, "IBMCLOUD_VPC_ENDPOINT", "")
+	load(&cfg.ResourceGroupID, "IBMCLOUD_RESOURCE_GROUP_ID", "")
+	load(&cfg.ProfileName, "IBMCLOUD_PODVM_INSTANCE_PROFILE_NAME", "")
+	load(&cfg.ZoneName, "IBMCLOUD_ZONE", "")
+	load(&cfg.PrimarySubnetID, "IBMCLOUD_VPC_SUBNET_ID", "")
+	load(&cfg.PrimarySecurityGroupID, "IBMCLOUD_VPC_SG_ID", "")
+	load(&cfg.KeyID, "IBMCLOUD_SSH_KEY_ID", "")
+	load(&cfg.VpcID, "IBMCLOUD_VPC_ID", "")
+	load(&cfg.ClusterID, "PEERPODS_CLUSTER_ID", "")
 
 	var instanceProfilesStr string
-	provider.DefaultToEnv(&instanceProfilesStr, "IBMCLOUD_PODVM_INSTANCE_PROFILE_LIST", "")
+	load(&instanceProfilesStr, "IBMCLOUD_PODVM_INSTANCE_PROFILE_LIST", "")
 	if instanceProfilesStr != "" {
-		_ = ibmcloudVPCConfig.InstanceProfiles.Set(instanceProfilesStr)
+		_ = cfg.InstanceProfiles.Set(instanceProfilesStr)
 	}
 
 	var imageIDsStr string
-	provider.DefaultToEnv(&imageIDsStr, "IBMCLOUD_PODVM_IMAGE_ID", "")
+	load(&imageIDsStr, "IBMCLOUD_PODVM_IMAGE_ID", "")
 	if imageIDsStr != "" {
-		_ = ibmcloudVPCConfig.Images.Set(imageIDsStr)
+		_ = cfg.Images.Set(imageIDsStr)
 	}
 }
 
@@ -70,6 +77,21 @@ func (_ *Manager) NewProvider() (provider.Provider, error) {
 	return NewProvider(&ibmcloudVPCConfig)
 }
 
+func (_ *Manager) NewProviderWithEnv(env map[string]string) (provider.Provider, error) {
+	cfg := ibmcloudVPCConfig
+	// The provider fills in the images, don't share them with the current
+	// configuration. loadEnv appends to the lists set in env, start them over.
+	cfg.Images = slices.Clone(cfg.Images)
+	if env["IBMCLOUD_PODVM_INSTANCE_PROFILE_LIST"] != "" {
+		cfg.InstanceProfiles = nil
+	}
+	if env["IBMCLOUD_PODVM_IMAGE_ID"] != "" {
+		cfg.Images = nil
+	}
+	loadEnv(&cfg, provider.OverrideFromEnv(env))
+	return NewProvider(&cfg)
+}
+
 func (_ *Manager) GetConfig() (config *Config) {
 	return &ibmcloudVPCConfig
 }
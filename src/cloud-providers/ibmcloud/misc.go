@@ -0,0 +1,121 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ibmcloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+)
+
+const (
+	// Ref: https://cloud.ibm.com/docs/vpc?topic=vpc-imd-configure-service
+	IBMCloudMetadataUrl = "http://api.metadata.cloud.ibm.com"
+	IBMCloudTokenUrl    = IBMCloudMetadataUrl + tokenPath + "?version=2022-03-01"
+	IBMCloudUserDataUrl = IBMCloudMetadataUrl + "/user_data/v1/user_data?version=2022-03-01"
+
+	tokenPath      = "/instance_identity/v1/token"
+	tokenExpiresIn = 300
+)
+
+// Method to check if the VM is running on IBM Cloud VPC
+// by checking if an instance identity token can be obtained from the metadata service
+// If the VM is running on IBM Cloud VPC, return true
+func IsIBMCloud(ctx context.Context) bool {
+
+	if _, err := getInstanceIdentityToken(ctx, IBMCloudTokenUrl); err != nil {
+		fmt.Printf("failed to get instance identity token: %s\n", err)
+		return false
+	}
+	return true
+}
+
+// Method to retrieve userData from the IBM Cloud VPC metadata service
+// and return it as a string
+func GetUserData(ctx context.Context, url string) ([]byte, error) {
+
+	// If url is empty then return empty string
+	if url == "" {
+		return nil, fmt.Errorf("url is empty")
+	}
+
+	// The token is served by the same endpoint as the user data
+	tokenUrl, err := neturl.Parse(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse url: %s", err)
+	}
+	tokenUrl.Path = tokenPath
+
+	token, err := getInstanceIdentityToken(ctx, tokenUrl.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance identity token: %s", err)
+	}
+
+	client := &http.Client{}
+
+	// Example request for IBM Cloud VPC.
+	// curl -H "Authorization: Bearer $token" "http://api.metadata.cloud.ibm.com/user_data/v1/user_data?version=2022-03-01"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %s", err)
+	}
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to retrieve userData: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %s", err)
+	}
+
+	return body, nil
+}
+
+// getInstanceIdentityToken obtains a short lived token to access the metadata service
+func getInstanceIdentityToken(ctx context.Context, url string) (string, error) {
+
+	client := &http.Client{}
+
+	body := []byte(fmt.Sprintf(`{"expires_in": %d}`, tokenExpiresIn))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %s", err)
+	}
+	req.Header.Add("Metadata-Flavor", "ibm")
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to retrieve token: %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode token: %s", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("empty access token")
+	}
+
+	return token.AccessToken, nil
+}
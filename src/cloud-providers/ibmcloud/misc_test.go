@@ -0,0 +1,45 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ibmcloud
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetUserData(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/instance_identity/v1/token":
+			if r.Method != http.MethodPut || r.Header.Get("Metadata-Flavor") != "ibm" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"access_token": "test-token"}`)) // nolint: errcheck
+		case "/user_data/v1/user_data":
+			if r.Header.Get("Authorization") != "Bearer test-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("userdata")) // nolint: errcheck
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	got, err := GetUserData(context.Background(), srv.URL+"/user_data/v1/user_data?version=2022-03-01")
+	if err != nil {
+		t.Fatalf("GetUserData() error = %v", err)
+	}
+	if string(got) != "userdata" {
+		t.Errorf("GetUserData() = %q, want %q", got, "userdata")
+	}
+
+	if _, err := GetUserData(context.Background(), ""); err == nil {
+		t.Errorf("GetUserData() with empty url should fail")
+	}
+}
@@ -8,11 +8,15 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"net/netip"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/IBM/platform-services-go-sdk/globaltaggingv1"
 	"github.com/IBM/vpc-go-sdk/vpcv1"
 
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
@@ -30,16 +34,33 @@ var errNotReady = errors.New("address not ready")
 
 const maxInstanceNameLen = 63
 
+// maxTagLen is the longest tag name accepted by the global tagging service
+const maxTagLen = 128
+
+// The boot volume of a VPC instance created from an image is 100 GB by
+// default, it can be extended up to 250 GB
+const (
+	defaultBootVolumeCapacity = 100
+	bootVolumeProfile         = "general-purpose"
+)
+
 type vpcV1 interface {
 	CreateInstanceWithContext(context.Context, *vpcv1.CreateInstanceOptions) (*vpcv1.Instance, *core.DetailedResponse, error)
 	GetInstanceWithContext(context.Context, *vpcv1.GetInstanceOptions) (*vpcv1.Instance, *core.DetailedResponse, error)
 	DeleteInstanceWithContext(context.Context, *vpcv1.DeleteInstanceOptions) (*core.DetailedResponse, error)
 	GetInstanceProfileWithContext(context.Context, *vpcv1.GetInstanceProfileOptions) (*vpcv1.InstanceProfile, *core.DetailedResponse, error)
 	GetImageWithContext(ctx context.Context, getImageOptions *vpcv1.GetImageOptions) (*vpcv1.Image, *core.DetailedResponse, error)
+	ListInstancesWithContext(context.Context, *vpcv1.ListInstancesOptions) (*vpcv1.InstanceCollection, *core.DetailedResponse, error)
+}
+
+type globalTagging interface {
+	AttachTagWithContext(context.Context, *globaltaggingv1.AttachTagOptions) (*globaltaggingv1.TagResults, *core.DetailedResponse, error)
+	ListTagsWithContext(context.Context, *globaltaggingv1.ListTagsOptions) (*globaltaggingv1.TagList, *core.DetailedResponse, error)
 }
 
 type ibmcloudVPCProvider struct {
 	vpc           vpcV1
+	tagging       globalTagging
 	serviceConfig *Config
 }
 
@@ -88,6 +109,13 @@ func NewProvider(config *Config) (provider.Provider, error) {
 		return nil, err
 	}
 
+	tagging, err := globaltaggingv1.NewGlobalTaggingV1(&globaltaggingv1.GlobalTaggingV1Options{
+		Authenticator: authenticator,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	// If this label exists assume we are in an IKS cluster
 	primarySubnetID, iks := nodeLabels["ibm-provider.kubernetes.io/subnet-id"]
 	if !iks {
@@ -118,6 +146,7 @@ func NewProvider(config *Config) (provider.Provider, error) {
 
 	provider := &ibmcloudVPCProvider{
 		vpc:           vpcV1,
+		tagging:       tagging,
 		serviceConfig: config,
 	}
 
@@ -167,6 +196,8 @@ func (p *ibmcloudVPCProvider) getInstancePrototype(instanceName, userData, insta
 		Zone:     &vpcv1.ZoneIdentity{Name: &p.serviceConfig.ZoneName},
 		Keys:     []vpcv1.KeyIdentityIntf{},
 		VPC:      &vpcv1.VPCIdentity{ID: &p.serviceConfig.VpcID},
+		// The metadata service serves the user data to process-user-data
+		MetadataService: &vpcv1.InstanceMetadataServicePrototype{Enabled: core.BoolPtr(true)},
 		PrimaryNetworkInterface: &vpcv1.NetworkInterfacePrototype{
 			Subnet: &vpcv1.SubnetIdentity{ID: &p.serviceConfig.PrimarySubnetID},
 			SecurityGroups: []vpcv1.SecurityGroupIdentityIntf{
@@ -259,6 +290,17 @@ func (p *ibmcloudVPCProvider) CreateInstance(ctx context.Context, podName, sandb
 
 	prototype := p.getInstancePrototype(instanceName, userData, instanceProfile, imageID)
 
+	// Only a boot volume larger than the default one can be requested
+	if spec.RootDiskSize > defaultBootVolumeCapacity {
+		prototype.BootVolumeAttachment = &vpcv1.VolumeAttachmentPrototypeInstanceByImageContext{
+			DeleteVolumeOnInstanceDelete: core.BoolPtr(true),
+			Volume: &vpcv1.VolumePrototypeInstanceByImageContext{
+				Capacity: core.Int64Ptr(spec.RootDiskSize),
+				Profile:  &vpcv1.VolumeProfileIdentity{Name: core.StringPtr(bootVolumeProfile)},
+			},
+		}
+	}
+
 	logger.Printf("CreateInstance: name: %q", instanceName)
 
 	vpcInstance, resp, err := p.vpc.CreateInstanceWithContext(ctx, &vpcv1.CreateInstanceOptions{InstancePrototype: prototype})
@@ -270,6 +312,17 @@ func (p *ibmcloudVPCProvider) CreateInstance(ctx context.Context, podName, sandb
 	instanceID := *vpcInstance.ID
 	numInterfaces := len(prototype.NetworkInterfaces)
 
+	// VPC instances can't be tagged at creation time, so attach the pod tags
+	// and the ownership tags afterwards. A failure here is not fatal for the pod.
+	ownershipTags := provider.OwnershipTags(p.serviceConfig.ClusterID, podName, spec.PodNamespace)
+	tags := provider.PodTags(spec, ownershipTags)
+	for k, v := range ownershipTags {
+		tags[k] = v
+	}
+	if err := p.attachTags(ctx, vpcInstance, tags); err != nil {
+		logger.Printf("failed to tag instance %s: %v", instanceID, err)
+	}
+
 	var ips []netip.Addr
 
 	for retries := 0; retries < maxRetries; retries++ {
@@ -294,20 +347,165 @@ func (p *ibmcloudVPCProvider) CreateInstance(ctx context.Context, podName, sandb
 	}
 
 	instance := &provider.Instance{
-		ID:   instanceID,
-		Name: instanceName,
-		IPs:  ips,
+		ID:      instanceID,
+		Name:    instanceName,
+		IPs:     ips,
+		Type:    instanceProfile,
+		ImageID: imageID,
 	}
 
 	return instance, nil
 }
 
+// attachTags attaches tags to the instance as user tags of the form key:value
+func (p *ibmcloudVPCProvider) attachTags(ctx context.Context, vpcInstance *vpcv1.Instance, tags map[string]string) error {
+
+	if len(tags) == 0 || p.tagging == nil || vpcInstance.CRN == nil {
+		return nil
+	}
+
+	var tagNames []string
+	for k, v := range tags {
+		tagNames = append(tagNames, tagName(k, v))
+	}
+	sort.Strings(tagNames)
+
+	_, resp, err := p.tagging.AttachTagWithContext(ctx, &globaltaggingv1.AttachTagOptions{
+		Resources: []globaltaggingv1.Resource{{ResourceID: vpcInstance.CRN}},
+		TagNames:  tagNames,
+	})
+	if err != nil {
+		return fmt.Errorf("attaching tags: %w, response: %s", err, resp)
+	}
+	return nil
+}
+
+// ListInstances returns the instances of the VPC carrying the cluster ID user tag.
+// Tag names are sanitized and case insensitive, so the cluster ID is compared
+// with the tag that CreateInstance would attach for it.
+func (p *ibmcloudVPCProvider) ListInstances(ctx context.Context, clusterID string) ([]*provider.Instance, error) {
+
+	if p.tagging == nil {
+		return nil, fmt.Errorf("listing instances of cluster %q: global tagging service is not configured", clusterID)
+	}
+
+	options := &vpcv1.ListInstancesOptions{}
+	if p.serviceConfig.VpcID != "" {
+		options.VPCID = core.StringPtr(p.serviceConfig.VpcID)
+	}
+	if p.serviceConfig.ResourceGroupID != "" {
+		options.ResourceGroupID = core.StringPtr(p.serviceConfig.ResourceGroupID)
+	}
+
+	clusterTag := tagName(provider.ClusterIDTagKey, clusterID)
+
+	var instances []*provider.Instance
+	for {
+		collection, resp, err := p.vpc.ListInstancesWithContext(ctx, options)
+		if err != nil {
+			return nil, fmt.Errorf("listing instances of cluster %q: %w, response: %s", clusterID, err, resp)
+		}
+
+		for _, vpcInstance := range collection.Instances {
+			if vpcInstance.ID == nil || vpcInstance.CRN == nil {
+				continue
+			}
+			tags, owned, err := p.instanceTags(ctx, *vpcInstance.CRN, clusterTag)
+			if err != nil {
+				return nil, err
+			}
+			if !owned {
+				continue
+			}
+			instance := &provider.Instance{
+				ID:   *vpcInstance.ID,
+				Name: core.StringNilMapper(vpcInstance.Name),
+				Tags: tags,
+			}
+			if vpcInstance.CreatedAt != nil {
+				instance.CreatedAt = time.Time(*vpcInstance.CreatedAt)
+			}
+			instances = append(instances, instance)
+		}
+
+		start, err := collection.GetNextStart()
+		if err != nil {
+			return nil, fmt.Errorf("listing instances of cluster %q: %w", clusterID, err)
+		}
+		if start == nil {
+			break
+		}
+		options.Start = start
+	}
+
+	return instances, nil
+}
+
+// instanceTags returns the user tags attached to crn as a map, and whether one
+// of them is clusterTag
+func (p *ibmcloudVPCProvider) instanceTags(ctx context.Context, crn, clusterTag string) (map[string]string, bool, error) {
+
+	tagList, resp, err := p.tagging.ListTagsWithContext(ctx, &globaltaggingv1.ListTagsOptions{
+		AttachedTo: core.StringPtr(crn),
+		TagType:    core.StringPtr(globaltaggingv1.ListTagsOptionsTagTypeUserConst),
+		Limit:      core.Int64Ptr(1000),
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("listing tags of %s: %w, response: %s", crn, err, resp)
+	}
+
+	tags := make(map[string]string)
+	owned := false
+	for _, tag := range tagList.Items {
+		if tag.Name == nil {
+			continue
+		}
+		if strings.EqualFold(*tag.Name, clusterTag) {
+			owned = true
+		}
+		if k, v, ok := strings.Cut(*tag.Name, ":"); ok {
+			tags[k] = v
+		}
+	}
+	return tags, owned, nil
+}
+
+// tagName returns a user tag for key and value. Characters that are not
+// allowed in tag names are replaced by '-' and the result is truncated.
+func tagName(key, value string) string {
+
+	sanitize := func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune(" _.-@", r):
+			return r
+		}
+		return '-'
+	}
+
+	name := strings.Map(sanitize, key) + ":" + strings.Map(sanitize, value)
+	if len(name) > maxTagLen {
+		name = name[:maxTagLen]
+	}
+	return name
+}
+
 // Select an instance profile based on the memory and vcpu requirements
 func (p *ibmcloudVPCProvider) selectInstanceProfile(ctx context.Context, spec provider.InstanceTypeSpec) (string, error) {
 
 	return provider.SelectInstanceTypeToUse(spec, p.serviceConfig.InstanceProfileSpecList, p.serviceConfig.InstanceProfiles, p.serviceConfig.ProfileName)
 }
 
+// InstanceCatalog implements provider.CatalogReporter
+func (p *ibmcloudVPCProvider) InstanceCatalog() provider.InstanceCatalog {
+	return provider.InstanceCatalog{
+		DefaultInstanceType: p.serviceConfig.ProfileName,
+		InstanceTypes:       p.serviceConfig.InstanceProfiles,
+		Specs:               p.serviceConfig.InstanceProfileSpecList,
+	}
+}
+
 // Populate instanceProfileSpecList for all the instanceProfiles
 func (p *ibmcloudVPCProvider) updateInstanceProfileSpecList() error {
 
@@ -412,11 +610,21 @@ func (p *ibmcloudVPCProvider) getImageDetails(ctx context.Context, imageID strin
 	return *result.OperatingSystem.Architecture, *result.OperatingSystem.Name, nil
 }
 
+// IBM Cloud VPC limits the userData to 64KB
+const maxUserDataSize = 65536
+
+func (p *ibmcloudVPCProvider) UserDataLimit() int {
+	return maxUserDataSize
+}
+
 func (p *ibmcloudVPCProvider) DeleteInstance(ctx context.Context, instanceID string) error {
 
 	options := &vpcv1.DeleteInstanceOptions{}
 	options.SetID(instanceID)
 	resp, err := p.vpc.DeleteInstanceWithContext(ctx, options)
+	if err != nil && resp != nil && resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", provider.ErrInstanceNotFound, instanceID)
+	}
 	if err != nil {
 		logger.Printf("failed to delete an instance: %v and the response is %v", err, resp)
 		return err
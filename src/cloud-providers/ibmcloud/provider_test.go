@@ -9,15 +9,20 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/IBM/platform-services-go-sdk/globaltaggingv1"
 	"github.com/IBM/vpc-go-sdk/vpcv1"
 	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/go-openapi/strfmt"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockVPC struct {
 	prototype vpcv1.InstancePrototypeIntf
+	instances []vpcv1.Instance
+	listed    *vpcv1.ListInstancesOptions
 }
 
 func ptr(s string) *string {
@@ -29,7 +34,8 @@ func (v *mockVPC) CreateInstanceWithContext(ctx context.Context, opt *vpcv1.Crea
 	v.prototype = opt.InstancePrototype
 
 	instance := &vpcv1.Instance{
-		ID: ptr("123"),
+		ID:  ptr("123"),
+		CRN: ptr("crn:v1:bluemix:public:is:us-south-1:a/123::instance:123"),
 		PrimaryNetworkInterface: &vpcv1.NetworkInterfaceInstanceContextReference{
 			ID: ptr("111"),
 			PrimaryIP: &vpcv1.ReservedIPReference{
@@ -115,6 +121,43 @@ func (v *mockVPC) GetImageWithContext(context context.Context, options *vpcv1.Ge
 	}, nil, nil
 }
 
+// ListInstancesWithContext returns one instance per page
+func (v *mockVPC) ListInstancesWithContext(ctx context.Context, opt *vpcv1.ListInstancesOptions) (*vpcv1.InstanceCollection, *core.DetailedResponse, error) {
+
+	v.listed = opt
+
+	page := 0
+	if opt.Start != nil {
+		fmt.Sscan(*opt.Start, &page)
+	}
+	collection := &vpcv1.InstanceCollection{Instances: v.instances[page : page+1]}
+	if page+1 < len(v.instances) {
+		collection.Next = &vpcv1.InstanceCollectionNext{Href: ptr(fmt.Sprintf("https://vpc.invalid/v1/instances?start=%d", page+1))}
+	}
+	return collection, nil, nil
+}
+
+type mockTagging struct {
+	options *globaltaggingv1.AttachTagOptions
+	tags    map[string][]string
+}
+
+func (g *mockTagging) AttachTagWithContext(ctx context.Context, opt *globaltaggingv1.AttachTagOptions) (*globaltaggingv1.TagResults, *core.DetailedResponse, error) {
+	g.options = opt
+	return &globaltaggingv1.TagResults{}, nil, nil
+}
+
+func (g *mockTagging) ListTagsWithContext(ctx context.Context, opt *globaltaggingv1.ListTagsOptions) (*globaltaggingv1.TagList, *core.DetailedResponse, error) {
+	if *opt.TagType != globaltaggingv1.ListTagsOptionsTagTypeUserConst {
+		return nil, nil, fmt.Errorf("unexpected tag type %s", *opt.TagType)
+	}
+	tagList := &globaltaggingv1.TagList{}
+	for _, name := range g.tags[*opt.AttachedTo] {
+		tagList.Items = append(tagList.Items, globaltaggingv1.Tag{Name: ptr(name)})
+	}
+	return tagList, nil, nil
+}
+
 type mockCloudConfig struct{}
 
 func (c *mockCloudConfig) Generate() (string, error) {
@@ -163,6 +206,152 @@ func TestCreateInstance(t *testing.T) {
 	assert.Equal(t, "cloud config", *p.UserData)
 }
 
+func TestCreateInstanceTags(t *testing.T) {
+
+	tagging := &mockTagging{}
+
+	images := make(Images, 0)
+	err := images.Set("valid-image-id")
+	if err != nil {
+		t.Errorf("Images.Set() error %v", err)
+	}
+	mockProvider := &ibmcloudVPCProvider{
+		vpc:     &mockVPC{},
+		tagging: tagging,
+		serviceConfig: &Config{
+			ProfileName: "bx2-2x8",
+			Images:      images,
+		},
+	}
+
+	spec := provider.InstanceTypeSpec{
+		InstanceType: "bx2-2x8",
+		Tags: map[string]string{
+			"peerpods-namespace": "default",
+			"app/name":           "nginx",
+		},
+	}
+	_, err = mockProvider.CreateInstance(context.Background(), "pod1", "999", &mockCloudConfig{}, spec)
+	assert.NoError(t, err)
+
+	assert.NotNil(t, tagging.options)
+	assert.Equal(t, "crn:v1:bluemix:public:is:us-south-1:a/123::instance:123", *tagging.options.Resources[0].ResourceID)
+	assert.Equal(t, []string{"app-name:nginx", "peerpods-namespace:default"}, tagging.options.TagNames)
+}
+
+func TestCreateInstanceOwnershipTags(t *testing.T) {
+
+	tagging := &mockTagging{}
+
+	images := make(Images, 0)
+	err := images.Set("valid-image-id")
+	if err != nil {
+		t.Errorf("Images.Set() error %v", err)
+	}
+	mockProvider := &ibmcloudVPCProvider{
+		vpc:     &mockVPC{},
+		tagging: tagging,
+		serviceConfig: &Config{
+			ProfileName: "bx2-2x8",
+			Images:      images,
+			ClusterID:   "cluster-1",
+		},
+	}
+
+	spec := provider.InstanceTypeSpec{
+		InstanceType: "bx2-2x8",
+		PodNamespace: "default",
+		Tags: map[string]string{
+			"peerpods-pod-name": "spoofed",
+			"app":               "nginx",
+		},
+	}
+	_, err = mockProvider.CreateInstance(context.Background(), "pod1", "999", &mockCloudConfig{}, spec)
+	assert.NoError(t, err)
+
+	assert.NotNil(t, tagging.options)
+	assert.Equal(t, []string{"app:nginx", "peerpods-cluster-id:cluster-1", "peerpods-namespace:default", "peerpods-pod-name:pod1"}, tagging.options.TagNames)
+}
+
+func TestListInstances(t *testing.T) {
+
+	created := strfmt.DateTime(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	vpc := &mockVPC{
+		instances: []vpcv1.Instance{
+			{ID: ptr("1"), CRN: ptr("crn-1"), Name: ptr("podvm-pod1-999"), CreatedAt: &created},
+			{ID: ptr("2"), CRN: ptr("crn-2"), Name: ptr("other")},
+			{ID: ptr("3"), CRN: ptr("crn-3"), Name: ptr("podvm-pod2-999"), CreatedAt: &created},
+		},
+	}
+	tagging := &mockTagging{
+		tags: map[string][]string{
+			"crn-1": {"peerpods-cluster-id:cluster-1", "peerpods-pod-name:pod1", "env"},
+			"crn-2": {"peerpods-cluster-id:cluster-2"},
+			"crn-3": {"peerpods-cluster-id:cluster-1"},
+		},
+	}
+	mockProvider := &ibmcloudVPCProvider{
+		vpc:     vpc,
+		tagging: tagging,
+		serviceConfig: &Config{
+			VpcID: "vpc-1",
+		},
+	}
+
+	// Tag names are case insensitive
+	instances, err := mockProvider.ListInstances(context.Background(), "Cluster-1")
+	assert.NoError(t, err)
+	if assert.Len(t, instances, 2) {
+		assert.Equal(t, &provider.Instance{
+			ID:        "1",
+			Name:      "podvm-pod1-999",
+			Tags:      map[string]string{"peerpods-cluster-id": "cluster-1", "peerpods-pod-name": "pod1"},
+			CreatedAt: time.Time(created),
+		}, instances[0])
+		assert.Equal(t, "3", instances[1].ID)
+	}
+	assert.Equal(t, "vpc-1", *vpc.listed.VPCID)
+	assert.Nil(t, vpc.listed.ResourceGroupID)
+}
+
+func TestCreateInstanceBootVolume(t *testing.T) {
+
+	images := make(Images, 0)
+	err := images.Set("valid-image-id")
+	if err != nil {
+		t.Errorf("Images.Set() error %v", err)
+	}
+
+	for _, tc := range []struct {
+		diskSize int64
+		want     *int64
+	}{
+		{0, nil},
+		{50, nil},
+		{150, core.Int64Ptr(150)},
+	} {
+		vpc := &mockVPC{}
+		mockProvider := &ibmcloudVPCProvider{
+			vpc: vpc,
+			serviceConfig: &Config{
+				ProfileName: "bx2-2x8",
+				Images:      images,
+			},
+		}
+
+		_, err := mockProvider.CreateInstance(context.Background(), "pod1", "999", &mockCloudConfig{}, provider.InstanceTypeSpec{InstanceType: "bx2-2x8", RootDiskSize: tc.diskSize})
+		assert.NoError(t, err)
+
+		p, ok := vpc.prototype.(*vpcv1.InstancePrototype)
+		assert.True(t, ok)
+		if tc.want == nil {
+			assert.Nil(t, p.BootVolumeAttachment, "disk size %d", tc.diskSize)
+		} else if assert.NotNil(t, p.BootVolumeAttachment, "disk size %d", tc.diskSize) {
+			assert.Equal(t, tc.want, p.BootVolumeAttachment.Volume.Capacity)
+		}
+	}
+}
+
 func TestDeleteInstance(t *testing.T) {
 
 	provider := &ibmcloudVPCProvider{
@@ -75,6 +75,7 @@ type Config struct {
 	SecondarySecurityGroupID string
 	KeyID                    string
 	VpcID                    string
+	ClusterID                string
 	InstanceProfiles         instanceProfiles
 	InstanceProfileSpecList  []provider.InstanceTypeSpec
 }
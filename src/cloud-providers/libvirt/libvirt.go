@@ -6,14 +6,17 @@
 package libvirt
 
 import (
+	"bytes"
 	"context"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"net/netip"
 	"strconv"
 	"time"
 
 	"github.com/avast/retry-go/v4"
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
 	libvirt "libvirt.org/go/libvirt"
 	libvirtxml "libvirt.org/go/libvirtxml"
 )
@@ -27,6 +30,8 @@ const (
 	GetDomainIPsRetries = 20
 	// The sleep time between retries to get the domain IP addresses
 	GetDomainIPsSleep = time.Second * 3
+	// How long the console of a domain is read, as the stream never ends by itself
+	consoleReadTime = time.Second * 5
 )
 
 type domainConfig struct {
@@ -531,7 +536,6 @@ func CreateDomain(ctx context.Context, libvirtClient *libvirtClient, v *vmConfig
 
 	v.cpu = uint(2)
 	v.mem = uint(8)
-	v.rootDiskSize = uint64(10)
 
 	exists, err := checkDomainExistsByName(v.name, libvirtClient)
 	if err != nil {
@@ -585,6 +589,11 @@ func CreateDomain(ctx context.Context, libvirtClient *libvirtClient, v *vmConfig
 		return nil, fmt.Errorf("error building the libvirt XML, cause: %w", err)
 	}
 
+	domCfg.Metadata, err = domainMetadata(v.tags, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("error building the domain metadata, cause: %w", err)
+	}
+
 	logger.Printf("Create XML for '%s'", v.name)
 	domXML, err := domCfg.Marshal()
 	if err != nil {
@@ -655,8 +664,7 @@ func DeleteDomain(ctx context.Context, libvirtClient *libvirtClient, id string)
 		return err
 	}
 	if !exists {
-		logger.Printf("Instance (%s) not found", id)
-		return err
+		return fmt.Errorf("%w: domain %s", provider.ErrInstanceNotFound, id)
 	}
 	// Stop and undefine domain
 
@@ -725,6 +733,117 @@ func DeleteDomain(ctx context.Context, libvirtClient *libvirtClient, id string)
 	return nil
 }
 
+// ListDomains returns the running domains whose peer-pod metadata carries
+// the cluster ID tag. Only running domains have the ID used as instance ID.
+func ListDomains(ctx context.Context, libvirtClient *libvirtClient, clusterID string) ([]*provider.Instance, error) {
+
+	domains, err := libvirtClient.connection.ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE)
+	if err != nil {
+		return nil, fmt.Errorf("listing libvirt domains: %w", err)
+	}
+
+	var instances []*provider.Instance
+	for i := range domains {
+		instance, err := domainInstance(&domains[i], clusterID)
+		_ = domains[i].Free()
+		if err != nil {
+			return nil, err
+		}
+		if instance != nil {
+			instances = append(instances, instance)
+		}
+	}
+
+	return instances, nil
+}
+
+// domainInstance returns the instance of domain if it belongs to clusterID, nil otherwise
+func domainInstance(domain *libvirt.Domain, clusterID string) (*provider.Instance, error) {
+
+	data, err := domain.GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, metadataNamespace, libvirt.DOMAIN_AFFECT_CURRENT)
+	if err != nil {
+		if e, ok := err.(libvirt.Error); ok && e.Code == libvirt.ERR_NO_DOMAIN_METADATA {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("retrieving domain metadata: %w", err)
+	}
+
+	tags, created, err := parseDomainMetadata(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing domain metadata: %w", err)
+	}
+	if tags[provider.ClusterIDTagKey] != clusterID {
+		return nil, nil
+	}
+
+	id, err := domain.GetID()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving domain ID: %w", err)
+	}
+	name, err := domain.GetName()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving domain name: %w", err)
+	}
+
+	return &provider.Instance{
+		ID:        strconv.FormatUint(uint64(id), 10),
+		Name:      name,
+		Tags:      tags,
+		CreatedAt: created,
+	}, nil
+}
+
+// ReadConsole returns what the domain writes to its console within
+// consoleReadTime. The console is a live stream, earlier output is not
+// replayed by libvirt.
+func ReadConsole(ctx context.Context, libvirtClient *libvirtClient, id string) (output []byte, err error) {
+
+	idUint, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid instance ID %q: %w", id, err)
+	}
+
+	domain, err := libvirtClient.connection.LookupDomainById(uint32(idUint))
+	if err != nil {
+		return nil, fmt.Errorf("retrieving libvirt domain %s: %w", id, err)
+	}
+	defer freeDomain(domain, &err)
+
+	stream, err := libvirtClient.connection.NewStream(0)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Free()
+
+	// Take over the console in case someone is attached to it
+	if err := domain.OpenConsole("", stream, libvirt.DOMAIN_CONSOLE_FORCE); err != nil {
+		return nil, fmt.Errorf("opening console of domain %s: %w", id, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, consoleReadTime)
+	defer cancel()
+
+	var buf bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(&buf, newStreamIO(*stream))
+		done <- err
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// Aborting the stream unblocks the pending Recv
+		_ = stream.Abort()
+		<-done
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading console of domain %s: %w", id, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
 func NewLibvirtClient(libvirtCfg Config) (*libvirtClient, error) {
 
 	// Define Domain via XML created before.
@@ -38,22 +38,34 @@ func (_ *Manager) ParseCmd(flags *flag.FlagSet) {
 	flags.BoolVar(&libvirtcfg.DisableCVM, "disable-cvm", false, "Use non-CVMs for peer pods")
 	flags.StringVar(&libvirtcfg.LaunchSecurity, "launch-security", defaultLaunchSecurity, "Libvirt's LaunchSecurity element for Confidential VMs. SEV or s390-pv. If omitted, will automatically determine.")
 	flags.StringVar(&libvirtcfg.Firmware, "firmware", defaultFirmware, "Path to OVMF")
+	flags.StringVar(&libvirtcfg.ClusterID, "cluster-id", "", "Cluster ID stored in the metadata of the Pod VMs to allow garbage collection of orphaned instances, defaults to `PEERPODS_CLUSTER_ID`")
 
 }
 
 func (_ *Manager) LoadEnv() {
-	provider.DefaultToEnv(&libvirtcfg.URI, "LIBVIRT_URI", defaultURI)
-	provider.DefaultToEnv(&libvirtcfg.PoolName, "LIBVIRT_POOL", defaultPoolName)
-	provider.DefaultToEnv(&libvirtcfg.NetworkName, "LIBVIRT_NET", defaultNetworkName)
-	provider.DefaultToEnv(&libvirtcfg.VolName, "LIBVIRT_VOL_NAME", defaultVolName)
-	provider.DefaultToEnv(&libvirtcfg.LaunchSecurity, "LIBVIRT_LAUNCH_SECURITY", defaultLaunchSecurity)
-	provider.DefaultToEnv(&libvirtcfg.Firmware, "LIBVIRT_FIRMWARE", defaultFirmware)
+	loadEnv(&libvirtcfg, provider.DefaultToEnv)
+}
+
+func loadEnv(cfg *Config, load provider.EnvLoadFunc) {
+	load(&cfg.URI, "LIBVIRT_URI", defaultURI)
+	load(&cfg.PoolName, "LIBVIRT_POOL", defaultPoolName)
+	load(&cfg.NetworkName, "LIBVIRT_NET", defaultNetworkName)
+	load(&cfg.VolName, "LIBVIRT_VOL_NAME", defaultVolName)
+	load(&cfg.LaunchSecurity, "LIBVIRT_LAUNCH_SECURITY", defaultLaunchSecurity)
+	load(&cfg.Firmware, "LIBVIRT_FIRMWARE", defaultFirmware)
+	load(&cfg.ClusterID, "PEERPODS_CLUSTER_ID", "")
 }
 
 func (_ *Manager) NewProvider() (provider.Provider, error) {
 	return NewProvider(&libvirtcfg)
 }
 
+func (_ *Manager) NewProviderWithEnv(env map[string]string) (provider.Provider, error) {
+	cfg := libvirtcfg
+	loadEnv(&cfg, provider.OverrideFromEnv(env))
+	return NewProvider(&cfg)
+}
+
 func (_ *Manager) GetConfig() (config *Config) {
 	return &libvirtcfg
 }
@@ -0,0 +1,88 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package libvirt
+
+import (
+	"encoding/xml"
+	"sort"
+	"time"
+
+	libvirtxml "libvirt.org/go/libvirtxml"
+)
+
+// metadataNamespace is the XML namespace of the peer-pod domain metadata
+const metadataNamespace = "https://confidentialcontainers.org/peerpods/tags"
+
+type metadataTag struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type metadataTags struct {
+	XMLName xml.Name      `xml:"peerpods:tags"`
+	Xmlns   string        `xml:"xmlns:peerpods,attr"`
+	Created string        `xml:"created,attr,omitempty"`
+	Tags    []metadataTag `xml:"peerpods:tag"`
+}
+
+// parsedMetadataTags matches metadataTags by namespace, whatever prefix
+// libvirt returns it with
+type parsedMetadataTags struct {
+	XMLName xml.Name      `xml:"https://confidentialcontainers.org/peerpods/tags tags"`
+	Created string        `xml:"created,attr"`
+	Tags    []metadataTag `xml:"https://confidentialcontainers.org/peerpods/tags tag"`
+}
+
+// domainMetadata renders tags and the creation time as custom domain metadata, e.g.
+//
+//	<peerpods:tags xmlns:peerpods="..." created="2024-05-01T10:00:00Z">
+//	  <peerpods:tag key="peerpods-namespace">default</peerpods:tag>
+//	</peerpods:tags>
+//
+// It returns nil if there are no tags.
+func domainMetadata(tags map[string]string, created time.Time) (*libvirtxml.DomainMetadata, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	m := metadataTags{Xmlns: metadataNamespace}
+	if !created.IsZero() {
+		m.Created = created.UTC().Format(time.RFC3339)
+	}
+	for k, v := range tags {
+		m.Tags = append(m.Tags, metadataTag{Key: k, Value: v})
+	}
+	sort.Slice(m.Tags, func(i, j int) bool { return m.Tags[i].Key < m.Tags[j].Key })
+
+	data, err := xml.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return &libvirtxml.DomainMetadata{XML: string(data)}, nil
+}
+
+// parseDomainMetadata returns the tags and the creation time rendered by
+// domainMetadata. The creation time is zero if it is missing.
+func parseDomainMetadata(data string) (map[string]string, time.Time, error) {
+	var m parsedMetadataTags
+	if err := xml.Unmarshal([]byte(data), &m); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	tags := make(map[string]string, len(m.Tags))
+	for _, tag := range m.Tags {
+		tags[tag.Key] = tag.Value
+	}
+
+	var created time.Time
+	if m.Created != "" {
+		var err error
+		if created, err = time.Parse(time.RFC3339, m.Created); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+
+	return tags, created, nil
+}
@@ -0,0 +1,65 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package libvirt
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDomainMetadata(t *testing.T) {
+	metadata, err := domainMetadata(nil, time.Now())
+	if err != nil || metadata != nil {
+		t.Fatalf("domainMetadata(nil) = %v, %v, want nil", metadata, err)
+	}
+
+	metadata, err = domainMetadata(map[string]string{
+		"peerpods-pod-name":  "nginx",
+		"peerpods-namespace": "a<b",
+	}, time.Time{})
+	if err != nil {
+		t.Fatalf("domainMetadata() error = %v", err)
+	}
+
+	want := `<peerpods:tags xmlns:peerpods="https://confidentialcontainers.org/peerpods/tags">` +
+		`<peerpods:tag key="peerpods-namespace">a&lt;b</peerpods:tag>` +
+		`<peerpods:tag key="peerpods-pod-name">nginx</peerpods:tag>` +
+		`</peerpods:tags>`
+	if metadata.XML != want {
+		t.Errorf("domainMetadata() = %s, want %s", metadata.XML, want)
+	}
+}
+
+func TestParseDomainMetadata(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tags := map[string]string{
+		"peerpods-cluster-id": "cluster-1",
+		"peerpods-pod-name":   "nginx",
+	}
+
+	metadata, err := domainMetadata(tags, created)
+	if err != nil {
+		t.Fatalf("domainMetadata() error = %v", err)
+	}
+
+	gotTags, gotCreated, err := parseDomainMetadata(metadata.XML)
+	if err != nil {
+		t.Fatalf("parseDomainMetadata() error = %v", err)
+	}
+	if !reflect.DeepEqual(gotTags, tags) || !gotCreated.Equal(created) {
+		t.Errorf("parseDomainMetadata() = %v, %v, want %v, %v", gotTags, gotCreated, tags, created)
+	}
+
+	// libvirt may return the element with another prefix
+	gotTags, gotCreated, err = parseDomainMetadata(`<pp:tags xmlns:pp="https://confidentialcontainers.org/peerpods/tags">` +
+		`<pp:tag key="peerpods-cluster-id">cluster-1</pp:tag></pp:tags>`)
+	if err != nil || gotTags["peerpods-cluster-id"] != "cluster-1" || !gotCreated.IsZero() {
+		t.Errorf("parseDomainMetadata() = %v, %v, %v", gotTags, gotCreated, err)
+	}
+
+	if _, _, err := parseDomainMetadata(`<tags xmlns="https://example.com/other"/>`); err == nil {
+		t.Error("parseDomainMetadata() of another namespace succeeded")
+	}
+}
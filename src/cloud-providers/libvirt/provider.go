@@ -56,8 +56,17 @@ func (p *libvirtProvider) CreateInstance(ctx context.Context, podName, sandboxID
 		return nil, err
 	}
 
+	ownershipTags := provider.OwnershipTags(p.serviceConfig.ClusterID, podName, spec.PodNamespace)
+	tags := provider.PodTags(spec, ownershipTags)
+	for k, v := range ownershipTags {
+		tags[k] = v
+	}
+
 	// TODO: Specify the maximum instance name length in Libvirt
-	vm := &vmConfig{name: instanceName, userData: userData, firmware: p.serviceConfig.Firmware}
+	vm := &vmConfig{name: instanceName, userData: userData, firmware: p.serviceConfig.Firmware, tags: tags}
+	if spec.RootDiskSize > 0 {
+		vm.rootDiskSize = uint64(spec.RootDiskSize) << 30
+	}
 
 	if p.serviceConfig.DisableCVM {
 		vm.launchSecurityType = NoLaunchSecurity
@@ -97,9 +106,10 @@ func (p *libvirtProvider) CreateInstance(ctx context.Context, podName, sandboxID
 	}
 
 	instance := &provider.Instance{
-		ID:   instanceID,
-		Name: instanceName,
-		IPs:  ips,
+		ID:      instanceID,
+		Name:    instanceName,
+		IPs:     ips,
+		ImageID: p.serviceConfig.VolName,
 	}
 
 	return instance, nil
@@ -116,6 +126,15 @@ func (p *libvirtProvider) DeleteInstance(ctx context.Context, instanceID string)
 
 }
 
+// ListInstances returns the running domains whose metadata carries the cluster ID
+func (p *libvirtProvider) ListInstances(ctx context.Context, clusterID string) ([]*provider.Instance, error) {
+	return ListDomains(ctx, p.libvirtClient, clusterID)
+}
+
+func (p *libvirtProvider) ConsoleOutput(ctx context.Context, instanceID string) ([]byte, error) {
+	return ReadConsole(ctx, p.libvirtClient, instanceID)
+}
+
 func (p *libvirtProvider) Teardown() error {
 	return nil
 }
@@ -21,18 +21,20 @@ type Config struct {
 	VolName        string
 	LaunchSecurity string
 	Firmware       string
+	ClusterID      string
 }
 
 type vmConfig struct {
 	name               string
 	cpu                uint
 	mem                uint
-	rootDiskSize       uint64
+	rootDiskSize       uint64 // in bytes, the root volume is at least the size of the image
 	userData           string
 	ips                []netip.Addr
 	instanceId         string //keeping it consistent with sandbox.vsi
 	launchSecurityType LaunchSecurityType
 	firmware           string
+	tags               map[string]string
 }
 
 type createDomainOutput struct {
@@ -0,0 +1,218 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package openstack
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+)
+
+const (
+	// Nova microversion exposing delete_on_termination of attached volumes
+	novaMicroversion = "2.3"
+	httpTimeout      = 60 * time.Second
+)
+
+// Catalog types of Cinder, newer deployments register it as block-storage
+var volumeServiceTypes = []string{"volumev3", "block-storage"}
+
+type attachedVolume struct {
+	ID                  string `json:"id"`
+	DeleteOnTermination bool   `json:"delete_on_termination"`
+}
+
+// server holds the fields of a Nova server that servers.Server lacks
+// Ref: https://docs.openstack.org/api-ref/compute/#show-server-details
+type server struct {
+	ID              string           `json:"id"`
+	Name            string           `json:"name"`
+	Status          string           `json:"status"`
+	VolumesAttached []attachedVolume `json:"os-extended-volumes:volumes_attached"`
+}
+
+func isNotFound(err error) bool {
+	var respErr gophercloud.ErrUnexpectedResponseCode
+	return errors.As(err, &respErr) && respErr.Actual == http.StatusNotFound
+}
+
+// Make openstackClient a mockable interface
+// gophercloud v1 requests don't take a context, they are bounded by httpTimeout
+type openstackClient interface {
+	ListFlavors(ctx context.Context) ([]flavors.Flavor, error)
+	CreatePort(ctx context.Context, opts ports.CreateOptsBuilder) (*ports.Port, error)
+	ListPorts(ctx context.Context, deviceID string) ([]ports.Port, error)
+	DeletePort(ctx context.Context, id string) error
+	CreateServer(ctx context.Context, opts servers.CreateOptsBuilder) (*servers.Server, error)
+	GetServer(ctx context.Context, id string) (*server, error)
+	ListServers(ctx context.Context) ([]servers.Server, error)
+	DeleteServer(ctx context.Context, id string) error
+	DeleteVolume(ctx context.Context, id string) error
+}
+
+// gophercloudClient implements openstackClient with the gophercloud service clients
+type gophercloudClient struct {
+	compute *gophercloud.ServiceClient
+	network *gophercloud.ServiceClient
+	volume  *gophercloud.ServiceClient
+}
+
+func newAuthOptions(config *Config) gophercloud.AuthOptions {
+
+	opts := gophercloud.AuthOptions{
+		IdentityEndpoint: config.AuthURL,
+		// Authenticate again when the token expires or is revoked
+		AllowReauth: true,
+	}
+
+	// Application credentials are scoped to a project on creation
+	if config.ApplicationCredentialID != "" {
+		opts.ApplicationCredentialID = config.ApplicationCredentialID
+		opts.ApplicationCredentialSecret = config.ApplicationCredentialSecret
+		return opts
+	}
+
+	opts.Username = config.Username
+	opts.Password = config.Password
+	opts.DomainName = config.UserDomainName
+	opts.Scope = &gophercloud.AuthScope{
+		ProjectName: config.ProjectName,
+		DomainName:  config.ProjectDomainName,
+	}
+
+	return opts
+}
+
+func newHTTPClient(config *Config) (http.Client, error) {
+
+	httpClient := http.Client{Timeout: httpTimeout}
+
+	if config.CACertFile != "" {
+		caCert, err := os.ReadFile(config.CACertFile)
+		if err != nil {
+			return httpClient, fmt.Errorf("reading CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return httpClient, fmt.Errorf("no certificate found in %s", config.CACertFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		httpClient.Transport = transport
+	}
+
+	return httpClient, nil
+}
+
+func NewOpenStackClient(config *Config) (*gophercloudClient, error) {
+
+	httpClient, err := newHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	providerClient, err := openstack.NewClient(config.AuthURL)
+	if err != nil {
+		return nil, fmt.Errorf("creating client for %s: %w", config.AuthURL, err)
+	}
+	providerClient.HTTPClient = httpClient
+
+	if err := openstack.Authenticate(providerClient, newAuthOptions(config)); err != nil {
+		return nil, fmt.Errorf("authenticating with %s: %w", config.AuthURL, err)
+	}
+
+	endpointOpts := gophercloud.EndpointOpts{Region: config.Region}
+
+	compute, err := openstack.NewComputeV2(providerClient, endpointOpts)
+	if err != nil {
+		return nil, fmt.Errorf("no public compute endpoint found in region %q: %w", config.Region, err)
+	}
+	compute.Microversion = novaMicroversion
+
+	network, err := openstack.NewNetworkV2(providerClient, endpointOpts)
+	if err != nil {
+		return nil, fmt.Errorf("no public network endpoint found in region %q: %w", config.Region, err)
+	}
+
+	var volume *gophercloud.ServiceClient
+	for _, serviceType := range volumeServiceTypes {
+		endpointOpts.Type = serviceType
+		if volume, err = openstack.NewBlockStorageV3(providerClient, endpointOpts); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no public volume endpoint found in region %q: %w", config.Region, err)
+	}
+
+	return &gophercloudClient{
+		compute: compute,
+		network: network,
+		volume:  volume,
+	}, nil
+}
+
+func (c *gophercloudClient) ListFlavors(ctx context.Context) ([]flavors.Flavor, error) {
+	pages, err := flavors.ListDetail(c.compute, nil).AllPages()
+	if err != nil {
+		return nil, err
+	}
+	return flavors.ExtractFlavors(pages)
+}
+
+func (c *gophercloudClient) CreatePort(ctx context.Context, opts ports.CreateOptsBuilder) (*ports.Port, error) {
+	return ports.Create(c.network, opts).Extract()
+}
+
+func (c *gophercloudClient) ListPorts(ctx context.Context, deviceID string) ([]ports.Port, error) {
+	pages, err := ports.List(c.network, ports.ListOpts{DeviceID: deviceID}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+	return ports.ExtractPorts(pages)
+}
+
+func (c *gophercloudClient) DeletePort(ctx context.Context, id string) error {
+	return ports.Delete(c.network, id).ExtractErr()
+}
+
+func (c *gophercloudClient) CreateServer(ctx context.Context, opts servers.CreateOptsBuilder) (*servers.Server, error) {
+	return servers.Create(c.compute, opts).Extract()
+}
+
+func (c *gophercloudClient) GetServer(ctx context.Context, id string) (*server, error) {
+	var s server
+	if err := servers.Get(c.compute, id).ExtractInto(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (c *gophercloudClient) ListServers(ctx context.Context) ([]servers.Server, error) {
+	pages, err := servers.List(c.compute, servers.ListOpts{}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+	return servers.ExtractServers(pages)
+}
+
+func (c *gophercloudClient) DeleteServer(ctx context.Context, id string) error {
+	return servers.Delete(c.compute, id).ExtractErr()
+}
+
+func (c *gophercloudClient) DeleteVolume(ctx context.Context, id string) error {
+	return volumes.Delete(c.volume, id, nil).ExtractErr()
+}
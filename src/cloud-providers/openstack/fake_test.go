@@ -0,0 +1,296 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Wire representations of the resources recorded by the fake
+// Ref: https://docs.openstack.org/api-ref/compute/
+// Ref: https://docs.openstack.org/api-ref/network/v2/
+
+type flavor struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	VCPUs int64  `json:"vcpus"`
+	RAM   int64  `json:"ram"`
+}
+
+type fixedIP struct {
+	SubnetID  string `json:"subnet_id,omitempty"`
+	IPAddress string `json:"ip_address,omitempty"`
+}
+
+type port struct {
+	ID             string    `json:"id,omitempty"`
+	Name           string    `json:"name,omitempty"`
+	NetworkID      string    `json:"network_id"`
+	DeviceID       string    `json:"device_id,omitempty"`
+	SecurityGroups []string  `json:"security_groups,omitempty"`
+	FixedIPs       []fixedIP `json:"fixed_ips,omitempty"`
+}
+
+type serverNetwork struct {
+	Port string `json:"port"`
+}
+
+type blockDevice struct {
+	BootIndex           int    `json:"boot_index"`
+	UUID                string `json:"uuid"`
+	SourceType          string `json:"source_type"`
+	DestinationType     string `json:"destination_type"`
+	VolumeSize          int    `json:"volume_size"`
+	DeleteOnTermination bool   `json:"delete_on_termination"`
+}
+
+type serverCreate struct {
+	Name               string            `json:"name"`
+	FlavorRef          string            `json:"flavorRef"`
+	ImageRef           string            `json:"imageRef,omitempty"`
+	KeyName            string            `json:"key_name,omitempty"`
+	UserData           string            `json:"user_data,omitempty"`
+	ConfigDrive        bool              `json:"config_drive,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	Networks           []serverNetwork   `json:"networks"`
+	BlockDeviceMapping []blockDevice     `json:"block_device_mapping_v2,omitempty"`
+}
+
+// fakeServer is a server along with the fields only returned by the fake
+type fakeServer struct {
+	server
+	Metadata map[string]string `json:"metadata"`
+	Created  string            `json:"created"`
+}
+
+type authRequest struct {
+	Auth struct {
+		Identity struct {
+			Password *struct {
+				User struct {
+					Password string `json:"password"`
+				} `json:"user"`
+			} `json:"password,omitempty"`
+		} `json:"identity"`
+	} `json:"auth"`
+}
+
+// fakeOpenStack is an HTTP fake of the Keystone, Nova, Neutron and Cinder APIs
+type fakeOpenStack struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	token  string
+	tokens int
+
+	flavors        []flavor
+	ports          map[string]*port
+	servers        map[string]*fakeServer
+	createdServer  *serverCreate
+	deletedVolumes []string
+	requests       []string
+
+	failServerCreate bool
+}
+
+func newFakeOpenStack(t *testing.T) *fakeOpenStack {
+	f := &fakeOpenStack{
+		flavors: []flavor{
+			{ID: "1", Name: "m1.small", VCPUs: 1, RAM: 2048},
+			{ID: "2", Name: "m1.medium", VCPUs: 2, RAM: 4096},
+			{ID: "3", Name: "m1.large", VCPUs: 4, RAM: 8192},
+		},
+		ports:   make(map[string]*port),
+		servers: make(map[string]*fakeServer),
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeOpenStack) config() *Config {
+	return &Config{
+		AuthURL:           f.URL + "/identity/v3",
+		Username:          "user",
+		Password:          "secret",
+		UserDomainName:    "Default",
+		ProjectName:       "project",
+		ProjectDomainName: "Default",
+		Region:            "RegionOne",
+		ImageID:           "image-id",
+		Flavor:            "m1.small",
+		NetworkID:         "network-id",
+		SecurityGroups:    stringList{"sg-1", "sg-2"},
+	}
+}
+
+// revokeToken invalidates the issued token, as Keystone does when it is revoked
+func (f *fakeOpenStack) revokeToken() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.token = "revoked"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeOpenStack) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := r.URL.Path
+	f.requests = append(f.requests, r.Method+" "+path)
+
+	if r.Method == http.MethodPost && path == "/identity/v3/auth/tokens" {
+		var req authRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Auth.Identity.Password == nil || req.Auth.Identity.Password.User.Password != "secret" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
+			return
+		}
+		f.tokens++
+		f.token = fmt.Sprintf("token-%d", f.tokens)
+
+		endpoint := func(t, p string) map[string]interface{} {
+			return map[string]interface{}{
+				"type": t,
+				"endpoints": []map[string]string{
+					{"interface": "internal", "region": "RegionOne", "url": "http://internal.invalid"},
+					{"interface": "public", "region": "RegionTwo", "url": "http://other-region.invalid"},
+					{"interface": "public", "region": "RegionOne", "url": f.URL + p},
+				},
+			}
+		}
+		w.Header().Set("X-Subject-Token", f.token)
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"token": map[string]interface{}{
+				"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+				"catalog": []interface{}{
+					endpoint("compute", "/compute"),
+					endpoint("network", "/network/"),
+					endpoint("block-storage", "/volume"),
+				},
+			},
+		})
+		return
+	}
+
+	if r.Header.Get("X-Auth-Token") != f.token {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && path == "/compute/flavors/detail":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"flavors": f.flavors})
+
+	case r.Method == http.MethodPost && path == "/network/v2.0/ports":
+		var req struct {
+			Port port `json:"port"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, nil)
+			return
+		}
+		p := req.Port
+		p.ID = fmt.Sprintf("port-%d", len(f.ports)+1)
+		p.FixedIPs = []fixedIP{{SubnetID: "subnet-id", IPAddress: fmt.Sprintf("10.0.0.%d", len(f.ports)+2)}}
+		f.ports[p.ID] = &p
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"port": p})
+
+	case r.Method == http.MethodGet && path == "/network/v2.0/ports":
+		ports := []port{}
+		for _, p := range f.ports {
+			if p.DeviceID == r.URL.Query().Get("device_id") {
+				ports = append(ports, *p)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ports": ports})
+
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "/network/v2.0/ports/"):
+		id := strings.TrimPrefix(path, "/network/v2.0/ports/")
+		if _, ok := f.ports[id]; !ok {
+			writeJSON(w, http.StatusNotFound, nil)
+			return
+		}
+		delete(f.ports, id)
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPost && path == "/compute/servers":
+		if r.Header.Get("X-OpenStack-Nova-API-Version") != novaMicroversion {
+			writeJSON(w, http.StatusBadRequest, nil)
+			return
+		}
+		if f.failServerCreate {
+			writeJSON(w, http.StatusForbidden, map[string]string{"message": "quota exceeded"})
+			return
+		}
+		var req struct {
+			Server serverCreate `json:"server"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, nil)
+			return
+		}
+		f.createdServer = &req.Server
+		s := &fakeServer{
+			server:   server{ID: fmt.Sprintf("server-%d", len(f.servers)+1), Name: req.Server.Name, Status: "BUILD"},
+			Metadata: req.Server.Metadata,
+			Created:  time.Now().UTC().Format(time.RFC3339),
+		}
+		for _, n := range req.Server.Networks {
+			if p, ok := f.ports[n.Port]; ok {
+				p.DeviceID = s.ID
+			}
+		}
+		f.servers[s.ID] = s
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{"server": map[string]string{"id": s.ID}})
+
+	case r.Method == http.MethodGet && path == "/compute/servers/detail":
+		servers := []*fakeServer{}
+		for _, s := range f.servers {
+			servers = append(servers, s)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"servers": servers})
+
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/compute/servers/"):
+		s, ok := f.servers[strings.TrimPrefix(path, "/compute/servers/")]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"server": s})
+
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "/compute/servers/"):
+		id := strings.TrimPrefix(path, "/compute/servers/")
+		if _, ok := f.servers[id]; !ok {
+			writeJSON(w, http.StatusNotFound, nil)
+			return
+		}
+		// Nova unbinds the ports but keeps the ones it did not create
+		delete(f.servers, id)
+		for _, p := range f.ports {
+			if p.DeviceID == id {
+				p.DeviceID = ""
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "/volume/volumes/"):
+		f.deletedVolumes = append(f.deletedVolumes, strings.TrimPrefix(path, "/volume/volumes/"))
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		writeJSON(w, http.StatusNotFound, nil)
+	}
+}
@@ -0,0 +1,79 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package openstack
+
+import (
+	"flag"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+var openstackcfg Config
+
+type Manager struct{}
+
+func init() {
+	provider.AddCloudProvider("openstack", &Manager{})
+}
+
+func (_ *Manager) ParseCmd(flags *flag.FlagSet) {
+
+	flags.StringVar(&openstackcfg.AuthURL, "openstack-auth-url", "", "Keystone v3 URL, defaults to `OS_AUTH_URL`")
+	flags.StringVar(&openstackcfg.Username, "openstack-username", "", "User name, defaults to `OS_USERNAME`")
+	flags.StringVar(&openstackcfg.Password, "openstack-password", "", "Password, defaults to `OS_PASSWORD`")
+	flags.StringVar(&openstackcfg.UserDomainName, "openstack-user-domain", "", "User domain name, defaults to `OS_USER_DOMAIN_NAME`")
+	flags.StringVar(&openstackcfg.ProjectName, "openstack-project", "", "Project name, defaults to `OS_PROJECT_NAME`")
+	flags.StringVar(&openstackcfg.ProjectDomainName, "openstack-project-domain", "", "Project domain name, defaults to `OS_PROJECT_DOMAIN_NAME`")
+	flags.StringVar(&openstackcfg.ApplicationCredentialID, "openstack-app-credential-id", "", "Application credential ID used instead of the user name and password, defaults to `OS_APPLICATION_CREDENTIAL_ID`")
+	flags.StringVar(&openstackcfg.ApplicationCredentialSecret, "openstack-app-credential-secret", "", "Application credential secret, defaults to `OS_APPLICATION_CREDENTIAL_SECRET`")
+	flags.StringVar(&openstackcfg.Region, "openstack-region", "", "Region, defaults to `OS_REGION_NAME`")
+	flags.StringVar(&openstackcfg.CACertFile, "openstack-cacert", "", "CA certificate bundle used to verify the API endpoints, defaults to `OS_CACERT`")
+	flags.StringVar(&openstackcfg.ImageID, "imageid", "", "Pod VM image id, defaults to `PODVM_IMAGE_ID`")
+	flags.StringVar(&openstackcfg.Flavor, "flavor", "m1.small", "Pod VM flavor name, defaults to `PODVM_INSTANCE_TYPE`")
+	// Add a List parameter to indicate different flavors to be used for the Pod VMs
+	flags.Var(&openstackcfg.Flavors, "flavors", "Flavor names to be used for the Pod VMs, comma separated")
+	flags.StringVar(&openstackcfg.NetworkID, "network-id", "", "Neutron network ID of the Pod VMs")
+	flags.Var(&openstackcfg.SecurityGroups, "security-groups", "Security group IDs to be used for the Pod VMs, comma separated")
+	flags.StringVar(&openstackcfg.KeyName, "keyname", "", "SSH Keypair name to be used with the Pod VM")
+	// Add a key value list parameter to indicate custom metadata to be used for the Pod VMs
+	flags.Var(&openstackcfg.Tags, "tags", "Custom metadata (key=value pairs) to be set on the Pod VMs, comma separated")
+	flags.BoolVar(&openstackcfg.UseConfigDrive, "use-config-drive", false, "Pass user data through a config drive instead of the metadata service")
+	flags.IntVar(&openstackcfg.BootVolumeSize, "boot-volume-size", 0, "Size (in GiB) of a boot volume created from the image, boot from the ephemeral disk if unset")
+	flags.StringVar(&openstackcfg.ClusterID, "cluster-id", "", "Cluster ID set in the metadata of the Pod VMs to allow garbage collection of orphaned instances, defaults to `PEERPODS_CLUSTER_ID`")
+
+}
+
+func (_ *Manager) LoadEnv() {
+	loadEnv(&openstackcfg, provider.DefaultToEnv)
+}
+
+func loadEnv(cfg *Config, load provider.EnvLoadFunc) {
+	load(&cfg.AuthURL, "OS_AUTH_URL", "")
+	load(&cfg.Username, "OS_USERNAME", "")
+	load(&cfg.Password, "OS_PASSWORD", "")
+	load(&cfg.UserDomainName, "OS_USER_DOMAIN_NAME", "Default")
+	load(&cfg.ProjectName, "OS_PROJECT_NAME", "")
+	load(&cfg.ProjectDomainName, "OS_PROJECT_DOMAIN_NAME", "Default")
+	load(&cfg.ApplicationCredentialID, "OS_APPLICATION_CREDENTIAL_ID", "")
+	load(&cfg.ApplicationCredentialSecret, "OS_APPLICATION_CREDENTIAL_SECRET", "")
+	load(&cfg.Region, "OS_REGION_NAME", "")
+	load(&cfg.CACertFile, "OS_CACERT", "")
+	load(&cfg.ImageID, "PODVM_IMAGE_ID", "")
+	load(&cfg.Flavor, "PODVM_INSTANCE_TYPE", "m1.small")
+	load(&cfg.ClusterID, "PEERPODS_CLUSTER_ID", "")
+}
+
+func (_ *Manager) NewProvider() (provider.Provider, error) {
+	return NewProvider(&openstackcfg)
+}
+
+func (_ *Manager) NewProviderWithEnv(env map[string]string) (provider.Provider, error) {
+	cfg := openstackcfg
+	loadEnv(&cfg, provider.OverrideFromEnv(env))
+	return NewProvider(&cfg)
+}
+
+func (_ *Manager) GetConfig() (config *Config) {
+	return &openstackcfg
+}
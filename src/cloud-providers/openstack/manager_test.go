@@ -0,0 +1,91 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package openstack
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestManager_ParseCmd(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected Config
+	}{
+		{
+			name: "AllFlagsSet",
+			args: []string{
+				"-openstack-auth-url=https://keystone.example.com/v3",
+				"-openstack-username=user",
+				"-openstack-password=secret",
+				"-openstack-user-domain=users",
+				"-openstack-project=project",
+				"-openstack-project-domain=projects",
+				"-openstack-app-credential-id=app-id",
+				"-openstack-app-credential-secret=app-secret",
+				"-openstack-region=RegionOne",
+				"-openstack-cacert=/etc/ssl/ca.pem",
+				"-imageid=image-id",
+				"-flavor=m1.medium",
+				"-flavors=m1.small,m1.medium",
+				"-network-id=network-id",
+				"-security-groups=sg-1,sg-2",
+				"-keyname=key",
+				"-tags=key1=value1",
+				"-use-config-drive=true",
+				"-boot-volume-size=20",
+			},
+			expected: Config{
+				AuthURL:                     "https://keystone.example.com/v3",
+				Username:                    "user",
+				Password:                    "secret",
+				UserDomainName:              "users",
+				ProjectName:                 "project",
+				ProjectDomainName:           "projects",
+				ApplicationCredentialID:     "app-id",
+				ApplicationCredentialSecret: "app-secret",
+				Region:                      "RegionOne",
+				CACertFile:                  "/etc/ssl/ca.pem",
+				ImageID:                     "image-id",
+				Flavor:                      "m1.medium",
+				Flavors:                     stringList{"m1.small", "m1.medium"},
+				NetworkID:                   "network-id",
+				SecurityGroups:              stringList{"sg-1", "sg-2"},
+				KeyName:                     "key",
+				Tags:                        map[string]string{"key1": "value1"},
+				UseConfigDrive:              true,
+				BootVolumeSize:              20,
+			},
+		},
+		{
+			name: "DefaultValues",
+			args: []string{},
+			expected: Config{
+				Flavor: "m1.small",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+
+			manager := &Manager{}
+			manager.ParseCmd(flags)
+
+			if err := flags.Parse(test.args); err != nil {
+				t.Errorf("Failed to parse flags: %v", err)
+			}
+
+			if !reflect.DeepEqual(test.expected, openstackcfg) {
+				t.Errorf("Expected config: %+v, but got: %+v", test.expected, openstackcfg)
+			}
+
+			// Reset the openstackcfg
+			openstackcfg = Config{}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// Ref: https://docs.openstack.org/nova/latest/user/metadata.html
+	OpenStackMetadataUrl = "http://169.254.169.254/openstack/latest/meta_data.json"
+	OpenStackUserDataUrl = "http://169.254.169.254/openstack/latest/user_data"
+)
+
+// Method to check if the VM is running on OpenStack
+// by checking if the OpenStack metadata service is reachable
+// If the VM is running on OpenStack, return true
+func IsOpenStack(ctx context.Context) bool {
+
+	client := &http.Client{}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, OpenStackMetadataUrl, nil)
+	if err != nil {
+		fmt.Printf("failed to create request: %s\n", err)
+		return false
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Printf("failed to send request: %s\n", err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode == http.StatusOK
+}
+
+// Method to retrieve userData from the OpenStack metadata service
+// and return it as a string
+func GetUserData(ctx context.Context, url string) ([]byte, error) {
+
+	// If url is empty then return empty string
+	if url == "" {
+		return nil, fmt.Errorf("url is empty")
+	}
+
+	client := &http.Client{}
+
+	// Example request for OpenStack.
+	// curl http://169.254.169.254/openstack/latest/user_data
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %s", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to retrieve userData: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %s", err)
+	}
+
+	return body, nil
+}
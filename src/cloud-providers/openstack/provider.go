@@ -0,0 +1,384 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package openstack
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/bootfromvolume"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/keypairs"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+)
+
+var logger = log.New(log.Writer(), "[adaptor/cloud/openstack] ", log.LstdFlags|log.Lmsgprefix)
+
+const (
+	maxInstanceNameLen = 63
+	maxWaitTime        = 120 * time.Second
+)
+
+// Interval between checks for the server deletion, a variable to speed up tests
+var deletePollInterval = 2 * time.Second
+
+type openstackProvider struct {
+	// Make client a mockable interface
+	client        openstackClient
+	serviceConfig *Config
+	// flavorIDs maps the flavor names to their IDs
+	flavorIDs map[string]string
+}
+
+func NewProvider(config *Config) (provider.Provider, error) {
+
+	logger.Printf("openstack config: %#v", config.Redact())
+
+	client, err := NewOpenStackClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &openstackProvider{
+		client:        client,
+		serviceConfig: config,
+	}
+
+	if err = provider.updateInstanceTypeSpecList(); err != nil {
+		return nil, err
+	}
+
+	return provider, nil
+}
+
+func getIPs(p *ports.Port) ([]netip.Addr, error) {
+
+	var podNodeIPs []netip.Addr
+	for i, fixed := range p.FixedIPs {
+		ip, err := netip.ParseAddr(fixed.IPAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pod node IP %q: %w", fixed.IPAddress, err)
+		}
+		podNodeIPs = append(podNodeIPs, ip)
+
+		logger.Printf("podNodeIP[%d]=%s", i, ip.String())
+	}
+
+	if len(podNodeIPs) == 0 {
+		return nil, fmt.Errorf("port %s has no fixed IP", p.ID)
+	}
+
+	return podNodeIPs, nil
+}
+
+func (p *openstackProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
+
+	instanceName := util.GenerateInstanceName(podName, sandboxID, maxInstanceNameLen)
+
+	cloudConfigData, err := cloudConfig.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	flavorName, err := p.selectInstanceType(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	flavorID, ok := p.flavorIDs[flavorName]
+	if !ok {
+		return nil, fmt.Errorf("flavor %q not found", flavorName)
+	}
+
+	// Create the port first so that the security groups apply from boot
+	// and the pod VM IP is known without waiting for the server to be active
+	portOpts := ports.CreateOpts{
+		Name:      instanceName,
+		NetworkID: p.serviceConfig.NetworkID,
+	}
+	// An empty list would drop the default security group of the project
+	if len(p.serviceConfig.SecurityGroups) > 0 {
+		securityGroups := []string(p.serviceConfig.SecurityGroups)
+		portOpts.SecurityGroups = &securityGroups
+	}
+	podPort, err := p.client.CreatePort(ctx, portOpts)
+	if err != nil {
+		return nil, fmt.Errorf("creating port for instance %s: %w", instanceName, err)
+	}
+
+	ips, err := getIPs(podPort)
+	if err != nil {
+		p.deletePort(ctx, podPort.ID)
+		return nil, err
+	}
+
+	// gophercloud passes user data that is valid base64 as is, encode it
+	// ourselves so that it is never sent unencoded
+	input := servers.CreateOpts{
+		Name:        instanceName,
+		FlavorRef:   flavorID,
+		UserData:    []byte(base64.StdEncoding.EncodeToString([]byte(cloudConfigData))),
+		ConfigDrive: &p.serviceConfig.UseConfigDrive,
+		Networks: []servers.Network{
+			{
+				Port: podPort.ID,
+			},
+		},
+	}
+
+	// Add custom metadata (k=v) from serviceConfig.Tags, the ownership tags
+	// and the pod tags to the server. Pod tags don't override the others.
+	ownershipTags := provider.OwnershipTags(p.serviceConfig.ClusterID, podName, spec.PodNamespace)
+	if len(p.serviceConfig.Tags) > 0 || len(spec.Tags) > 0 || len(ownershipTags) > 0 {
+		input.Metadata = provider.PodTags(spec, p.serviceConfig.Tags, ownershipTags)
+		for k, v := range p.serviceConfig.Tags {
+			input.Metadata[k] = v
+		}
+		for k, v := range ownershipTags {
+			input.Metadata[k] = v
+		}
+	}
+
+	if p.serviceConfig.BootVolumeSize == 0 {
+		input.ImageRef = p.serviceConfig.ImageID
+	}
+
+	var opts servers.CreateOptsBuilder = input
+	if p.serviceConfig.BootVolumeSize > 0 {
+		opts = bootfromvolume.CreateOptsExt{
+			CreateOptsBuilder: opts,
+			BlockDevice: []bootfromvolume.BlockDevice{
+				{
+					BootIndex:           0,
+					UUID:                p.serviceConfig.ImageID,
+					SourceType:          bootfromvolume.SourceImage,
+					DestinationType:     bootfromvolume.DestinationVolume,
+					VolumeSize:          p.serviceConfig.BootVolumeSize,
+					DeleteOnTermination: true,
+				},
+			},
+		}
+	}
+
+	if p.serviceConfig.KeyName != "" {
+		opts = keypairs.CreateOptsExt{
+			CreateOptsBuilder: opts,
+			KeyName:           p.serviceConfig.KeyName,
+		}
+	}
+
+	logger.Printf("CreateInstance: name: %q", instanceName)
+
+	result, err := p.client.CreateServer(ctx, opts)
+	if err != nil {
+		// The port is not deleted along with the server since we created it
+		p.deletePort(ctx, podPort.ID)
+		return nil, fmt.Errorf("creating instance %s: %w", instanceName, err)
+	}
+
+	logger.Printf("created an instance %s for sandbox %s", result.ID, sandboxID)
+
+	instance := &provider.Instance{
+		ID:      result.ID,
+		Name:    instanceName,
+		IPs:     ips,
+		Type:    flavorName,
+		ImageID: p.serviceConfig.ImageID,
+	}
+
+	return instance, nil
+}
+
+// Nova limits the base64 encoded user_data to 65535 bytes
+const maxUserDataSize = 65535 / 4 * 3
+
+func (p *openstackProvider) UserDataLimit() int {
+	return maxUserDataSize
+}
+
+func (p *openstackProvider) DeleteInstance(ctx context.Context, instanceID string) error {
+
+	logger.Printf("Deleting instance (%s)", instanceID)
+
+	srv, err := p.client.GetServer(ctx, instanceID)
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("%w: %s", provider.ErrInstanceNotFound, instanceID)
+		}
+		return fmt.Errorf("getting instance %s: %w", instanceID, err)
+	}
+
+	// Ports created by the adaptor are not released by Nova, list them before
+	// the server is gone
+	podPorts, err := p.client.ListPorts(ctx, instanceID)
+	if err != nil {
+		return fmt.Errorf("listing ports of instance %s: %w", instanceID, err)
+	}
+
+	if err := p.client.DeleteServer(ctx, instanceID); err != nil && !isNotFound(err) {
+		logger.Printf("failed to delete an instance: %v", err)
+		return err
+	}
+
+	if err := p.waitForServerDeletion(ctx, instanceID); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, pt := range podPorts {
+		if err := p.client.DeletePort(ctx, pt.ID); err != nil && !isNotFound(err) {
+			errs = append(errs, fmt.Errorf("deleting port %s: %w", pt.ID, err))
+		}
+	}
+
+	// Nova deletes the boot volume by itself, unless the server was in a state
+	// in which the volume could not be detached. Only delete the volumes that
+	// were meant to be deleted, other volumes (e.g. attached by the CSI wrapper)
+	// are owned by someone else
+	for _, vol := range srv.VolumesAttached {
+		if !vol.DeleteOnTermination {
+			continue
+		}
+		if err := p.client.DeleteVolume(ctx, vol.ID); err != nil && !isNotFound(err) {
+			errs = append(errs, fmt.Errorf("deleting volume %s: %w", vol.ID, err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		logger.Printf("failed to release the resources of instance %s: %v", instanceID, err)
+		return err
+	}
+
+	logger.Printf("deleted an instance %s", instanceID)
+	return nil
+}
+
+// waitForServerDeletion waits until the server no longer exists, so that its volumes are detached
+func (p *openstackProvider) waitForServerDeletion(ctx context.Context, instanceID string) error {
+
+	ctx, cancel := context.WithTimeout(ctx, maxWaitTime)
+	defer cancel()
+
+	for {
+		if _, err := p.client.GetServer(ctx, instanceID); err != nil {
+			if isNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("waiting for instance %s deletion: %w", instanceID, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for instance %s deletion: %w", instanceID, ctx.Err())
+		case <-time.After(deletePollInterval):
+		}
+	}
+}
+
+// ListInstances returns the servers of the project whose metadata holds the given cluster ID.
+// Nova can't filter servers on their metadata, so all the servers are listed.
+func (p *openstackProvider) ListInstances(ctx context.Context, clusterID string) ([]*provider.Instance, error) {
+
+	result, err := p.client.ListServers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing instances of cluster %q: %w", clusterID, err)
+	}
+
+	var instances []*provider.Instance
+	for _, srv := range result {
+		if srv.Metadata[provider.ClusterIDTagKey] != clusterID {
+			continue
+		}
+		instances = append(instances, &provider.Instance{
+			ID:        srv.ID,
+			Name:      srv.Name,
+			Tags:      srv.Metadata,
+			CreatedAt: srv.Created,
+		})
+	}
+
+	return instances, nil
+}
+
+func (p *openstackProvider) deletePort(ctx context.Context, portID string) {
+	if err := p.client.DeletePort(ctx, portID); err != nil {
+		logger.Printf("failed to delete port %s: %v", portID, err)
+	}
+}
+
+func (p *openstackProvider) Teardown() error {
+	return nil
+}
+
+func (p *openstackProvider) ConfigVerifier() error {
+	if len(p.serviceConfig.ImageID) == 0 {
+		return fmt.Errorf("ImageID is empty")
+	}
+	if len(p.serviceConfig.NetworkID) == 0 {
+		return fmt.Errorf("NetworkID is empty")
+	}
+	return nil
+}
+
+// Select a flavor based on the memory and vcpu requirements
+func (p *openstackProvider) selectInstanceType(ctx context.Context, spec provider.InstanceTypeSpec) (string, error) {
+
+	return provider.SelectInstanceTypeToUse(spec, p.serviceConfig.FlavorSpecList, p.serviceConfig.Flavors, p.serviceConfig.Flavor)
+}
+
+// InstanceCatalog implements provider.CatalogReporter
+func (p *openstackProvider) InstanceCatalog() provider.InstanceCatalog {
+	return provider.InstanceCatalog{
+		DefaultInstanceType: p.serviceConfig.Flavor,
+		InstanceTypes:       p.serviceConfig.Flavors,
+		Specs:               p.serviceConfig.FlavorSpecList,
+	}
+}
+
+// Populate FlavorSpecList for all the configured flavors from the flavors defined in Nova
+func (p *openstackProvider) updateInstanceTypeSpecList() error {
+
+	flavorNames := p.serviceConfig.Flavors
+
+	// If flavorNames is empty then populate it with the default flavor
+	if len(flavorNames) == 0 {
+		flavorNames = append(flavorNames, p.serviceConfig.Flavor)
+	}
+
+	flavorList, err := p.client.ListFlavors(context.Background())
+	if err != nil {
+		return fmt.Errorf("listing flavors: %w", err)
+	}
+
+	available := make(map[string]flavors.Flavor, len(flavorList))
+	for _, f := range flavorList {
+		available[f.Name] = f
+	}
+
+	var flavorSpecList []provider.InstanceTypeSpec
+	p.flavorIDs = make(map[string]string)
+
+	for _, name := range flavorNames {
+		f, ok := available[name]
+		if !ok {
+			return fmt.Errorf("flavor %q not found", name)
+		}
+		p.flavorIDs[name] = f.ID
+		flavorSpecList = append(flavorSpecList, provider.InstanceTypeSpec{InstanceType: name, VCPUs: int64(f.VCPUs), Memory: int64(f.RAM)})
+	}
+
+	// Sort the flavorSpecList by Memory and update the serviceConfig
+	p.serviceConfig.FlavorSpecList = provider.SortInstanceTypesOnMemory(flavorSpecList)
+	logger.Printf("FlavorSpecList (%v)", p.serviceConfig.FlavorSpecList)
+	return nil
+}
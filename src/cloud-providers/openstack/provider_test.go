@@ -0,0 +1,261 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package openstack
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+type mockCloudConfig struct{}
+
+func (c *mockCloudConfig) Generate() (string, error) {
+	return "cloud config", nil
+}
+
+func newTestProvider(t *testing.T, config *Config) *openstackProvider {
+	client, err := NewOpenStackClient(config)
+	if err != nil {
+		t.Fatalf("NewOpenStackClient() error = %v", err)
+	}
+	p := &openstackProvider{
+		client:        client,
+		serviceConfig: config,
+	}
+	if err := p.updateInstanceTypeSpecList(); err != nil {
+		t.Fatalf("updateInstanceTypeSpecList() error = %v", err)
+	}
+	return p
+}
+
+func TestCreateInstance(t *testing.T) {
+	tests := []struct {
+		name           string
+		bootVolumeSize int
+		flavors        stringList
+		spec           provider.InstanceTypeSpec
+		wantFlavorRef  string
+		wantFlavor     string
+	}{
+		{
+			name:          "CreateInstanceWithDefaultFlavor",
+			spec:          provider.InstanceTypeSpec{Tags: map[string]string{"peerpods-namespace": "default", "team": "other"}},
+			wantFlavorRef: "1",
+			wantFlavor:    "m1.small",
+		},
+		{
+			name:           "CreateInstanceWithBootVolume",
+			bootVolumeSize: 20,
+			flavors:        stringList{"m1.small", "m1.large"},
+			spec:           provider.InstanceTypeSpec{VCPUs: 2, Memory: 4096},
+			wantFlavorRef:  "3",
+			wantFlavor:     "m1.large",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeOpenStack(t)
+			config := fake.config()
+			config.BootVolumeSize = tt.bootVolumeSize
+			config.Flavors = tt.flavors
+			config.UseConfigDrive = true
+			config.Tags = provider.KeyValueFlag{"team": "peerpods"}
+			p := newTestProvider(t, config)
+
+			instance, err := p.CreateInstance(context.Background(), "test", "123", &mockCloudConfig{}, tt.spec)
+			if err != nil {
+				t.Fatalf("CreateInstance() error = %v", err)
+			}
+
+			want := &provider.Instance{
+				ID:      "server-1",
+				Name:    "podvm-test-123",
+				IPs:     []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+				Type:    tt.wantFlavor,
+				ImageID: "image-id",
+			}
+			if !reflect.DeepEqual(instance, want) {
+				t.Errorf("CreateInstance() = %+v, want %+v", instance, want)
+			}
+
+			port := fake.ports["port-1"]
+			if port == nil || port.NetworkID != "network-id" || !reflect.DeepEqual(port.SecurityGroups, []string{"sg-1", "sg-2"}) {
+				t.Errorf("unexpected port %+v", port)
+			}
+
+			created := fake.createdServer
+			if created.FlavorRef != tt.wantFlavorRef {
+				t.Errorf("flavorRef = %q, want %q", created.FlavorRef, tt.wantFlavorRef)
+			}
+			if userData, _ := base64.StdEncoding.DecodeString(created.UserData); string(userData) != "cloud config" {
+				t.Errorf("user_data = %q", created.UserData)
+			}
+			if !created.ConfigDrive {
+				t.Errorf("config_drive not set")
+			}
+			if !reflect.DeepEqual(created.Networks, []serverNetwork{{Port: "port-1"}}) {
+				t.Errorf("networks = %+v", created.Networks)
+			}
+			if created.Metadata["team"] != "peerpods" {
+				t.Errorf("metadata = %v", created.Metadata)
+			}
+			if ns, ok := tt.spec.Tags["peerpods-namespace"]; ok && created.Metadata["peerpods-namespace"] != ns {
+				t.Errorf("metadata = %v, want pod tags", created.Metadata)
+			}
+
+			if tt.bootVolumeSize > 0 {
+				wantBDM := []blockDevice{{UUID: "image-id", SourceType: "image", DestinationType: "volume", VolumeSize: tt.bootVolumeSize, DeleteOnTermination: true}}
+				if created.ImageRef != "" || !reflect.DeepEqual(created.BlockDeviceMapping, wantBDM) {
+					t.Errorf("imageRef = %q, block_device_mapping_v2 = %+v", created.ImageRef, created.BlockDeviceMapping)
+				}
+			} else if created.ImageRef != "image-id" || created.BlockDeviceMapping != nil {
+				t.Errorf("imageRef = %q, block_device_mapping_v2 = %+v", created.ImageRef, created.BlockDeviceMapping)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceFailureReleasesPort(t *testing.T) {
+	fake := newFakeOpenStack(t)
+	p := newTestProvider(t, fake.config())
+
+	fake.failServerCreate = true
+	if _, err := p.CreateInstance(context.Background(), "test", "123", &mockCloudConfig{}, provider.InstanceTypeSpec{}); err == nil {
+		t.Fatalf("CreateInstance() expected an error")
+	}
+	if len(fake.ports) != 0 {
+		t.Errorf("port leaked: %+v", fake.ports)
+	}
+}
+
+func TestDeleteInstance(t *testing.T) {
+	deletePollInterval = 0
+
+	fake := newFakeOpenStack(t)
+	p := newTestProvider(t, fake.config())
+
+	instance, err := p.CreateInstance(context.Background(), "test", "123", &mockCloudConfig{}, provider.InstanceTypeSpec{})
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	// A boot volume left behind by Nova and a volume attached by someone else
+	fake.servers[instance.ID].VolumesAttached = []attachedVolume{
+		{ID: "boot-volume", DeleteOnTermination: true},
+		{ID: "csi-volume"},
+	}
+
+	if err := p.DeleteInstance(context.Background(), instance.ID); err != nil {
+		t.Fatalf("DeleteInstance() error = %v", err)
+	}
+	if len(fake.servers) != 0 {
+		t.Errorf("server not deleted: %+v", fake.servers)
+	}
+	if len(fake.ports) != 0 {
+		t.Errorf("port not deleted: %+v", fake.ports)
+	}
+	if !reflect.DeepEqual(fake.deletedVolumes, []string{"boot-volume"}) {
+		t.Errorf("deleted volumes = %v, want [boot-volume]", fake.deletedVolumes)
+	}
+
+	// Deleting a missing instance reports it as not found
+	if err := p.DeleteInstance(context.Background(), instance.ID); !errors.Is(err, provider.ErrInstanceNotFound) {
+		t.Errorf("DeleteInstance() of a deleted instance error = %v, want %v", err, provider.ErrInstanceNotFound)
+	}
+}
+
+func TestListInstances(t *testing.T) {
+	fake := newFakeOpenStack(t)
+	config := fake.config()
+	p := newTestProvider(t, config)
+
+	spec := provider.InstanceTypeSpec{
+		PodNamespace: "default",
+		Tags:         map[string]string{provider.PodNameTagKey: "other"},
+	}
+
+	config.ClusterID = "cluster-1"
+	owned, err := p.CreateInstance(context.Background(), "web.0", "123", &mockCloudConfig{}, spec)
+	if err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+	wantTags := map[string]string{
+		provider.ClusterIDTagKey: "cluster-1",
+		provider.PodNameTagKey:   "web.0",
+		provider.NamespaceTagKey: "default",
+	}
+	if !reflect.DeepEqual(fake.createdServer.Metadata, wantTags) {
+		t.Errorf("metadata = %v, want %v", fake.createdServer.Metadata, wantTags)
+	}
+
+	config.ClusterID = "cluster-2"
+	if _, err := p.CreateInstance(context.Background(), "web.1", "456", &mockCloudConfig{}, spec); err != nil {
+		t.Fatalf("CreateInstance() error = %v", err)
+	}
+
+	instances, err := p.ListInstances(context.Background(), "cluster-1")
+	if err != nil {
+		t.Fatalf("ListInstances() error = %v", err)
+	}
+	if len(instances) != 1 {
+		t.Fatalf("ListInstances() = %+v, want one instance", instances)
+	}
+	if instances[0].ID != owned.ID || instances[0].Name != owned.Name || !reflect.DeepEqual(instances[0].Tags, wantTags) {
+		t.Errorf("ListInstances() = %+v, want instance %s with tags %v", instances[0], owned.ID, wantTags)
+	}
+	if time.Since(instances[0].CreatedAt) > time.Minute {
+		t.Errorf("CreatedAt = %v, want the creation time", instances[0].CreatedAt)
+	}
+}
+
+func TestUpdateInstanceTypeSpecList(t *testing.T) {
+	fake := newFakeOpenStack(t)
+	config := fake.config()
+	config.Flavors = stringList{"m1.large", "m1.small"}
+	p := newTestProvider(t, config)
+
+	want := []provider.InstanceTypeSpec{
+		{InstanceType: "m1.small", VCPUs: 1, Memory: 2048},
+		{InstanceType: "m1.large", VCPUs: 4, Memory: 8192},
+	}
+	if !reflect.DeepEqual(config.FlavorSpecList, want) {
+		t.Errorf("FlavorSpecList = %+v, want %+v", config.FlavorSpecList, want)
+	}
+
+	config.Flavors = stringList{"m1.unknown"}
+	if err := p.updateInstanceTypeSpecList(); err == nil {
+		t.Errorf("updateInstanceTypeSpecList() expected an error for an unknown flavor")
+	}
+}
+
+func TestReauthenticateOnRevokedToken(t *testing.T) {
+	fake := newFakeOpenStack(t)
+	p := newTestProvider(t, fake.config())
+
+	fake.revokeToken()
+
+	if _, err := p.client.ListFlavors(context.Background()); err != nil {
+		t.Fatalf("ListFlavors() error = %v", err)
+	}
+	if fake.tokens != 2 {
+		t.Errorf("authenticated %d times, want 2", fake.tokens)
+	}
+}
+
+func TestAuthenticationFailure(t *testing.T) {
+	fake := newFakeOpenStack(t)
+	config := fake.config()
+	config.Password = "wrong"
+
+	if _, err := NewOpenStackClient(config); err == nil {
+		t.Errorf("NewOpenStackClient() expected an authentication error")
+	}
+}
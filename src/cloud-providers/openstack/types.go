@@ -0,0 +1,54 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package openstack
+
+import (
+	"strings"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
+)
+
+type stringList []string
+
+func (i *stringList) String() string {
+	return strings.Join(*i, ", ")
+}
+
+func (i *stringList) Set(value string) error {
+	if len(value) == 0 {
+		*i = make(stringList, 0)
+	} else {
+		*i = append(*i, strings.Split(value, ",")...)
+	}
+	return nil
+}
+
+type Config struct {
+	AuthURL                     string
+	Username                    string
+	Password                    string
+	UserDomainName              string
+	ProjectName                 string
+	ProjectDomainName           string
+	ApplicationCredentialID     string
+	ApplicationCredentialSecret string
+	Region                      string
+	CACertFile                  string
+	ImageID                     string
+	Flavor                      string
+	Flavors                     stringList
+	FlavorSpecList              []provider.InstanceTypeSpec
+	NetworkID                   string
+	SecurityGroups              stringList
+	KeyName                     string
+	Tags                        provider.KeyValueFlag
+	UseConfigDrive              bool
+	BootVolumeSize              int
+	ClusterID                   string
+}
+
+func (c Config) Redact() Config {
+	return *util.RedactStruct(&c, "Password", "ApplicationCredentialSecret").(*Config)
+}
@@ -0,0 +1,277 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownProfile is returned when a pod selects a profile that is not configured
+var ErrUnknownProfile = errors.New("unknown provider profile")
+
+// ProfilesPollInterval is how often the profiles directory is read for
+// changes. The kubelet updates mounted Secrets about once a minute.
+const ProfilesPollInterval = 30 * time.Second
+
+// loadProfiles reads the provider profiles from dir. Each subdirectory is a
+// profile named after it, holding one file per configuration variable, which
+// is the layout of a ConfigMap or Secret mounted in it. A missing dir means
+// that no profile is configured.
+func loadProfiles(dir string) (map[string]map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading provider profiles: %w", err)
+	}
+
+	profiles := make(map[string]map[string]string)
+	for _, entry := range entries {
+		// Skip the hidden entries of the atomic writer of mounted volumes
+		if strings.HasPrefix(entry.Name(), ".") || !isDir(filepath.Join(dir, entry.Name())) {
+			continue
+		}
+		env, err := loadProfile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading provider profile %s: %w", entry.Name(), err)
+		}
+		profiles[entry.Name()] = env
+	}
+	return profiles, nil
+}
+
+func loadProfile(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string)
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if strings.HasPrefix(entry.Name(), ".") || isDir(path) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		env[entry.Name()] = strings.TrimSuffix(string(data), "\n")
+	}
+	return env, nil
+}
+
+// WatchProfiles reads the profiles in dir every interval until ctx is done, and
+// calls reload when they changed since the previous read. The kubelet updates
+// the Secrets mounted in dir without any event on the peer-pods ConfigMap.
+func WatchProfiles(ctx context.Context, dir string, interval time.Duration, reload func()) {
+	last, err := loadProfiles(dir)
+	if err != nil {
+		logger.Printf("watching the provider profiles: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		profiles, err := loadProfiles(dir)
+		if err != nil {
+			logger.Printf("watching the provider profiles: %v", err)
+			continue
+		}
+		if maps.EqualFunc(profiles, last, maps.Equal[map[string]string]) {
+			continue
+		}
+		last = profiles
+		logger.Printf("the provider profiles in %s changed", dir)
+		reload()
+	}
+}
+
+// isDir follows symlinks, mounted volumes link their entries to a hidden directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// NewProfileProvider creates the provider of a profile. The profile selects
+// its cloud with CLOUD_PROVIDER, defaulting to defaultCloud, and its variables
+// take precedence over env.
+func NewProfileProvider(profile map[string]string, defaultCloud string, env map[string]string) (Provider, error) {
+	merged := maps.Clone(env)
+	if merged == nil {
+		merged = make(map[string]string)
+	}
+	maps.Copy(merged, profile)
+
+	return NewProviderWithEnv(profileCloud(profile, defaultCloud), merged)
+}
+
+func profileCloud(profile map[string]string, defaultCloud string) string {
+	if cloudName := profile["CLOUD_PROVIDER"]; cloudName != "" {
+		return cloudName
+	}
+	return defaultCloud
+}
+
+// Profiles holds the provider of each named profile next to the default
+// provider, each of them swappable on its own.
+type Profiles struct {
+	mutex     sync.Mutex
+	defaults  *SwappableProvider
+	providers map[string]*SwappableProvider
+	// clouds maps the loaded profiles to the name of their cloud provider
+	clouds map[string]string
+}
+
+func NewProfiles(defaultProvider Provider) *Profiles {
+	return &Profiles{
+		defaults:  NewSwappableProvider(defaultProvider),
+		providers: make(map[string]*SwappableProvider),
+		clouds:    make(map[string]string),
+	}
+}
+
+// Default returns the provider used when no profile is selected
+func (p *Profiles) Default() *SwappableProvider {
+	return p.defaults
+}
+
+// Set adds the provider of a profile, or replaces it once the operations
+// using the previous one are done
+func (p *Profiles) Set(name string, cloudProvider Provider) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if s, ok := p.providers[name]; ok {
+		s.Swap(cloudProvider)
+		return
+	}
+	p.providers[name] = NewSwappableProvider(cloudProvider)
+}
+
+// Load creates the provider of every profile found in dir, see NewProfileProvider.
+// The profiles loaded earlier that are no longer found in dir are removed.
+func (p *Profiles) Load(dir, defaultCloud string, env map[string]string) error {
+	profiles, err := loadProfiles(dir)
+	if err != nil {
+		return err
+	}
+	p.removeStale(profiles)
+	for name, profile := range profiles {
+		cloudProvider, err := NewProfileProvider(profile, defaultCloud, env)
+		if err != nil {
+			return fmt.Errorf("creating the provider of profile %s: %w", name, err)
+		}
+		p.Set(name, cloudProvider)
+
+		p.mutex.Lock()
+		p.clouds[name] = profileCloud(profile, defaultCloud)
+		p.mutex.Unlock()
+
+		logger.Printf("loaded provider profile %s", name)
+	}
+	return nil
+}
+
+// removeStale removes the profiles loaded from a directory that are not in
+// profiles. Their providers are torn down once the operations using them are done.
+func (p *Profiles) removeStale(profiles map[string]map[string]string) {
+	p.mutex.Lock()
+	var stale []*SwappableProvider
+	for name := range p.clouds {
+		if _, ok := profiles[name]; ok {
+			continue
+		}
+		if s, ok := p.providers[name]; ok {
+			stale = append(stale, s)
+		}
+		delete(p.providers, name)
+		delete(p.clouds, name)
+		logger.Printf("removed provider profile %s", name)
+	}
+	p.mutex.Unlock()
+
+	for _, s := range stale {
+		s.Retire()
+	}
+}
+
+// Has returns whether a profile is configured
+func (p *Profiles) Has(name string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	_, ok := p.providers[name]
+	return ok
+}
+
+// CloudName returns the name of the cloud provider of a profile loaded from a
+// directory, or an empty string if it is unknown
+func (p *Profiles) CloudName(name string) string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.clouds[name]
+}
+
+// Names returns the sorted names of the configured profiles
+func (p *Profiles) Names() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	names := make([]string, 0, len(p.providers))
+	for name := range p.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Acquire returns the provider of a profile, or the default provider if name
+// is empty, and a function to call once the operation using it completes
+func (p *Profiles) Acquire(name string) (Provider, func(), error) {
+	s := p.defaults
+	if name != "" {
+		p.mutex.Lock()
+		var ok bool
+		s, ok = p.providers[name]
+		p.mutex.Unlock()
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+		}
+	}
+
+	cloudProvider, release := s.Acquire()
+	return cloudProvider, release, nil
+}
+
+// Teardown tears down the default provider and the provider of every profile
+func (p *Profiles) Teardown() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	errs := []error{p.defaults.Teardown()}
+	for name, s := range p.providers {
+		if err := s.Teardown(); err != nil {
+			errs = append(errs, fmt.Errorf("profile %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,204 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// envProvider records the configuration it was created with
+type envProvider struct {
+	teardownProvider
+	env map[string]string
+}
+
+type envCloud struct{}
+
+func (c *envCloud) ParseCmd(flags *flag.FlagSet) {}
+
+func (c *envCloud) LoadEnv() {}
+
+func (c *envCloud) NewProvider() (Provider, error) {
+	return &envProvider{}, nil
+}
+
+func (c *envCloud) NewProviderWithEnv(env map[string]string) (Provider, error) {
+	return &envProvider{env: env}, nil
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"aws-us-east/AWS_REGION":         "us-east-1\n",
+		"aws-us-east/CLOUD_PROVIDER":     "aws",
+		"azure-westeu/..data/IGNORED":    "x",
+		"azure-westeu/AZURE_REGION":      "westeurope",
+		"azure-westeu/AZURE_CLIENT_ID":   "id",
+		"..2024_01_01/aws-us-east/OTHER": "x",
+		"README":                         "not a profile",
+	})
+
+	profiles, err := loadProfiles(dir)
+	if err != nil {
+		t.Fatalf("loadProfiles() error = %v", err)
+	}
+	want := map[string]map[string]string{
+		"aws-us-east":  {"AWS_REGION": "us-east-1", "CLOUD_PROVIDER": "aws"},
+		"azure-westeu": {"AZURE_REGION": "westeurope", "AZURE_CLIENT_ID": "id"},
+	}
+	if !reflect.DeepEqual(profiles, want) {
+		t.Errorf("loadProfiles() = %v, want %v", profiles, want)
+	}
+
+	if profiles, err := loadProfiles(filepath.Join(dir, "missing")); err != nil || profiles != nil {
+		t.Errorf("loadProfiles() of a missing dir = %v, %v, want no profile", profiles, err)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	AddCloudProvider("profiletest", &envCloud{})
+	defer delete(providerTable, "profiletest")
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"east/REGION": "east",
+		"west/REGION": "west",
+	})
+
+	defaults := &teardownProvider{}
+	profiles := NewProfiles(defaults)
+	if err := profiles.Load(dir, "profiletest", map[string]string{"REGION": "default", "KEY": "secret"}); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cloudName := profiles.CloudName("east"); cloudName != "profiletest" {
+		t.Errorf("CloudName(east) = %q, want profiletest", cloudName)
+	}
+	if names := profiles.Names(); !reflect.DeepEqual(names, []string{"east", "west"}) {
+		t.Errorf("Names() = %v", names)
+	}
+
+	p, release, err := profiles.Acquire("")
+	if err != nil || p != defaults {
+		t.Errorf("Acquire(\"\") = %v, %v, want the default provider", p, err)
+	} else {
+		release()
+	}
+
+	p, release, err = profiles.Acquire("west")
+	if err != nil {
+		t.Fatalf("Acquire(west) error = %v", err)
+	}
+	defer release()
+	want := map[string]string{"REGION": "west", "KEY": "secret"}
+	if got := p.(*envProvider).env; !reflect.DeepEqual(got, want) {
+		t.Errorf("profile env = %v, want %v", got, want)
+	}
+
+	if _, _, err := profiles.Acquire("north"); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("Acquire(north) error = %v, want ErrUnknownProfile", err)
+	}
+
+	if err := profiles.Teardown(); err != nil || !defaults.tornDown || !p.(*envProvider).tornDown {
+		t.Errorf("Teardown() = %v, did not tear down all the providers", err)
+	}
+}
+
+func TestWatchProfiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"east/REGION": "east"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloaded := make(chan struct{}, 1)
+	go WatchProfiles(ctx, dir, 10*time.Millisecond, func() { reloaded <- struct{}{} })
+
+	// Unchanged profiles are not reloaded
+	select {
+	case <-reloaded:
+		t.Fatalf("reload called for unchanged profiles")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	writeFiles(t, dir, map[string]string{"west/REGION": "west"})
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("reload not called for an added profile")
+	}
+
+	if err := os.RemoveAll(filepath.Join(dir, "east")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("reload not called for a removed profile")
+	}
+}
+
+func TestProfilesLoadRemovesStale(t *testing.T) {
+	AddCloudProvider("profiletest", &envCloud{})
+	defer delete(providerTable, "profiletest")
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"east/REGION": "east",
+		"west/REGION": "west",
+	})
+
+	profiles := NewProfiles(&teardownProvider{})
+	if err := profiles.Load(dir, "profiletest", nil); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	west, release, err := profiles.Acquire("west")
+	if err != nil {
+		t.Fatalf("Acquire(west) error = %v", err)
+	}
+
+	if err := os.RemoveAll(filepath.Join(dir, "west")); err != nil {
+		t.Fatal(err)
+	}
+	if err := profiles.Load(dir, "profiletest", nil); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if names := profiles.Names(); !reflect.DeepEqual(names, []string{"east"}) {
+		t.Errorf("Names() = %v, want [east]", names)
+	}
+	if cloudName := profiles.CloudName("west"); cloudName != "" {
+		t.Errorf("CloudName(west) = %q, want an empty string", cloudName)
+	}
+	if _, _, err := profiles.Acquire("west"); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("Acquire(west) error = %v, want ErrUnknownProfile", err)
+	}
+
+	// The removed provider is torn down once the operation using it is done
+	if west.(*envProvider).tornDown {
+		t.Errorf("removed provider torn down while in use")
+	}
+	release()
+	if !west.(*envProvider).tornDown {
+		t.Errorf("removed provider not torn down")
+	}
+}
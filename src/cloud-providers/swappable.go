@@ -0,0 +1,95 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import "sync"
+
+// SwappableProvider holds a Provider that can be replaced while it is in use,
+// e.g. after the cloud credentials were rotated. Operations keep using the
+// provider they acquired, and a replaced provider is torn down once all of
+// them have released it.
+type SwappableProvider struct {
+	mutex   sync.Mutex
+	current *providerRef
+}
+
+type providerRef struct {
+	provider Provider
+	users    int
+	retired  bool
+}
+
+func NewSwappableProvider(p Provider) *SwappableProvider {
+	return &SwappableProvider{current: &providerRef{provider: p}}
+}
+
+// Acquire returns the current provider and a function to call once the
+// operation using it completes
+func (s *SwappableProvider) Acquire() (Provider, func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ref := s.current
+	ref.users++
+
+	var once sync.Once
+	return ref.provider, func() {
+		once.Do(func() { s.release(ref) })
+	}
+}
+
+func (s *SwappableProvider) release(ref *providerRef) {
+	s.mutex.Lock()
+	ref.users--
+	drained := ref.retired && ref.users == 0
+	s.mutex.Unlock()
+
+	if drained {
+		teardownRetired(ref.provider)
+	}
+}
+
+// Swap replaces the current provider. The previous provider is torn down
+// once the operations that acquired it are done.
+func (s *SwappableProvider) Swap(p Provider) {
+	s.mutex.Lock()
+	old := s.current
+	s.current = &providerRef{provider: p}
+	old.retired = true
+	drained := old.users == 0
+	s.mutex.Unlock()
+
+	if drained {
+		teardownRetired(old.provider)
+	}
+}
+
+// Retire tears down the current provider once the operations that acquired
+// it are done, for providers that are no longer configured
+func (s *SwappableProvider) Retire() {
+	s.mutex.Lock()
+	ref := s.current
+	ref.retired = true
+	drained := ref.users == 0
+	s.mutex.Unlock()
+
+	if drained {
+		teardownRetired(ref.provider)
+	}
+}
+
+// Teardown tears down the current provider
+func (s *SwappableProvider) Teardown() error {
+	s.mutex.Lock()
+	p := s.current.provider
+	s.mutex.Unlock()
+
+	return p.Teardown()
+}
+
+func teardownRetired(p Provider) {
+	if err := p.Teardown(); err != nil {
+		logger.Printf("failed to tear down the replaced provider: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+type teardownProvider struct {
+	tornDown bool
+}
+
+func (p *teardownProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec InstanceTypeSpec) (*Instance, error) {
+	return &Instance{}, nil
+}
+
+func (p *teardownProvider) DeleteInstance(ctx context.Context, instanceID string) error {
+	return nil
+}
+
+func (p *teardownProvider) Teardown() error {
+	p.tornDown = true
+	return nil
+}
+
+func (p *teardownProvider) ConfigVerifier() error {
+	return nil
+}
+
+func TestSwappableProvider(t *testing.T) {
+	first, second, third := &teardownProvider{}, &teardownProvider{}, &teardownProvider{}
+	s := NewSwappableProvider(first)
+
+	p, release := s.Acquire()
+	if p != first {
+		t.Fatalf("Acquire() = %v, want the first provider", p)
+	}
+
+	s.Swap(second)
+	if got, done := s.Acquire(); got != second {
+		t.Errorf("Acquire() after Swap() = %v, want the second provider", got)
+	} else {
+		done()
+	}
+
+	// The first provider is still in use
+	if first.tornDown {
+		t.Errorf("replaced provider torn down while in use")
+	}
+	release()
+	release()
+	if !first.tornDown {
+		t.Errorf("replaced provider not torn down once released")
+	}
+
+	// An idle provider is torn down right away
+	s.Swap(third)
+	if !second.tornDown {
+		t.Errorf("idle replaced provider not torn down")
+	}
+
+	if err := s.Teardown(); err != nil || !third.tornDown {
+		t.Errorf("Teardown() = %v, current provider torn down %v", err, third.tornDown)
+	}
+}
+
+func TestOverrideFromEnv(t *testing.T) {
+	load := OverrideFromEnv(map[string]string{"SET": "new"})
+
+	set, kept, empty := "old", "old", ""
+	load(&set, "SET", "fallback")
+	load(&kept, "UNSET", "fallback")
+	load(&empty, "UNSET", "fallback")
+
+	if set != "new" || kept != "old" || empty != "fallback" {
+		t.Errorf("OverrideFromEnv() set %q, %q, %q, want %q, %q, %q", set, kept, empty, "new", "old", "fallback")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"plugin"
 	"strings"
+	"sync"
 )
 
 type CloudProvider interface {
@@ -17,7 +18,44 @@ type CloudProvider interface {
 	NewProvider() (Provider, error)
 }
 
-var providerTable map[string]CloudProvider = make(map[string]CloudProvider)
+// ReloadableCloudProvider is an optional interface implemented by cloud
+// providers that can take their configuration from a given set of environment
+// variables, e.g. the data of the peer-pods ConfigMap and Secret, so that
+// rotated credentials are picked up without restarting the process.
+type ReloadableCloudProvider interface {
+	// NewProviderWithEnv creates a provider from a copy of the current
+	// configuration in which the variables set in env replace the values
+	// loaded by ParseCmd and LoadEnv. Providers created earlier keep their
+	// configuration.
+	NewProviderWithEnv(env map[string]string) (Provider, error)
+}
+
+var (
+	providerTable = make(map[string]CloudProvider)
+	tableMutex    sync.RWMutex
+)
+
+// ExternalPluginLauncher connects to cloud provider plugins running out of process
+type ExternalPluginLauncher interface {
+	// Launch spawns the plugin binary at path and connects to it
+	Launch(name, path string) (CloudProvider, error)
+}
+
+var pluginLauncher ExternalPluginLauncher
+
+// connectedPlugins records the out-of-process plugins already registered, so
+// that repeated calls to Get don't spawn the plugin again. pluginMutex
+// serializes the loading of plugins, Get is called by the configuration
+// reload goroutines too.
+var (
+	connectedPlugins = make(map[string]bool)
+	pluginMutex      sync.Mutex
+)
+
+// SetExternalPluginLauncher sets the launcher used for out-of-process plugins
+func SetExternalPluginLauncher(launcher ExternalPluginLauncher) {
+	pluginLauncher = launcher
+}
 
 func getFileNameAndSha256sum(providerPath string) (string, string, error) {
 	file, err := os.Open(providerPath)
@@ -57,12 +95,26 @@ func hasExecutePermission(providerPath string) (bool, error) {
 // LoadCloudProvider loads cloud provider external plugin from the given path CLOUD_PROVIDER_EXTERNAL_PLUGIN_PATH
 // The values of 1) ${CLOUD_PROVIDER}, 2) the filename of the cloud provider external plugin
 // and 3) the provider defined within the external plugin must all match
+//
+// A plugin named ${CLOUD_PROVIDER}.so is loaded in process with plugin.Open. A plugin
+// binary named ${CLOUD_PROVIDER} is spawned and served over gRPC.
 func LoadCloudProvider(name string) {
-	if os.Getenv("ENABLE_CLOUD_PROVIDER_EXTERNAL_PLUGIN") != "true" {
+	loadCloudProvider(name, os.Getenv)
+}
+
+func loadCloudProvider(name string, getenv func(string) string) {
+	if getenv("ENABLE_CLOUD_PROVIDER_EXTERNAL_PLUGIN") != "true" {
 		logger.Printf("Cloud provider external plugin loading is disabled, skipping plugin loading")
 		return
 	}
-	externalPluginPath := os.Getenv("CLOUD_PROVIDER_EXTERNAL_PLUGIN_PATH")
+
+	pluginMutex.Lock()
+	defer pluginMutex.Unlock()
+
+	if connectedPlugins[name] {
+		return
+	}
+	externalPluginPath := getenv("CLOUD_PROVIDER_EXTERNAL_PLUGIN_PATH")
 	executePermission, err := hasExecutePermission(externalPluginPath)
 	if err != nil {
 		logger.Printf("Failed to retrieve file information for the parent directory of CLOUD_PROVIDER_EXTERNAL_PLUGIN_PATH %s", err)
@@ -72,7 +124,7 @@ func LoadCloudProvider(name string) {
 		logger.Printf("The parent directory of the external plugin %s lacks execute permissions", filepath.Dir(externalPluginPath))
 		return
 	}
-	cloudProviderPluginHash := os.Getenv("CLOUD_PROVIDER_EXTERNAL_PLUGIN_HASH")
+	cloudProviderPluginHash := getenv("CLOUD_PROVIDER_EXTERNAL_PLUGIN_HASH")
 	if externalPluginPath == "" {
 		logger.Printf("Env CLOUD_PROVIDER_EXTERNAL_PLUGIN_PATH is not set")
 		return
@@ -82,7 +134,8 @@ func LoadCloudProvider(name string) {
 		return
 	}
 	filename, realPluginHash, err := getFileNameAndSha256sum(externalPluginPath)
-	if !strings.EqualFold(filename, name+".so") {
+	isSharedObject := strings.EqualFold(filename, name+".so")
+	if !isSharedObject && filename != name {
 		logger.Printf("Filename of the external plugin: %s, is not match with CLOUD_PROVIDER: %s", filename, name)
 		return
 	}
@@ -96,6 +149,10 @@ func LoadCloudProvider(name string) {
 		logger.Printf("The sha256sum of the external plugin: %s doesn't match the one from configmap: %s", realPluginHash, cloudProviderPluginHash)
 		return
 	}
+	if !isSharedObject {
+		launchCloudProvider(name, externalPluginPath)
+		return
+	}
 	_, err = plugin.Open(externalPluginPath)
 	if err != nil {
 		logger.Printf("Failed to open the external plugin %s", err)
@@ -104,16 +161,64 @@ func LoadCloudProvider(name string) {
 	}
 }
 
+func launchCloudProvider(name, path string) {
+	if pluginLauncher == nil {
+		logger.Printf("Out-of-process external plugins are not supported by this binary")
+		return
+	}
+	cloud, err := pluginLauncher.Launch(name, path)
+	if err != nil {
+		logger.Printf("Failed to launch the external plugin %s", err)
+		return
+	}
+	AddCloudProvider(name, cloud)
+	connectedPlugins[name] = true
+	logger.Printf("Successfully launched the external plugin %s", path)
+}
+
 func Get(name string) CloudProvider {
 	LoadCloudProvider(name)
-	return providerTable[name]
+	return lookup(name)
+}
+
+// GetWithEnv is like Get, reading the external plugin settings from env
+// before the process environment
+func GetWithEnv(name string, env map[string]string) CloudProvider {
+	loadCloudProvider(name, Getenv(env))
+	return lookup(name)
+}
+
+// NewProviderWithEnv creates a provider of the named cloud configured from env.
+// Cloud providers that don't implement ReloadableCloudProvider are only
+// configured from the command line and the process environment.
+func NewProviderWithEnv(name string, env map[string]string) (Provider, error) {
+	cloud := GetWithEnv(name, env)
+	if cloud == nil {
+		return nil, fmt.Errorf("%s cloud provider not supported", name)
+	}
+	if reloadable, ok := cloud.(ReloadableCloudProvider); ok {
+		return reloadable.NewProviderWithEnv(env)
+	}
+	logger.Printf("%s cloud provider can only be configured from the process environment", name)
+	cloud.LoadEnv()
+	return cloud.NewProvider()
 }
 
 func AddCloudProvider(name string, cloud CloudProvider) {
+	tableMutex.Lock()
+	defer tableMutex.Unlock()
 	providerTable[name] = cloud
 }
 
+func lookup(name string) CloudProvider {
+	tableMutex.RLock()
+	defer tableMutex.RUnlock()
+	return providerTable[name]
+}
+
 func List() []string {
+	tableMutex.RLock()
+	defer tableMutex.RUnlock()
 
 	var list []string
 
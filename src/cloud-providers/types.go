@@ -9,10 +9,22 @@ import (
 	"fmt"
 	"net/netip"
 	"strings"
+	"time"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
 )
 
+// ErrInstanceNotFound is returned, possibly wrapped, by DeleteInstance when
+// the instance does not exist in the cloud. Callers treat it as a successful
+// deletion.
+var ErrInstanceNotFound = errors.New("instance not found")
+
+// ErrNotSupported is returned by the optional interfaces of a provider that
+// only finds out at runtime that it lacks the capability, e.g. the proxy of an
+// out-of-process plugin. Callers handle it as if the interface was not
+// implemented.
+var ErrNotSupported = errors.New("not supported by the cloud provider")
+
 type Provider interface {
 	CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec InstanceTypeSpec) (instance *Instance, err error)
 	DeleteInstance(ctx context.Context, instanceID string) error
@@ -20,6 +32,59 @@ type Provider interface {
 	ConfigVerifier() error
 }
 
+// InstanceLister is an optional interface implemented by providers that can
+// enumerate the pod VMs they created for a cluster. It is used by peerpod-ctrl
+// to find instances that are no longer referenced by any PeerPod.
+type InstanceLister interface {
+	ListInstances(ctx context.Context, clusterID string) ([]*Instance, error)
+}
+
+// UserDataLimiter is an optional interface implemented by providers whose
+// cloud limits the size of the userdata of a VM. The cloud-api-adaptor
+// compresses the cloud config to fit in the limit before creating the VM.
+type UserDataLimiter interface {
+	// UserDataLimit returns the maximum size in bytes of the userdata as
+	// generated by the CloudConfigGenerator
+	UserDataLimit() int
+}
+
+// ConsoleReader is an optional interface implemented by providers that can
+// retrieve the console output of a VM. The cloud-api-adaptor saves it when a
+// pod VM fails to start, to diagnose VMs that never reach the forwarder.
+type ConsoleReader interface {
+	// ConsoleOutput returns the latest console output of an instance
+	ConsoleOutput(ctx context.Context, instanceID string) ([]byte, error)
+}
+
+// QuotaReporter is an optional interface implemented by providers that can
+// query the quota of the cloud account. peerpod-ctrl uses it to lower the
+// peer pods capacity advertised by the nodes once the quota is exhausted.
+type QuotaReporter interface {
+	// AvailableInstances returns how many more pod VMs of the default
+	// instance type the cloud account can run
+	AvailableInstances(ctx context.Context) (int64, error)
+}
+
+// CatalogReporter is an optional interface implemented by providers that
+// select the instance type of pod VMs from an allowlist. The cloud-api-adaptor
+// publishes the catalog, so that pods asking for an instance type the
+// provider can't create are rejected at admission rather than by CreateVM.
+type CatalogReporter interface {
+	InstanceCatalog() InstanceCatalog
+}
+
+// InstanceCatalog describes the instance types a provider creates pod VMs
+// with, see SelectInstanceTypeToUse
+type InstanceCatalog struct {
+	// DefaultInstanceType is used for pods that select no instance type
+	DefaultInstanceType string `json:"defaultInstanceType,omitempty"`
+	// InstanceTypes are the instance types pods may select. Only the
+	// default instance type is allowed when empty.
+	InstanceTypes []string `json:"instanceTypes,omitempty"`
+	// Specs are the resources of the instance types, sorted on memory
+	Specs []InstanceTypeSpec `json:"specs,omitempty"`
+}
+
 // keyValueFlag represents a flag of key-value pairs
 type KeyValueFlag map[string]string
 
@@ -58,12 +123,28 @@ type Instance struct {
 	ID   string
 	Name string
 	IPs  []netip.Addr
+	// Type and ImageID are the instance type and the image the instance
+	// was created with, when the provider knows them
+	Type    string
+	ImageID string
+	// Tags and CreatedAt are only populated by InstanceLister
+	Tags      map[string]string
+	CreatedAt time.Time
 }
 
 type InstanceTypeSpec struct {
-	InstanceType string
-	VCPUs        int64
-	Memory       int64
-	Arch         string
-	GPUs         int64
+	InstanceType string `json:"instanceType,omitempty"`
+	VCPUs        int64  `json:"vcpus,omitempty"`
+	// Memory is in MiB
+	Memory int64  `json:"memory,omitempty"`
+	Arch   string `json:"arch,omitempty"`
+	GPUs   int64  `json:"gpus,omitempty"`
+	// RootDiskSize is the root disk size in GiB requested by the pod, used
+	// when it is larger than the disk the provider would create otherwise
+	RootDiskSize int64 `json:"rootDiskSize,omitempty"`
+	// PodNamespace is the namespace of the pod the pod VM is created for
+	PodNamespace string `json:"podNamespace,omitempty"`
+	// Tags are derived from the pod metadata and are applied to the pod VM
+	// in addition to any tags configured on the provider
+	Tags map[string]string `json:"tags,omitempty"`
 }
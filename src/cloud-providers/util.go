@@ -9,12 +9,60 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
 )
 
 var logger = log.New(log.Writer(), "[adaptor/cloud] ", log.LstdFlags|log.Lmsgprefix)
 
+const (
+	// ClusterIDTagKey is the tag key identifying the cluster that owns a pod VM
+	ClusterIDTagKey = "peerpods-cluster-id"
+	// PodNameTagKey is the tag key holding the name of the pod a pod VM was created for
+	PodNameTagKey = "peerpods-pod-name"
+	// NamespaceTagKey is the tag key holding the namespace of the pod a pod VM was created for
+	NamespaceTagKey = "peerpods-namespace"
+)
+
+// OwnershipTags returns the tags a provider stamps on a pod VM so that it can
+// later be listed by InstanceLister and matched with its pod. No tags are
+// returned if clusterID is empty.
+func OwnershipTags(clusterID, podName, namespace string) map[string]string {
+	if clusterID == "" {
+		return nil
+	}
+	tags := map[string]string{
+		ClusterIDTagKey: clusterID,
+		PodNameTagKey:   podName,
+	}
+	if namespace != "" {
+		tags[NamespaceTagKey] = namespace
+	}
+	return tags
+}
+
+// PodTags returns the per-pod tags of spec without the keys set in any of the
+// reserved tag sets, so that configured and ownership tags always take
+// precedence over tags derived from the pod.
+func PodTags(spec InstanceTypeSpec, reserved ...map[string]string) map[string]string {
+	tags := make(map[string]string, len(spec.Tags))
+	for k, v := range spec.Tags {
+		clash := false
+		for _, r := range reserved {
+			if _, ok := r[k]; ok {
+				clash = true
+				break
+			}
+		}
+		if !clash {
+			tags[k] = v
+		}
+	}
+	return tags
+}
+
 // Method to verify the correct instanceType to be used for Pod VM
 func VerifyCloudInstanceType(instanceType string, validInstanceTypes []string, defaultInstanceType string) (string, error) {
 	// If instanceType is empty, set instanceType to default.
@@ -101,6 +149,11 @@ func GetBestFitInstanceType(sortedInstanceTypeSpecList []InstanceTypeSpec, vcpus
 
 }
 
+// EnvLoadFunc sets a configuration field from the environment variable env,
+// or from fallback if neither is set. DefaultToEnv is the EnvLoadFunc reading
+// the process environment.
+type EnvLoadFunc func(field *string, env, fallback string)
+
 func DefaultToEnv(field *string, env, fallback string) {
 
 	if *field != "" {
@@ -115,6 +168,91 @@ func DefaultToEnv(field *string, env, fallback string) {
 	*field = val
 }
 
+// OverrideFromEnv returns an EnvLoadFunc used to reload a configuration. The
+// variables set in env replace the current value of their field, which is
+// otherwise kept.
+func OverrideFromEnv(env map[string]string) EnvLoadFunc {
+	return func(field *string, name, fallback string) {
+		if val := env[name]; val != "" {
+			*field = val
+		} else if *field == "" {
+			*field = fallback
+		}
+	}
+}
+
+// LoadListFromEnv sets a list field from the comma separated variable env
+// through load
+func LoadListFromEnv(load EnvLoadFunc, field *[]string, env string) {
+	val := strings.Join(*field, ",")
+	load(&val, env, "")
+	if val == "" {
+		*field = nil
+	} else {
+		*field = strings.Split(val, ",")
+	}
+}
+
+// LoadBoolFromEnv sets a boolean field from the variable env through load,
+// "true" enables it
+func LoadBoolFromEnv(load EnvLoadFunc, field *bool, env string) {
+	val := ""
+	if *field {
+		val = "true"
+	}
+	load(&val, env, "")
+	*field = val == "true"
+}
+
+// LoadIntFromEnv sets an integer field from the variable env through load.
+// An invalid value is ignored.
+func LoadIntFromEnv(load EnvLoadFunc, field *int, env string) {
+	val := ""
+	if *field != 0 {
+		val = strconv.Itoa(*field)
+	}
+	load(&val, env, "")
+	if val == "" {
+		return
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		logger.Printf("ignoring invalid %s=%q: %v", env, val, err)
+		return
+	}
+	*field = n
+}
+
+// LoadTagsFromEnv sets a key value field from the comma separated key=value
+// pairs of the variable env through load. An invalid value is ignored.
+func LoadTagsFromEnv(load EnvLoadFunc, field *KeyValueFlag, env string) {
+	val := ""
+	if len(*field) > 0 {
+		val = field.String()
+	}
+	load(&val, env, "")
+	if val == "" {
+		return
+	}
+	var tags KeyValueFlag
+	if err := tags.Set(val); err != nil {
+		logger.Printf("ignoring invalid %s=%q: %v", env, val, err)
+		return
+	}
+	*field = tags
+}
+
+// Getenv returns a function looking up the variables of env before the
+// process environment
+func Getenv(env map[string]string) func(string) string {
+	return func(name string) string {
+		if val, ok := env[name]; ok {
+			return val
+		}
+		return os.Getenv(name)
+	}
+}
+
 // Method to write userdata to a file
 
 func WriteUserData(instanceName string, userData string, dataDir string) (string, error) {
@@ -5,17 +5,28 @@ package cloudinit
 
 import (
 	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
 	"text/template"
 )
 
 const (
-	DefaultAuthfileLimit   = 12288 // TODO: use a whole userdata limit mechanism instead of limiting authfile
+	// Deprecated: the size of the whole userdata is limited by CloudConfig.Fit
+	DefaultAuthfileLimit   = 12288
 	DefaultAAKBCParamsPath = "/etc/attestation-agent/kbc-params.json"
+
+	// EncodingGzipBase64 is the write_files encoding of compressed content
+	EncodingGzipBase64 = "gzip+base64"
 )
 
+var ErrUserDataTooLarge = errors.New("userdata too large")
+
 // https://cloudinit.readthedocs.io/en/latest/topics/format.html#cloud-config-data
 
 type CloudConfigGenerator interface {
@@ -24,6 +35,8 @@ type CloudConfigGenerator interface {
 
 type CloudConfig struct {
 	WriteFiles []WriteFile `yaml:"write_files"`
+	// SigningKey signs the generated userdata if set
+	SigningKey ed25519.PrivateKey `yaml:"-"`
 }
 
 // https://cloudinit.readthedocs.io/en/latest/topics/modules.html#write-files
@@ -92,9 +105,102 @@ func (config *CloudConfig) Generate() (string, error) {
 		return "", fmt.Errorf("Error executing a template for cloudinit userdata: %w", err)
 	}
 
+	if config.SigningKey != nil {
+		return sign(buf.String(), config.SigningKey), nil
+	}
+
 	return buf.String(), nil
 }
 
+// Fit compresses write_files entries with gzip+base64, largest first, until
+// the generated userdata is no larger than limit bytes. A limit of 0 or less
+// means no limit. ErrUserDataTooLarge is returned if the userdata doesn't fit
+// even when all the entries are compressed, the userdata is never split into
+// a multi-part archive.
+func (config *CloudConfig) Fit(limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+
+	userData, err := config.Generate()
+	if err != nil {
+		return err
+	}
+	if len(userData) <= limit {
+		return nil
+	}
+
+	order := make([]int, 0, len(config.WriteFiles))
+	for i, wf := range config.WriteFiles {
+		if wf.Encoding == "" {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(config.WriteFiles[order[i]].Content) > len(config.WriteFiles[order[j]].Content)
+	})
+
+	for _, i := range order {
+		wf := &config.WriteFiles[i]
+		content, err := EncodeContent(wf.Content)
+		if err != nil {
+			return fmt.Errorf("compressing %s: %w", wf.Path, err)
+		}
+		wf.Content = content
+		wf.Encoding = EncodingGzipBase64
+
+		userData, err = config.Generate()
+		if err != nil {
+			return err
+		}
+		if len(userData) <= limit {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %d bytes after compression exceeds the limit of %d bytes", ErrUserDataTooLarge, len(userData), limit)
+}
+
+// EncodeContent compresses content with gzip and encodes it with base64
+func EncodeContent(content string) (string, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(content)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeContent decodes content with one of the base64 based write_files
+// encodings supported by cloud-init
+func DecodeContent(content, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(content), nil
+	case "b64", "base64":
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(content))
+		if err != nil {
+			return nil, fmt.Errorf("decoding base64 content: %w", err)
+		}
+		return data, nil
+	case "gz+b64", "gz+base64", "gzip+b64", "gzip+base64":
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(content))
+		if err != nil {
+			return nil, fmt.Errorf("decoding base64 content: %w", err)
+		}
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("decompressing content: %w", err)
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+	return nil, fmt.Errorf("unsupported encoding %q", encoding)
+}
+
 func AuthJSONToResourcesJSON(text string) string {
 	var buf bytes.Buffer
 	tpl := template.Must(template.New("cerdTpl").Parse("{\"default/credential/test\":\"{{.EncodedAuth}}\"}"))
@@ -4,6 +4,7 @@
 package cloudinit
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
@@ -229,3 +230,93 @@ func TestUserDataWithDaemonAndAuthAndAAKBCParams(t *testing.T) {
 	}
 
 }
+
+func TestFit(t *testing.T) {
+	large := strings.Repeat("{\"auths\": {}}\n", 1000)
+	small := "Hello\n"
+
+	newConfig := func() *CloudConfig {
+		return &CloudConfig{
+			WriteFiles: []WriteFile{
+				{Path: "/small", Content: small},
+				{Path: "/large", Content: large},
+			},
+		}
+	}
+
+	cloudConfig := newConfig()
+	if err := cloudConfig.Fit(0); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if !reflect.DeepEqual(cloudConfig, newConfig()) {
+		t.Fatalf("Expect userdata without limit to be unchanged")
+	}
+
+	cloudConfig = newConfig()
+	if err := cloudConfig.Fit(4096); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if e, a := "", cloudConfig.WriteFiles[0].Encoding; e != a {
+		t.Fatalf("Expect small file encoding %q, got %q", e, a)
+	}
+	if e, a := EncodingGzipBase64, cloudConfig.WriteFiles[1].Encoding; e != a {
+		t.Fatalf("Expect large file encoding %q, got %q", e, a)
+	}
+	userData, err := cloudConfig.Generate()
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if len(userData) > 4096 {
+		t.Fatalf("Expect userdata to fit in 4096 bytes, got %d", len(userData))
+	}
+
+	var output CloudConfig
+	if err := yaml.Unmarshal([]byte(userData), &output); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	content, err := DecodeContent(output.WriteFiles[1].Content, output.WriteFiles[1].Encoding)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if string(content) != large {
+		t.Fatalf("Expect decoded content to match the original content")
+	}
+
+	cloudConfig = newConfig()
+	if err := cloudConfig.Fit(64); !errors.Is(err, ErrUserDataTooLarge) {
+		t.Fatalf("Expect %v, got %v", ErrUserDataTooLarge, err)
+	}
+}
+
+func TestDecodeContent(t *testing.T) {
+	encoded, err := EncodeContent("Hello\nWorld\n")
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		content  string
+		encoding string
+		wantErr  bool
+	}{
+		{content: "Hello\nWorld\n"},
+		{content: "SGVsbG8KV29ybGQK", encoding: "b64"},
+		{content: encoded, encoding: "gz+b64"},
+		{content: encoded, encoding: EncodingGzipBase64},
+		{content: "Hello", encoding: "base64", wantErr: true},
+		{content: "Hello", encoding: "text/plain", wantErr: true},
+	} {
+		data, err := DecodeContent(tc.content, tc.encoding)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("Expect error for encoding %q", tc.encoding)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expect no error for encoding %q, got %v", tc.encoding, err)
+		} else if string(data) != "Hello\nWorld\n" {
+			t.Errorf("Expect %q for encoding %q, got %q", "Hello\nWorld\n", tc.encoding, data)
+		}
+	}
+}
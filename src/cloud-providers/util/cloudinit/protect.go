@@ -0,0 +1,178 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloudinit
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// SignaturePrefix starts the comment line that carries the signature of
+	// the userdata. Being a comment, it is ignored by cloud-init.
+	SignaturePrefix = "# peerpods-signature: "
+
+	// EncryptedSuffix is appended to the path of encrypted write_files entries
+	EncryptedSuffix = ".enc"
+
+	// EncryptionKeySize is the size of the AES-256 key used to encrypt files
+	EncryptionKeySize = 32
+)
+
+var (
+	ErrMissingSignature = errors.New("userdata is not signed")
+	ErrInvalidSignature = errors.New("userdata signature is invalid")
+)
+
+// sign appends the signature line of userData
+func sign(userData string, key ed25519.PrivateKey) string {
+	if !strings.HasSuffix(userData, "\n") {
+		userData += "\n"
+	}
+	signature := ed25519.Sign(key, []byte(userData))
+	return userData + SignaturePrefix + base64.StdEncoding.EncodeToString(signature) + "\n"
+}
+
+// Verify checks the signature line of userData and returns the signed
+// userdata without the signature line
+func Verify(userData []byte, key ed25519.PublicKey) ([]byte, error) {
+	i := bytes.LastIndex(userData, []byte("\n"+SignaturePrefix))
+	if i < 0 {
+		return nil, ErrMissingSignature
+	}
+	body, line := userData[:i+1], userData[i+1+len(SignaturePrefix):]
+
+	signature, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(line)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	if !ed25519.Verify(key, body, signature) {
+		return nil, ErrInvalidSignature
+	}
+	return body, nil
+}
+
+// Encrypt replaces the content of the write_files entries of paths with its
+// AES-GCM ciphertext. The entries are renamed with the EncryptedSuffix, so
+// that the ciphertext is never written to the plaintext path.
+func (config *CloudConfig) Encrypt(paths []string, key []byte) error {
+	for i := range config.WriteFiles {
+		wf := &config.WriteFiles[i]
+		if !contains(paths, wf.Path) {
+			continue
+		}
+		ciphertext, err := Encrypt(wf.Path, []byte(wf.Content), key)
+		if err != nil {
+			return fmt.Errorf("encrypting %s: %w", wf.Path, err)
+		}
+		wf.Path += EncryptedSuffix
+		wf.Content = base64.StdEncoding.EncodeToString(ciphertext)
+		wf.Encoding = "b64"
+	}
+	return nil
+}
+
+// Encrypt encrypts the content of the file at path with AES-GCM. The path is
+// authenticated, so the ciphertext can't be moved to another file.
+func Encrypt(path string, content, key []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, content, []byte(path)), nil
+}
+
+// Decrypt decrypts a ciphertext created by Encrypt for the file at path
+func Decrypt(path string, ciphertext, key []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, []byte(path))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", EncryptionKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// LoadSigningKey reads an ed25519 private key from a PKCS #8 PEM file
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 private key", path)
+	}
+	return edKey, nil
+}
+
+// LoadVerificationKey reads an ed25519 public key from a PKIX PEM file
+func LoadVerificationKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 public key", path)
+	}
+	return edKey, nil
+}
+
+func readPEM(path, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s does not contain a PEM %s block", path, blockType)
+	}
+	return block.Bytes, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
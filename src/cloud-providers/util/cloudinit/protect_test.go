@@ -0,0 +1,157 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cloudinit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	cloudConfig := &CloudConfig{
+		WriteFiles: []WriteFile{
+			{Path: forwarderConfigPath, Content: "{}\n"},
+			{Path: authJSONPath, Content: "{\"auths\": {}}\n"},
+		},
+		SigningKey: priv,
+	}
+	userData, err := cloudConfig.Generate()
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if !strings.Contains(userData, "\n"+SignaturePrefix) {
+		t.Fatalf("Expect a signature line in %q", userData)
+	}
+
+	body, err := Verify([]byte(userData), pub)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	var output CloudConfig
+	if err := yaml.Unmarshal(body, &output); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if e, a := 2, len(output.WriteFiles); e != a {
+		t.Fatalf("Expect %d files, got %d", e, a)
+	}
+
+	tampered := strings.Replace(userData, "auths", "autht", 1)
+	if _, err := Verify([]byte(tampered), pub); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Expect %v, got %v", ErrInvalidSignature, err)
+	}
+
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	if _, err := Verify([]byte(userData), otherPub); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Expect %v, got %v", ErrInvalidSignature, err)
+	}
+
+	cloudConfig.SigningKey = nil
+	unsigned, err := cloudConfig.Generate()
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if _, err := Verify([]byte(unsigned), pub); !errors.Is(err, ErrMissingSignature) {
+		t.Fatalf("Expect %v, got %v", ErrMissingSignature, err)
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, EncryptionKeySize)
+	content := "{\"auths\": {\"registry\": {}}}\n"
+
+	cloudConfig := &CloudConfig{
+		WriteFiles: []WriteFile{
+			{Path: forwarderConfigPath, Content: "{}\n"},
+			{Path: authJSONPath, Content: content},
+		},
+	}
+	if err := cloudConfig.Encrypt([]string{authJSONPath}, key); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if e, a := forwarderConfigPath, cloudConfig.WriteFiles[0].Path; e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+	wf := cloudConfig.WriteFiles[1]
+	if e, a := authJSONPath+EncryptedSuffix, wf.Path; e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+	if strings.Contains(wf.Content, "registry") {
+		t.Fatalf("Expect content to be encrypted, got %q", wf.Content)
+	}
+
+	ciphertext, err := DecodeContent(wf.Content, wf.Encoding)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	plaintext, err := Decrypt(authJSONPath, ciphertext, key)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if e, a := content, string(plaintext); e != a {
+		t.Fatalf("Expect %q, got %q", e, a)
+	}
+
+	if _, err := Decrypt(forwarderConfigPath, ciphertext, key); err == nil {
+		t.Fatalf("Expect error decrypting the ciphertext for another path")
+	}
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err := Decrypt(authJSONPath, ciphertext, key); err == nil {
+		t.Fatalf("Expect error decrypting a tampered ciphertext")
+	}
+	if err := cloudConfig.Encrypt([]string{forwarderConfigPath}, key[:16]); err == nil {
+		t.Fatalf("Expect error for a short key")
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	dir := t.TempDir()
+
+	privDER, _ := x509.MarshalPKCS8PrivateKey(priv)
+	privPath := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	pubDER, _ := x509.MarshalPKIXPublicKey(pub)
+	pubPath := filepath.Join(dir, "key.pub")
+	if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+
+	loadedPriv, err := LoadSigningKey(privPath)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if !priv.Equal(loadedPriv) {
+		t.Fatalf("Expect loaded private key to match")
+	}
+	loadedPub, err := LoadVerificationKey(pubPath)
+	if err != nil {
+		t.Fatalf("Expect no error, got %v", err)
+	}
+	if !pub.Equal(loadedPub) {
+		t.Fatalf("Expect loaded public key to match")
+	}
+
+	if _, err := LoadSigningKey(pubPath); err == nil {
+		t.Fatalf("Expect error loading a public key as a signing key")
+	}
+}
@@ -0,0 +1,99 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// WatchProviderConfig watches the ConfigMap and Secret holding the cloud
+// provider configuration, and calls onChange with their merged data, the
+// Secret taking precedence, each time it changes. The first call passes the
+// data found when the watch starts. It returns once ctx is done.
+func WatchProviderConfig(ctx context.Context, client kubernetes.Interface, namespace, configMap, secret string, onChange func(env map[string]string)) error {
+	cmWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", configMap).String()
+			return client.CoreV1().ConfigMaps(namespace).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", configMap).String()
+			return client.CoreV1().ConfigMaps(namespace).Watch(ctx, options)
+		},
+	}
+	secretWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", secret).String()
+			return client.CoreV1().Secrets(namespace).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", secret).String()
+			return client.CoreV1().Secrets(namespace).Watch(ctx, options)
+		},
+	}
+
+	// Events only signal a change, the data is read from the informer stores
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { notify() },
+		UpdateFunc: func(oldObj, newObj interface{}) { notify() },
+		DeleteFunc: func(obj interface{}) { notify() },
+	}
+
+	cmInformer := cache.NewSharedInformer(cmWatch, &corev1.ConfigMap{}, 0)
+	secretInformer := cache.NewSharedInformer(secretWatch, &corev1.Secret{}, 0)
+	if _, err := cmInformer.AddEventHandler(handler); err != nil {
+		return err
+	}
+	if _, err := secretInformer.AddEventHandler(handler); err != nil {
+		return err
+	}
+
+	go cmInformer.Run(ctx.Done())
+	go secretInformer.Run(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), cmInformer.HasSynced, secretInformer.HasSynced) {
+		return fmt.Errorf("waiting for %s/%s and %s/%s: %w", namespace, configMap, namespace, secret, ctx.Err())
+	}
+
+	var current map[string]string
+	for {
+		env := make(map[string]string)
+		if obj, ok, _ := cmInformer.GetStore().GetByKey(namespace + "/" + configMap); ok {
+			maps.Copy(env, obj.(*corev1.ConfigMap).Data)
+		}
+		if obj, ok, _ := secretInformer.GetStore().GetByKey(namespace + "/" + secret); ok {
+			for k, v := range obj.(*corev1.Secret).Data {
+				env[k] = string(v)
+			}
+		}
+
+		if current == nil || !maps.Equal(env, current) {
+			current = env
+			onChange(env)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package util
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWatchProviderConfig(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "peer-pods-cm", Namespace: "ns"},
+		Data:       map[string]string{"CLOUD_PROVIDER": "aws", "AWS_REGION": "us-east-1"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "peer-pods-secret", Namespace: "ns"},
+		Data:       map[string][]byte{"AWS_SECRET_ACCESS_KEY": []byte("old")},
+	}
+	client := fake.NewSimpleClientset(cm, secret)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	envs := make(chan map[string]string, 10)
+	go func() {
+		if err := WatchProviderConfig(ctx, client, "ns", "peer-pods-cm", "peer-pods-secret", func(env map[string]string) {
+			envs <- env
+		}); err != nil {
+			t.Errorf("WatchProviderConfig() error = %v", err)
+		}
+	}()
+
+	next := func() map[string]string {
+		select {
+		case env := <-envs:
+			return env
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for the config")
+			return nil
+		}
+	}
+
+	want := map[string]string{"CLOUD_PROVIDER": "aws", "AWS_REGION": "us-east-1", "AWS_SECRET_ACCESS_KEY": "old"}
+	if env := next(); !reflect.DeepEqual(env, want) {
+		t.Errorf("initial config = %v, want %v", env, want)
+	}
+
+	secret.Data["AWS_SECRET_ACCESS_KEY"] = []byte("new")
+	if _, err := client.CoreV1().Secrets("ns").Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want["AWS_SECRET_ACCESS_KEY"] = "new"
+	if env := next(); !reflect.DeepEqual(env, want) {
+		t.Errorf("updated config = %v, want %v", env, want)
+	}
+}
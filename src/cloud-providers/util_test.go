@@ -373,3 +373,64 @@ func TestGetBestFitInstanceType(t *testing.T) {
 		})
 	}
 }
+
+func TestPodTags(t *testing.T) {
+	spec := InstanceTypeSpec{
+		Tags: map[string]string{
+			"peerpods-namespace": "default",
+			"team":               "finance",
+			"Name":               "spoofed",
+		},
+	}
+
+	got := PodTags(spec, map[string]string{"Name": "podvm-test"}, nil)
+	want := map[string]string{
+		"peerpods-namespace": "default",
+		"team":               "finance",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PodTags() = %v, want %v", got, want)
+	}
+
+	if got := PodTags(InstanceTypeSpec{}); len(got) != 0 {
+		t.Errorf("PodTags() of empty spec = %v, want empty", got)
+	}
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	t.Setenv("TEST_LIST", "a,b")
+	t.Setenv("TEST_BOOL", "true")
+	t.Setenv("TEST_INT", "60")
+	t.Setenv("TEST_TAGS", "team=a,env=prod")
+
+	// Unset fields default to the environment
+	var list []string
+	var enabled bool
+	var size int
+	var tags KeyValueFlag
+	LoadListFromEnv(DefaultToEnv, &list, "TEST_LIST")
+	LoadBoolFromEnv(DefaultToEnv, &enabled, "TEST_BOOL")
+	LoadIntFromEnv(DefaultToEnv, &size, "TEST_INT")
+	LoadTagsFromEnv(DefaultToEnv, &tags, "TEST_TAGS")
+	if !reflect.DeepEqual(list, []string{"a", "b"}) || !enabled || size != 60 || tags["env"] != "prod" {
+		t.Errorf("Expected the values of the environment, got %v %v %v %v", list, enabled, size, tags)
+	}
+
+	// Set fields keep their value
+	list, size, tags = []string{"c"}, 30, KeyValueFlag{"team": "b"}
+	LoadListFromEnv(DefaultToEnv, &list, "TEST_LIST")
+	LoadIntFromEnv(DefaultToEnv, &size, "TEST_INT")
+	LoadTagsFromEnv(DefaultToEnv, &tags, "TEST_TAGS")
+	if !reflect.DeepEqual(list, []string{"c"}) || size != 30 || !reflect.DeepEqual(tags, KeyValueFlag{"team": "b"}) {
+		t.Errorf("Expected the values to be kept, got %v %v %v", list, size, tags)
+	}
+
+	// Reloaded variables replace set fields, invalid values are ignored
+	env := map[string]string{"TEST_BOOL": "false", "TEST_INT": "large", "TEST_TAGS": "team=c"}
+	LoadBoolFromEnv(OverrideFromEnv(env), &enabled, "TEST_BOOL")
+	LoadIntFromEnv(OverrideFromEnv(env), &size, "TEST_INT")
+	LoadTagsFromEnv(OverrideFromEnv(env), &tags, "TEST_TAGS")
+	if enabled || size != 30 || !reflect.DeepEqual(tags, KeyValueFlag{"team": "c"}) {
+		t.Errorf("Expected the reloaded values, got %v %v %v", enabled, size, tags)
+	}
+}
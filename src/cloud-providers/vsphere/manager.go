@@ -30,18 +30,30 @@ func (_ *Manager) ParseCmd(flags *flag.FlagSet) {
 	flags.StringVar(&vspherecfg.Cluster, "cluster", "", "vCenter destination cluster name ")
 	flags.StringVar(&vspherecfg.DRS, "drs", "false", "Use DRS for clone placement in destination Vcenter cluster")
 	flags.StringVar(&vspherecfg.Host, "host", "", "vCenter host name of resource pool destination")
+	flags.StringVar(&vspherecfg.ClusterID, "cluster-id", "", "Cluster ID set as a custom attribute of the Pod VMs to allow garbage collection of orphaned instances, defaults to `PEERPODS_CLUSTER_ID`")
 }
 
 func (_ *Manager) LoadEnv() {
-	provider.DefaultToEnv(&vspherecfg.UserName, "GOVC_USERNAME", "")
-	provider.DefaultToEnv(&vspherecfg.Password, "GOVC_PASSWORD", "")
-	provider.DefaultToEnv(&vspherecfg.Thumbprint, "GOVC_THUMBPRINT", "")
+	loadEnv(&vspherecfg, provider.DefaultToEnv)
+}
+
+func loadEnv(cfg *Config, load provider.EnvLoadFunc) {
+	load(&cfg.UserName, "GOVC_USERNAME", "")
+	load(&cfg.Password, "GOVC_PASSWORD", "")
+	load(&cfg.Thumbprint, "GOVC_THUMBPRINT", "")
+	load(&cfg.ClusterID, "PEERPODS_CLUSTER_ID", "")
 }
 
 func (_ *Manager) NewProvider() (provider.Provider, error) {
 	return NewProvider(&vspherecfg)
 }
 
+func (_ *Manager) NewProviderWithEnv(env map[string]string) (provider.Provider, error) {
+	cfg := vspherecfg
+	loadEnv(&cfg, provider.OverrideFromEnv(env))
+	return NewProvider(&cfg)
+}
+
 func (_ *Manager) GetConfig() (config *Config) {
 	return &vspherecfg
 }
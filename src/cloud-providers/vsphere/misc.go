@@ -0,0 +1,70 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+)
+
+const (
+	// VSphereUserDataKey is the guestinfo key holding the userData set by CreateInstance
+	VSphereUserDataKey = "guestinfo.userdata"
+
+	dmiSysVendorPath = "/sys/class/dmi/id/sys_vendor"
+)
+
+// Method to check if the VM is running on vSphere
+// by checking the system vendor reported by the firmware
+func IsVSphere(ctx context.Context) bool {
+
+	vendor, err := os.ReadFile(dmiSysVendorPath)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(string(vendor), "VMware")
+}
+
+// Method to retrieve userData from the VM guestinfo using vmware-rpctool,
+// decoding it as indicated by the <key>.encoding guestinfo
+func GetUserData(ctx context.Context, key string) ([]byte, error) {
+
+	// If key is empty then return empty string
+	if key == "" {
+		return nil, fmt.Errorf("key is empty")
+	}
+
+	value, err := getGuestInfo(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %s", key, err)
+	}
+
+	// A missing encoding means that the value is not encoded
+	encoding, _ := getGuestInfo(ctx, key+".encoding")
+
+	return decodeGuestInfo(value, encoding)
+}
+
+func getGuestInfo(ctx context.Context, key string) (string, error) {
+	out, err := exec.CommandContext(ctx, "vmware-rpctool", "info-get "+key).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// decodeGuestInfo decodes a guestinfo value, which supports the same
+// encodings as cloud-init write_files
+func decodeGuestInfo(value, encoding string) ([]byte, error) {
+	data, err := cloudinit.DecodeContent(value, encoding)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode userData: %s", err)
+	}
+	return data, nil
+}
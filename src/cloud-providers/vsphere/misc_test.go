@@ -0,0 +1,43 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"testing"
+)
+
+func TestDecodeGuestInfo(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("userdata")) // nolint: errcheck
+	w.Close()
+
+	tests := []struct {
+		name     string
+		value    string
+		encoding string
+		wantErr  bool
+	}{
+		{name: "Plain", value: "userdata"},
+		{name: "Base64", value: base64.StdEncoding.EncodeToString([]byte("userdata")), encoding: "base64"},
+		{name: "GzipBase64", value: base64.StdEncoding.EncodeToString(gz.Bytes()), encoding: "gzip+base64"},
+		{name: "InvalidBase64", value: "not base64!", encoding: "b64", wantErr: true},
+		{name: "UnknownEncoding", value: "userdata", encoding: "rot13", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeGuestInfo(tt.value, tt.encoding)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeGuestInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != "userdata" {
+				t.Errorf("decodeGuestInfo() = %q, want %q", got, "userdata")
+			}
+		})
+	}
+}
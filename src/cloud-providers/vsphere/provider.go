@@ -7,6 +7,7 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"log"
 	"net/netip"
 	"path"
@@ -19,12 +20,18 @@ import (
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
 )
 
 var logger = log.New(log.Writer(), "[adaptor/cloud/vsphere] ", log.LstdFlags|log.Lmsgprefix)
 
-const maxInstanceNameLen = 63
+const (
+	maxInstanceNameLen = 63
+	// serialLogFile is the file in the VM directory the serial console is written to
+	serialLogFile = "serial.log"
+)
 
 type vsphereProvider struct {
 	gclient       *govmomi.Client
@@ -273,6 +280,17 @@ func (p *vsphereProvider) CreateInstance(ctx context.Context, podName, sandboxID
 		ExtraConfig: extraconfig,
 	}
 
+	// Log the serial console of the pod VM to a file in its directory, so
+	// that it can be retrieved with ConsoleOutput
+	if relocateSpec.Datastore != nil {
+		serial, err := p.serialPortSpec(ctx, vm, *relocateSpec.Datastore, vmname)
+		if err != nil {
+			logger.Printf("Cannot add a serial port to VM %s: %s", vmname, err)
+		} else {
+			configSpec.DeviceChange = append(configSpec.DeviceChange, serial)
+		}
+	}
+
 	cloneSpec.Location = relocateSpec
 	cloneSpec.Config = &configSpec
 
@@ -296,6 +314,17 @@ func (p *vsphereProvider) CreateInstance(ctx context.Context, podName, sandboxID
 
 	logger.Printf("VM %s, UUID %s created", name, clone.UUID(ctx))
 
+	ownershipTags := provider.OwnershipTags(p.serviceConfig.ClusterID, podName, requirement.PodNamespace)
+	tags := provider.PodTags(requirement, ownershipTags)
+	for k, v := range ownershipTags {
+		tags[k] = v
+	}
+
+	err = p.setCustomAttributes(ctx, clone, tags)
+	if err != nil {
+		logger.Printf("Failed to set custom attributes on VM %s: %s", vmname, err)
+	}
+
 	ips, err := getIPs(clone) // TODO Fix to get all ips
 	if err != nil {
 		logger.Printf("Failed to get IPs for the instance : %v ", err)
@@ -303,15 +332,78 @@ func (p *vsphereProvider) CreateInstance(ctx context.Context, podName, sandboxID
 	}
 
 	instance := &provider.Instance{
-		ID:   clone.UUID(ctx),
-		Name: vmname,
-		IPs:  ips,
+		ID:      clone.UUID(ctx),
+		Name:    vmname,
+		IPs:     ips,
+		ImageID: p.serviceConfig.Template,
 	}
 
 	logger.Printf("CreateInstance VM name %s UUID %s done", vmname, clone.UUID(ctx))
 	return instance, nil
 }
 
+// setCustomAttributes sets the tags as custom attributes of the VM,
+// defining any attribute that doesn't exist yet in vCenter
+func (p *vsphereProvider) setCustomAttributes(ctx context.Context, vm *object.VirtualMachine, tags map[string]string) error {
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	fields, err := object.GetCustomFieldsManager(p.gclient.Client)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range tags {
+		key, err := fields.FindKey(ctx, name)
+		if err == object.ErrKeyNameNotFound {
+			def, err := fields.Add(ctx, name, "VirtualMachine", nil, nil)
+			if err != nil {
+				return fmt.Errorf("adding custom attribute %s: %w", name, err)
+			}
+			key = def.Key
+		} else if err != nil {
+			return err
+		}
+
+		err = fields.Set(ctx, vm.Reference(), key, value)
+		if err != nil {
+			return fmt.Errorf("setting custom attribute %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// serialPortSpec returns the device change adding a serial port backed by
+// serialLogFile in the VM directory on the datastore
+func (p *vsphereProvider) serialPortSpec(ctx context.Context, template *object.VirtualMachine, datastoreref types.ManagedObjectReference, vmname string) (*types.VirtualDeviceConfigSpec, error) {
+
+	dsname, err := object.NewDatastore(p.gclient.Client, datastoreref).ObjectName(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := template.Device(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := devices.CreateSerialPort()
+	if err != nil {
+		return nil, err
+	}
+
+	file := object.DatastorePath{Datastore: dsname, Path: path.Join(vmname, serialLogFile)}
+	devices.ConnectSerialPort(serial, file.String(), false, "")
+
+	return &types.VirtualDeviceConfigSpec{
+		Operation: types.VirtualDeviceConfigSpecOperationAdd,
+		Device:    serial,
+	}, nil
+}
+
 func getIPs(vm *object.VirtualMachine) ([]netip.Addr, error) { // TODO Fix to get all ips
 	var podNodeIPs []netip.Addr
 
@@ -349,31 +441,12 @@ func (p *vsphereProvider) DeleteInstance(ctx context.Context, instanceID string)
 		state types.VirtualMachinePowerState
 	)
 
-	err := CheckSessionWithRestore(ctx, p.serviceConfig, p.gclient)
-	if err != nil {
-		logger.Printf("Cannot find or create a new vcenter session")
-		return err
-	}
-
-	finder := find.NewFinder(p.gclient.Client)
-
-	dc, err := finder.Datacenter(ctx, p.serviceConfig.Datacenter)
-
-	if err != nil {
-		logger.Printf("Cannot get vcenter datacenter %s", p.serviceConfig.Datacenter)
-		return err
-	}
-
-	s := object.NewSearchIndex(dc.Client())
-
-	vmref, err := s.FindByUuid(ctx, dc, instanceID, true, nil)
+	_, vm, err := p.findVM(ctx, instanceID)
 	if err != nil {
 		logger.Printf("Delete VM can't find VM UUID %s to delete it", instanceID)
 		return err
 	}
 
-	vm := object.NewVirtualMachine(dc.Client(), vmref.Reference())
-
 	state, err = vm.PowerState(ctx)
 	if err != nil {
 		return err
@@ -402,6 +475,150 @@ func (p *vsphereProvider) DeleteInstance(ctx context.Context, instanceID string)
 	return nil
 }
 
+// ListInstances returns the VMs of the datacenter whose cluster ID custom
+// attribute is clusterID. CreatedAt is only known from vSphere 6.7 onwards.
+func (p *vsphereProvider) ListInstances(ctx context.Context, clusterID string) ([]*provider.Instance, error) {
+
+	err := CheckSessionWithRestore(ctx, p.serviceConfig, p.gclient)
+	if err != nil {
+		logger.Printf("Cannot find or create a new vcenter session")
+		return nil, err
+	}
+
+	fields, err := object.GetCustomFieldsManager(p.gclient.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	defs, err := fields.Field(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing custom attributes: %w", err)
+	}
+	names := make(map[int32]string, len(defs))
+	for _, def := range defs {
+		names[def.Key] = def.Name
+	}
+
+	finder := find.NewFinder(p.gclient.Client)
+
+	dc, err := finder.Datacenter(ctx, p.serviceConfig.Datacenter)
+	if err != nil {
+		logger.Printf("Cannot get vcenter datacenter %s", p.serviceConfig.Datacenter)
+		return nil, err
+	}
+
+	v, err := view.NewManager(p.gclient.Client).CreateContainerView(ctx, dc.Reference(), []string{"VirtualMachine"}, true)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = v.Destroy(ctx) }()
+
+	var vms []mo.VirtualMachine
+	err = v.Retrieve(ctx, []string{"VirtualMachine"}, []string{"name", "config.uuid", "config.createDate", "customValue"}, &vms)
+	if err != nil {
+		return nil, fmt.Errorf("listing VMs of cluster %q: %w", clusterID, err)
+	}
+
+	var instances []*provider.Instance
+	for _, vm := range vms {
+		tags := make(map[string]string)
+		for _, value := range vm.CustomValue {
+			if value, ok := value.(*types.CustomFieldStringValue); ok && names[value.Key] != "" {
+				tags[names[value.Key]] = value.Value
+			}
+		}
+		if tags[provider.ClusterIDTagKey] != clusterID || vm.Config == nil {
+			continue
+		}
+
+		instance := &provider.Instance{
+			ID:   vm.Config.Uuid,
+			Name: vm.Name,
+			Tags: tags,
+		}
+		if vm.Config.CreateDate != nil {
+			instance.CreatedAt = *vm.Config.CreateDate
+		}
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
+
+// findVM returns the datacenter and the VM with the given UUID
+func (p *vsphereProvider) findVM(ctx context.Context, instanceID string) (*object.Datacenter, *object.VirtualMachine, error) {
+
+	err := CheckSessionWithRestore(ctx, p.serviceConfig, p.gclient)
+	if err != nil {
+		logger.Printf("Cannot find or create a new vcenter session")
+		return nil, nil, err
+	}
+
+	finder := find.NewFinder(p.gclient.Client)
+
+	dc, err := finder.Datacenter(ctx, p.serviceConfig.Datacenter)
+	if err != nil {
+		logger.Printf("Cannot get vcenter datacenter %s", p.serviceConfig.Datacenter)
+		return nil, nil, err
+	}
+
+	s := object.NewSearchIndex(dc.Client())
+
+	vmref, err := s.FindByUuid(ctx, dc, instanceID, true, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if vmref == nil {
+		return nil, nil, fmt.Errorf("%w: VM UUID %s", provider.ErrInstanceNotFound, instanceID)
+	}
+
+	return dc, object.NewVirtualMachine(dc.Client(), vmref.Reference()), nil
+}
+
+// ConsoleOutput downloads the serial console log of the VM from its datastore
+func (p *vsphereProvider) ConsoleOutput(ctx context.Context, instanceID string) ([]byte, error) {
+
+	instanceID = strings.ToLower(strings.TrimSpace(instanceID))
+
+	dc, vm, err := p.findVM(ctx, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := vm.Device(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var file object.DatastorePath
+	for _, device := range devices.SelectByType((*types.VirtualSerialPort)(nil)) {
+		backing, ok := device.GetVirtualDevice().Backing.(*types.VirtualSerialPortFileBackingInfo)
+		if ok && file.FromString(backing.FileName) && path.Base(file.Path) == serialLogFile {
+			break
+		}
+		file = object.DatastorePath{}
+	}
+	if file.Path == "" {
+		return nil, fmt.Errorf("VM UUID %s has no serial port logging to %s", instanceID, serialLogFile)
+	}
+
+	finder := find.NewFinder(p.gclient.Client)
+	finder.SetDatacenter(dc)
+
+	datastore, err := finder.Datastore(ctx, file.Datastore)
+	if err != nil {
+		return nil, err
+	}
+
+	r, _, err := datastore.Download(ctx, file.Path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", file.String(), err)
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
 func (p *vsphereProvider) Teardown() error {
 	logger.Printf("Logout user %s", p.serviceConfig.UserName)
 	return DeleteGovmomiClient(p.gclient)
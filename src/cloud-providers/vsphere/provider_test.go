@@ -0,0 +1,71 @@
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+	"testing"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/simulator"
+)
+
+func TestListInstances(t *testing.T) {
+	model := simulator.VPX()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(model.Remove)
+
+	server := model.Service.NewServer()
+	t.Cleanup(server.Close)
+
+	password, _ := server.URL.User.Password()
+	config := &Config{
+		VcenterURL: server.URL.String(),
+		UserName:   server.URL.User.Username(),
+		Password:   password,
+		Datacenter: "DC0",
+		Host:       "DC0_H0",
+		Datastore:  "LocalDS_0",
+	}
+	p, err := NewProvider(config)
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	vsphere := p.(*vsphereProvider)
+
+	ctx := context.Background()
+	finder := find.NewFinder(vsphere.gclient.Client, true)
+	vms, err := finder.VirtualMachineList(ctx, "/DC0/vm/*")
+	if err != nil || len(vms) < 2 {
+		t.Fatalf("VirtualMachineList() = %v, %v", vms, err)
+	}
+
+	tags := map[string]string{
+		provider.ClusterIDTagKey: "cluster-1",
+		provider.PodNameTagKey:   "pod1",
+	}
+	if err := vsphere.setCustomAttributes(ctx, vms[0], tags); err != nil {
+		t.Fatalf("setCustomAttributes() error = %v", err)
+	}
+	if err := vsphere.setCustomAttributes(ctx, vms[1], map[string]string{provider.ClusterIDTagKey: "cluster-2"}); err != nil {
+		t.Fatalf("setCustomAttributes() error = %v", err)
+	}
+
+	instances, err := vsphere.ListInstances(ctx, "cluster-1")
+	if err != nil {
+		t.Fatalf("ListInstances() error = %v", err)
+	}
+	if len(instances) != 1 {
+		t.Fatalf("ListInstances() = %v, want one instance", instances)
+	}
+	if instances[0].ID != vms[0].UUID(ctx) || instances[0].Name != vms[0].Name() {
+		t.Errorf("ListInstances() = %+v, want VM %s", instances[0], vms[0].Name())
+	}
+	if instances[0].Tags[provider.PodNameTagKey] != "pod1" {
+		t.Errorf("ListInstances() tags = %v, want %v", instances[0].Tags, tags)
+	}
+}
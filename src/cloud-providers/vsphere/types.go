@@ -19,6 +19,7 @@ type Config struct {
 	Deployfolder string
 	Template     string
 	Host         string
+	ClusterID    string
 }
 
 func (c Config) Redact() Config {
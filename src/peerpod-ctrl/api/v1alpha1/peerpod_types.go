@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -27,15 +28,111 @@ import (
 type PeerPodSpec struct {
 	CloudProvider string `json:"cloudProvider,omitempty"`
 	InstanceID    string `json:"instanceID,omitempty"`
+	// InitdataDigest is the digest of the initdata provisioned to the pod VM
+	InitdataDigest string `json:"initdataDigest,omitempty"`
+	// Profile is the provider profile the instance was created with, empty
+	// for the default provider
+	Profile string `json:"profile,omitempty"`
 }
 
+// PeerPodPhase is the lifecycle phase of the pod VM of a PeerPod
+// +kubebuilder:validation:Enum=Provisioning;Running;Deleting;Failed
+type PeerPodPhase string
+
+const (
+	// PeerPodProvisioning means that the instance is created and the pod VM is starting
+	PeerPodProvisioning PeerPodPhase = "Provisioning"
+	// PeerPodRunning means that the kata agent in the pod VM is reachable
+	PeerPodRunning PeerPodPhase = "Running"
+	// PeerPodDeleting means that the instance is being deleted
+	PeerPodDeleting PeerPodPhase = "Deleting"
+	// PeerPodFailed means that the pod VM failed to start or to be deleted
+	PeerPodFailed PeerPodPhase = "Failed"
+)
+
+// Condition types of a PeerPod
+const (
+	// InstanceCreated is true once the cloud provider created the instance
+	InstanceCreated = "InstanceCreated"
+	// NetworkReady is true once the tunnel to the pod VM network is set up
+	NetworkReady = "NetworkReady"
+	// AgentConnected is true once the adaptor is connected to the kata agent
+	AgentConnected = "AgentConnected"
+	// DeletionFailed is true once the deletion of the instance failed the
+	// maximum number of attempts of peerpod-ctrl
+	DeletionFailed = "DeletionFailed"
+)
+
+// DeletePolicyAnnotation selects what peerpod-ctrl does once it failed to
+// delete the instance of a PeerPod the maximum number of attempts
+const DeletePolicyAnnotation = "peerpods.confidentialcontainers.org/delete-policy"
+
+const (
+	// DeletePolicyRetry keeps retrying the deletion, it is the default
+	DeletePolicyRetry = "Retry"
+	// DeletePolicyRelease releases the finalizer of the PeerPod, leaving the
+	// instance behind
+	DeletePolicyRelease = "Release"
+)
+
+// ProfileAnnotation selects the provider profile creating the pod VM of a pod
+const ProfileAnnotation = "peerpods.confidentialcontainers.org/profile"
+
 // PeerPodStatus defines the observed state of PeerPod
 type PeerPodStatus struct {
-	Cleaned bool `json:"cleand,omitempty"`
+	// Cleaned is set once the instance has been deleted
+	Cleaned bool `json:"cleaned,omitempty"`
+	// Phase is the lifecycle phase of the pod VM
+	Phase PeerPodPhase `json:"phase,omitempty"`
+	// Conditions are the InstanceCreated, NetworkReady, AgentConnected and
+	// DeletionFailed conditions of the pod VM
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// InstanceName is the name of the instance in the cloud provider
+	InstanceName string `json:"instanceName,omitempty"`
+	// InstanceType is the instance type, flavor or profile of the instance
+	InstanceType string `json:"instanceType,omitempty"`
+	// IPs are the addresses of the pod VM
+	IPs []string `json:"ips,omitempty"`
+	// ImageID is the image the instance was created from
+	ImageID string `json:"imageID,omitempty"`
+	// CreatedAt is when the instance was created
+	CreatedAt *metav1.Time `json:"createdAt,omitempty"`
+	// ReadyAt is when the adaptor connected to the kata agent
+	ReadyAt *metav1.Time `json:"readyAt,omitempty"`
+	// DeletedAt is when the instance was deleted
+	DeletedAt *metav1.Time `json:"deletedAt,omitempty"`
+	// DeleteAttempts is the number of failed attempts of peerpod-ctrl to
+	// delete the instance
+	DeleteAttempts int32 `json:"deleteAttempts,omitempty"`
+	// LastDeleteAttempt is when peerpod-ctrl last failed to delete the instance
+	LastDeleteAttempt *metav1.Time `json:"lastDeleteAttempt,omitempty"`
+}
+
+// SetCondition sets a condition of the PeerPod, updating its transition
+// time only when its status changes
+func (s *PeerPodStatus) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&s.Conditions, metav1.Condition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Instance",type=string,JSONPath=`.status.instanceName`
+//+kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.status.instanceType`
+//+kubebuilder:printcolumn:name="IPs",type=string,JSONPath=`.status.ips`
+//+kubebuilder:printcolumn:name="Image",type=string,JSONPath=`.status.imageID`,priority=1
+//+kubebuilder:printcolumn:name="Instance ID",type=string,JSONPath=`.spec.instanceID`,priority=1
+//+kubebuilder:printcolumn:name="Created",type=date,JSONPath=`.status.createdAt`,priority=1
+//+kubebuilder:printcolumn:name="Ready",type=date,JSONPath=`.status.readyAt`,priority=1
+//+kubebuilder:printcolumn:name="Deleted",type=date,JSONPath=`.status.deletedAt`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // PeerPod is the Schema for the peerpods API
 type PeerPod struct {
@@ -0,0 +1,220 @@
+/*
+Copyright Confidential Containers Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	confidentialcontainersorgv1alpha1 "github.com/confidential-containers/cloud-api-adaptor/src/peerpod-ctrl/api/v1alpha1"
+)
+
+// peerPodsExtendedResource is the node resource requested by peer pods
+const peerPodsExtendedResource = "kata.peerpods.io/vm"
+
+var capacityLog = ctrl.Log.WithName("capacity-updater")
+
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=nodes/status,verbs=patch
+//+kubebuilder:rbac:groups="",resources=pods,verbs=list
+
+// CapacityUpdater periodically recomputes the peer pods extended resource of
+// the nodes advertising it, so that the scheduler stops placing peer pods once
+// the cloud account can't run more pod VMs. The capacity of a node is the
+// number of its live PeerPods plus its share of the instances left in the
+// cloud quota, as reported by a provider implementing provider.QuotaReporter,
+// and at most MaxPerNode when set.
+type CapacityUpdater struct {
+	client.Client
+	// APIReader lists the pods of the nodes from the API server, so that the
+	// pods of the whole cluster are not cached
+	APIReader client.Reader
+	// Reconciler provides the cloud provider shared with the PeerPod controller
+	Reconciler *PeerPodReconciler
+	Interval   time.Duration
+	// MaxPerNode caps the capacity of each node, zero means no cap
+	MaxPerNode int64
+}
+
+// Start implements manager.Runnable
+func (c *CapacityUpdater) Start(ctx context.Context) error {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.update(ctx); err != nil {
+			capacityLog.Error(err, "updating the peer pods capacity failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, only the
+// leader should update the nodes
+func (c *CapacityUpdater) NeedLeaderElection() bool {
+	return true
+}
+
+func (c *CapacityUpdater) update(ctx context.Context) error {
+	available, err := c.availableInstances(ctx)
+	if err != nil {
+		return err
+	}
+	if available < 0 && c.MaxPerNode <= 0 {
+		capacityLog.V(1).Info("cloud provider does not report its quota and no maximum per node is set, skipping")
+		return nil
+	}
+
+	nodeList := corev1.NodeList{}
+	if err := c.List(ctx, &nodeList); err != nil {
+		return fmt.Errorf("listing Nodes: %w", err)
+	}
+	var nodes []string
+	current := make(map[string]int64)
+	for _, node := range nodeList.Items {
+		// Only the nodes set up for peer pods advertise the resource
+		if quantity, ok := node.Status.Capacity[peerPodsExtendedResource]; ok {
+			nodes = append(nodes, node.Name)
+			current[node.Name] = quantity.Value()
+		}
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	ppList := confidentialcontainersorgv1alpha1.PeerPodList{}
+	if err := c.List(ctx, &ppList); err != nil {
+		return fmt.Errorf("listing PeerPods: %w", err)
+	}
+	var pods []corev1.Pod
+	if len(ppList.Items) > 0 {
+		for _, node := range nodes {
+			podList := corev1.PodList{}
+			if err := c.APIReader.List(ctx, &podList, client.MatchingFields{"spec.nodeName": node}); err != nil {
+				return fmt.Errorf("listing the Pods of node %s: %w", node, err)
+			}
+			pods = append(pods, podList.Items...)
+		}
+	}
+
+	capacities := nodeCapacities(nodes, ppList.Items, pods, available, c.MaxPerNode)
+	for _, node := range nodes {
+		if capacities[node] == current[node] {
+			continue
+		}
+		if err := c.patchCapacity(ctx, node, capacities[node]); err != nil {
+			capacityLog.Error(err, "failed to update the peer pods capacity", "node", node)
+			continue
+		}
+		capacityLog.Info("updated the peer pods capacity", "node", node, "from", current[node], "to", capacities[node])
+	}
+	return nil
+}
+
+// availableInstances returns the number of pod VMs the cloud account can
+// still run, or -1 if the cloud provider does not report it
+func (c *CapacityUpdater) availableInstances(ctx context.Context) (int64, error) {
+	cloudProvider, release, err := c.Reconciler.getProvider(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	reporter, ok := cloudProvider.(provider.QuotaReporter)
+	if !ok {
+		return -1, nil
+	}
+	available, err := reporter.AvailableInstances(ctx)
+	if errors.Is(err, provider.ErrNotSupported) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("getting the cloud quota: %w", err)
+	}
+	return available, nil
+}
+
+func (c *CapacityUpdater) patchCapacity(ctx context.Context, nodeName string, capacity int64) error {
+	patch, err := json.Marshal([]map[string]string{{
+		"op":    "replace",
+		"path":  "/status/capacity/" + strings.ReplaceAll(peerPodsExtendedResource, "/", "~1"),
+		"value": strconv.FormatInt(capacity, 10),
+	}})
+	if err != nil {
+		return err
+	}
+	node := &corev1.Node{}
+	node.Name = nodeName
+	return c.Status().Patch(ctx, node, client.RawPatch(types.JSONPatchType, patch))
+}
+
+// nodeCapacities returns the capacity of each node: the PeerPods of the pods
+// running on it plus an even share of the available instances, capped by
+// maxPerNode when it is positive. When available is negative, the quota is
+// unknown and all the nodes get maxPerNode.
+func nodeCapacities(nodes []string, peerPods []confidentialcontainersorgv1alpha1.PeerPod, pods []corev1.Pod, available, maxPerNode int64) map[string]int64 {
+	podNodes := make(map[types.UID]string, len(pods))
+	for _, pod := range pods {
+		podNodes[pod.UID] = pod.Spec.NodeName
+	}
+	used := make(map[string]int64, len(nodes))
+	for _, pp := range peerPods {
+		for _, owner := range pp.OwnerReferences {
+			if owner.Kind == "Pod" {
+				if node := podNodes[owner.UID]; node != "" {
+					used[node]++
+				}
+			}
+		}
+	}
+
+	sorted := append([]string(nil), nodes...)
+	sort.Strings(sorted)
+	capacities := make(map[string]int64, len(nodes))
+	for i, node := range sorted {
+		capacity := maxPerNode
+		if available >= 0 {
+			share := available / int64(len(sorted))
+			if int64(i) < available%int64(len(sorted)) {
+				share++
+			}
+			capacity = used[node] + share
+			if maxPerNode > 0 && capacity > maxPerNode {
+				capacity = maxPerNode
+			}
+		}
+		capacities[node] = capacity
+	}
+	return capacities
+}
@@ -0,0 +1,87 @@
+/*
+Copyright Confidential Containers Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	confidentialcontainersorgv1alpha1 "github.com/confidential-containers/cloud-api-adaptor/src/peerpod-ctrl/api/v1alpha1"
+)
+
+func TestNodeCapacities(t *testing.T) {
+	newPod := func(uid, node string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{UID: types.UID(uid)},
+			Spec:       corev1.PodSpec{NodeName: node},
+		}
+	}
+	newPeerPod := func(podUID string) confidentialcontainersorgv1alpha1.PeerPod {
+		return confidentialcontainersorgv1alpha1.PeerPod{
+			ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Pod", UID: types.UID(podUID)},
+			}},
+		}
+	}
+
+	nodes := []string{"worker-1", "worker-0"}
+	pods := []corev1.Pod{newPod("a", "worker-0"), newPod("b", "worker-0"), newPod("c", "worker-1"), newPod("d", "")}
+	peerPods := []confidentialcontainersorgv1alpha1.PeerPod{newPeerPod("a"), newPeerPod("b"), newPeerPod("c"), newPeerPod("d"), newPeerPod("gone")}
+
+	tests := []struct {
+		name       string
+		available  int64
+		maxPerNode int64
+		want       map[string]int64
+	}{
+		{
+			name:      "quota exhausted",
+			available: 0,
+			want:      map[string]int64{"worker-0": 2, "worker-1": 1},
+		},
+		{
+			name:      "remainder goes to the first nodes",
+			available: 3,
+			want:      map[string]int64{"worker-0": 4, "worker-1": 2},
+		},
+		{
+			name:       "capped",
+			available:  10,
+			maxPerNode: 4,
+			want:       map[string]int64{"worker-0": 4, "worker-1": 4},
+		},
+		{
+			name:       "unknown quota",
+			available:  -1,
+			maxPerNode: 5,
+			want:       map[string]int64{"worker-0": 5, "worker-1": 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nodeCapacities(nodes, peerPods, pods, tt.available, tt.maxPerNode)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nodeCapacities() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
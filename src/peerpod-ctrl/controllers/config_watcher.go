@@ -0,0 +1,118 @@
+/*
+Copyright Confidential Containers Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util"
+)
+
+var configLog = ctrl.Log.WithName("config-watcher")
+
+// ConfigWatcher watches the peer-pods ConfigMap and Secret and reloads the
+// cloud provider of the PeerPod controller when they change, e.g. after the
+// cloud credentials were rotated.
+type ConfigWatcher struct {
+	Clientset  kubernetes.Interface
+	Namespace  string
+	Reconciler *PeerPodReconciler
+}
+
+// Start implements manager.Runnable
+func (w *ConfigWatcher) Start(ctx context.Context) error {
+	return util.WatchProviderConfig(ctx, w.Clientset, w.Namespace, ppConfigMap, ppSecret, w.Reconciler.ReloadProvider)
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, a standby
+// replica keeps its provider up to date to take over
+func (w *ConfigWatcher) NeedLeaderElection() bool {
+	return false
+}
+
+// ReloadProvider replaces the cloud provider and the providers of the profiles
+// with ones configured from env, the data of the peer-pods ConfigMap and
+// Secret. Deletions in progress complete with the previous providers.
+func (r *PeerPodReconciler) ReloadProvider(env map[string]string) {
+	p, err := newProvider(env)
+	if err != nil {
+		configLog.Error(err, "cannot reload the cloud provider, keeping the current one")
+		return
+	}
+
+	r.providerMutex.Lock()
+	defer r.providerMutex.Unlock()
+
+	r.Provider = p
+	r.configs = env
+	if r.profiles == nil {
+		r.profiles = provider.NewProfiles(p)
+	} else {
+		r.profiles.Default().Swap(p)
+	}
+	configLog.Info("reloaded the cloud provider")
+
+	if err := r.loadProfiles(r.profiles, env); err != nil {
+		configLog.Error(err, "cannot reload the provider profiles")
+	}
+}
+
+// ProfilesWatcher reloads the provider profiles of the PeerPod controller when
+// the profiles directory changes. The kubelet updates the Secrets mounted in it
+// without any change of the peer-pods ConfigMap or Secret.
+type ProfilesWatcher struct {
+	Reconciler *PeerPodReconciler
+	// Interval defaults to provider.ProfilesPollInterval
+	Interval time.Duration
+}
+
+// Start implements manager.Runnable
+func (w *ProfilesWatcher) Start(ctx context.Context) error {
+	interval := w.Interval
+	if interval == 0 {
+		interval = provider.ProfilesPollInterval
+	}
+	provider.WatchProfiles(ctx, w.Reconciler.ProfilesDir, interval, w.Reconciler.ReloadProfiles)
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (w *ProfilesWatcher) NeedLeaderElection() bool {
+	return false
+}
+
+// ReloadProfiles creates or reloads the providers of the profiles found in
+// ProfilesDir, and removes the profiles that are gone
+func (r *PeerPodReconciler) ReloadProfiles() {
+	r.providerMutex.Lock()
+	defer r.providerMutex.Unlock()
+
+	// The profiles are loaded along with the provider by the first reconcile
+	if r.profiles == nil {
+		return
+	}
+	if err := r.loadProfiles(r.profiles, r.configs); err != nil {
+		configLog.Error(err, "cannot reload the provider profiles")
+		return
+	}
+	configLog.Info("reloaded the provider profiles")
+}
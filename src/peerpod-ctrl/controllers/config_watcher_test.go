@@ -0,0 +1,133 @@
+/*
+Copyright Confidential Containers Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+)
+
+// mockCloudProvider creates mockProviders, recording the env they were created with
+type mockCloudProvider struct {
+	env map[string]string
+}
+
+func (c *mockCloudProvider) ParseCmd(flags *flag.FlagSet) {
+}
+
+func (c *mockCloudProvider) LoadEnv() {
+}
+
+func (c *mockCloudProvider) NewProvider() (provider.Provider, error) {
+	return &mockProvider{}, nil
+}
+
+func (c *mockCloudProvider) NewProviderWithEnv(env map[string]string) (provider.Provider, error) {
+	c.env = env
+	return &mockProvider{}, nil
+}
+
+func TestReloadProvider(t *testing.T) {
+	cloud := &mockCloudProvider{}
+	provider.AddCloudProvider("mock", cloud)
+
+	old := &mockProvider{}
+	r := &PeerPodReconciler{Provider: old}
+
+	p, release, err := r.getProvider(context.Background(), "")
+	if err != nil || p != old {
+		t.Fatalf("getProvider() = %v, %v, want the initial provider", p, err)
+	}
+
+	env := map[string]string{"CLOUD_PROVIDER": "mock", clusterIDEnv: "cluster-1"}
+	r.ReloadProvider(env)
+	if cloud.env["CLOUD_PROVIDER"] != "mock" {
+		t.Errorf("provider not created from the configs: %v", cloud.env)
+	}
+
+	current, done, err := r.getProvider(context.Background(), "")
+	if err != nil || current == old {
+		t.Errorf("getProvider() = %v, %v, want the reloaded provider", current, err)
+	}
+	done()
+
+	// The deletion in progress keeps the previous provider
+	if old.tornDown {
+		t.Errorf("previous provider torn down while in use")
+	}
+	release()
+	if !old.tornDown {
+		t.Errorf("previous provider not torn down once released")
+	}
+
+	if got := r.getenv(clusterIDEnv); got != "cluster-1" {
+		t.Errorf("getenv(%q) = %q, want %q", clusterIDEnv, got, "cluster-1")
+	}
+
+	// A failed reload keeps the current provider
+	r.ReloadProvider(map[string]string{"CLOUD_PROVIDER": "unknown"})
+	if p, done, _ := r.getProvider(context.Background(), ""); p != current {
+		t.Errorf("getProvider() after a failed reload = %v, want %v", p, current)
+	} else {
+		done()
+	}
+}
+
+func TestReloadProfiles(t *testing.T) {
+	provider.AddCloudProvider("mock", &mockCloudProvider{})
+
+	dir := t.TempDir()
+	writeProfile := func(name string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name, "CLOUD_PROVIDER"), []byte("mock"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeProfile("east")
+
+	r := &PeerPodReconciler{Provider: &mockProvider{}, ProfilesDir: dir}
+	// Nothing to reload before the first reconcile
+	r.ReloadProfiles()
+
+	_, release, err := r.getProvider(context.Background(), "east")
+	if err != nil {
+		t.Fatalf("getProvider(east) error = %v", err)
+	}
+	release()
+
+	writeProfile("west")
+	if err := os.RemoveAll(filepath.Join(dir, "east")); err != nil {
+		t.Fatal(err)
+	}
+	r.ReloadProfiles()
+
+	if names := r.profiles.Names(); !reflect.DeepEqual(names, []string{"west"}) {
+		t.Errorf("profiles = %v, want [west]", names)
+	}
+	if _, _, err := r.getProvider(context.Background(), "east"); err == nil {
+		t.Errorf("getProvider(east) of a removed profile succeeded")
+	}
+}
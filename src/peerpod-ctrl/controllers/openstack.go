@@ -0,0 +1,10 @@
+//go:build openstack
+
+// (C) Copyright Confidential Containers Contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	_ "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/openstack"
+)
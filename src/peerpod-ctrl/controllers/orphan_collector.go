@@ -0,0 +1,197 @@
+/*
+Copyright Confidential Containers Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	confidentialcontainersorgv1alpha1 "github.com/confidential-containers/cloud-api-adaptor/src/peerpod-ctrl/api/v1alpha1"
+)
+
+// clusterIDEnv holds the cluster ID the cloud providers tag pod VMs with.
+// Like the other provider settings it can be set through peer-pods-cm.
+const clusterIDEnv = "PEERPODS_CLUSTER_ID"
+
+var orphanLog = ctrl.Log.WithName("orphan-collector")
+
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+
+// OrphanCollector periodically looks for pod VMs created for this cluster
+// that are neither referenced by a PeerPod nor backing a live Pod, and deletes
+// them once they are older than GracePeriod. It goes through the default
+// provider and the provider of every profile, skipping those that don't
+// implement provider.InstanceLister.
+type OrphanCollector struct {
+	client.Client
+	// Reconciler provides the cloud provider shared with the PeerPod controller
+	Reconciler  *PeerPodReconciler
+	Interval    time.Duration
+	GracePeriod time.Duration
+	// DryRun only reports orphaned instances instead of deleting them
+	DryRun bool
+}
+
+// Start implements manager.Runnable
+func (c *OrphanCollector) Start(ctx context.Context) error {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := c.collect(ctx); err != nil {
+				orphanLog.Error(err, "collecting orphaned instances failed")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, only the
+// leader should delete instances
+func (c *OrphanCollector) NeedLeaderElection() bool {
+	return true
+}
+
+// collect deletes the orphaned instances of the default provider and of every
+// provider profile, as the PeerPods of a profile are created with its provider
+func (c *OrphanCollector) collect(ctx context.Context) error {
+	clusterID := c.Reconciler.getenv(clusterIDEnv)
+	if clusterID == "" {
+		orphanLog.V(1).Info("cluster ID is not set, skipping", "env", clusterIDEnv)
+		return nil
+	}
+
+	// Initialize the default provider and the profiles on first use
+	_, release, err := c.Reconciler.getProvider(ctx, "")
+	if err != nil {
+		return err
+	}
+	release()
+
+	var errs []error
+	for _, profile := range append([]string{""}, c.Reconciler.profileNames()...) {
+		if err := c.collectProfile(ctx, profile, clusterID); err != nil {
+			errs = append(errs, fmt.Errorf("profile %q: %w", profile, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// collectProfile deletes the orphaned instances of the provider of a profile,
+// or of the default provider if profile is empty
+func (c *OrphanCollector) collectProfile(ctx context.Context, profile, clusterID string) error {
+	cloudProvider, release, err := c.Reconciler.getProvider(ctx, profile)
+	if errors.Is(err, provider.ErrUnknownProfile) {
+		// The profile was removed since the names were read
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	lister, ok := cloudProvider.(provider.InstanceLister)
+	if !ok {
+		orphanLog.V(1).Info("cloud provider does not support listing instances, skipping", "profile", profile)
+		return nil
+	}
+
+	instances, err := lister.ListInstances(ctx, clusterID)
+	if errors.Is(err, provider.ErrNotSupported) {
+		orphanLog.V(1).Info("cloud provider does not support listing instances, skipping", "profile", profile)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ppList := confidentialcontainersorgv1alpha1.PeerPodList{}
+	if err := c.List(ctx, &ppList); err != nil {
+		return fmt.Errorf("listing PeerPods: %w", err)
+	}
+
+	podList := corev1.PodList{}
+	if err := c.List(ctx, &podList); err != nil {
+		return fmt.Errorf("listing Pods: %w", err)
+	}
+
+	for _, instance := range orphanedInstances(instances, ppList.Items, podList.Items, time.Now(), c.GracePeriod) {
+		if c.DryRun {
+			orphanLog.Info("found orphaned instance (dry-run)", "profile", profile, "InstanceID", instance.ID, "Name", instance.Name, "CreatedAt", instance.CreatedAt)
+			continue
+		}
+
+		orphanLog.Info("deleting orphaned instance", "profile", profile, "InstanceID", instance.ID, "Name", instance.Name, "CreatedAt", instance.CreatedAt)
+		if err := cloudProvider.DeleteInstance(ctx, instance.ID); err != nil && !errors.Is(err, provider.ErrInstanceNotFound) {
+			orphanLog.Error(err, "failed to delete orphaned instance", "profile", profile, "InstanceID", instance.ID)
+		}
+	}
+
+	return nil
+}
+
+// orphanedInstances returns the instances that are not referenced by any PeerPod,
+// whose pod no longer exists and that were created more than gracePeriod ago.
+// Instances without a creation time are never considered orphaned.
+func orphanedInstances(instances []*provider.Instance, peerPods []confidentialcontainersorgv1alpha1.PeerPod, pods []corev1.Pod, now time.Time, gracePeriod time.Duration) []*provider.Instance {
+	owned := make(map[string]bool, len(peerPods))
+	for _, pp := range peerPods {
+		owned[pp.Spec.InstanceID] = true
+	}
+
+	livePods := make(map[string]bool, len(pods))
+	livePodNames := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		livePods[pod.Namespace+"/"+pod.Name] = true
+		livePodNames[pod.Name] = true
+	}
+
+	var orphans []*provider.Instance
+	for _, instance := range instances {
+		if owned[instance.ID] {
+			continue
+		}
+		if podName, ok := instance.Tags[provider.PodNameTagKey]; ok {
+			// Instances created before the namespace was tagged are matched
+			// by pod name across namespaces
+			if namespace, ok := instance.Tags[provider.NamespaceTagKey]; ok {
+				if livePods[namespace+"/"+podName] {
+					continue
+				}
+			} else if livePodNames[podName] {
+				continue
+			}
+		}
+		if instance.CreatedAt.IsZero() || now.Sub(instance.CreatedAt) < gracePeriod {
+			continue
+		}
+		orphans = append(orphans, instance)
+	}
+
+	return orphans
+}
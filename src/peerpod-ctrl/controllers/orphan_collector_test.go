@@ -0,0 +1,172 @@
+/*
+Copyright Confidential Containers Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	confidentialcontainersorgv1alpha1 "github.com/confidential-containers/cloud-api-adaptor/src/peerpod-ctrl/api/v1alpha1"
+)
+
+func TestOrphanedInstances(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	grace := 10 * time.Minute
+
+	newInstance := func(id, podName string, age time.Duration) *provider.Instance {
+		instance := &provider.Instance{
+			ID:   id,
+			Tags: map[string]string{provider.PodNameTagKey: podName, provider.NamespaceTagKey: "default"},
+		}
+		if age > 0 {
+			instance.CreatedAt = now.Add(-age)
+		}
+		return instance
+	}
+
+	peerPods := []confidentialcontainersorgv1alpha1.PeerPod{
+		{Spec: confidentialcontainersorgv1alpha1.PeerPodSpec{InstanceID: "owned"}},
+	}
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "live", Namespace: "default"}},
+	}
+
+	tests := []struct {
+		name     string
+		instance *provider.Instance
+		orphaned bool
+	}{
+		{
+			name:     "referenced by PeerPod",
+			instance: newInstance("owned", "gone", time.Hour),
+		},
+		{
+			name:     "pod still exists",
+			instance: newInstance("i-1", "live", time.Hour),
+		},
+		{
+			name: "pod with the same name in another namespace",
+			instance: &provider.Instance{
+				ID:        "i-5",
+				Tags:      map[string]string{provider.PodNameTagKey: "live", provider.NamespaceTagKey: "other"},
+				CreatedAt: now.Add(-time.Hour),
+			},
+			orphaned: true,
+		},
+		{
+			name: "pod still exists, namespace not tagged",
+			instance: &provider.Instance{
+				ID:        "i-6",
+				Tags:      map[string]string{provider.PodNameTagKey: "live"},
+				CreatedAt: now.Add(-time.Hour),
+			},
+		},
+		{
+			name:     "within grace period",
+			instance: newInstance("i-2", "gone", time.Minute),
+		},
+		{
+			name:     "unknown creation time",
+			instance: newInstance("i-3", "gone", 0),
+		},
+		{
+			name:     "orphaned",
+			instance: newInstance("i-4", "gone", time.Hour),
+			orphaned: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := orphanedInstances([]*provider.Instance{tt.instance}, peerPods, pods, now, grace)
+			if orphaned := len(got) == 1; orphaned != tt.orphaned {
+				t.Errorf("orphanedInstances() orphaned = %v, want %v", orphaned, tt.orphaned)
+			}
+		})
+	}
+}
+
+// mockListerProvider is a mockProvider implementing provider.InstanceLister
+type mockListerProvider struct {
+	mockProvider
+	instances []*provider.Instance
+	clusterID string
+}
+
+func (p *mockListerProvider) ListInstances(ctx context.Context, clusterID string) ([]*provider.Instance, error) {
+	p.clusterID = clusterID
+	return p.instances, nil
+}
+
+func TestCollectProfiles(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := confidentialcontainersorgv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	pp := &confidentialcontainersorgv1alpha1.PeerPod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pp", Namespace: "default"},
+		Spec:       confidentialcontainersorgv1alpha1.PeerPodSpec{InstanceID: "i-owned", Profile: "east"},
+	}
+	created := time.Now().Add(-time.Hour)
+
+	defaultProvider := &mockProvider{}
+	eastProvider := &mockListerProvider{
+		instances: []*provider.Instance{
+			{ID: "i-owned", CreatedAt: created},
+			{ID: "i-orphan", CreatedAt: created},
+		},
+	}
+	westProvider := &mockListerProvider{}
+
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pp).Build()
+	r := &PeerPodReconciler{
+		Client:   k8sClient,
+		Scheme:   scheme,
+		Provider: defaultProvider,
+		profiles: provider.NewProfiles(defaultProvider),
+		configs:  map[string]string{clusterIDEnv: "cluster-1"},
+	}
+	r.profiles.Set("east", eastProvider)
+	r.profiles.Set("west", westProvider)
+
+	c := &OrphanCollector{Client: k8sClient, Reconciler: r, GracePeriod: 10 * time.Minute}
+	if err := c.collect(context.Background()); err != nil {
+		t.Fatalf("collect() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(eastProvider.deleted, []string{"i-orphan"}) {
+		t.Errorf("deleted by the east profile = %v, want [i-orphan]", eastProvider.deleted)
+	}
+	if eastProvider.clusterID != "cluster-1" || westProvider.clusterID != "cluster-1" {
+		t.Errorf("listed cluster IDs = %q, %q, want cluster-1", eastProvider.clusterID, westProvider.clusterID)
+	}
+	if len(defaultProvider.deleted) != 0 || len(westProvider.deleted) != 0 {
+		t.Errorf("deleted by the default provider %v, by the west profile %v", defaultProvider.deleted, westProvider.deleted)
+	}
+}
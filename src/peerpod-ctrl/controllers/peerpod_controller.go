@@ -18,12 +18,18 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -39,40 +45,46 @@ type PeerPodReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Provider provider.Provider
+	Recorder record.EventRecorder
+	// DeleteBackoff is the delay after the first failed deletion of an
+	// instance, doubled after each failure up to MaxDeleteBackoff
+	DeleteBackoff    time.Duration
+	MaxDeleteBackoff time.Duration
+	// MaxDeleteAttempts is the number of failed deletions after which the
+	// delete policy of the PeerPod applies
+	MaxDeleteAttempts int32
+	// ProfilesDir is the directory of the provider profiles that PeerPods
+	// may have been created with
+	ProfilesDir string
+	// profiles holds the current providers, replaced when the configs change
+	profiles *provider.Profiles
+	// configs holds the data of the peer-pods ConfigMap and Secret
+	configs map[string]string
+	// guards lazy initialization of profiles
+	providerMutex sync.Mutex
 }
 
 const (
 	ppFinalizer = "peer.pod/finalizer"
 	ppConfigMap = "peer-pods-cm"
 	ppSecret    = "peer-pods-secret"
+
+	defaultDeleteBackoff     = 10 * time.Second
+	defaultMaxDeleteBackoff  = 10 * time.Minute
+	defaultMaxDeleteAttempts = 10
 )
 
-//+kubebuilder:rbac:groups="",resourceNames=peer-pods-cm;peer-pods-secret,resources=configmaps;secrets,verbs=get
+//+kubebuilder:rbac:groups="",resourceNames=peer-pods-cm;peer-pods-secret,resources=configmaps;secrets,verbs=get;list;watch
 
 //+kubebuilder:rbac:groups=confidentialcontainers.org,resources=peerpods,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=confidentialcontainers.org,resources=peerpods/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=confidentialcontainers.org,resources=peerpods/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *PeerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 	pp := confidentialcontainersorgv1alpha1.PeerPod{}
 
-	// cloud provider was not set, try to fetch cloud provider and its configs dynamically from ConfigMap or Secret
-	// make sure the matching RBAC rules are set
-	if r.Provider == nil {
-		logger.Info("trying to fetch cloud provider configs for peerpod-ctrl")
-		if err := r.cloudConfigsGetter(); err != nil {
-			// don't requeue, if cloud configs are missing it will requeue later
-			logger.Info("cannot fetch cloud configs at the moment", "error", err)
-		}
-
-		var pErr error
-		r.Provider, pErr = SetProvider()
-		if pErr != nil {
-			return ctrl.Result{}, pErr
-		}
-	}
-
 	if err := r.Get(ctx, req.NamespacedName, &pp); err != nil {
 		if apierrors.IsNotFound(err) {
 			return ctrl.Result{}, nil
@@ -104,9 +116,43 @@ func (r *PeerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	}
 
 	if controllerutil.ContainsFinalizer(&pp, ppFinalizer) {
-		logger.Info("deleting instance", "InstanceID", pp.Spec.InstanceID, "CloudProvider", pp.Spec.CloudProvider)
-		if err := r.Provider.DeleteInstance(ctx, pp.Spec.InstanceID); err != nil {
-			return ctrl.Result{}, err
+		// The adaptor may have deleted the instance without releasing the PeerPod
+		if !pp.Status.Cleaned {
+			// Status updates trigger a reconcile, wait for the backoff of the last failure
+			if wait := r.deleteBackoffRemaining(&pp, time.Now()); wait > 0 {
+				return ctrl.Result{RequeueAfter: wait}, nil
+			}
+
+			if pp.Status.DeleteAttempts == 0 && pp.Status.Phase != confidentialcontainersorgv1alpha1.PeerPodDeleting {
+				pp.Status.Phase = confidentialcontainersorgv1alpha1.PeerPodDeleting
+				if err := r.Status().Update(ctx, &pp); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+
+			// The instance is deleted by the provider of the profile it was created with
+			cloudProvider, release, err := r.getProvider(ctx, pp.Spec.Profile)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			defer release()
+
+			logger.Info("deleting instance", "InstanceID", pp.Spec.InstanceID, "CloudProvider", pp.Spec.CloudProvider, "Profile", pp.Spec.Profile)
+			err = cloudProvider.DeleteInstance(ctx, pp.Spec.InstanceID)
+			if errors.Is(err, provider.ErrInstanceNotFound) {
+				logger.Info("instance not found, assuming it is already deleted", "InstanceID", pp.Spec.InstanceID)
+				err = nil
+			}
+			if err != nil {
+				return r.deleteFailed(ctx, &pp, err)
+			}
+
+			now := metav1.Now()
+			pp.Status.Cleaned = true
+			pp.Status.DeletedAt = &now
+			if err := r.Status().Update(ctx, &pp); err != nil {
+				return ctrl.Result{}, err
+			}
 		}
 
 		controllerutil.RemoveFinalizer(&pp, ppFinalizer)
@@ -122,6 +168,97 @@ func (r *PeerPodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	return ctrl.Result{}, nil
 }
 
+// deleteFailed records a failed deletion of the instance of a PeerPod and
+// schedules the next attempt. Once the maximum number of attempts is reached,
+// the delete policy of the PeerPod decides whether to keep retrying or to
+// release its finalizer.
+func (r *PeerPodReconciler) deleteFailed(ctx context.Context, pp *confidentialcontainersorgv1alpha1.PeerPod, deleteErr error) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	now := metav1.Now()
+	pp.Status.DeleteAttempts++
+	pp.Status.LastDeleteAttempt = &now
+	attempts := pp.Status.DeleteAttempts
+
+	logger.Info("failed to delete instance", "InstanceID", pp.Spec.InstanceID, "attempts", attempts, "error", deleteErr)
+	r.recordEvent(pp, corev1.EventTypeWarning, "DeleteFailed", "Failed to delete instance %s (attempt %d): %v", pp.Spec.InstanceID, attempts, deleteErr)
+
+	if attempts >= r.maxDeleteAttempts() {
+		message := fmt.Sprintf("failed to delete instance %s after %d attempts: %v", pp.Spec.InstanceID, attempts, deleteErr)
+		pp.Status.Phase = confidentialcontainersorgv1alpha1.PeerPodFailed
+
+		if deletePolicy(pp) == confidentialcontainersorgv1alpha1.DeletePolicyRelease {
+			pp.Status.SetCondition(confidentialcontainersorgv1alpha1.DeletionFailed, metav1.ConditionTrue, "FinalizerReleased", message)
+			if err := r.Status().Update(ctx, pp); err != nil {
+				return ctrl.Result{}, err
+			}
+			r.recordEvent(pp, corev1.EventTypeWarning, "InstanceLeaked", "Released the PeerPod, instance %s must be deleted manually", pp.Spec.InstanceID)
+
+			controllerutil.RemoveFinalizer(pp, ppFinalizer)
+			if err := r.Update(ctx, pp); err != nil && !apierrors.IsNotFound(err) {
+				return ctrl.Result{}, err
+			}
+			logger.Info("released PeerPod without deleting its instance", "InstanceID", pp.Spec.InstanceID)
+			return ctrl.Result{}, nil
+		}
+
+		pp.Status.SetCondition(confidentialcontainersorgv1alpha1.DeletionFailed, metav1.ConditionTrue, "MaxAttemptsReached", message)
+	}
+
+	if err := r.Status().Update(ctx, pp); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: r.deleteBackoff(attempts)}, nil
+}
+
+// deleteBackoff returns the delay before the next deletion attempt, doubling
+// with each failed attempt up to MaxDeleteBackoff
+func (r *PeerPodReconciler) deleteBackoff(attempts int32) time.Duration {
+	backoff, maxBackoff := r.DeleteBackoff, r.MaxDeleteBackoff
+	if backoff <= 0 {
+		backoff = defaultDeleteBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxDeleteBackoff
+	}
+	for i := int32(1); i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
+
+// deleteBackoffRemaining returns how long to wait before the next deletion
+// attempt of a PeerPod
+func (r *PeerPodReconciler) deleteBackoffRemaining(pp *confidentialcontainersorgv1alpha1.PeerPod, now time.Time) time.Duration {
+	if pp.Status.LastDeleteAttempt == nil {
+		return 0
+	}
+	next := pp.Status.LastDeleteAttempt.Add(r.deleteBackoff(pp.Status.DeleteAttempts))
+	return next.Sub(now)
+}
+
+func (r *PeerPodReconciler) maxDeleteAttempts() int32 {
+	if r.MaxDeleteAttempts <= 0 {
+		return defaultMaxDeleteAttempts
+	}
+	return r.MaxDeleteAttempts
+}
+
+// deletePolicy returns the delete policy of a PeerPod, which defaults to retrying
+func deletePolicy(pp *confidentialcontainersorgv1alpha1.PeerPod) string {
+	if strings.EqualFold(pp.Annotations[confidentialcontainersorgv1alpha1.DeletePolicyAnnotation], confidentialcontainersorgv1alpha1.DeletePolicyRelease) {
+		return confidentialcontainersorgv1alpha1.DeletePolicyRelease
+	}
+	return confidentialcontainersorgv1alpha1.DeletePolicyRetry
+}
+
+func (r *PeerPodReconciler) recordEvent(pp *confidentialcontainersorgv1alpha1.PeerPod, eventType, reason, messageFmt string, args ...interface{}) {
+	if r.Recorder != nil {
+		r.Recorder.Eventf(pp, eventType, reason, messageFmt, args...)
+	}
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *PeerPodReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
@@ -129,48 +266,111 @@ func (r *PeerPodReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Complete(r)
 }
 
-func (r *PeerPodReconciler) cloudConfigsGetter() error {
+// getProvider returns the cloud provider of a profile, or the default one if
+// profile is empty, initializing them on first use, and a function to call
+// once done with it
+func (r *PeerPodReconciler) getProvider(ctx context.Context, profile string) (provider.Provider, func(), error) {
+	r.providerMutex.Lock()
+	defer r.providerMutex.Unlock()
+
+	if r.profiles == nil {
+		// cloud provider was not set, try to fetch cloud provider and its configs dynamically from ConfigMap or Secret
+		// make sure the matching RBAC rules are set
+		if r.Provider == nil {
+			logger := log.FromContext(ctx)
+			logger.Info("trying to fetch cloud provider configs for peerpod-ctrl")
+			env, err := r.cloudConfigsGetter(ctx)
+			if err != nil {
+				// don't requeue, if cloud configs are missing it will requeue later
+				logger.Info("cannot fetch cloud configs at the moment", "error", err)
+			}
+
+			if r.Provider, err = newProvider(env); err != nil {
+				return nil, nil, err
+			}
+			r.configs = env
+		}
+		profiles := provider.NewProfiles(r.Provider)
+		if err := r.loadProfiles(profiles, r.configs); err != nil {
+			return nil, nil, err
+		}
+		r.profiles = profiles
+	}
+
+	return r.profiles.Acquire(profile)
+}
+
+// profileNames returns the names of the provider profiles loaded so far
+func (r *PeerPodReconciler) profileNames() []string {
+	r.providerMutex.Lock()
+	defer r.providerMutex.Unlock()
+
+	if r.profiles == nil {
+		return nil
+	}
+	return r.profiles.Names()
+}
+
+// loadProfiles creates or reloads the providers of the profiles in ProfilesDir,
+// which take the configs they don't set from env
+func (r *PeerPodReconciler) loadProfiles(profiles *provider.Profiles, env map[string]string) error {
+	if r.ProfilesDir == "" {
+		return nil
+	}
+	return profiles.Load(r.ProfilesDir, provider.Getenv(env)("CLOUD_PROVIDER"), env)
+}
+
+// getenv returns the value of a config from the peer-pods ConfigMap and Secret,
+// or from the process environment
+func (r *PeerPodReconciler) getenv(name string) string {
+	r.providerMutex.Lock()
+	defer r.providerMutex.Unlock()
+
+	return provider.Getenv(r.configs)(name)
+}
+
+// cloudConfigsGetter returns the data of the peer-pods ConfigMap and Secret
+func (r *PeerPodReconciler) cloudConfigsGetter(ctx context.Context) (map[string]string, error) {
 	peerpodscm := corev1.ConfigMap{}
 	peerpodssecret := corev1.Secret{}
 	ns := os.Getenv("PEERPODS_NAMESPACE")
 	if ns == "" {
-		return fmt.Errorf("PEERPODS_NAMESPACE is not set")
+		return nil, fmt.Errorf("PEERPODS_NAMESPACE is not set")
 	}
 
+	env := make(map[string]string)
+
 	var cmErr error
-	if cmErr = r.Client.Get(context.TODO(), types.NamespacedName{Name: ppConfigMap, Namespace: ns}, &peerpodscm); cmErr == nil {
-		// set all configs as env vars to make sure all the required vars for auth are set
+	if cmErr = r.Client.Get(ctx, types.NamespacedName{Name: ppConfigMap, Namespace: ns}, &peerpodscm); cmErr == nil {
 		for k, v := range peerpodscm.Data {
-			os.Setenv(k, v)
+			env[k] = v
 		}
 	}
 
 	var secretErr error
-	if secretErr = r.Client.Get(context.TODO(), types.NamespacedName{Name: ppSecret, Namespace: ns}, &peerpodssecret); secretErr == nil {
+	if secretErr = r.Client.Get(ctx, types.NamespacedName{Name: ppSecret, Namespace: ns}, &peerpodssecret); secretErr == nil {
 		for k, v := range peerpodssecret.Data {
-			os.Setenv(k, string(v))
+			env[k] = string(v)
 		}
 	}
 
 	if peerpodscm.Data == nil && peerpodssecret.Data == nil {
-		return fmt.Errorf("ConfigMap Error: %v, Secret Error: %v", cmErr, secretErr)
+		return nil, fmt.Errorf("ConfigMap Error: %v, Secret Error: %v", cmErr, secretErr)
 	}
 
-	return nil
+	return env, nil
 }
 
+// SetProvider creates the cloud provider from the process environment
 func SetProvider() (provider.Provider, error) {
-	cloudName := os.Getenv("CLOUD_PROVIDER")
-	if cloud := provider.Get(cloudName); cloud != nil {
-		cloud.LoadEnv()
-		provider, err := cloud.NewProvider()
-		if err != nil {
-			return nil, err
-		}
-		return provider, nil
-	}
+	return newProvider(nil)
+}
 
-	return nil, fmt.Errorf("%s cloud provider not supported", cloudName)
+// newProvider creates the cloud provider named by CLOUD_PROVIDER, looking up
+// its configs in env before the process environment
+func newProvider(env map[string]string) (provider.Provider, error) {
+	cloudName := provider.Getenv(env)("CLOUD_PROVIDER")
+	return provider.NewProviderWithEnv(cloudName, env)
 }
 
 func isOldPeerPod(pp, cur confidentialcontainersorgv1alpha1.PeerPod) bool {
@@ -0,0 +1,293 @@
+/*
+Copyright Confidential Containers Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	provider "github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers"
+	"github.com/confidential-containers/cloud-api-adaptor/src/cloud-providers/util/cloudinit"
+	confidentialcontainersorgv1alpha1 "github.com/confidential-containers/cloud-api-adaptor/src/peerpod-ctrl/api/v1alpha1"
+)
+
+type mockProvider struct {
+	deleteErr error
+	deleted   []string
+	tornDown  bool
+}
+
+func (p *mockProvider) CreateInstance(ctx context.Context, podName, sandboxID string, cloudConfig cloudinit.CloudConfigGenerator, spec provider.InstanceTypeSpec) (*provider.Instance, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *mockProvider) DeleteInstance(ctx context.Context, instanceID string) error {
+	p.deleted = append(p.deleted, instanceID)
+	return p.deleteErr
+}
+
+func (p *mockProvider) Teardown() error {
+	p.tornDown = true
+	return nil
+}
+
+func (p *mockProvider) ConfigVerifier() error {
+	return nil
+}
+
+func TestDeleteBackoff(t *testing.T) {
+	r := &PeerPodReconciler{DeleteBackoff: time.Second, MaxDeleteBackoff: 10 * time.Second}
+
+	for attempts, want := range map[int32]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		4:  8 * time.Second,
+		5:  10 * time.Second,
+		40: 10 * time.Second,
+	} {
+		if got := r.deleteBackoff(attempts); got != want {
+			t.Errorf("deleteBackoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+
+	r = &PeerPodReconciler{}
+	if got := r.deleteBackoff(1); got != defaultDeleteBackoff {
+		t.Errorf("deleteBackoff(1) = %v, want %v", got, defaultDeleteBackoff)
+	}
+}
+
+func TestDeletePolicy(t *testing.T) {
+	for annotation, want := range map[string]string{
+		"":        confidentialcontainersorgv1alpha1.DeletePolicyRetry,
+		"Retry":   confidentialcontainersorgv1alpha1.DeletePolicyRetry,
+		"release": confidentialcontainersorgv1alpha1.DeletePolicyRelease,
+		"Release": confidentialcontainersorgv1alpha1.DeletePolicyRelease,
+		"unknown": confidentialcontainersorgv1alpha1.DeletePolicyRetry,
+	} {
+		pp := &confidentialcontainersorgv1alpha1.PeerPod{}
+		if annotation != "" {
+			pp.Annotations = map[string]string{confidentialcontainersorgv1alpha1.DeletePolicyAnnotation: annotation}
+		}
+		if got := deletePolicy(pp); got != want {
+			t.Errorf("deletePolicy(%q) = %q, want %q", annotation, got, want)
+		}
+	}
+}
+
+func TestReconcileDelete(t *testing.T) {
+	tests := []struct {
+		name          string
+		deleteErr     error
+		policy        string
+		attempts      int32
+		wantRequeue   bool
+		wantFinalizer bool
+		wantCleaned   bool
+		wantCondition string
+		wantEvents    int
+	}{
+		{
+			name:        "deleted",
+			wantCleaned: true,
+		},
+		{
+			name:        "not found",
+			deleteErr:   fmt.Errorf("%w: i-1", provider.ErrInstanceNotFound),
+			wantCleaned: true,
+		},
+		{
+			name:          "failure",
+			deleteErr:     errors.New("boom"),
+			wantRequeue:   true,
+			wantFinalizer: true,
+			wantEvents:    1,
+		},
+		{
+			name:          "last attempt retried",
+			deleteErr:     errors.New("boom"),
+			attempts:      2,
+			wantRequeue:   true,
+			wantFinalizer: true,
+			wantCondition: "MaxAttemptsReached",
+			wantEvents:    1,
+		},
+		{
+			name:          "last attempt released",
+			deleteErr:     errors.New("boom"),
+			policy:        confidentialcontainersorgv1alpha1.DeletePolicyRelease,
+			attempts:      2,
+			wantCondition: "FinalizerReleased",
+			wantEvents:    2,
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	if err := confidentialcontainersorgv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := metav1.Now()
+			pp := &confidentialcontainersorgv1alpha1.PeerPod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "pp",
+					Namespace: "default",
+					// Keep the object once ppFinalizer is removed to check its status
+					Finalizers:        []string{ppFinalizer, "test/keep"},
+					DeletionTimestamp: &now,
+				},
+				Spec: confidentialcontainersorgv1alpha1.PeerPodSpec{InstanceID: "i-1"},
+				Status: confidentialcontainersorgv1alpha1.PeerPodStatus{
+					DeleteAttempts: tt.attempts,
+				},
+			}
+			if tt.policy != "" {
+				pp.Annotations = map[string]string{confidentialcontainersorgv1alpha1.DeletePolicyAnnotation: tt.policy}
+			}
+			if tt.attempts > 0 {
+				// The backoff of the previous attempt is over
+				last := metav1.NewTime(now.Add(-time.Hour))
+				pp.Status.LastDeleteAttempt = &last
+			}
+
+			recorder := record.NewFakeRecorder(10)
+			cloudProvider := &mockProvider{deleteErr: tt.deleteErr}
+			r := &PeerPodReconciler{
+				Client:            fake.NewClientBuilder().WithScheme(scheme).WithObjects(pp).Build(),
+				Scheme:            scheme,
+				Provider:          cloudProvider,
+				Recorder:          recorder,
+				DeleteBackoff:     time.Second,
+				MaxDeleteBackoff:  time.Minute,
+				MaxDeleteAttempts: 3,
+			}
+
+			key := types.NamespacedName{Name: pp.Name, Namespace: pp.Namespace}
+			result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if (result.RequeueAfter > 0) != tt.wantRequeue {
+				t.Errorf("Reconcile() = %+v, wantRequeue %v", result, tt.wantRequeue)
+			}
+			if len(cloudProvider.deleted) != 1 {
+				t.Errorf("DeleteInstance called %d times, want 1", len(cloudProvider.deleted))
+			}
+			if len(recorder.Events) != tt.wantEvents {
+				t.Errorf("recorded %d events, want %d", len(recorder.Events), tt.wantEvents)
+			}
+
+			got := &confidentialcontainersorgv1alpha1.PeerPod{}
+			if err := r.Get(context.Background(), key, got); err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if controllerutil.ContainsFinalizer(got, ppFinalizer) != tt.wantFinalizer {
+				t.Errorf("finalizers = %v, wantFinalizer %v", got.Finalizers, tt.wantFinalizer)
+			}
+			if got.Status.Cleaned != tt.wantCleaned {
+				t.Errorf("Cleaned = %v, want %v", got.Status.Cleaned, tt.wantCleaned)
+			}
+			if tt.deleteErr != nil && !tt.wantCleaned && got.Status.DeleteAttempts != tt.attempts+1 {
+				t.Errorf("DeleteAttempts = %d, want %d", got.Status.DeleteAttempts, tt.attempts+1)
+			}
+
+			cond := meta.FindStatusCondition(got.Status.Conditions, confidentialcontainersorgv1alpha1.DeletionFailed)
+			if tt.wantCondition == "" {
+				if cond != nil {
+					t.Errorf("unexpected condition %+v", cond)
+				}
+			} else if cond == nil || cond.Reason != tt.wantCondition {
+				t.Errorf("condition = %+v, want reason %q", cond, tt.wantCondition)
+			}
+
+			// A reconcile within the backoff does not retry the deletion
+			if tt.wantRequeue {
+				result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+				if err != nil || result.RequeueAfter <= 0 {
+					t.Errorf("Reconcile() = %+v, %v, want a requeue", result, err)
+				}
+				if len(cloudProvider.deleted) != 1 {
+					t.Errorf("DeleteInstance retried within the backoff")
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileDeleteProfile(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := confidentialcontainersorgv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	now := metav1.Now()
+	pp := &confidentialcontainersorgv1alpha1.PeerPod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "pp",
+			Namespace:         "default",
+			Finalizers:        []string{ppFinalizer, "test/keep"},
+			DeletionTimestamp: &now,
+		},
+		Spec: confidentialcontainersorgv1alpha1.PeerPodSpec{InstanceID: "i-1", Profile: "east"},
+	}
+
+	defaultProvider, eastProvider := &mockProvider{}, &mockProvider{}
+	r := &PeerPodReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(pp).Build(),
+		Scheme:   scheme,
+		Provider: defaultProvider,
+		Recorder: record.NewFakeRecorder(10),
+		profiles: provider.NewProfiles(defaultProvider),
+	}
+	r.profiles.Set("east", eastProvider)
+
+	key := types.NamespacedName{Name: pp.Name, Namespace: pp.Namespace}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(eastProvider.deleted) != 1 || len(defaultProvider.deleted) != 0 {
+		t.Errorf("instance deleted by the default provider %v, by the profile provider %v", defaultProvider.deleted, eastProvider.deleted)
+	}
+
+	// A PeerPod of a profile that is no longer configured is retried
+	pp = &confidentialcontainersorgv1alpha1.PeerPod{}
+	if err := r.Get(context.Background(), key, pp); err != nil {
+		t.Fatal(err)
+	}
+	pp.Finalizers = []string{ppFinalizer, "test/keep"}
+	pp.Spec.Profile = "west"
+	pp.Status.Cleaned = false
+	if err := r.Update(context.Background(), pp); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); !errors.Is(err, provider.ErrUnknownProfile) {
+		t.Errorf("Reconcile() error = %v, want ErrUnknownProfile", err)
+	}
+}
@@ -19,6 +19,7 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -27,6 +28,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -54,11 +56,39 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var orphanGCInterval time.Duration
+	var orphanGCGracePeriod time.Duration
+	var orphanGCDryRun bool
+	var capacityInterval time.Duration
+	var capacityMaxPerNode int64
+	var deleteBackoff time.Duration
+	var deleteMaxBackoff time.Duration
+	var deleteMaxAttempts int
+	var profilesDir string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&orphanGCInterval, "orphan-gc-interval", 0,
+		"Interval at which to look for orphaned pod VMs. Zero disables the garbage collector. "+
+			"Requires PEERPODS_CLUSTER_ID and is not supported by the ibmcloud-powervs and docker providers.")
+	flag.DurationVar(&orphanGCGracePeriod, "orphan-gc-grace-period", 15*time.Minute,
+		"Minimum age of a pod VM before it is considered orphaned.")
+	flag.BoolVar(&orphanGCDryRun, "orphan-gc-dry-run", false,
+		"Only report orphaned pod VMs instead of deleting them.")
+	flag.DurationVar(&capacityInterval, "capacity-interval", 0,
+		"Interval at which to recompute the peer pods capacity of the nodes from the cloud quota. Zero disables it.")
+	flag.Int64Var(&capacityMaxPerNode, "capacity-max-per-node", 0,
+		"Maximum peer pods capacity of a node. Zero means no maximum.")
+	flag.DurationVar(&deleteBackoff, "delete-backoff", 10*time.Second,
+		"Delay before retrying a failed pod VM deletion, doubled after each failure.")
+	flag.DurationVar(&deleteMaxBackoff, "delete-max-backoff", 10*time.Minute,
+		"Maximum delay between pod VM deletion attempts.")
+	flag.IntVar(&deleteMaxAttempts, "delete-max-attempts", 10,
+		"Number of failed pod VM deletions after which the delete policy of the PeerPod applies.")
+	flag.StringVar(&profilesDir, "provider-profiles-dir", os.Getenv("PROVIDER_PROFILES_DIR"),
+		"Directory with a subdirectory of configs per provider profile, to delete the pod VMs created with them.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -101,14 +131,70 @@ func main() {
 		setupLog.Info("unable to set provider at init, will retry at reconcile", "error", err)
 	}
 
-	if err = (&controllers.PeerPodReconciler{
+	reconciler := &controllers.PeerPodReconciler{
 		Client:   mgr.GetClient(),
 		Scheme:   mgr.GetScheme(),
 		Provider: provider,
-	}).SetupWithManager(mgr); err != nil {
+		Recorder: mgr.GetEventRecorderFor("peerpod-ctrl"),
+
+		DeleteBackoff:     deleteBackoff,
+		MaxDeleteBackoff:  deleteMaxBackoff,
+		MaxDeleteAttempts: int32(deleteMaxAttempts),
+		ProfilesDir:       profilesDir,
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PeerPod")
 		os.Exit(1)
 	}
+
+	if ns := os.Getenv("PEERPODS_NAMESPACE"); ns != "" {
+		clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+		if err != nil {
+			setupLog.Error(err, "unable to create clientset")
+			os.Exit(1)
+		}
+		if err = mgr.Add(&controllers.ConfigWatcher{
+			Clientset:  clientset,
+			Namespace:  ns,
+			Reconciler: reconciler,
+		}); err != nil {
+			setupLog.Error(err, "unable to add cloud provider config watcher")
+			os.Exit(1)
+		}
+	}
+
+	if profilesDir != "" {
+		if err = mgr.Add(&controllers.ProfilesWatcher{Reconciler: reconciler}); err != nil {
+			setupLog.Error(err, "unable to add provider profiles watcher")
+			os.Exit(1)
+		}
+	}
+
+	if orphanGCInterval > 0 {
+		if err = mgr.Add(&controllers.OrphanCollector{
+			Client:      mgr.GetClient(),
+			Reconciler:  reconciler,
+			Interval:    orphanGCInterval,
+			GracePeriod: orphanGCGracePeriod,
+			DryRun:      orphanGCDryRun,
+		}); err != nil {
+			setupLog.Error(err, "unable to add orphaned instance collector")
+			os.Exit(1)
+		}
+	}
+
+	if capacityInterval > 0 {
+		if err = mgr.Add(&controllers.CapacityUpdater{
+			Client:     mgr.GetClient(),
+			APIReader:  mgr.GetAPIReader(),
+			Reconciler: reconciler,
+			Interval:   capacityInterval,
+			MaxPerNode: capacityMaxPerNode,
+		}); err != nil {
+			setupLog.Error(err, "unable to add peer pods capacity updater")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -42,6 +43,183 @@ type PeerPodConfigSpec struct {
 	// ConfigMapName is the name of the configmap that holds cloud provider specific environment Variables
 	// +kubebuilder:default:=peer-pods-cm
 	ConfigMapName string `json:"configMapName"`
+
+	// Images overrides the container images of the components
+	// +optional
+	Images ComponentImages `json:"images,omitempty"`
+
+	// CloudAPIAdaptor sets cloud-api-adaptor options, they take precedence
+	// over the ones of ConfigMapName
+	// +optional
+	CloudAPIAdaptor CloudAPIAdaptorSpec `json:"cloudApiAdaptor,omitempty"`
+
+	// Webhook deploys the peer pods mutating webhook when set
+	// +optional
+	Webhook *WebhookSpec `json:"webhook,omitempty"`
+
+	// PeerPodController deploys peerpod-ctrl when set
+	// +optional
+	PeerPodController *PeerPodControllerSpec `json:"peerpodController,omitempty"`
+
+	// RuntimeClass creates the RuntimeClass of peer pods when set
+	// +optional
+	RuntimeClass *RuntimeClassSpec `json:"runtimeClass,omitempty"`
+
+	// CSIWrapper adds the csi-wrapper containers to a CSI driver when set
+	// +optional
+	CSIWrapper *CSIWrapperSpec `json:"csiWrapper,omitempty"`
+}
+
+// ComponentImages are the container images of the components, the defaults
+// are used for the empty ones
+type ComponentImages struct {
+	// CloudAPIAdaptor is the cloud-api-adaptor image, it defaults to the
+	// RELATED_IMAGE_CAA environment variable of the controller
+	// +optional
+	CloudAPIAdaptor string `json:"cloudApiAdaptor,omitempty"`
+
+	// Webhook is the peer pods webhook image
+	// +optional
+	Webhook string `json:"webhook,omitempty"`
+
+	// PeerPodController is the peerpod-ctrl image
+	// +optional
+	PeerPodController string `json:"peerpodController,omitempty"`
+
+	// CSIControllerWrapper is the csi-controller-wrapper image
+	// +optional
+	CSIControllerWrapper string `json:"csiControllerWrapper,omitempty"`
+
+	// CSINodeWrapper is the csi-node-wrapper image
+	// +optional
+	CSINodeWrapper string `json:"csiNodeWrapper,omitempty"`
+}
+
+// CloudAPIAdaptorSpec are the cloud-api-adaptor options that are not specific
+// to a cloud provider. Unset options keep the value of the ConfigMap.
+type CloudAPIAdaptorSpec struct {
+	// PauseImage is the pause image of the pod VMs
+	// +optional
+	PauseImage string `json:"pauseImage,omitempty"`
+
+	// ProxyTimeout is the maximum time to establish the agent proxy connection
+	// +optional
+	ProxyTimeout *metav1.Duration `json:"proxyTimeout,omitempty"`
+
+	// ForwarderPort is the port of the agent protocol forwarder
+	// +optional
+	ForwarderPort int32 `json:"forwarderPort,omitempty"`
+
+	// VXLANPort is the UDP port of the VXLAN tunnels
+	// +optional
+	VXLANPort int32 `json:"vxlanPort,omitempty"`
+
+	// AAKBCParams are the attestation-agent KBC parameters
+	// +optional
+	AAKBCParams string `json:"aaKbcParams,omitempty"`
+
+	// CloudConfigVerify enables the verification of the cloud config
+	// +optional
+	CloudConfigVerify *bool `json:"cloudConfigVerify,omitempty"`
+
+	// SecureComms uses SSH to secure the communication with the pod VMs
+	// +optional
+	SecureComms *bool `json:"secureComms,omitempty"`
+
+	// SecureCommsInbounds are the inbound tags of the secure comms tunnels
+	// +optional
+	SecureCommsInbounds string `json:"secureCommsInbounds,omitempty"`
+
+	// SecureCommsOutbounds are the outbound tags of the secure comms tunnels
+	// +optional
+	SecureCommsOutbounds string `json:"secureCommsOutbounds,omitempty"`
+
+	// SecureCommsKBSAddr is the address of the KBS service for secure comms
+	// +optional
+	SecureCommsKBSAddr string `json:"secureCommsKbsAddr,omitempty"`
+
+	// PodTags tags the pod VMs with the pod namespace, name and owner
+	// +optional
+	PodTags *bool `json:"podTags,omitempty"`
+
+	// PodTagLabels are the pod labels added to the pod VM tags
+	// +optional
+	PodTagLabels []string `json:"podTagLabels,omitempty"`
+
+	// PodTagAnnotations are the pod annotations added to the pod VM tags
+	// +optional
+	PodTagAnnotations []string `json:"podTagAnnotations,omitempty"`
+
+	// AgentConfigAnnotations are the agent options that pods may set with annotations
+	// +optional
+	AgentConfigAnnotations []string `json:"agentConfigAnnotations,omitempty"`
+
+	// RegistryAuthFallback provides the node-wide registry auth.json to the
+	// pod VMs of pods without pull secrets. Disabled by default
+	// +optional
+	RegistryAuthFallback *bool `json:"registryAuthFallback,omitempty"`
+}
+
+// WebhookSpec configures the peer pods mutating webhook. Its serving
+// certificate is generated and renewed by the controller.
+type WebhookSpec struct {
+	// Replicas is the number of webhook pods
+	// +kubebuilder:default:=2
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+}
+
+// PeerPodControllerSpec configures peerpod-ctrl
+type PeerPodControllerSpec struct {
+	// OrphanGCInterval enables the garbage collection of orphaned pod VMs
+	// +optional
+	OrphanGCInterval *metav1.Duration `json:"orphanGcInterval,omitempty"`
+
+	// CapacityInterval enables the periodic update of the peer pods capacity
+	// of the nodes from the cloud quota and the running peer pods. Limit is
+	// then the maximum capacity of a node.
+	// +optional
+	CapacityInterval *metav1.Duration `json:"capacityInterval,omitempty"`
+}
+
+// RuntimeClassSpec configures the RuntimeClass of peer pods
+type RuntimeClassSpec struct {
+	// Name is the name of the RuntimeClass
+	// +kubebuilder:default:=kata-remote
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Handler is the kata runtime handler
+	// +kubebuilder:default:=kata-remote
+	// +optional
+	Handler string `json:"handler,omitempty"`
+
+	// Overhead is the pod overhead, the resources of the pod on the node
+	// +optional
+	Overhead corev1.ResourceList `json:"overhead,omitempty"`
+}
+
+// CSIWrapperSpec selects the CSI driver to which the csi-wrapper containers
+// are added
+type CSIWrapperSpec struct {
+	// Namespace is the namespace of the CSI driver
+	// +kubebuilder:default:=kube-system
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// DriverName is the name of the CSI driver, e.g. file.csi.azure.com
+	DriverName string `json:"driverName"`
+
+	// ControllerDeployment is the name of the Deployment of the CSI controller plugin
+	ControllerDeployment string `json:"controllerDeployment"`
+
+	// NodeDaemonSet is the name of the DaemonSet of the CSI node plugin
+	NodeDaemonSet string `json:"nodeDaemonSet"`
+
+	// SocketVolume is the name of the volume holding the CSI socket
+	// +kubebuilder:default:=socket-dir
+	// +optional
+	SocketVolume string `json:"socketVolume,omitempty"`
 }
 
 // PeerPodConfigStatus defines the observed state of PeerPodConfig
@@ -51,8 +229,44 @@ type PeerPodConfigStatus struct {
 
 	// SetupCompleted is set to true when all components have been deployed/created
 	SetupCompleted bool `json:"setupCompleted,omitempty"`
+
+	// Nodes reports the advertisement of the peer pods extended resource on
+	// each selected node
+	// +optional
+	Nodes []NodeAdvertisement `json:"nodes,omitempty"`
+
+	// Conditions are the ResourcesAdvertised, CAAReady and ComponentsReady conditions
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// NodeAdvertisement is the state of the peer pods extended resource on a node
+type NodeAdvertisement struct {
+	// Name is the name of the node
+	Name string `json:"name"`
+
+	// Advertised is true once the node capacity includes the extended resource
+	Advertised bool `json:"advertised"`
+
+	// Message is the error of the last failed advertisement
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// Condition types of a PeerPodConfig
+const (
+	// ResourcesAdvertised is true once all the selected nodes advertise the
+	// peer pods extended resource
+	ResourcesAdvertised = "ResourcesAdvertised"
+	// CAAReady is true once the cloud-api-adaptor DaemonSet is rolled out
+	CAAReady = "CAAReady"
+	// ComponentsReady is true once the optional components are deployed and
+	// their Deployments are available
+	ComponentsReady = "ComponentsReady"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 
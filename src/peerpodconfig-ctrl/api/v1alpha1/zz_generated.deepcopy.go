@@ -21,16 +21,118 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CSIWrapperSpec) DeepCopyInto(out *CSIWrapperSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CSIWrapperSpec.
+func (in *CSIWrapperSpec) DeepCopy() *CSIWrapperSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CSIWrapperSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudAPIAdaptorSpec) DeepCopyInto(out *CloudAPIAdaptorSpec) {
+	*out = *in
+	if in.ProxyTimeout != nil {
+		in, out := &in.ProxyTimeout, &out.ProxyTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.CloudConfigVerify != nil {
+		in, out := &in.CloudConfigVerify, &out.CloudConfigVerify
+		*out = new(bool)
+		**out = **in
+	}
+	if in.SecureComms != nil {
+		in, out := &in.SecureComms, &out.SecureComms
+		*out = new(bool)
+		**out = **in
+	}
+	if in.PodTags != nil {
+		in, out := &in.PodTags, &out.PodTags
+		*out = new(bool)
+		**out = **in
+	}
+	if in.PodTagLabels != nil {
+		in, out := &in.PodTagLabels, &out.PodTagLabels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PodTagAnnotations != nil {
+		in, out := &in.PodTagAnnotations, &out.PodTagAnnotations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AgentConfigAnnotations != nil {
+		in, out := &in.AgentConfigAnnotations, &out.AgentConfigAnnotations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RegistryAuthFallback != nil {
+		in, out := &in.RegistryAuthFallback, &out.RegistryAuthFallback
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudAPIAdaptorSpec.
+func (in *CloudAPIAdaptorSpec) DeepCopy() *CloudAPIAdaptorSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudAPIAdaptorSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComponentImages) DeepCopyInto(out *ComponentImages) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentImages.
+func (in *ComponentImages) DeepCopy() *ComponentImages {
+	if in == nil {
+		return nil
+	}
+	out := new(ComponentImages)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeAdvertisement) DeepCopyInto(out *NodeAdvertisement) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeAdvertisement.
+func (in *NodeAdvertisement) DeepCopy() *NodeAdvertisement {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeAdvertisement)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PeerPodConfig) DeepCopyInto(out *PeerPodConfig) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeerPodConfig.
@@ -93,6 +195,28 @@ func (in *PeerPodConfigSpec) DeepCopyInto(out *PeerPodConfigSpec) {
 			(*out)[key] = val
 		}
 	}
+	out.Images = in.Images
+	in.CloudAPIAdaptor.DeepCopyInto(&out.CloudAPIAdaptor)
+	if in.Webhook != nil {
+		in, out := &in.Webhook, &out.Webhook
+		*out = new(WebhookSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PeerPodController != nil {
+		in, out := &in.PeerPodController, &out.PeerPodController
+		*out = new(PeerPodControllerSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RuntimeClass != nil {
+		in, out := &in.RuntimeClass, &out.RuntimeClass
+		*out = new(RuntimeClassSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CSIWrapper != nil {
+		in, out := &in.CSIWrapper, &out.CSIWrapper
+		*out = new(CSIWrapperSpec)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeerPodConfigSpec.
@@ -108,6 +232,18 @@ func (in *PeerPodConfigSpec) DeepCopy() *PeerPodConfigSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PeerPodConfigStatus) DeepCopyInto(out *PeerPodConfigStatus) {
 	*out = *in
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]NodeAdvertisement, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeerPodConfigStatus.
@@ -119,3 +255,70 @@ func (in *PeerPodConfigStatus) DeepCopy() *PeerPodConfigStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PeerPodControllerSpec) DeepCopyInto(out *PeerPodControllerSpec) {
+	*out = *in
+	if in.OrphanGCInterval != nil {
+		in, out := &in.OrphanGCInterval, &out.OrphanGCInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.CapacityInterval != nil {
+		in, out := &in.CapacityInterval, &out.CapacityInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeerPodControllerSpec.
+func (in *PeerPodControllerSpec) DeepCopy() *PeerPodControllerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PeerPodControllerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RuntimeClassSpec) DeepCopyInto(out *RuntimeClassSpec) {
+	*out = *in
+	if in.Overhead != nil {
+		in, out := &in.Overhead, &out.Overhead
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RuntimeClassSpec.
+func (in *RuntimeClassSpec) DeepCopy() *RuntimeClassSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RuntimeClassSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookSpec) DeepCopyInto(out *WebhookSpec) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookSpec.
+func (in *WebhookSpec) DeepCopy() *WebhookSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookSpec)
+	in.DeepCopyInto(out)
+	return out
+}
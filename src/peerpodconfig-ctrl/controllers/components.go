@@ -0,0 +1,843 @@
+/*
+Copyright Confidential Containers Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	ccv1alpha1 "github.com/confidential-containers/cloud-api-adaptor/src/peerpodconfig-ctrl/api/v1alpha1"
+)
+
+const (
+	// Names of the env vars overriding the default images of the components
+	WebhookImageEnvName              = "RELATED_IMAGE_WEBHOOK"
+	PeerPodCtrlImageEnvName          = "RELATED_IMAGE_PEERPOD_CTRL"
+	CSIControllerWrapperImageEnvName = "RELATED_IMAGE_CSI_CONTROLLER_WRAPPER"
+	CSINodeWrapperImageEnvName       = "RELATED_IMAGE_CSI_NODE_WRAPPER"
+
+	DefaultWebhookImage              = "quay.io/confidential-containers/peer-pods-webhook:latest"
+	DefaultPeerPodCtrlImage          = "quay.io/confidential-containers/peerpod-ctrl:latest"
+	DefaultCSIControllerWrapperImage = "quay.io/confidential-containers/csi-controller-wrapper:latest"
+	DefaultCSINodeWrapperImage       = "quay.io/confidential-containers/csi-node-wrapper:latest"
+
+	// Webhook objects, the ClusterRole is deployed along with the controller
+	webhookName           = "peerpodconfig-ctrl-webhook"
+	webhookRoleName       = "peerpodconfig-ctrl-webhook-role"
+	webhookCertSecretName = "peerpodconfig-ctrl-webhook-cert"
+	webhookConfigName     = "peerpodconfig-ctrl-mutating-webhook-configuration"
+	validatingConfigName  = "peerpodconfig-ctrl-validating-webhook-configuration"
+	// webhookPoliciesConfigMapName is created by the user to set the policies
+	// of several peer pods RuntimeClasses
+	webhookPoliciesConfigMapName = "peer-pods-webhook-policies"
+
+	// peerpod-ctrl objects, the ClusterRole is deployed along with the controller
+	peerPodCtrlName     = "peerpodconfig-ctrl-peerpod-ctrl"
+	peerPodCtrlRoleName = "peerpodconfig-ctrl-peerpod-ctrl-role"
+
+	defaultRuntimeClassName = "kata-remote"
+
+	csiControllerWrapperName = "csi-controller-wrapper"
+	csiNodeWrapperName       = "csi-node-wrapper"
+	csiControllerWrapperSock = "/csi/csi-controller-wrapper.sock"
+	csiNodeWrapperSock       = "/csi/csi-node-wrapper.sock"
+
+	// managedByLabel marks the cluster scoped objects created by the
+	// controller, which can't be owned by the PeerPodConfig
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedBy      = "peerpodconfig-ctrl"
+
+	// Delay before checking the webhook certificate for renewal again
+	componentsResyncInterval = 24 * time.Hour
+)
+
+// componentImage returns the image set in the PeerPodConfig, or the one of
+// the env var envName, or defaultImage
+func componentImage(image, envName, defaultImage string) string {
+	if image != "" {
+		return image
+	}
+	if image = os.Getenv(envName); image != "" {
+		return image
+	}
+	return defaultImage
+}
+
+// caaEnv returns the environment of the cloud-api-adaptor container for the
+// options set in spec, as read by its entrypoint
+func caaEnv(spec *ccv1alpha1.CloudAPIAdaptorSpec) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	add := func(name, value string) {
+		if value != "" {
+			env = append(env, corev1.EnvVar{Name: name, Value: value})
+		}
+	}
+	addBool := func(name string, value *bool) {
+		if value != nil {
+			add(name, strconv.FormatBool(*value))
+		}
+	}
+	addInt := func(name string, value int32) {
+		if value != 0 {
+			add(name, strconv.Itoa(int(value)))
+		}
+	}
+
+	add("PAUSE_IMAGE", spec.PauseImage)
+	if spec.ProxyTimeout != nil {
+		add("PROXY_TIMEOUT", spec.ProxyTimeout.Duration.String())
+	}
+	addInt("FORWARDER_PORT", spec.ForwarderPort)
+	addInt("VXLAN_PORT", spec.VXLANPort)
+	add("AA_KBC_PARAMS", spec.AAKBCParams)
+	addBool("CLOUD_CONFIG_VERIFY", spec.CloudConfigVerify)
+	addBool("SECURE_COMMS", spec.SecureComms)
+	add("SECURE_COMMS_INBOUNDS", spec.SecureCommsInbounds)
+	add("SECURE_COMMS_OUTBOUNDS", spec.SecureCommsOutbounds)
+	add("SECURE_COMMS_KBS_ADDR", spec.SecureCommsKBSAddr)
+	addBool("POD_TAGS", spec.PodTags)
+	add("POD_TAG_LABELS", strings.Join(spec.PodTagLabels, ","))
+	add("POD_TAG_ANNOTATIONS", strings.Join(spec.PodTagAnnotations, ","))
+	add("AGENT_CONFIG_ANNOTATIONS", strings.Join(spec.AgentConfigAnnotations, ","))
+	addBool("REGISTRY_AUTH_FALLBACK", spec.RegistryAuthFallback)
+	return env
+}
+
+// reconcileComponents deploys the optional components enabled in the
+// PeerPodConfig and removes the disabled ones. It returns the names of the
+// components that are not ready yet.
+func (r *PeerPodConfigReconciler) reconcileComponents(ctx context.Context) ([]string, error) {
+	var notReady []string
+	components := []struct {
+		name      string
+		reconcile func(context.Context) (bool, error)
+	}{
+		{"runtimeclass", r.reconcileRuntimeClass},
+		{"webhook", r.reconcileWebhook},
+		{"peerpod-ctrl", r.reconcilePeerPodCtrl},
+		{"csi-wrapper", r.reconcileCSIWrapper},
+	}
+	for _, component := range components {
+		ready, err := component.reconcile(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("reconciling %s: %w", component.name, err)
+		}
+		if !ready {
+			notReady = append(notReady, component.name)
+		}
+	}
+	return notReady, nil
+}
+
+// deleteComponents deletes the cluster scoped objects of the components, the
+// namespaced ones are owned by the PeerPodConfig
+func (r *PeerPodConfigReconciler) deleteComponents(ctx context.Context) error {
+	if err := r.deleteRuntimeClasses(ctx, ""); err != nil {
+		return err
+	}
+	return r.deleteObjects(ctx,
+		&admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: webhookConfigName}},
+		&admissionregistrationv1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: validatingConfigName}},
+		&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: webhookName}},
+		&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: peerPodCtrlName}},
+	)
+}
+
+// apply creates or updates obj as set by mutate. Namespaced objects are owned
+// by the PeerPodConfig, cluster scoped ones get the managedByLabel.
+func (r *PeerPodConfigReconciler) apply(ctx context.Context, obj client.Object, mutate func() error) error {
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, obj, func() error {
+		if err := mutate(); err != nil {
+			return err
+		}
+		if obj.GetNamespace() != "" {
+			return controllerutil.SetControllerReference(r.peerPodConfig, obj, r.Scheme)
+		}
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[managedByLabel] = managedBy
+		obj.SetLabels(labels)
+		return nil
+	})
+	return err
+}
+
+func (r *PeerPodConfigReconciler) deleteObjects(ctx context.Context, objs ...client.Object) error {
+	for _, obj := range objs {
+		if err := r.Client.Delete(ctx, obj); err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("deleting %s: %w", obj.GetName(), err)
+		}
+	}
+	return nil
+}
+
+func runtimeClassName(config *ccv1alpha1.PeerPodConfig) string {
+	if config.Spec.RuntimeClass != nil && config.Spec.RuntimeClass.Name != "" {
+		return config.Spec.RuntimeClass.Name
+	}
+	return defaultRuntimeClassName
+}
+
+// reconcileRuntimeClass creates the RuntimeClass of peer pods, which schedules
+// them on the nodes running the cloud-api-adaptor
+func (r *PeerPodConfigReconciler) reconcileRuntimeClass(ctx context.Context) (bool, error) {
+	spec := r.peerPodConfig.Spec.RuntimeClass
+	if spec == nil {
+		return true, r.deleteRuntimeClasses(ctx, "")
+	}
+
+	name := runtimeClassName(r.peerPodConfig)
+	handler := spec.Handler
+	if handler == "" {
+		handler = defaultRuntimeClassName
+	}
+	overhead := spec.Overhead
+	if overhead == nil {
+		overhead = corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("250m"),
+			corev1.ResourceMemory: resource.MustParse("120Mi"),
+		}
+	}
+
+	rc := &nodev1.RuntimeClass{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	err := r.apply(ctx, rc, func() error {
+		rc.Handler = handler
+		rc.Overhead = &nodev1.Overhead{PodFixed: overhead}
+		rc.Scheduling = &nodev1.Scheduling{NodeSelector: nodeSelectorOf(r.peerPodConfig)}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	// Remove the RuntimeClass of a previous name
+	return true, r.deleteRuntimeClasses(ctx, name)
+}
+
+// deleteRuntimeClasses deletes the RuntimeClasses created by the controller
+// but the one named keep
+func (r *PeerPodConfigReconciler) deleteRuntimeClasses(ctx context.Context, keep string) error {
+	list := &nodev1.RuntimeClassList{}
+	if err := r.Client.List(ctx, list, client.MatchingLabels{managedByLabel: managedBy}); err != nil {
+		return err
+	}
+	for i := range list.Items {
+		if list.Items[i].Name == keep {
+			continue
+		}
+		if err := r.deleteObjects(ctx, &list.Items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func webhookDNSNames(namespace string) []string {
+	return []string{
+		fmt.Sprintf("%s.%s.svc", webhookName, namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", webhookName, namespace),
+	}
+}
+
+// reconcileWebhook deploys the peer pods mutating and validating webhooks
+// along with their serving certificate
+func (r *PeerPodConfigReconciler) reconcileWebhook(ctx context.Context) (bool, error) {
+	namespace := os.Getenv("PEERPODS_NAMESPACE")
+	meta := metav1.ObjectMeta{Name: webhookName, Namespace: namespace}
+	if r.peerPodConfig.Spec.Webhook == nil {
+		return true, r.deleteObjects(ctx,
+			&admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: webhookConfigName}},
+			&admissionregistrationv1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: validatingConfigName}},
+			&appsv1.Deployment{ObjectMeta: meta},
+			&corev1.Service{ObjectMeta: meta},
+			&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: webhookName}},
+			&corev1.ServiceAccount{ObjectMeta: meta},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: webhookCertSecretName, Namespace: namespace}},
+		)
+	}
+
+	caBundle, err := r.reconcileWebhookCert(ctx, namespace)
+	if err != nil {
+		return false, err
+	}
+	if err := r.reconcileServiceAccount(ctx, meta, webhookRoleName); err != nil {
+		return false, err
+	}
+
+	service := &corev1.Service{ObjectMeta: meta}
+	err = r.apply(ctx, service, func() error {
+		service.Spec.Selector = map[string]string{"app": webhookName}
+		service.Spec.Ports = []corev1.ServicePort{{
+			Port:       443,
+			Protocol:   corev1.ProtocolTCP,
+			TargetPort: intstr.FromInt(9443),
+		}}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	deployment := &appsv1.Deployment{ObjectMeta: meta}
+	err = r.apply(ctx, deployment, func() error {
+		deployment.Spec = r.webhookDeploymentSpec()
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	webhookConfig := &admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: webhookConfigName}}
+	err = r.apply(ctx, webhookConfig, func() error {
+		webhookConfig.Webhooks = mutatingWebhooks(namespace, caBundle)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	validatingConfig := &admissionregistrationv1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: validatingConfigName}}
+	err = r.apply(ctx, validatingConfig, func() error {
+		validatingConfig.Webhooks = validatingWebhooks(namespace, caBundle)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return deploymentAvailable(deployment), nil
+}
+
+// reconcileWebhookCert generates the webhook serving certificate, or renews
+// it, and returns its CA bundle
+func (r *PeerPodConfigReconciler) reconcileWebhookCert(ctx context.Context, namespace string) ([]byte, error) {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: webhookCertSecretName, Namespace: namespace}}
+	err := r.apply(ctx, secret, func() error {
+		dnsNames := webhookDNSNames(namespace)
+		if !webhookCertNeedsRenewal(secret.Data, dnsNames, time.Now()) {
+			return nil
+		}
+		caPEM, certPEM, keyPEM, err := newWebhookCert(dnsNames, time.Now())
+		if err != nil {
+			return err
+		}
+		r.Log.Info("generated the webhook serving certificate", "secret", webhookCertSecretName)
+		if secret.CreationTimestamp.IsZero() {
+			secret.Type = corev1.SecretTypeTLS
+		}
+		secret.Data = map[string][]byte{
+			caCertKey:               caPEM,
+			corev1.TLSCertKey:       certPEM,
+			corev1.TLSPrivateKeyKey: keyPEM,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return secret.Data[caCertKey], nil
+}
+
+func mutatingWebhooks(namespace string, caBundle []byte) []admissionregistrationv1.MutatingWebhook {
+	var (
+		failurePolicy = admissionregistrationv1.Fail
+		sideEffects   = admissionregistrationv1.SideEffectClassNone
+	)
+	return []admissionregistrationv1.MutatingWebhook{{
+		Name:                    "mwebhook.peerpods.io",
+		AdmissionReviewVersions: []string{"v1"},
+		ClientConfig:            webhookClientConfig(namespace, "/mutate-v1-pod", caBundle),
+		FailurePolicy:           &failurePolicy,
+		SideEffects:             &sideEffects,
+		Rules:                   webhookPodRules(admissionregistrationv1.Create, admissionregistrationv1.Update),
+		NamespaceSelector:       webhookNamespaceSelector(namespace),
+	}}
+}
+
+// validatingWebhooks reject the peer pods whose pod VM can't be created,
+// according to the catalog published by the cloud-api-adaptor
+func validatingWebhooks(namespace string, caBundle []byte) []admissionregistrationv1.ValidatingWebhook {
+	var (
+		failurePolicy = admissionregistrationv1.Fail
+		sideEffects   = admissionregistrationv1.SideEffectClassNone
+	)
+	return []admissionregistrationv1.ValidatingWebhook{{
+		Name:                    "vwebhook.peerpods.io",
+		AdmissionReviewVersions: []string{"v1"},
+		ClientConfig:            webhookClientConfig(namespace, "/validate-v1-pod", caBundle),
+		FailurePolicy:           &failurePolicy,
+		SideEffects:             &sideEffects,
+		Rules:                   webhookPodRules(admissionregistrationv1.Create),
+		NamespaceSelector:       webhookNamespaceSelector(namespace),
+	}}
+}
+
+func webhookClientConfig(namespace, path string, caBundle []byte) admissionregistrationv1.WebhookClientConfig {
+	return admissionregistrationv1.WebhookClientConfig{
+		Service: &admissionregistrationv1.ServiceReference{
+			Name:      webhookName,
+			Namespace: namespace,
+			Path:      &path,
+		},
+		CABundle: caBundle,
+	}
+}
+
+func webhookPodRules(operations ...admissionregistrationv1.OperationType) []admissionregistrationv1.RuleWithOperations {
+	scope := admissionregistrationv1.NamespacedScope
+	return []admissionregistrationv1.RuleWithOperations{{
+		Operations: operations,
+		Rule: admissionregistrationv1.Rule{
+			APIGroups:   []string{""},
+			APIVersions: []string{"v1"},
+			Resources:   []string{"pods"},
+			Scope:       &scope,
+		},
+	}}
+}
+
+// webhookNamespaceSelector excludes the pods of the webhook itself and of
+// kube-system
+func webhookNamespaceSelector(namespace string) *metav1.LabelSelector {
+	return &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{
+			Key:      "kubernetes.io/metadata.name",
+			Operator: metav1.LabelSelectorOpNotIn,
+			Values:   []string{namespace, "kube-system"},
+		}},
+	}
+}
+
+func (r *PeerPodConfigReconciler) webhookDeploymentSpec() appsv1.DeploymentSpec {
+	var (
+		labels       = map[string]string{"app": webhookName}
+		runAsNonRoot = true
+		noEscalation = false
+		certMode     = int32(0420)
+		optional     = true
+	)
+	return appsv1.DeploymentSpec{
+		Replicas: r.peerPodConfig.Spec.Webhook.Replicas,
+		Selector: &metav1.LabelSelector{MatchLabels: labels},
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: labels},
+			Spec: corev1.PodSpec{
+				ServiceAccountName: webhookName,
+				SecurityContext:    &corev1.PodSecurityContext{RunAsNonRoot: &runAsNonRoot},
+				Containers: []corev1.Container{{
+					Name:    "manager",
+					Image:   componentImage(r.peerPodConfig.Spec.Images.Webhook, WebhookImageEnvName, DefaultWebhookImage),
+					Command: []string{"/manager"},
+					Env: []corev1.EnvVar{
+						{Name: "TARGET_RUNTIMECLASS", Value: runtimeClassName(r.peerPodConfig)},
+						{Name: "POD_VM_EXTENDED_RESOURCE", Value: peerPodsExtendedResource},
+						// The namespace of the catalog published by the cloud-api-adaptor
+						{Name: "PEERPODS_NAMESPACE", Value: os.Getenv("PEERPODS_NAMESPACE")},
+					},
+					Ports: []corev1.ContainerPort{{
+						Name:          "webhook-server",
+						ContainerPort: 9443,
+						Protocol:      corev1.ProtocolTCP,
+					}},
+					SecurityContext: &corev1.SecurityContext{AllowPrivilegeEscalation: &noEscalation},
+					LivenessProbe:   httpProbe("/healthz", 15, 20),
+					ReadinessProbe:  httpProbe("/readyz", 5, 10),
+					Resources:       managerResources(),
+					VolumeMounts: []corev1.VolumeMount{{
+						Name:      "cert",
+						MountPath: "/tmp/k8s-webhook-server/serving-certs",
+						ReadOnly:  true,
+					}, {
+						Name:      "policies",
+						MountPath: "/etc/peer-pods-webhook",
+						ReadOnly:  true,
+					}},
+				}},
+				Volumes: []corev1.Volume{{
+					Name: "cert",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{
+							SecretName:  webhookCertSecretName,
+							DefaultMode: &certMode,
+						},
+					},
+				}, {
+					// The policies of the peer pods RuntimeClasses, when
+					// several of them are used
+					Name: "policies",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: webhookPoliciesConfigMapName},
+							Optional:             &optional,
+						},
+					},
+				}},
+			},
+		},
+	}
+}
+
+// reconcilePeerPodCtrl deploys peerpod-ctrl, which deletes the pod VMs left
+// behind by the cloud-api-adaptor
+func (r *PeerPodConfigReconciler) reconcilePeerPodCtrl(ctx context.Context) (bool, error) {
+	meta := metav1.ObjectMeta{Name: peerPodCtrlName, Namespace: os.Getenv("PEERPODS_NAMESPACE")}
+	if r.peerPodConfig.Spec.PeerPodController == nil {
+		return true, r.deleteObjects(ctx,
+			&appsv1.Deployment{ObjectMeta: meta},
+			&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: peerPodCtrlName}},
+			&corev1.ServiceAccount{ObjectMeta: meta},
+		)
+	}
+
+	if err := r.reconcileServiceAccount(ctx, meta, peerPodCtrlRoleName); err != nil {
+		return false, err
+	}
+
+	deployment := &appsv1.Deployment{ObjectMeta: meta}
+	err := r.apply(ctx, deployment, func() error {
+		deployment.Spec = r.peerPodCtrlDeploymentSpec()
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return deploymentAvailable(deployment), nil
+}
+
+func (r *PeerPodConfigReconciler) peerPodCtrlDeploymentSpec() appsv1.DeploymentSpec {
+	var (
+		labels         = map[string]string{"app": peerPodCtrlName}
+		replicas       = int32(1)
+		noEscalation   = false
+		sshMode        = int32(0600)
+		optional       = true
+		args           []string
+		peerPodCtrlCfg = r.peerPodConfig.Spec.PeerPodController
+	)
+	if peerPodCtrlCfg.OrphanGCInterval != nil {
+		args = append(args, "--orphan-gc-interval="+peerPodCtrlCfg.OrphanGCInterval.Duration.String())
+	}
+	if peerPodCtrlCfg.CapacityInterval != nil {
+		limit := r.peerPodsLimit()
+		args = append(args,
+			"--capacity-interval="+peerPodCtrlCfg.CapacityInterval.Duration.String(),
+			"--capacity-max-per-node="+strconv.FormatInt(limit.Value(), 10))
+	}
+
+	return appsv1.DeploymentSpec{
+		// Without leader election a single replica may run at a time
+		Replicas: &replicas,
+		Strategy: appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
+		Selector: &metav1.LabelSelector{MatchLabels: labels},
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: labels},
+			Spec: corev1.PodSpec{
+				ServiceAccountName: peerPodCtrlName,
+				Containers: []corev1.Container{{
+					Name:    "manager",
+					Image:   componentImage(r.peerPodConfig.Spec.Images.PeerPodController, PeerPodCtrlImageEnvName, DefaultPeerPodCtrlImage),
+					Command: []string{"/manager"},
+					Args:    args,
+					EnvFrom: []corev1.EnvFromSource{
+						{
+							SecretRef: &corev1.SecretEnvSource{
+								LocalObjectReference: corev1.LocalObjectReference{Name: r.peerPodConfig.Spec.CloudSecretName},
+								Optional:             &optional,
+							},
+						},
+						{
+							ConfigMapRef: &corev1.ConfigMapEnvSource{
+								LocalObjectReference: corev1.LocalObjectReference{Name: r.peerPodConfig.Spec.ConfigMapName},
+								Optional:             &optional,
+							},
+						},
+					},
+					Env: []corev1.EnvVar{{
+						Name: "PEERPODS_NAMESPACE",
+						ValueFrom: &corev1.EnvVarSource{
+							FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+						},
+					}},
+					SecurityContext: &corev1.SecurityContext{AllowPrivilegeEscalation: &noEscalation},
+					LivenessProbe:   httpProbe("/healthz", 15, 20),
+					ReadinessProbe:  httpProbe("/readyz", 5, 10),
+					Resources:       managerResources(),
+					VolumeMounts: []corev1.VolumeMount{{
+						Name:      "ssh",
+						MountPath: "/root/.ssh/",
+						ReadOnly:  true,
+					}},
+				}},
+				Volumes: []corev1.Volume{{
+					Name: "ssh",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{
+							SecretName:  "ssh-key-secret",
+							DefaultMode: &sshMode,
+							Optional:    &optional,
+						},
+					},
+				}},
+			},
+		},
+	}
+}
+
+// reconcileServiceAccount creates the ServiceAccount of a component and binds
+// it to the ClusterRole of the component
+func (r *PeerPodConfigReconciler) reconcileServiceAccount(ctx context.Context, meta metav1.ObjectMeta, roleName string) error {
+	serviceAccount := &corev1.ServiceAccount{ObjectMeta: meta}
+	if err := r.apply(ctx, serviceAccount, func() error { return nil }); err != nil {
+		return err
+	}
+
+	binding := &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: meta.Name}}
+	return r.apply(ctx, binding, func() error {
+		binding.RoleRef = rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     roleName,
+		}
+		binding.Subjects = []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      meta.Name,
+			Namespace: meta.Namespace,
+		}}
+		return nil
+	})
+}
+
+func httpProbe(path string, initialDelaySeconds, periodSeconds int32) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{Path: path, Port: intstr.FromInt(8081)},
+		},
+		InitialDelaySeconds: initialDelaySeconds,
+		PeriodSeconds:       periodSeconds,
+	}
+}
+
+func managerResources() corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("500m"),
+			corev1.ResourceMemory: resource.MustParse("128Mi"),
+		},
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("10m"),
+			corev1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+	}
+}
+
+// deploymentAvailable returns whether all the replicas of a Deployment run its
+// latest template and are available
+func deploymentAvailable(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.AvailableReplicas == replicas
+}
+
+// reconcileCSIWrapper adds the csi-wrapper containers to the controller and
+// node plugins of a CSI driver, and points the CSI sidecars to them. The CSI
+// driver is left patched when the csi-wrapper is disabled.
+func (r *PeerPodConfigReconciler) reconcileCSIWrapper(ctx context.Context) (bool, error) {
+	spec := r.peerPodConfig.Spec.CSIWrapper
+	if spec == nil {
+		return true, nil
+	}
+	csi := *spec
+	if csi.Namespace == "" {
+		csi.Namespace = "kube-system"
+	}
+	if csi.SocketVolume == "" {
+		csi.SocketVolume = "socket-dir"
+	}
+	images := r.peerPodConfig.Spec.Images
+
+	deployment := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: csi.Namespace, Name: csi.ControllerDeployment}, deployment); err != nil {
+		return false, fmt.Errorf("getting the CSI controller plugin: %w", err)
+	}
+	original := deployment.DeepCopy()
+	injectCSIControllerWrapper(&deployment.Spec.Template.Spec, &csi,
+		componentImage(images.CSIControllerWrapper, CSIControllerWrapperImageEnvName, DefaultCSIControllerWrapperImage))
+	if !equality.Semantic.DeepEqual(original.Spec, deployment.Spec) {
+		r.Log.Info("adding the csi-wrapper to the CSI controller plugin", "deployment", csi.ControllerDeployment)
+		if err := r.Client.Patch(ctx, deployment, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+			return false, err
+		}
+	}
+
+	daemonSet := &appsv1.DaemonSet{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: csi.Namespace, Name: csi.NodeDaemonSet}, daemonSet); err != nil {
+		return false, fmt.Errorf("getting the CSI node plugin: %w", err)
+	}
+	originalDs := daemonSet.DeepCopy()
+	injectCSINodeWrapper(&daemonSet.Spec.Template.Spec, &csi,
+		componentImage(images.CSINodeWrapper, CSINodeWrapperImageEnvName, DefaultCSINodeWrapperImage))
+	if !equality.Semantic.DeepEqual(originalDs.Spec, daemonSet.Spec) {
+		r.Log.Info("adding the csi-wrapper to the CSI node plugin", "daemonset", csi.NodeDaemonSet)
+		if err := r.Client.Patch(ctx, daemonSet, client.MergeFromWithOptions(originalDs, client.MergeFromWithOptimisticLock{})); err != nil {
+			return false, err
+		}
+	}
+
+	return deploymentAvailable(deployment) && daemonSetRolledOut(daemonSet), nil
+}
+
+func injectCSIControllerWrapper(podSpec *corev1.PodSpec, csi *ccv1alpha1.CSIWrapperSpec, image string) {
+	setContainer(podSpec, corev1.Container{
+		Name:            csiControllerWrapperName,
+		Image:           image,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Args: []string{
+			"--v=2",
+			"--endpoint=" + csiControllerWrapperSock,
+			"--target-endpoint=/csi/csi.sock",
+			"--namespace=" + csi.Namespace,
+		},
+		VolumeMounts: []corev1.VolumeMount{{Name: csi.SocketVolume, MountPath: "/csi"}},
+	})
+
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		switch container.Name {
+		case "csi-provisioner", "csi-attacher", "csi-resizer", "csi-snapshotter":
+			setEnv(container, "ADDRESS", csiControllerWrapperSock)
+			setCSIAddressArg(container, csiControllerWrapperSock)
+		}
+	}
+}
+
+func injectCSINodeWrapper(podSpec *corev1.PodSpec, csi *ccv1alpha1.CSIWrapperSpec, image string) {
+	setContainer(podSpec, corev1.Container{
+		Name:            csiNodeWrapperName,
+		Image:           image,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Args: []string{
+			"--v=2",
+			"--endpoint=" + csiNodeWrapperSock,
+			"--target-endpoint=/csi/csi.sock",
+			"--namespace=" + csi.Namespace,
+		},
+		Env: []corev1.EnvVar{{
+			Name: "POD_NODE_NAME",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+			},
+		}},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: csi.SocketVolume, MountPath: "/csi"},
+			{Name: "podvminfo-dir", MountPath: "/run/peerpod/"},
+			{Name: "kata-direct-volumes-dir", MountPath: "/run/kata-containers/shared/direct-volumes"},
+		},
+	})
+
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		if container.Name == "node-driver-registrar" {
+			setEnv(container, "ADDRESS", csiNodeWrapperSock)
+			setEnv(container, "DRIVER_REG_SOCK_PATH", fmt.Sprintf("/var/lib/kubelet/plugins/%s/csi-node-wrapper.sock", csi.DriverName))
+			setCSIAddressArg(container, csiNodeWrapperSock)
+		}
+	}
+
+	directory := corev1.HostPathDirectory
+	directoryOrCreate := corev1.HostPathDirectoryOrCreate
+	setVolume(podSpec, corev1.Volume{
+		Name: "podvminfo-dir",
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{Path: "/run/peerpod/", Type: &directory},
+		},
+	})
+	setVolume(podSpec, corev1.Volume{
+		Name: "kata-direct-volumes-dir",
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{Path: "/run/kata-containers/shared/direct-volumes", Type: &directoryOrCreate},
+		},
+	})
+}
+
+// setContainer adds container to podSpec, or replaces the one of the same name
+func setContainer(podSpec *corev1.PodSpec, container corev1.Container) {
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name == container.Name {
+			// Keep the fields defaulted by the API server
+			container.TerminationMessagePath = podSpec.Containers[i].TerminationMessagePath
+			container.TerminationMessagePolicy = podSpec.Containers[i].TerminationMessagePolicy
+			podSpec.Containers[i] = container
+			return
+		}
+	}
+	podSpec.Containers = append(podSpec.Containers, container)
+}
+
+func setVolume(podSpec *corev1.PodSpec, volume corev1.Volume) {
+	for i := range podSpec.Volumes {
+		if podSpec.Volumes[i].Name == volume.Name {
+			podSpec.Volumes[i] = volume
+			return
+		}
+	}
+	podSpec.Volumes = append(podSpec.Volumes, volume)
+}
+
+func setEnv(container *corev1.Container, name, value string) {
+	for i := range container.Env {
+		if container.Env[i].Name == name {
+			container.Env[i] = corev1.EnvVar{Name: name, Value: value}
+			return
+		}
+	}
+	container.Env = append(container.Env, corev1.EnvVar{Name: name, Value: value})
+}
+
+// setCSIAddressArg points the csi-address argument of a CSI sidecar to
+// address, unless it refers to the ADDRESS env var
+func setCSIAddressArg(container *corev1.Container, address string) {
+	for i, arg := range container.Args {
+		for _, prefix := range []string{"--csi-address=", "-csi-address="} {
+			if strings.HasPrefix(arg, prefix) && arg != prefix+"$(ADDRESS)" {
+				container.Args[i] = prefix + address
+			}
+		}
+	}
+}
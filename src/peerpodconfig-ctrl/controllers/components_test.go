@@ -0,0 +1,303 @@
+/*
+Copyright Confidential Containers Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ccv1alpha1 "github.com/confidential-containers/cloud-api-adaptor/src/peerpodconfig-ctrl/api/v1alpha1"
+)
+
+func TestCAAEnv(t *testing.T) {
+	secureComms, fallback := true, false
+	spec := &ccv1alpha1.CloudAPIAdaptorSpec{
+		PauseImage:           "pause:3.9",
+		ProxyTimeout:         &metav1.Duration{Duration: 5 * time.Minute},
+		VXLANPort:            4790,
+		SecureComms:          &secureComms,
+		PodTagLabels:         []string{"app", "team"},
+		RegistryAuthFallback: &fallback,
+	}
+	want := []corev1.EnvVar{
+		{Name: "PAUSE_IMAGE", Value: "pause:3.9"},
+		{Name: "PROXY_TIMEOUT", Value: "5m0s"},
+		{Name: "VXLAN_PORT", Value: "4790"},
+		{Name: "SECURE_COMMS", Value: "true"},
+		{Name: "POD_TAG_LABELS", Value: "app,team"},
+		{Name: "REGISTRY_AUTH_FALLBACK", Value: "false"},
+	}
+	if got := caaEnv(spec); !reflect.DeepEqual(got, want) {
+		t.Errorf("caaEnv() = %v, want %v", got, want)
+	}
+	if got := caaEnv(&ccv1alpha1.CloudAPIAdaptorSpec{}); len(got) != 0 {
+		t.Errorf("caaEnv() of an empty spec = %v", got)
+	}
+}
+
+func TestWebhookCert(t *testing.T) {
+	now := time.Now()
+	dnsNames := webhookDNSNames(testNamespace)
+	caPEM, certPEM, keyPEM, err := newWebhookCert(dnsNames, now)
+	if err != nil {
+		t.Fatalf("newWebhookCert() error = %v", err)
+	}
+	data := map[string][]byte{
+		caCertKey:               caPEM,
+		corev1.TLSCertKey:       certPEM,
+		corev1.TLSPrivateKeyKey: keyPEM,
+	}
+
+	if webhookCertNeedsRenewal(data, dnsNames, now) {
+		t.Error("a new certificate needs renewal")
+	}
+	if !webhookCertNeedsRenewal(data, dnsNames, now.Add(webhookCertValidity-webhookCertRenewBefore+time.Hour)) {
+		t.Error("an expiring certificate does not need renewal")
+	}
+	if !webhookCertNeedsRenewal(data, webhookDNSNames("other"), now) {
+		t.Error("a certificate for another service does not need renewal")
+	}
+	if !webhookCertNeedsRenewal(nil, dnsNames, now) {
+		t.Error("a missing certificate does not need renewal")
+	}
+}
+
+func TestReconcileComponents(t *testing.T) {
+	replicas := int32(2)
+	config := &ccv1alpha1.PeerPodConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "peerpodconfig", Namespace: testNamespace},
+		Spec: ccv1alpha1.PeerPodConfigSpec{
+			CloudSecretName: "peer-pods-secret",
+			ConfigMapName:   "peer-pods-cm",
+			Limit:           "5",
+			Images:          ccv1alpha1.ComponentImages{Webhook: "registry/webhook:dev"},
+			Webhook:         &ccv1alpha1.WebhookSpec{Replicas: &replicas},
+			PeerPodController: &ccv1alpha1.PeerPodControllerSpec{
+				OrphanGCInterval: &metav1.Duration{Duration: time.Hour},
+				CapacityInterval: &metav1.Duration{Duration: time.Minute},
+			},
+			RuntimeClass: &ccv1alpha1.RuntimeClassSpec{Name: "kata-remote"},
+		},
+	}
+	r := newTestReconciler(t, config)
+	r.peerPodConfig = config
+	ctx := context.Background()
+
+	notReady, err := r.reconcileComponents(ctx)
+	if err != nil {
+		t.Fatalf("reconcileComponents() error = %v", err)
+	}
+	if !reflect.DeepEqual(notReady, []string{"webhook", "peerpod-ctrl"}) {
+		t.Errorf("reconcileComponents() not ready = %v", notReady)
+	}
+
+	rc := &nodev1.RuntimeClass{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: "kata-remote"}, rc); err != nil {
+		t.Fatalf("getting the RuntimeClass: %v", err)
+	}
+	if rc.Handler != "kata-remote" || rc.Overhead == nil || !reflect.DeepEqual(rc.Scheduling.NodeSelector, map[string]string{defaultNodeSelectorLabel: ""}) {
+		t.Errorf("RuntimeClass = %+v", rc)
+	}
+
+	webhook := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: webhookName, Namespace: testNamespace}, webhook); err != nil {
+		t.Fatalf("getting the webhook: %v", err)
+	}
+	if image := webhook.Spec.Template.Spec.Containers[0].Image; image != "registry/webhook:dev" {
+		t.Errorf("webhook image = %s", image)
+	}
+	if *webhook.Spec.Replicas != 2 || len(webhook.OwnerReferences) != 1 {
+		t.Errorf("webhook Deployment = %+v", webhook.ObjectMeta)
+	}
+	if volumes := webhook.Spec.Template.Spec.Volumes; len(volumes) != 2 || volumes[1].ConfigMap == nil ||
+		volumes[1].ConfigMap.Name != webhookPoliciesConfigMapName || !*volumes[1].ConfigMap.Optional {
+		t.Errorf("webhook volumes = %+v", volumes)
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: webhookCertSecretName, Namespace: testNamespace}, secret); err != nil {
+		t.Fatalf("getting the webhook certificate: %v", err)
+	}
+	webhookConfig := &admissionregistrationv1.MutatingWebhookConfiguration{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: webhookConfigName}, webhookConfig); err != nil {
+		t.Fatalf("getting the MutatingWebhookConfiguration: %v", err)
+	}
+	if !bytes.Equal(webhookConfig.Webhooks[0].ClientConfig.CABundle, secret.Data[caCertKey]) {
+		t.Error("the webhook CA bundle does not match the certificate")
+	}
+	validatingConfig := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: validatingConfigName}, validatingConfig); err != nil {
+		t.Fatalf("getting the ValidatingWebhookConfiguration: %v", err)
+	}
+	if !bytes.Equal(validatingConfig.Webhooks[0].ClientConfig.CABundle, secret.Data[caCertKey]) {
+		t.Error("the validating webhook CA bundle does not match the certificate")
+	}
+
+	peerPodCtrl := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: peerPodCtrlName, Namespace: testNamespace}, peerPodCtrl); err != nil {
+		t.Fatalf("getting peerpod-ctrl: %v", err)
+	}
+	if args := peerPodCtrl.Spec.Template.Spec.Containers[0].Args; !reflect.DeepEqual(args, []string{
+		"--orphan-gc-interval=1h0m0s", "--capacity-interval=1m0s", "--capacity-max-per-node=5"}) {
+		t.Errorf("peerpod-ctrl args = %v", args)
+	}
+	binding := &rbacv1.ClusterRoleBinding{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: peerPodCtrlName}, binding); err != nil {
+		t.Fatalf("getting the peerpod-ctrl ClusterRoleBinding: %v", err)
+	}
+	if binding.RoleRef.Name != peerPodCtrlRoleName || binding.Subjects[0].Namespace != testNamespace {
+		t.Errorf("peerpod-ctrl ClusterRoleBinding = %+v", binding)
+	}
+
+	// The certificate is kept until it needs renewal
+	if _, err := r.reconcileComponents(ctx); err != nil {
+		t.Fatalf("reconcileComponents() error = %v", err)
+	}
+	renewed := &corev1.Secret{}
+	if err := r.Client.Get(ctx, client.ObjectKeyFromObject(secret), renewed); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(renewed.Data[corev1.TLSCertKey], secret.Data[corev1.TLSCertKey]) {
+		t.Error("the webhook certificate was regenerated")
+	}
+
+	// Rename the RuntimeClass and disable the other components
+	config.Spec.RuntimeClass.Name = "kata-remote-cc"
+	config.Spec.Webhook = nil
+	config.Spec.PeerPodController = nil
+	notReady, err = r.reconcileComponents(ctx)
+	if err != nil || len(notReady) != 0 {
+		t.Fatalf("reconcileComponents() = %v, %v", notReady, err)
+	}
+	for _, obj := range []client.Object{
+		&nodev1.RuntimeClass{ObjectMeta: metav1.ObjectMeta{Name: "kata-remote"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: webhookName, Namespace: testNamespace}},
+		&admissionregistrationv1.MutatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: webhookConfigName}},
+		&admissionregistrationv1.ValidatingWebhookConfiguration{ObjectMeta: metav1.ObjectMeta{Name: validatingConfigName}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: peerPodCtrlName, Namespace: testNamespace}},
+		&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: peerPodCtrlName}},
+	} {
+		if err := r.Client.Get(ctx, client.ObjectKeyFromObject(obj), obj); !k8serrors.IsNotFound(err) {
+			t.Errorf("%T %s was not deleted: %v", obj, obj.GetName(), err)
+		}
+	}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: "kata-remote-cc"}, rc); err != nil {
+		t.Errorf("getting the renamed RuntimeClass: %v", err)
+	}
+
+	if err := r.deleteComponents(ctx); err != nil {
+		t.Fatalf("deleteComponents() error = %v", err)
+	}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: "kata-remote-cc"}, rc); !k8serrors.IsNotFound(err) {
+		t.Errorf("RuntimeClass was not deleted: %v", err)
+	}
+}
+
+func TestReconcileCSIWrapper(t *testing.T) {
+	labels := map[string]string{"app": "csi"}
+	controller := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "csi-controller", Namespace: "kube-system"},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{Name: "csi-attacher", Args: []string{"-v=2", "--csi-address=/csi/csi.sock"}},
+						{Name: "csi-provisioner", Env: []corev1.EnvVar{{Name: "ADDRESS", Value: "/csi/csi.sock"}}},
+						{Name: "driver"},
+					},
+				},
+			},
+		},
+	}
+	node := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "csi-node", Namespace: "kube-system"},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "node-driver-registrar"}, {Name: "driver"}},
+				},
+			},
+		},
+	}
+	config := &ccv1alpha1.PeerPodConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "peerpodconfig", Namespace: testNamespace},
+		Spec: ccv1alpha1.PeerPodConfigSpec{
+			CSIWrapper: &ccv1alpha1.CSIWrapperSpec{
+				DriverName:           "file.csi.azure.com",
+				ControllerDeployment: "csi-controller",
+				NodeDaemonSet:        "csi-node",
+			},
+		},
+	}
+	r := newTestReconciler(t, config, controller, node)
+	r.peerPodConfig = config
+	ctx := context.Background()
+
+	if _, err := r.reconcileCSIWrapper(ctx); err != nil {
+		t.Fatalf("reconcileCSIWrapper() error = %v", err)
+	}
+	// Reconciling again leaves the plugins unchanged
+	if _, err := r.reconcileCSIWrapper(ctx); err != nil {
+		t.Fatalf("reconcileCSIWrapper() error = %v", err)
+	}
+
+	if err := r.Client.Get(ctx, client.ObjectKeyFromObject(controller), controller); err != nil {
+		t.Fatal(err)
+	}
+	containers := controller.Spec.Template.Spec.Containers
+	if len(containers) != 4 || containers[3].Name != csiControllerWrapperName || containers[3].Image != DefaultCSIControllerWrapperImage {
+		t.Fatalf("controller plugin containers = %+v", containers)
+	}
+	if args := containers[0].Args; args[1] != "--csi-address="+csiControllerWrapperSock {
+		t.Errorf("csi-attacher args = %v", args)
+	}
+	if env := containers[1].Env; len(env) != 1 || env[0].Value != csiControllerWrapperSock {
+		t.Errorf("csi-provisioner env = %v", env)
+	}
+	if env := containers[2].Env; len(env) != 0 {
+		t.Errorf("driver env = %v", env)
+	}
+
+	if err := r.Client.Get(ctx, client.ObjectKeyFromObject(node), node); err != nil {
+		t.Fatal(err)
+	}
+	podSpec := node.Spec.Template.Spec
+	if len(podSpec.Containers) != 3 || podSpec.Containers[2].Name != csiNodeWrapperName || len(podSpec.Volumes) != 2 {
+		t.Fatalf("node plugin = %+v", podSpec)
+	}
+	want := []corev1.EnvVar{
+		{Name: "ADDRESS", Value: csiNodeWrapperSock},
+		{Name: "DRIVER_REG_SOCK_PATH", Value: "/var/lib/kubelet/plugins/file.csi.azure.com/csi-node-wrapper.sock"},
+	}
+	if env := podSpec.Containers[0].Env; !reflect.DeepEqual(env, want) {
+		t.Errorf("node-driver-registrar env = %v, want %v", env, want)
+	}
+}
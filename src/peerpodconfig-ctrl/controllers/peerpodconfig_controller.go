@@ -22,23 +22,31 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
-	k8sclient "k8s.io/client-go/kubernetes"
-	restclient "k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	ccv1alpha1 "github.com/confidential-containers/cloud-api-adaptor/src/peerpodconfig-ctrl/api/v1alpha1"
 )
@@ -51,6 +59,13 @@ const (
 	defaultPeerPodsLimitPerNode = "1"
 	// cloud-api-adaptor (CAA) daemonset name
 	caaDsName = "peerpodconfig-ctrl-caa-daemon"
+	// peerPodsExtendedResource is the node resource consumed by peer pods
+	peerPodsExtendedResource = "kata.peerpods.io/vm"
+	// peerPodConfigFinalizer removes the extended resource from the nodes
+	// before the PeerPodConfig goes away
+	peerPodConfigFinalizer = "peerpodconfig.confidentialcontainers.org/finalizer"
+	// Delay before retrying the nodes on which the advertisement failed
+	advertiseRetryInterval = 30 * time.Second
 )
 
 // PeerPodConfigReconciler reconciles a PeerPodConfig object
@@ -67,17 +82,23 @@ type PeerPodConfigReconciler struct {
 //+kubebuilder:rbac:groups=confidentialcontainers.org,resources=peerpodconfigs/finalizers,verbs=update
 //+kubebuilder:rbac:groups="",resources=nodes/status,verbs=patch
 //+kubebuilder:rbac:groups="",resources=configmaps,verbs=create;get;update;list;watch
-//+kubebuilder:rbac:groups="",resources=secrets,verbs=create;get;update;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=create;get;update;list;watch;delete
 //+kubebuilder:rbac:groups="";machineconfiguration.openshift.io,resources=nodes;machineconfigs;machineconfigpools;containerruntimeconfigs;pods;services;services/finalizers;endpoints;persistentvolumeclaims;events;configmaps;secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps,resources=daemonsets,resourceNames=peerpodconfig-ctrl-caa-daemon,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=create;get;update;list;watch;delete
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterrolebindings,verbs=create;get;update;list;watch;delete
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterroles,resourceNames=peerpodconfig-ctrl-webhook-role;peerpodconfig-ctrl-peerpod-ctrl-role,verbs=bind
+//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations,verbs=create;get;update;list;watch;delete
+//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations,verbs=create;get;update;list;watch;delete
+//+kubebuilder:rbac:groups=node.k8s.io,resources=runtimeclasses,verbs=create;get;update;list;watch;delete
 //+kubebuilder:rbac:groups=apps,resources=daemonsets/finalizers,verbs=update
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the PeerPodConfig object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
+// Reconcile advertises the peer pods extended resource on the selected nodes,
+// deploys the cloud-api-adaptor DaemonSet and the enabled components, and
+// reports their state in the status of the PeerPodConfig. The extended
+// resource is removed from the nodes when the PeerPodConfig is deleted.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.11.0/pkg/reconcile
@@ -88,11 +109,12 @@ func (r *PeerPodConfigReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 
 	// Fetch the PeerPodConfig instance
 	r.peerPodConfig = &ccv1alpha1.PeerPodConfig{}
-	err := r.Client.Get(context.TODO(), req.NamespacedName, r.peerPodConfig)
+	err := r.Client.Get(ctx, req.NamespacedName, r.peerPodConfig)
 	if err != nil {
 		if k8serrors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
-			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
+			// Owned objects are automatically garbage collected, the nodes are
+			// cleaned up before the finalizer is removed.
 			// Return and don't requeue
 			return ctrl.Result{}, nil
 		}
@@ -100,7 +122,19 @@ func (r *PeerPodConfigReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, err
 	}
 
-	if err := r.advertiseExtendedResources(); err != nil {
+	if !r.peerPodConfig.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx)
+	}
+
+	if !controllerutil.ContainsFinalizer(r.peerPodConfig, peerPodConfigFinalizer) {
+		controllerutil.AddFinalizer(r.peerPodConfig, peerPodConfigFinalizer)
+		if err := r.Client.Update(ctx, r.peerPodConfig); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	nodes, err := r.advertiseExtendedResources(ctx)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
 
@@ -111,21 +145,152 @@ func (r *PeerPodConfigReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, err
 	}
 
-	err = r.Client.Update(context.TODO(), ds)
+	err = r.Client.Update(ctx, ds)
 	if err != nil && k8serrors.IsNotFound(err) {
 		r.Log.Error(err, "cloud-api-adaptor daemonset doesn't exist. Creating")
-		err = r.Client.Create(context.TODO(), ds)
+		err = r.Client.Create(ctx, ds)
 		if err != nil {
 			r.Log.Error(err, "failed to create cloud-api-adaptor daemonset")
 			return ctrl.Result{}, err
 		}
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The DaemonSet is owned, its rollout triggers a reconcile
+	if err := r.Client.Get(ctx, client.ObjectKeyFromObject(ds), ds); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	notReady, componentsErr := r.reconcileComponents(ctx)
+	if err := r.updateStatus(ctx, nodes, ds, notReady, componentsErr); err != nil {
+		return ctrl.Result{}, err
+	}
+	if componentsErr != nil {
+		return ctrl.Result{}, componentsErr
 	}
 
 	r.Log.Info("Reconciling PeerPodConfig")
 
+	for _, node := range nodes {
+		if !node.Advertised {
+			return ctrl.Result{RequeueAfter: advertiseRetryInterval}, nil
+		}
+	}
+	if r.peerPodConfig.Spec.Webhook != nil {
+		// Check the webhook certificate for renewal
+		return ctrl.Result{RequeueAfter: componentsResyncInterval}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// finalize removes the extended resource from the nodes it was advertised on
+// and the cluster scoped objects of the components, and releases the
+// PeerPodConfig
+func (r *PeerPodConfigReconciler) finalize(ctx context.Context) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(r.peerPodConfig, peerPodConfigFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	r.Log.Info("removing extended resources before deleting the PeerPodConfig")
+	nodeList := &corev1.NodeList{}
+	if err := r.Client.List(ctx, nodeList); err != nil {
+		return ctrl.Result{}, err
+	}
+	for i := range nodeList.Items {
+		if err := r.removeExtendedResource(ctx, &nodeList.Items[i]); err != nil {
+			return ctrl.Result{}, fmt.Errorf("removing the extended resource of node %s: %w", nodeList.Items[i].Name, err)
+		}
+	}
+
+	if err := r.deleteComponents(ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	controllerutil.RemoveFinalizer(r.peerPodConfig, peerPodConfigFinalizer)
+	if err := r.Client.Update(ctx, r.peerPodConfig); err != nil && !k8serrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
 	return ctrl.Result{}, nil
 }
 
+// updateStatus reports the advertisement on the nodes, the rollout of the
+// cloud-api-adaptor DaemonSet and the state of the optional components
+func (r *PeerPodConfigReconciler) updateStatus(ctx context.Context, nodes []ccv1alpha1.NodeAdvertisement, ds *appsv1.DaemonSet, notReady []string, componentsErr error) error {
+	status := &r.peerPodConfig.Status
+	status.Nodes = nodes
+
+	advertised := metav1.Condition{
+		Type:               ccv1alpha1.ResourcesAdvertised,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Advertised",
+		Message:            fmt.Sprintf("%d nodes advertise %s", len(nodes), peerPodsExtendedResource),
+		ObservedGeneration: r.peerPodConfig.Generation,
+	}
+	var failed []string
+	for _, node := range nodes {
+		if !node.Advertised {
+			failed = append(failed, node.Name)
+		}
+	}
+	if len(failed) > 0 {
+		advertised.Status = metav1.ConditionFalse
+		advertised.Reason = "AdvertisementFailed"
+		advertised.Message = fmt.Sprintf("failed to advertise %s on nodes %s", peerPodsExtendedResource, strings.Join(failed, ", "))
+	} else if len(nodes) == 0 {
+		advertised.Status = metav1.ConditionFalse
+		advertised.Reason = "NoNodes"
+		advertised.Message = "no node matches the node selector"
+	}
+	meta.SetStatusCondition(&status.Conditions, advertised)
+
+	caaReady := metav1.Condition{
+		Type:               ccv1alpha1.CAAReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             "RollingOut",
+		Message:            fmt.Sprintf("%d of %d cloud-api-adaptor pods are ready", ds.Status.NumberReady, ds.Status.DesiredNumberScheduled),
+		ObservedGeneration: r.peerPodConfig.Generation,
+	}
+	if daemonSetRolledOut(ds) {
+		caaReady.Status = metav1.ConditionTrue
+		caaReady.Reason = "RolledOut"
+	}
+	meta.SetStatusCondition(&status.Conditions, caaReady)
+
+	componentsReady := metav1.Condition{
+		Type:               ccv1alpha1.ComponentsReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Deployed",
+		Message:            "the enabled components are deployed",
+		ObservedGeneration: r.peerPodConfig.Generation,
+	}
+	if componentsErr != nil {
+		componentsReady.Status = metav1.ConditionFalse
+		componentsReady.Reason = "Failed"
+		componentsReady.Message = componentsErr.Error()
+	} else if len(notReady) > 0 {
+		componentsReady.Status = metav1.ConditionFalse
+		componentsReady.Reason = "RollingOut"
+		componentsReady.Message = fmt.Sprintf("waiting for %s", strings.Join(notReady, ", "))
+	}
+	meta.SetStatusCondition(&status.Conditions, componentsReady)
+
+	status.SetupCompleted = meta.IsStatusConditionTrue(status.Conditions, ccv1alpha1.ResourcesAdvertised) &&
+		meta.IsStatusConditionTrue(status.Conditions, ccv1alpha1.CAAReady) &&
+		meta.IsStatusConditionTrue(status.Conditions, ccv1alpha1.ComponentsReady)
+
+	return r.Client.Status().Update(ctx, r.peerPodConfig)
+}
+
+// daemonSetRolledOut returns whether all the pods of ds run its latest
+// template and are ready
+func daemonSetRolledOut(ds *appsv1.DaemonSet) bool {
+	return ds.Status.ObservedGeneration >= ds.Generation &&
+		ds.Status.DesiredNumberScheduled > 0 &&
+		ds.Status.UpdatedNumberScheduled == ds.Status.DesiredNumberScheduled &&
+		ds.Status.NumberReady == ds.Status.DesiredNumberScheduled
+}
+
 func MountProgagationRef(mode corev1.MountPropagationMode) *corev1.MountPropagationMode {
 	return &mode
 }
@@ -148,7 +313,10 @@ func (r *PeerPodConfigReconciler) createCaaDaemonset() *appsv1.DaemonSet {
 		nodeSelector = r.peerPodConfig.Spec.NodeSelector
 	}
 
-	imageString := os.Getenv(CloudApiAdaptorImageEnvName)
+	imageString := r.peerPodConfig.Spec.Images.CloudAPIAdaptor
+	if imageString == "" {
+		imageString = os.Getenv(CloudApiAdaptorImageEnvName)
+	}
 	if imageString == "" {
 		imageString = DefaultCloudApiAdaptorImage
 	}
@@ -211,6 +379,8 @@ func (r *PeerPodConfigReconciler) createCaaDaemonset() *appsv1.DaemonSet {
 									},
 								},
 							},
+							// Env takes precedence over EnvFrom
+							Env: caaEnv(&r.peerPodConfig.Spec.CloudAPIAdaptor),
 							VolumeMounts: []corev1.VolumeMount{
 								{
 									Name:      "auth-json-volume",
@@ -280,76 +450,171 @@ func (r *PeerPodConfigReconciler) createCaaDaemonset() *appsv1.DaemonSet {
 func (r *PeerPodConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&ccv1alpha1.PeerPodConfig{}).
+		Owns(&appsv1.DaemonSet{}).
+		Owns(&appsv1.Deployment{}).
+		Watches(&source.Kind{Type: &corev1.Node{}},
+			handler.EnqueueRequestsFromMapFunc(r.nodeToPeerPodConfigs),
+			builder.WithPredicates(nodePredicate)).
 		Complete(r)
 }
 
-func (r *PeerPodConfigReconciler) getNodesWithLabels(nodeLabels map[string]string) (*corev1.NodeList, error) {
+// nodePredicate passes the node events that may change the advertisement:
+// nodes joining or leaving, label changes and lost capacity
+var nodePredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldNode, oldOk := e.ObjectOld.(*corev1.Node)
+		newNode, newOk := e.ObjectNew.(*corev1.Node)
+		if !oldOk || !newOk {
+			return false
+		}
+		return !labels.Equals(oldNode.Labels, newNode.Labels) ||
+			!oldNode.Status.Capacity.Name(peerPodsExtendedResource, resource.DecimalSI).Equal(*newNode.Status.Capacity.Name(peerPodsExtendedResource, resource.DecimalSI))
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return false
+	},
+}
+
+// nodeToPeerPodConfigs maps a node to the PeerPodConfigs selecting it, or
+// that advertised the extended resource on it
+func (r *PeerPodConfigReconciler) nodeToPeerPodConfigs(obj client.Object) []reconcile.Request {
+	configs := &ccv1alpha1.PeerPodConfigList{}
+	if err := r.Client.List(context.TODO(), configs); err != nil {
+		r.Log.Error(err, "listing PeerPodConfigs for node event", "node", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, config := range configs.Items {
+		selected := labels.SelectorFromSet(nodeSelectorOf(&config)).Matches(labels.Set(obj.GetLabels()))
+		if !selected {
+			for _, node := range config.Status.Nodes {
+				if node.Name == obj.GetName() {
+					selected = true
+					break
+				}
+			}
+		}
+		if selected {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&config)})
+		}
+	}
+	return requests
+}
+
+// nodeSelectorOf returns the labels of the nodes selected by a PeerPodConfig
+func nodeSelectorOf(config *ccv1alpha1.PeerPodConfig) map[string]string {
+	if config.Spec.NodeSelector != nil {
+		return config.Spec.NodeSelector
+	}
+	return map[string]string{defaultNodeSelectorLabel: ""}
+}
+
+func (r *PeerPodConfigReconciler) getNodesWithLabels(ctx context.Context, nodeLabels map[string]string) (*corev1.NodeList, error) {
 	nodes := &corev1.NodeList{}
 	labelSelector := labels.SelectorFromSet(nodeLabels)
 	listOpts := []client.ListOption{
 		client.MatchingLabelsSelector{Selector: labelSelector},
 	}
 
-	if err := r.Client.List(context.TODO(), nodes, listOpts...); err != nil {
+	if err := r.Client.List(ctx, nodes, listOpts...); err != nil {
 		r.Log.Error(err, "Getting list of nodes having specified labels failed")
 		return &corev1.NodeList{}, err
 	}
 	return nodes, nil
 }
 
-func (r *PeerPodConfigReconciler) advertiseExtendedResources() error {
-
-	nodeSelector := map[string]string{
-		defaultNodeSelectorLabel: "",
+// peerPodsLimit parses the limit from PeerPodConfig.Spec.Limit. If not set
+// or in case of error, defaultPeerPodsLimitPerNode is used.
+func (r *PeerPodConfigReconciler) peerPodsLimit() resource.Quantity {
+	if r.peerPodConfig.Spec.Limit == "" {
+		return resource.MustParse(defaultPeerPodsLimitPerNode)
 	}
-
-	if r.peerPodConfig.Spec.NodeSelector != nil {
-		nodeSelector = r.peerPodConfig.Spec.NodeSelector
+	limit, err := resource.ParseQuantity(r.peerPodConfig.Spec.Limit)
+	if err != nil {
+		r.Log.Info("Invalid peer pods limit, using the default", "limit", r.peerPodConfig.Spec.Limit)
+		return resource.MustParse(defaultPeerPodsLimitPerNode)
 	}
+	return limit
+}
+
+// advertiseExtendedResources sets the peer pods extended resource on the
+// selected nodes, and removes it from the nodes that are no longer selected.
+// It returns the advertisement state of each selected node.
+func (r *PeerPodConfigReconciler) advertiseExtendedResources(ctx context.Context) ([]ccv1alpha1.NodeAdvertisement, error) {
+	nodeSelector := nodeSelectorOf(r.peerPodConfig)
 
 	r.Log.Info("set up extended resources")
-	nodesList, err := r.getNodesWithLabels(nodeSelector)
+	nodesList, err := r.getNodesWithLabels(ctx, nodeSelector)
 	if err != nil {
 		r.Log.Info("getting node list failed when trying to update nodes with extended resources")
-		return err
+		return nil, err
 	}
 
-	// Do nothing for empty nodes list
-	if len(nodesList.Items) == 0 {
-		r.Log.Info("Not advertising extended resources for empty nodelist for nodeSelector", "nodeSelector", nodeSelector)
-		return nil
+	limit := r.peerPodsLimit()
+	patch := append([]JsonPatch{}, NewJsonPatch("add", "/status/capacity", peerPodsExtendedResource, limit.String()))
+	// peerpod-ctrl updates the capacity of the nodes already advertising it
+	dynamicCapacity := r.peerPodConfig.Spec.PeerPodController != nil && r.peerPodConfig.Spec.PeerPodController.CapacityInterval != nil
+
+	nodes := make([]ccv1alpha1.NodeAdvertisement, 0, len(nodesList.Items))
+	selected := make(map[string]bool, len(nodesList.Items))
+	for i := range nodesList.Items {
+		node := &nodesList.Items[i]
+		selected[node.Name] = true
+		state := ccv1alpha1.NodeAdvertisement{Name: node.Name, Advertised: true}
+
+		if current, ok := node.Status.Capacity[corev1.ResourceName(peerPodsExtendedResource)]; !ok || (!dynamicCapacity && !current.Equal(limit)) {
+			if err := r.PatchNodeStatus(ctx, node, patch); err != nil {
+				r.Log.Info("Failed to set extended resource for node", "node name", node.Name, "error", err)
+				state.Advertised = false
+				state.Message = err.Error()
+			} else {
+				r.Log.Info("Successfully set extended resource for node", "node name", node.Name)
+			}
+		}
+		nodes = append(nodes, state)
 	}
 
-	// Parse limit from PeerPodConfig.Spec.Limit.
-	// If not set or in case of error, use defaultPeerPodsLimitPerNode
-	limitPerNode := defaultPeerPodsLimitPerNode
-	if r.peerPodConfig.Spec.Limit != "" {
-		limitPerNode = r.peerPodConfig.Spec.Limit
+	// Nodes that are no longer selected don't run the cloud-api-adaptor anymore
+	for _, previous := range r.peerPodConfig.Status.Nodes {
+		if selected[previous.Name] {
+			continue
+		}
+		node := &corev1.Node{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Name: previous.Name}, node); err != nil {
+			if !k8serrors.IsNotFound(err) {
+				r.Log.Info("Failed to get node no longer selected", "node name", previous.Name, "error", err)
+			}
+			continue
+		}
+		if err := r.removeExtendedResource(ctx, node); err != nil {
+			r.Log.Info("Failed to remove extended resource from node", "node name", node.Name, "error", err)
+		}
 	}
 
-	patch := append([]JsonPatch{}, NewJsonPatch("add", "/status/capacity", "kata.peerpods.io~1vm", limitPerNode))
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes, nil
+}
 
-	cli, err := r.GetClient()
-	if err != nil {
-		return fmt.Errorf("failed to get k8s client: %v", err)
+// removeExtendedResource removes the peer pods extended resource from the
+// capacity of a node, if it is set
+func (r *PeerPodConfigReconciler) removeExtendedResource(ctx context.Context, node *corev1.Node) error {
+	if _, ok := node.Status.Capacity[corev1.ResourceName(peerPodsExtendedResource)]; !ok {
+		return nil
 	}
-
-	for _, node := range nodesList.Items {
-		err = r.PatchNodeStatus(cli, node.Name, patch)
-		if err != nil {
-			r.Log.Info("Failed to set extended resource for node", "node name", node.Name)
-			continue
-		}
-		r.Log.Info("Successfully set extended resource for node", "node name", node.Name)
+	patch := append([]JsonPatch{}, NewJsonPatch("remove", "/status/capacity", peerPodsExtendedResource, ""))
+	if err := r.PatchNodeStatus(ctx, node, patch); err != nil {
+		return err
 	}
+	r.Log.Info("Removed extended resource from node", "node name", node.Name)
 	return nil
 }
 
-func (r *PeerPodConfigReconciler) PatchNodeStatus(c *k8sclient.Clientset, nodeName string, patches []JsonPatch) error {
+func (r *PeerPodConfigReconciler) PatchNodeStatus(ctx context.Context, node *corev1.Node, patches []JsonPatch) error {
 	if len(patches) > 0 {
 		data, err := json.Marshal(patches)
 		if err == nil {
-			_, err = c.CoreV1().Nodes().Patch(context.TODO(), nodeName, types.JSONPatchType, data, metav1.PatchOptions{}, "status")
+			err = r.Client.Status().Patch(ctx, node, client.RawPatch(types.JSONPatchType, data))
 		}
 		return err
 	}
@@ -368,16 +633,3 @@ type JsonPatch struct {
 func NewJsonPatch(verb string, jsonpath string, key string, value string) JsonPatch {
 	return JsonPatch{verb, path.Join(jsonpath, strings.ReplaceAll(key, "/", "~1")), value}
 }
-
-// GetClient creates and returns a new clientset from given config
-func (r *PeerPodConfigReconciler) GetClient() (*k8sclient.Clientset, error) {
-	Kubeconfig, err := restclient.InClusterConfig()
-	if err != nil {
-		return nil, err
-	}
-	clientset, err := k8sclient.NewForConfig(Kubeconfig)
-	if err != nil {
-		return nil, err
-	}
-	return clientset, nil
-}
@@ -0,0 +1,240 @@
+/*
+Copyright Confidential Containers Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	ccv1alpha1 "github.com/confidential-containers/cloud-api-adaptor/src/peerpodconfig-ctrl/api/v1alpha1"
+)
+
+const testNamespace = "confidential-containers-system"
+
+func newTestReconciler(t *testing.T, objs ...client.Object) *PeerPodConfigReconciler {
+	t.Helper()
+	t.Setenv("PEERPODS_NAMESPACE", testNamespace)
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := ccv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return &PeerPodConfigReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+		Scheme: scheme,
+		Log:    zap.New(zap.UseDevMode(true)),
+	}
+}
+
+func testNode(name string, labels map[string]string, capacity string) *corev1.Node {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Status:     corev1.NodeStatus{Capacity: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")}},
+	}
+	if capacity != "" {
+		node.Status.Capacity[peerPodsExtendedResource] = resource.MustParse(capacity)
+	}
+	return node
+}
+
+func nodeCapacity(t *testing.T, r *PeerPodConfigReconciler, name string) (resource.Quantity, bool) {
+	t.Helper()
+	node := &corev1.Node{}
+	if err := r.Client.Get(context.Background(), client.ObjectKey{Name: name}, node); err != nil {
+		t.Fatal(err)
+	}
+	quantity, ok := node.Status.Capacity[peerPodsExtendedResource]
+	return quantity, ok
+}
+
+func TestReconcile(t *testing.T) {
+	config := &ccv1alpha1.PeerPodConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "peerpodconfig", Namespace: testNamespace},
+		Spec: ccv1alpha1.PeerPodConfigSpec{
+			Limit:        "5",
+			NodeSelector: map[string]string{"peerpods": "true"},
+		},
+	}
+	r := newTestReconciler(t, config,
+		testNode("worker-0", map[string]string{"peerpods": "true"}, ""),
+		testNode("worker-1", map[string]string{"peerpods": "true"}, "5"),
+		testNode("other", nil, ""),
+	)
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(config)}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	for _, name := range []string{"worker-0", "worker-1"} {
+		if quantity, ok := nodeCapacity(t, r, name); !ok || quantity.Value() != 5 {
+			t.Errorf("capacity of %s = %v, want 5", name, quantity.String())
+		}
+	}
+	if _, ok := nodeCapacity(t, r, "other"); ok {
+		t.Error("extended resource advertised on a node that is not selected")
+	}
+
+	got := &ccv1alpha1.PeerPodConfig{}
+	if err := r.Client.Get(ctx, req.NamespacedName, got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Finalizers) != 1 || got.Finalizers[0] != peerPodConfigFinalizer {
+		t.Errorf("finalizers = %v", got.Finalizers)
+	}
+	if len(got.Status.Nodes) != 2 || !got.Status.Nodes[0].Advertised || got.Status.Nodes[0].Name != "worker-0" {
+		t.Errorf("status nodes = %+v", got.Status.Nodes)
+	}
+	if !meta.IsStatusConditionTrue(got.Status.Conditions, ccv1alpha1.ResourcesAdvertised) {
+		t.Errorf("%s condition is not true", ccv1alpha1.ResourcesAdvertised)
+	}
+	if meta.IsStatusConditionTrue(got.Status.Conditions, ccv1alpha1.CAAReady) || got.Status.SetupCompleted {
+		t.Error("setup completed before the cloud-api-adaptor rolled out")
+	}
+
+	// Unselect a node
+	node := &corev1.Node{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: "worker-1"}, node); err != nil {
+		t.Fatal(err)
+	}
+	node.Labels = nil
+	if err := r.Client.Update(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if _, ok := nodeCapacity(t, r, "worker-1"); ok {
+		t.Error("extended resource not removed from the node that is no longer selected")
+	}
+	if err := r.Client.Get(ctx, req.NamespacedName, got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Status.Nodes) != 1 || got.Status.Nodes[0].Name != "worker-0" {
+		t.Errorf("status nodes = %+v, want worker-0", got.Status.Nodes)
+	}
+
+	// Deletion removes the extended resource before the finalizer
+	if err := r.Client.Delete(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if _, ok := nodeCapacity(t, r, "worker-0"); ok {
+		t.Error("extended resource not removed on deletion")
+	}
+	if err := r.Client.Get(ctx, req.NamespacedName, got); err == nil && len(got.Finalizers) > 0 {
+		t.Errorf("finalizers = %v after deletion", got.Finalizers)
+	}
+}
+
+func TestReconcileDynamicCapacity(t *testing.T) {
+	config := &ccv1alpha1.PeerPodConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "peerpodconfig", Namespace: testNamespace},
+		Spec: ccv1alpha1.PeerPodConfigSpec{
+			Limit:             "5",
+			NodeSelector:      map[string]string{"peerpods": "true"},
+			PeerPodController: &ccv1alpha1.PeerPodControllerSpec{CapacityInterval: &metav1.Duration{Duration: time.Minute}},
+		},
+	}
+	r := newTestReconciler(t, config,
+		testNode("worker-0", map[string]string{"peerpods": "true"}, ""),
+		testNode("worker-1", map[string]string{"peerpods": "true"}, "2"),
+	)
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(config)}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	// The capacity computed by peerpod-ctrl is kept
+	want := map[string]int64{"worker-0": 5, "worker-1": 2}
+	for name, value := range want {
+		if quantity, ok := nodeCapacity(t, r, name); !ok || quantity.Value() != value {
+			t.Errorf("capacity of %s = %v, want %d", name, quantity.String(), value)
+		}
+	}
+}
+
+func TestDaemonSetRolledOut(t *testing.T) {
+	tests := []struct {
+		name   string
+		status appsv1.DaemonSetStatus
+		want   bool
+	}{
+		{"not observed", appsv1.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 2, UpdatedNumberScheduled: 2, NumberReady: 2}, false},
+		{"not scheduled", appsv1.DaemonSetStatus{ObservedGeneration: 2}, false},
+		{"updating", appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 2, UpdatedNumberScheduled: 1, NumberReady: 2}, false},
+		{"not ready", appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 2, UpdatedNumberScheduled: 2, NumberReady: 1}, false},
+		{"rolled out", appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 2, UpdatedNumberScheduled: 2, NumberReady: 2}, true},
+	}
+	for _, tt := range tests {
+		ds := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Generation: 2}, Status: tt.status}
+		if got := daemonSetRolledOut(ds); got != tt.want {
+			t.Errorf("%s: daemonSetRolledOut() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNodeToPeerPodConfigs(t *testing.T) {
+	selecting := &ccv1alpha1.PeerPodConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "selecting", Namespace: testNamespace},
+		Spec:       ccv1alpha1.PeerPodConfigSpec{NodeSelector: map[string]string{"peerpods": "true"}},
+	}
+	previous := &ccv1alpha1.PeerPodConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "previous", Namespace: testNamespace},
+		Spec:       ccv1alpha1.PeerPodConfigSpec{NodeSelector: map[string]string{"other": "true"}},
+		Status:     ccv1alpha1.PeerPodConfigStatus{Nodes: []ccv1alpha1.NodeAdvertisement{{Name: "worker-0"}}},
+	}
+	defaults := &ccv1alpha1.PeerPodConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "defaults", Namespace: testNamespace},
+	}
+	r := newTestReconciler(t, selecting, previous, defaults)
+
+	requests := r.nodeToPeerPodConfigs(testNode("worker-0", map[string]string{"peerpods": "true"}, ""))
+	names := map[string]bool{}
+	for _, req := range requests {
+		names[req.Name] = true
+	}
+	if len(names) != 2 || !names["selecting"] || !names["previous"] {
+		t.Errorf("nodeToPeerPodConfigs(worker-0) = %v", requests)
+	}
+
+	requests = r.nodeToPeerPodConfigs(testNode("worker-1", map[string]string{defaultNodeSelectorLabel: ""}, ""))
+	if len(requests) != 1 || requests[0].Name != "defaults" {
+		t.Errorf("nodeToPeerPodConfigs(worker-1) = %v", requests)
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"os"
 
 	"github.com/confidential-containers/cloud-api-adaptor/src/webhook/pkg/mutating_webhook"
+	"github.com/confidential-containers/cloud-api-adaptor/src/webhook/pkg/policy"
+	"github.com/confidential-containers/cloud-api-adaptor/src/webhook/pkg/validating_webhook"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -53,11 +55,15 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var policiesFile string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&policiesFile, "policies-file", policy.POLICIES_FILE_DEFAULT,
+		"The file of the policies of the peer pods RuntimeClasses, reloaded when it changes. "+
+			"When it doesn't exist, TARGET_RUNTIMECLASS and POD_VM_EXTENDED_RESOURCE are used.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -86,13 +92,25 @@ func main() {
 	}
 
 	setupLog.Info("Setting up webhook server")
+	policies := policy.NewStore(policiesFile)
 	podMutator := &mutating_webhook.PodMutator{
-		Client:  mgr.GetClient(),
-		Decoder: admission.NewDecoder(mgr.GetScheme()),
+		Client:   mgr.GetClient(),
+		Decoder:  admission.NewDecoder(mgr.GetScheme()),
+		Policies: policies,
 	}
 
 	mgr.GetWebhookServer().Register("/mutate-v1-pod", &webhook.Admission{Handler: podMutator})
 
+	// The validator only reads the catalog ConfigMap, which the cache of the
+	// manager client would need to list and watch in all namespaces
+	podValidator := &validating_webhook.PodValidator{
+		Reader:   mgr.GetAPIReader(),
+		Decoder:  admission.NewDecoder(mgr.GetScheme()),
+		Policies: policies,
+	}
+
+	mgr.GetWebhookServer().Register("/validate-v1-pod", &webhook.Admission{Handler: podValidator})
+
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -21,6 +21,8 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/confidential-containers/cloud-api-adaptor/src/webhook/pkg/policy"
+
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -32,6 +34,10 @@ import (
 type PodMutator struct {
 	Client  client.Client
 	Decoder *admission.Decoder
+	// Policies are the mutation policies of the peer pods runtimeClasses,
+	// the TARGET_RUNTIMECLASS and POD_VM_EXTENDED_RESOURCE environment
+	// variables are used when nil
+	Policies *policy.Store
 }
 
 // podMutator adds peer-pod extended resource to the pod spec add removes all other resource specs
@@ -2,10 +2,15 @@ package mutating_webhook
 
 import (
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
+	"github.com/confidential-containers/cloud-api-adaptor/src/webhook/pkg/policy"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestMutatePod_CpuMemReqLimit(t *testing.T) {
@@ -511,6 +516,76 @@ func TestMutatePod_InitContainers(t *testing.T) {
 	}
 }
 
+func TestMutatePod_EphemeralStorage(t *testing.T) {
+	// Mock environment variable
+	os.Setenv("TARGET_RUNTIMECLASS", "kata-remote")
+	os.Setenv("POD_VM_EXTENDED_RESOURCE", "kata.peerpods.io/vm")
+
+	tests := []struct {
+		name     string
+		requests corev1.ResourceList
+		limits   corev1.ResourceList
+		want     string
+	}{
+		{
+			name:     "request only",
+			requests: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("20Gi")},
+			want:     "20",
+		},
+		{
+			name:     "limit preferred over request",
+			requests: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("20Gi")},
+			limits:   corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("30Gi")},
+			want:     "30",
+		},
+		{
+			name:     "rounded up to GiB",
+			requests: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("20G")},
+			want:     "19",
+		},
+		{
+			// Sizes that don't fit in GiB are not annotated
+			name:     "too large",
+			requests: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("100Ei")},
+		},
+		{
+			name:     "no ephemeral storage",
+			requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtimeClassName := "kata-remote"
+			pod := &corev1.Pod{
+				Spec: corev1.PodSpec{
+					RuntimeClassName: &runtimeClassName,
+					Containers: []corev1.Container{
+						{
+							Name:      "container1",
+							Image:     "busybox",
+							Resources: corev1.ResourceRequirements{Requests: tt.requests, Limits: tt.limits},
+						},
+					},
+				},
+			}
+
+			podMutator := &PodMutator{}
+			mutatedPod, err := podMutator.mutatePod(pod)
+			if err != nil {
+				t.Fatalf("mutatePod() error = %v", err)
+			}
+
+			if got := mutatedPod.Annotations[PEERPODS_ROOT_DISK_ANNOTATION]; got != tt.want {
+				t.Errorf("Expected root disk annotation to be %q, got %q", tt.want, got)
+			}
+			if _, exists := mutatedPod.Spec.Containers[0].Resources.Requests[corev1.ResourceEphemeralStorage]; exists {
+				t.Errorf("Expected ephemeral storage request to be removed")
+			}
+		})
+	}
+}
+
 func TestMutatePod_NoChangeForDifferentRuntimeClass(t *testing.T) {
 	// Mock environment variable
 	os.Setenv("TARGET_RUNTIMECLASS", "kata-remote")
@@ -566,3 +641,140 @@ func TestMutatePod_NoChangeForDifferentRuntimeClass(t *testing.T) {
 		}
 	}
 }
+
+func TestMutatePod_Policies(t *testing.T) {
+	dir := t.TempDir()
+	policiesFile := filepath.Join(dir, "policies.yaml")
+	err := os.WriteFile(policiesFile, []byte(`
+runtimeClasses:
+- runtimeClassName: kata-remote
+- runtimeClassName: kata-remote-cc
+  extendedResource: kata.peerpods.io/cvm
+  defaultInstanceType: Standard_DC2as_v5
+  annotations:
+    peerpods.confidentialcontainers.org/profile: azure-cvm
+  enforcedAnnotations:
+    io.katacontainers.config.hypervisor.image: cvm-image
+- runtimeClassName: kata-remote-fixed
+  defaultInstanceType: t3.small
+  skipResourceAnnotations: true
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	podMutator := &PodMutator{Policies: policy.NewStore(policiesFile)}
+
+	newPod := func(runtimeClassName string, annotations map[string]string, requests corev1.ResourceList) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Annotations: annotations},
+			Spec: corev1.PodSpec{
+				RuntimeClassName: &runtimeClassName,
+				Containers: []corev1.Container{{
+					Name:      "container1",
+					Image:     "busybox",
+					Resources: corev1.ResourceRequirements{Requests: requests},
+				}},
+			},
+		}
+	}
+	cpuMem := corev1.ResourceList{
+		corev1.ResourceCPU:              resource.MustParse("2"),
+		corev1.ResourceMemory:           resource.MustParse("4Gi"),
+		corev1.ResourceEphemeralStorage: resource.MustParse("50Gi"),
+	}
+
+	tests := []struct {
+		name             string
+		pod              *corev1.Pod
+		extendedResource string
+		annotations      map[string]string
+	}{
+		{
+			name:             "policy without options",
+			pod:              newPod("kata-remote", nil, cpuMem),
+			extendedResource: POD_VM_EXTENDED_RESOURCE_DEFAULT,
+			annotations: map[string]string{
+				PEERPODS_CPU_ANNOTATION:       "2",
+				PEERPODS_MEMORY_ANNOTATION:    "4096",
+				PEERPODS_ROOT_DISK_ANNOTATION: "50",
+			},
+		},
+		{
+			name:             "default instance type and annotations",
+			pod:              newPod("kata-remote-cc", nil, nil),
+			extendedResource: "kata.peerpods.io/cvm",
+			annotations: map[string]string{
+				PEERPODS_INSTANCE_TYPE_ANNOTATION:             "Standard_DC2as_v5",
+				"peerpods.confidentialcontainers.org/profile": "azure-cvm",
+				"io.katacontainers.config.hypervisor.image":   "cvm-image",
+			},
+		},
+		{
+			name: "pod annotations kept unless enforced",
+			pod: newPod("kata-remote-cc", map[string]string{
+				PEERPODS_INSTANCE_TYPE_ANNOTATION:             "Standard_DC4as_v5",
+				"peerpods.confidentialcontainers.org/profile": "azure-other",
+				"io.katacontainers.config.hypervisor.image":   "other-image",
+			}, nil),
+			extendedResource: "kata.peerpods.io/cvm",
+			annotations: map[string]string{
+				PEERPODS_INSTANCE_TYPE_ANNOTATION:             "Standard_DC4as_v5",
+				"peerpods.confidentialcontainers.org/profile": "azure-other",
+				"io.katacontainers.config.hypervisor.image":   "cvm-image",
+			},
+		},
+		{
+			name:             "no default instance type with cpu and memory",
+			pod:              newPod("kata-remote-cc", nil, cpuMem),
+			extendedResource: "kata.peerpods.io/cvm",
+			annotations: map[string]string{
+				PEERPODS_CPU_ANNOTATION:                       "2",
+				PEERPODS_MEMORY_ANNOTATION:                    "4096",
+				PEERPODS_ROOT_DISK_ANNOTATION:                 "50",
+				"peerpods.confidentialcontainers.org/profile": "azure-cvm",
+				"io.katacontainers.config.hypervisor.image":   "cvm-image",
+			},
+		},
+		{
+			name:             "resource annotations skipped",
+			pod:              newPod("kata-remote-fixed", nil, cpuMem),
+			extendedResource: POD_VM_EXTENDED_RESOURCE_DEFAULT,
+			annotations: map[string]string{
+				PEERPODS_INSTANCE_TYPE_ANNOTATION: "t3.small",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mutatedPod, err := podMutator.mutatePod(tt.pod)
+			if err != nil {
+				t.Fatalf("mutatePod() error = %v", err)
+			}
+			if !reflect.DeepEqual(mutatedPod.Annotations, tt.annotations) {
+				t.Errorf("Expected annotations %v, got %v", tt.annotations, mutatedPod.Annotations)
+			}
+			want := corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceName(tt.extendedResource): resource.MustParse("1")},
+				Limits:   corev1.ResourceList{corev1.ResourceName(tt.extendedResource): resource.MustParse("1")},
+			}
+			if !reflect.DeepEqual(mutatedPod.Spec.Containers[0].Resources, want) {
+				t.Errorf("Expected resources %v, got %v", want, mutatedPod.Spec.Containers[0].Resources)
+			}
+		})
+	}
+
+	// Runtime classes without a policy are not mutated, even the one of the
+	// environment variable once the policies file is used
+	for _, runtimeClassName := range []string{"different-runtime", "kata-remote-env"} {
+		t.Setenv("TARGET_RUNTIMECLASS", "kata-remote-env")
+		pod := newPod(runtimeClassName, nil, cpuMem)
+		mutatedPod, err := podMutator.mutatePod(pod)
+		if err != nil {
+			t.Fatalf("mutatePod() error = %v", err)
+		}
+		if !reflect.DeepEqual(mutatedPod, pod) {
+			t.Errorf("Expected the %s pod not to be mutated, got %v", runtimeClassName, mutatedPod)
+		}
+	}
+}
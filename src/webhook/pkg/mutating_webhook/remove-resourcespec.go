@@ -2,8 +2,8 @@ package mutating_webhook
 
 import (
 	"log"
-	"os"
 
+	"github.com/confidential-containers/cloud-api-adaptor/src/webhook/pkg/policy"
 	"github.com/confidential-containers/cloud-api-adaptor/src/webhook/pkg/utils"
 
 	corev1 "k8s.io/api/core/v1"
@@ -11,12 +11,15 @@ import (
 )
 
 const (
-	RUNTIME_CLASS_NAME_DEFAULT       = "kata-remote"
-	POD_VM_EXTENDED_RESOURCE_DEFAULT = "kata.peerpods.io/vm"
-	PEERPODS_CPU_ANNOTATION          = "io.katacontainers.config.hypervisor.default_vcpus"
-	PEERPODS_MEMORY_ANNOTATION       = "io.katacontainers.config.hypervisor.default_memory"
-	GPU_RESOURCE_NAME                = "nvidia.com/gpu"
-	PEERPODS_GPU_ANNOTATION          = "kata.peerpods.io.gpus"
+	RUNTIME_CLASS_NAME_DEFAULT        = policy.RUNTIME_CLASS_NAME_DEFAULT
+	POD_VM_EXTENDED_RESOURCE_DEFAULT  = policy.POD_VM_EXTENDED_RESOURCE_DEFAULT
+	PEERPODS_CPU_ANNOTATION           = "io.katacontainers.config.hypervisor.default_vcpus"
+	PEERPODS_MEMORY_ANNOTATION        = "io.katacontainers.config.hypervisor.default_memory"
+	PEERPODS_INSTANCE_TYPE_ANNOTATION = "io.katacontainers.config.hypervisor.machine_type"
+	GPU_RESOURCE_NAME                 = "nvidia.com/gpu"
+	PEERPODS_GPU_ANNOTATION           = "kata.peerpods.io.gpus"
+	// PEERPODS_ROOT_DISK_ANNOTATION is the root disk size in GiB of the pod VM
+	PEERPODS_ROOT_DISK_ANNOTATION = "kata.peerpods.io.root_disk_size"
 )
 
 var logger = log.New(log.Writer(), "[pod-mutator] ", log.LstdFlags|log.Lmsgprefix)
@@ -24,27 +27,37 @@ var logger = log.New(log.Writer(), "[pod-mutator] ", log.LstdFlags|log.Lmsgprefi
 // mutate POD spec
 // remove the POD resource spec
 func (a *PodMutator) mutatePod(pod *corev1.Pod) (*corev1.Pod, error) {
-	var runtimeClassName string
 	mpod := pod.DeepCopy()
 
-	if runtimeClassName = os.Getenv("TARGET_RUNTIMECLASS"); runtimeClassName == "" {
-		runtimeClassName = RUNTIME_CLASS_NAME_DEFAULT
+	// Mutate only if the POD is using a peer pods runtimeClass
+	if mpod.Spec.RuntimeClassName == nil {
+		return mpod, nil
 	}
-	// Mutate only if the POD is using specific runtimeClass
-	if mpod.Spec.RuntimeClassName == nil || *mpod.Spec.RuntimeClassName != runtimeClassName {
+	podPolicy, ok := a.policies().Lookup(*mpod.Spec.RuntimeClassName)
+	if !ok {
 		return mpod, nil
 	}
 
-	mpod = adjustResourceSpec(mpod)
+	mpod = adjustResourceSpec(mpod, podPolicy)
+	mpod = applyAnnotationPolicy(mpod, podPolicy)
 
 	return mpod, nil
 }
 
+// policies returns the policies of the mutator, or the policy of the
+// environment variables when it has none
+func (a *PodMutator) policies() *policy.Store {
+	if a.Policies == nil {
+		return policy.NewStore("")
+	}
+	return a.Policies
+}
+
 // function to remove resource spec from the pod spec
 // add the cumulative resources as annotation to pod spec
 // add the peer-pod resource to the first container in the pod spec
 
-func adjustResourceSpec(pod *corev1.Pod) *corev1.Pod {
+func adjustResourceSpec(pod *corev1.Pod, podPolicy policy.Policy) *corev1.Pod {
 
 	// Get total CPU resource requests
 	cpuRequest := utils.GetResourceRequestQuantity(pod, corev1.ResourceCPU)
@@ -63,9 +76,14 @@ func adjustResourceSpec(pod *corev1.Pod) *corev1.Pod {
 	// So we don't need to check for limits
 	gpuRequest := utils.GetResourceRequestQuantity(pod, corev1.ResourceName(GPU_RESOURCE_NAME))
 
+	// Get total ephemeral storage resource requests and limits
+	// The ephemeral storage of a peer pod is on the root disk of the pod VM
+	storageRequest := utils.GetResourceRequestQuantity(pod, corev1.ResourceEphemeralStorage)
+	storageLimit := utils.GetResourceLimitQuantity(pod, corev1.ResourceEphemeralStorage)
+
 	// log the resource values
-	logger.Printf("CPU Request: %s, CPU Limit: %s, Memory Request: %s, Memory Limit: %s, GPU Request: %s",
-		cpuRequest.String(), cpuLimit.String(), memoryRequest.String(), memoryLimit.String(), gpuRequest.String())
+	logger.Printf("CPU Request: %s, CPU Limit: %s, Memory Request: %s, Memory Limit: %s, GPU Request: %s, Ephemeral Storage Request: %s, Ephemeral Storage Limit: %s",
+		cpuRequest.String(), cpuLimit.String(), memoryRequest.String(), memoryLimit.String(), gpuRequest.String(), storageRequest.String(), storageLimit.String())
 
 	// Add the cumulative resources as annotation to pod spec
 	// Use cpuLimit and memoryLimit if those are greater than cpuResource and memoryResource
@@ -74,6 +92,11 @@ func adjustResourceSpec(pod *corev1.Pod) *corev1.Pod {
 		annotations = make(map[string]string)
 	}
 
+	if podPolicy.SkipResourceAnnotations {
+		logger.Printf("Not adding resource annotations, skipped by the policy of runtimeClass %s", podPolicy.RuntimeClassName)
+		cpuRequest, memoryRequest, gpuRequest, storageRequest = resource.Quantity{}, resource.Quantity{}, resource.Quantity{}, resource.Quantity{}
+	}
+
 	// A non-existent request or limit will be 0 and we don't need to add annotation for 0
 	// We only add annotation if the value is greater than 0
 	// Limit will always be preferred over request
@@ -111,6 +134,26 @@ func adjustResourceSpec(pod *corev1.Pod) *corev1.Pod {
 		annotations[PEERPODS_GPU_ANNOTATION] = gpuRequest.String()
 	}
 
+	// Add root disk annotation
+	if !storageRequest.IsZero() && storageLimit.Cmp(storageRequest) >= 0 {
+		logger.Printf("Adding root disk annotation based on ephemeral storage limit: %s", storageLimit.String())
+		storageLimitGiBStr, err := utils.ConvertStorageQuantityToGib(storageLimit)
+		if err != nil {
+			logger.Printf("Error converting ephemeral storage quantity to GiB, skipping the root disk annotation: %v", err)
+		} else {
+			annotations[PEERPODS_ROOT_DISK_ANNOTATION] = storageLimitGiBStr
+		}
+
+	} else if storageRequest.Sign() == 1 {
+		logger.Printf("Adding root disk annotation based on ephemeral storage request: %s", storageRequest.String())
+		storageRequestGiBStr, err := utils.ConvertStorageQuantityToGib(storageRequest)
+		if err != nil {
+			logger.Printf("Error converting ephemeral storage quantity to GiB, skipping the root disk annotation: %v", err)
+		} else {
+			annotations[PEERPODS_ROOT_DISK_ANNOTATION] = storageRequestGiBStr
+		}
+	}
+
 	pod.SetAnnotations(annotations)
 
 	// Remove all resource specs
@@ -123,21 +166,53 @@ func adjustResourceSpec(pod *corev1.Pod) *corev1.Pod {
 	}
 
 	// Add peer-pod resource to one container
-	pod.Spec.Containers[0].Resources = defaultContainerResourceRequirements()
+	pod.Spec.Containers[0].Resources = defaultContainerResourceRequirements(podPolicy.ExtendedResource)
+	return pod
+}
+
+// applyAnnotationPolicy adds the annotations of the policy that the pod
+// doesn't set, the default instance type when the pod VM size is not set
+// otherwise, and then the enforced annotations
+func applyAnnotationPolicy(pod *corev1.Pod, podPolicy policy.Policy) *corev1.Pod {
+	annotations := pod.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	for key, value := range podPolicy.Annotations {
+		if _, ok := annotations[key]; !ok {
+			logger.Printf("Adding annotation %s of the policy of runtimeClass %s", key, podPolicy.RuntimeClassName)
+			annotations[key] = value
+		}
+	}
+
+	if podPolicy.DefaultInstanceType != "" {
+		_, instanceType := annotations[PEERPODS_INSTANCE_TYPE_ANNOTATION]
+		_, cpu := annotations[PEERPODS_CPU_ANNOTATION]
+		_, memory := annotations[PEERPODS_MEMORY_ANNOTATION]
+		if !instanceType && !cpu && !memory {
+			logger.Printf("Adding the default instance type %s of runtimeClass %s", podPolicy.DefaultInstanceType, podPolicy.RuntimeClassName)
+			annotations[PEERPODS_INSTANCE_TYPE_ANNOTATION] = podPolicy.DefaultInstanceType
+		}
+	}
+
+	for key, value := range podPolicy.EnforcedAnnotations {
+		if current, ok := annotations[key]; !ok || current != value {
+			logger.Printf("Setting annotation %s enforced by the policy of runtimeClass %s", key, podPolicy.RuntimeClassName)
+			annotations[key] = value
+		}
+	}
+
+	pod.SetAnnotations(annotations)
 	return pod
 }
 
 // defaultContainerResourceRequirements returns the default requirements for a container
-func defaultContainerResourceRequirements() corev1.ResourceRequirements {
+func defaultContainerResourceRequirements(podVmExtResource string) corev1.ResourceRequirements {
 	requirements := corev1.ResourceRequirements{}
 	requirements.Requests = corev1.ResourceList{}
 	requirements.Limits = corev1.ResourceList{}
 
-	var podVmExtResource string
-	if podVmExtResource = os.Getenv("POD_VM_EXTENDED_RESOURCE"); podVmExtResource == "" {
-		podVmExtResource = POD_VM_EXTENDED_RESOURCE_DEFAULT
-	}
-
 	requirements.Requests[corev1.ResourceName(podVmExtResource)] = resource.MustParse("1")
 	requirements.Limits[corev1.ResourceName(podVmExtResource)] = resource.MustParse("1")
 	return requirements
@@ -0,0 +1,163 @@
+package policy
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	RUNTIME_CLASS_NAME_DEFAULT       = "kata-remote"
+	POD_VM_EXTENDED_RESOURCE_DEFAULT = "kata.peerpods.io/vm"
+	// POLICIES_FILE_DEFAULT is where the peer-pods-webhook-policies ConfigMap
+	// is mounted
+	POLICIES_FILE_DEFAULT = "/etc/peer-pods-webhook/policies.yaml"
+)
+
+var logger = log.New(log.Writer(), "[policy] ", log.LstdFlags|log.Lmsgprefix)
+
+// Policy is how the webhooks handle the pods of a peer pods RuntimeClass
+type Policy struct {
+	RuntimeClassName string `json:"runtimeClassName"`
+	// ExtendedResource is the resource the pods request instead of their cpu
+	// and memory, POD_VM_EXTENDED_RESOURCE by default
+	ExtendedResource string `json:"extendedResource,omitempty"`
+	// DefaultInstanceType is the instance type of the pods that set neither
+	// an instance type nor cpu or memory
+	DefaultInstanceType string `json:"defaultInstanceType,omitempty"`
+	// SkipResourceAnnotations keeps the cpu, memory, GPU and ephemeral
+	// storage requests of the pods from being turned into pod VM
+	// annotations, so that their pod VMs always get the instance type of the
+	// annotations
+	SkipResourceAnnotations bool `json:"skipResourceAnnotations,omitempty"`
+	// Annotations are added to the pods that don't set them
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// EnforcedAnnotations are set on the pods, overriding their value
+	EnforcedAnnotations map[string]string `json:"enforcedAnnotations,omitempty"`
+}
+
+// Policies is the content of the policies file
+type Policies struct {
+	RuntimeClasses []Policy `json:"runtimeClasses"`
+}
+
+// Parse parses a policies file, giving the policies that don't set it the
+// default extended resource
+func Parse(data []byte, extendedResource string) (map[string]Policy, error) {
+	var policies Policies
+	if err := yaml.UnmarshalStrict(data, &policies); err != nil {
+		return nil, err
+	}
+
+	table := make(map[string]Policy, len(policies.RuntimeClasses))
+	for i, policy := range policies.RuntimeClasses {
+		if policy.RuntimeClassName == "" {
+			return nil, fmt.Errorf("runtimeClasses[%d]: runtimeClassName is missing", i)
+		}
+		if _, ok := table[policy.RuntimeClassName]; ok {
+			return nil, fmt.Errorf("runtimeClasses[%d]: duplicate policy for RuntimeClass %s", i, policy.RuntimeClassName)
+		}
+		if policy.ExtendedResource == "" {
+			policy.ExtendedResource = extendedResource
+		}
+		table[policy.RuntimeClassName] = policy
+	}
+	return table, nil
+}
+
+// Store holds the policies of the peer pods RuntimeClasses. They are read
+// from a file, typically a mounted ConfigMap, which is read again when it
+// changes so that the policies can be updated without restarting the
+// webhook. Without the file, the only policy is the one of the
+// TARGET_RUNTIMECLASS and POD_VM_EXTENDED_RESOURCE environment variables.
+type Store struct {
+	path string
+
+	mutex sync.Mutex
+	// read is whether modTime is the one of the file that was last read
+	read     bool
+	modTime  time.Time
+	policies map[string]Policy
+}
+
+// NewStore returns a Store reading the policies from path, or only using
+// the environment variables when path is empty
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Lookup returns the policy of a RuntimeClass, false if its pods are not peer
+// pods
+func (s *Store) Lookup(runtimeClassName string) (Policy, bool) {
+	policy, ok := s.load()[runtimeClassName]
+	return policy, ok
+}
+
+func (s *Store) load() map[string]Policy {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.path == "" {
+		return envPolicies()
+	}
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.read, s.policies = false, nil
+		return envPolicies()
+	}
+	if err != nil {
+		logger.Printf("Error reading the policies file %s: %v", s.path, err)
+		return s.current()
+	}
+	if s.read && info.ModTime().Equal(s.modTime) {
+		return s.current()
+	}
+
+	s.read, s.modTime = true, info.ModTime()
+	data, err := os.ReadFile(s.path)
+	if err == nil {
+		var policies map[string]Policy
+		if policies, err = Parse(data, extendedResourceFromEnv()); err == nil {
+			logger.Printf("Loaded the policies of %d RuntimeClasses from %s", len(policies), s.path)
+			s.policies = policies
+			return s.policies
+		}
+	}
+	// Keep the last valid policies rather than mutating the pods differently
+	// because of a typo
+	logger.Printf("Error loading the policies file %s: %v", s.path, err)
+	return s.current()
+}
+
+// current returns the last valid policies
+func (s *Store) current() map[string]Policy {
+	if s.policies == nil {
+		return envPolicies()
+	}
+	return s.policies
+}
+
+// envPolicies returns the policy of the environment variables
+func envPolicies() map[string]Policy {
+	runtimeClassName := os.Getenv("TARGET_RUNTIMECLASS")
+	if runtimeClassName == "" {
+		runtimeClassName = RUNTIME_CLASS_NAME_DEFAULT
+	}
+	return map[string]Policy{
+		runtimeClassName: {
+			RuntimeClassName: runtimeClassName,
+			ExtendedResource: extendedResourceFromEnv(),
+		},
+	}
+}
+
+func extendedResourceFromEnv() string {
+	if extendedResource := os.Getenv("POD_VM_EXTENDED_RESOURCE"); extendedResource != "" {
+		return extendedResource
+	}
+	return POD_VM_EXTENDED_RESOURCE_DEFAULT
+}
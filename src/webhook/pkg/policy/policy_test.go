@@ -0,0 +1,96 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	policies, err := Parse([]byte(`
+runtimeClasses:
+- runtimeClassName: kata-remote-cc
+  extendedResource: kata.peerpods.io/cvm
+  defaultInstanceType: Standard_DC2as_v5
+- runtimeClassName: kata-remote
+`), "kata.peerpods.io/vm")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(policies) != 2 {
+		t.Fatalf("Expected 2 policies, got %v", policies)
+	}
+	if p := policies["kata-remote-cc"]; p.ExtendedResource != "kata.peerpods.io/cvm" || p.DefaultInstanceType != "Standard_DC2as_v5" {
+		t.Errorf("Unexpected kata-remote-cc policy %+v", p)
+	}
+	if p := policies["kata-remote"]; p.ExtendedResource != "kata.peerpods.io/vm" {
+		t.Errorf("Expected the default extended resource, got %+v", p)
+	}
+
+	for name, data := range map[string]string{
+		"missing name":  "runtimeClasses:\n- extendedResource: kata.peerpods.io/vm\n",
+		"duplicate":     "runtimeClasses:\n- runtimeClassName: a\n- runtimeClassName: a\n",
+		"unknown field": "runtimeClasses:\n- runtimeClassName: a\n  instanceType: t3.small\n",
+	} {
+		if _, err := Parse([]byte(data), "kata.peerpods.io/vm"); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	t.Setenv("TARGET_RUNTIMECLASS", "kata-remote")
+	t.Setenv("POD_VM_EXTENDED_RESOURCE", "kata.peerpods.io/vm")
+
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	store := NewStore(path)
+
+	// Without the file, the environment variables are used
+	if p, ok := store.Lookup("kata-remote"); !ok || p.ExtendedResource != "kata.peerpods.io/vm" {
+		t.Errorf("Expected the policy of the environment, got %+v, %v", p, ok)
+	}
+
+	write := func(data string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// The modification time may not change between quick writes
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+
+	write("runtimeClasses:\n- runtimeClassName: kata-remote-cc\n", now)
+	if _, ok := store.Lookup("kata-remote"); ok {
+		t.Error("Expected the policy of the environment to be replaced by the file")
+	}
+	if _, ok := store.Lookup("kata-remote-cc"); !ok {
+		t.Error("Expected the policy of kata-remote-cc")
+	}
+
+	// Changes are reloaded
+	write("runtimeClasses:\n- runtimeClassName: kata-remote-cc\n  defaultInstanceType: t3.small\n", now.Add(time.Second))
+	if p, _ := store.Lookup("kata-remote-cc"); p.DefaultInstanceType != "t3.small" {
+		t.Errorf("Expected the updated policy, got %+v", p)
+	}
+
+	// Invalid changes keep the last valid policies
+	write("runtimeClasses: [", now.Add(2*time.Second))
+	if p, _ := store.Lookup("kata-remote-cc"); p.DefaultInstanceType != "t3.small" {
+		t.Errorf("Expected the last valid policy, got %+v", p)
+	}
+
+	// Removing the file goes back to the environment variables
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Lookup("kata-remote"); !ok {
+		t.Error("Expected the policy of the environment")
+	}
+
+	if _, ok := NewStore("").Lookup("kata-remote"); !ok {
+		t.Error("Expected the policy of the environment without a file")
+	}
+}
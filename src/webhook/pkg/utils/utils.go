@@ -69,7 +69,7 @@ func GetResourceLimitQuantity(pod *corev1.Pod, resourceName corev1.ResourceName)
 func getResourceQuantity(resourceName corev1.ResourceName) resource.Quantity {
 
 	switch resourceName {
-	case corev1.ResourceMemory:
+	case corev1.ResourceMemory, corev1.ResourceEphemeralStorage:
 		return resource.Quantity{Format: resource.BinarySI}
 	default:
 		return resource.Quantity{Format: resource.DecimalSI}
@@ -85,3 +85,13 @@ func ConvertMemoryQuantityToMib(memoryQuantity resource.Quantity) (string, error
 	}
 	return strconv.FormatInt(memoryQuantityMib, 10), nil
 }
+
+// Method to convert storage quantity to GiB string
+func ConvertStorageQuantityToGib(storageQuantity resource.Quantity) (string, error) {
+
+	storageQuantityGib, err := helpers.RoundUpToGiB(storageQuantity)
+	if err != nil {
+		return "0", err
+	}
+	return strconv.FormatInt(storageQuantityGib, 10), nil
+}
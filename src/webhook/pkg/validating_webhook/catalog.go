@@ -0,0 +1,74 @@
+package validating_webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// CATALOG_CONFIGMAP is the ConfigMap the cloud-api-adaptor publishes
+	// its catalog in
+	CATALOG_CONFIGMAP = "peer-pods-catalog"
+	CATALOG_KEY       = "catalog.json"
+	// PEERPODS_NAMESPACE_DEFAULT is the namespace of the cloud-api-adaptor
+	PEERPODS_NAMESPACE_DEFAULT = "confidential-containers-system"
+)
+
+// Catalog describes the pod VMs the cloud-api-adaptor can create, it is
+// published by the adaptor in CATALOG_CONFIGMAP
+type Catalog struct {
+	// Instances is the catalog of the default provider, nil if the provider
+	// does not report one
+	Instances *InstanceCatalog `json:"instances,omitempty"`
+	// Profiles are the catalogs of the provider profiles by name, nil for
+	// the profiles whose provider does not report one
+	Profiles map[string]*InstanceCatalog `json:"profiles,omitempty"`
+	Initdata InitdataCatalog             `json:"initdata"`
+}
+
+// InstanceCatalog are the instance types a provider can create pod VMs with
+type InstanceCatalog struct {
+	DefaultInstanceType string `json:"defaultInstanceType,omitempty"`
+	// InstanceTypes is the allowlist of instance types, only the default
+	// instance type is allowed when it is empty
+	InstanceTypes []string `json:"instanceTypes,omitempty"`
+	// Specs are the resources of the instance types, sorted on memory
+	Specs []InstanceTypeSpec `json:"specs,omitempty"`
+}
+
+type InstanceTypeSpec struct {
+	InstanceType string `json:"instanceType,omitempty"`
+	VCPUs        int64  `json:"vcpus,omitempty"`
+	// Memory is in MiB
+	Memory int64 `json:"memory,omitempty"`
+	GPUs   int64 `json:"gpus,omitempty"`
+}
+
+// InitdataCatalog describes the initdata accepted by the cloud-api-adaptor
+type InitdataCatalog struct {
+	MaxSize    int      `json:"maxSize"`
+	Algorithms []string `json:"algorithms"`
+	Keys       []string `json:"keys"`
+}
+
+// getCatalog reads the catalog published in namespace. It returns nil if
+// the catalog is not published yet.
+func getCatalog(ctx context.Context, reader client.Reader, namespace string) (*Catalog, error) {
+	cm := &corev1.ConfigMap{}
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: CATALOG_CONFIGMAP}, cm); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	data, ok := cm.Data[CATALOG_KEY]
+	if !ok {
+		return nil, nil
+	}
+	catalog := &Catalog{}
+	if err := json.Unmarshal([]byte(data), catalog); err != nil {
+		return nil, fmt.Errorf("decoding the catalog in ConfigMap %s/%s: %w", namespace, CATALOG_CONFIGMAP, err)
+	}
+	return catalog, nil
+}
@@ -0,0 +1,213 @@
+package validating_webhook
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/webhook/pkg/mutating_webhook"
+
+	toml "github.com/pelletier/go-toml/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	PEERPODS_INSTANCE_TYPE_ANNOTATION = mutating_webhook.PEERPODS_INSTANCE_TYPE_ANNOTATION
+	PEERPODS_INITDATA_ANNOTATION      = "io.katacontainers.config.runtime.cc_init_data"
+	PEERPODS_PROFILE_ANNOTATION       = "peerpods.confidentialcontainers.org/profile"
+)
+
+var annotationsPath = field.NewPath("metadata", "annotations")
+
+// validatePod checks the pod VM requested by the annotations of a pod against
+// the catalog, the way the cloud-api-adaptor selects the provider, the
+// instance type and the initdata of the pod VM when creating it
+func validatePod(pod *corev1.Pod, catalog *Catalog) field.ErrorList {
+	var errs field.ErrorList
+
+	instances, profileErr := selectInstanceCatalog(pod, catalog)
+	if profileErr != nil {
+		errs = append(errs, profileErr)
+	}
+	if instances != nil {
+		errs = append(errs, validateInstanceType(pod.Annotations, instances)...)
+	}
+	if initdata, ok := pod.Annotations[PEERPODS_INITDATA_ANNOTATION]; ok {
+		errs = append(errs, validateInitdata(initdata, &catalog.Initdata)...)
+	}
+	return errs
+}
+
+// selectInstanceCatalog returns the catalog of the provider profile selected
+// by the profile annotation, or by the RuntimeClass when a profile is named
+// after it, or else of the default provider
+func selectInstanceCatalog(pod *corev1.Pod, catalog *Catalog) (*InstanceCatalog, *field.Error) {
+	profile := pod.Annotations[PEERPODS_PROFILE_ANNOTATION]
+	if profile == "" && pod.Spec.RuntimeClassName != nil {
+		if _, ok := catalog.Profiles[*pod.Spec.RuntimeClassName]; ok {
+			profile = *pod.Spec.RuntimeClassName
+		}
+	}
+	if profile == "" {
+		return catalog.Instances, nil
+	}
+
+	instances, ok := catalog.Profiles[profile]
+	if !ok {
+		profiles := make([]string, 0, len(catalog.Profiles))
+		for name := range catalog.Profiles {
+			profiles = append(profiles, name)
+		}
+		sort.Strings(profiles)
+		return nil, field.NotSupported(annotationsPath.Key(PEERPODS_PROFILE_ANNOTATION), profile, profiles)
+	}
+	return instances, nil
+}
+
+// validateInstanceType checks that an instance type of the catalog fits the
+// vCPUs, memory and GPUs of the pod, or that the requested instance type is
+// allowed. The annotations are parsed like the cloud-api-adaptor does, which
+// ignores values that are not integers.
+func validateInstanceType(annotations map[string]string, instances *InstanceCatalog) field.ErrorList {
+	vcpus := parseAnnotation(annotations, mutating_webhook.PEERPODS_CPU_ANNOTATION)
+	memory := parseAnnotation(annotations, mutating_webhook.PEERPODS_MEMORY_ANNOTATION)
+	gpus := parseAnnotation(annotations, mutating_webhook.PEERPODS_GPU_ANNOTATION)
+	// Only providers knowing the GPUs of their instance types report them
+	if !reportsGPUs(instances) {
+		gpus = 0
+	}
+
+	instanceType := annotations[PEERPODS_INSTANCE_TYPE_ANNOTATION]
+	if vcpus != 0 && memory != 0 {
+		spec, ok := bestFit(instances.Specs, vcpus, memory, gpus)
+		if !ok {
+			return field.ErrorList{field.Invalid(annotationsPath, formatResources(vcpus, memory, gpus),
+				"no instance type offers these resources, available instance types are "+formatSpecs(instances.Specs))}
+		}
+		instanceType = spec.InstanceType
+	} else if instanceType != "" {
+		path := annotationsPath.Key(PEERPODS_INSTANCE_TYPE_ANNOTATION)
+		if len(instances.InstanceTypes) == 0 && instanceType != instances.DefaultInstanceType {
+			return field.ErrorList{field.NotSupported(path, instanceType, []string{instances.DefaultInstanceType})}
+		}
+		if len(instances.InstanceTypes) > 0 && !contains(instances.InstanceTypes, instanceType) {
+			return field.ErrorList{field.NotSupported(path, instanceType, instances.InstanceTypes)}
+		}
+	} else {
+		instanceType = instances.DefaultInstanceType
+	}
+
+	if gpus > 0 {
+		for _, spec := range instances.Specs {
+			if spec.InstanceType == instanceType && spec.GPUs < gpus {
+				return field.ErrorList{field.Invalid(annotationsPath.Key(mutating_webhook.PEERPODS_GPU_ANNOTATION), gpus,
+					fmt.Sprintf("instance type %s has %d GPUs, available instance types are %s", instanceType, spec.GPUs, formatSpecs(instances.Specs)))}
+			}
+		}
+	}
+	return nil
+}
+
+// bestFit returns the instance type with the least memory that has the
+// vcpus, memory and gpus, specs being sorted on memory
+func bestFit(specs []InstanceTypeSpec, vcpus, memory, gpus int64) (InstanceTypeSpec, bool) {
+	for _, spec := range specs {
+		if spec.Memory >= memory && spec.VCPUs >= vcpus && spec.GPUs >= gpus {
+			return spec, true
+		}
+	}
+	return InstanceTypeSpec{}, false
+}
+
+func reportsGPUs(instances *InstanceCatalog) bool {
+	for _, spec := range instances.Specs {
+		if spec.GPUs > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func parseAnnotation(annotations map[string]string, key string) int64 {
+	value, err := strconv.ParseInt(annotations[key], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+func formatResources(vcpus, memory, gpus int64) string {
+	resources := fmt.Sprintf("%d vCPUs, %d MiB", vcpus, memory)
+	if gpus > 0 {
+		resources += fmt.Sprintf(", %d GPUs", gpus)
+	}
+	return resources
+}
+
+func formatSpecs(specs []InstanceTypeSpec) string {
+	if len(specs) == 0 {
+		return "unknown"
+	}
+	formatted := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		formatted = append(formatted, fmt.Sprintf("%s (%s)", spec.InstanceType, formatResources(spec.VCPUs, spec.Memory, spec.GPUs)))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// initdata is the shape of an initdata document
+type initdata struct {
+	Algorithm string            `toml:"algorithm"`
+	Version   string            `toml:"version"`
+	Data      map[string]string `toml:"data,omitempty"`
+}
+
+// validateInitdata checks that the initdata annotation is a base64 encoded
+// initdata document passing the checks of the cloud-api-adaptor. The content
+// of the data entries is left to the adaptor.
+func validateInitdata(encoded string, catalog *InitdataCatalog) field.ErrorList {
+	path := annotationsPath.Key(PEERPODS_INITDATA_ANNOTATION)
+
+	doc, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, "", "initdata is not base64 encoded: "+err.Error())}
+	}
+	if catalog.MaxSize > 0 && len(doc) > catalog.MaxSize {
+		return field.ErrorList{field.TooLong(path, "", catalog.MaxSize)}
+	}
+	var parsed initdata
+	if err := toml.Unmarshal(doc, &parsed); err != nil {
+		return field.ErrorList{field.Invalid(path, "", "initdata is not a TOML document: "+err.Error())}
+	}
+
+	var errs field.ErrorList
+	if !contains(catalog.Algorithms, parsed.Algorithm) {
+		errs = append(errs, field.NotSupported(path.Child("algorithm"), parsed.Algorithm, catalog.Algorithms))
+	}
+	if parsed.Version == "" {
+		errs = append(errs, field.Required(path.Child("version"), "initdata version is missing"))
+	}
+	keys := make([]string, 0, len(parsed.Data))
+	for key := range parsed.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !contains(catalog.Keys, key) {
+			errs = append(errs, field.NotSupported(path.Child("data").Key(key), key, catalog.Keys))
+		}
+	}
+	return errs
+}
+
+func contains(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package validating_webhook
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/webhook/pkg/mutating_webhook"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testCatalog() *Catalog {
+	return &Catalog{
+		Instances: &InstanceCatalog{
+			DefaultInstanceType: "small",
+			InstanceTypes:       []string{"small", "large", "gpu"},
+			Specs: []InstanceTypeSpec{
+				{InstanceType: "small", VCPUs: 2, Memory: 4096},
+				{InstanceType: "large", VCPUs: 8, Memory: 32768},
+				{InstanceType: "gpu", VCPUs: 8, Memory: 65536, GPUs: 1},
+			},
+		},
+		Profiles: map[string]*InstanceCatalog{
+			"kata-remote": nil,
+			"other-cloud": {DefaultInstanceType: "tiny"},
+		},
+		Initdata: InitdataCatalog{
+			MaxSize:    1024,
+			Algorithms: []string{"sha256", "sha384", "sha512"},
+			Keys:       []string{"aa.toml", "cdh.toml", "policy.rego"},
+		},
+	}
+}
+
+func encodeInitdata(doc string) string {
+	return base64.StdEncoding.EncodeToString([]byte(doc))
+}
+
+func TestValidatePod(t *testing.T) {
+	tests := []struct {
+		name             string
+		annotations      map[string]string
+		runtimeClassName string
+		// wantErr is a part of the error message, empty if the pod is valid
+		wantErr string
+	}{
+		{
+			name: "default instance type",
+		},
+		{
+			name:        "allowed instance type",
+			annotations: map[string]string{PEERPODS_INSTANCE_TYPE_ANNOTATION: "large"},
+		},
+		{
+			name:        "instance type not allowed",
+			annotations: map[string]string{PEERPODS_INSTANCE_TYPE_ANNOTATION: "huge"},
+			wantErr:     `Unsupported value: "huge": supported values: "small", "large", "gpu"`,
+		},
+		{
+			name: "best fit",
+			annotations: map[string]string{
+				mutating_webhook.PEERPODS_CPU_ANNOTATION:    "4",
+				mutating_webhook.PEERPODS_MEMORY_ANNOTATION: "8192",
+			},
+		},
+		{
+			name: "no fit",
+			annotations: map[string]string{
+				mutating_webhook.PEERPODS_CPU_ANNOTATION:    "16",
+				mutating_webhook.PEERPODS_MEMORY_ANNOTATION: "8192",
+			},
+			wantErr: "no instance type offers these resources",
+		},
+		{
+			name: "fractional vCPUs are ignored",
+			annotations: map[string]string{
+				mutating_webhook.PEERPODS_CPU_ANNOTATION:    "500m",
+				mutating_webhook.PEERPODS_MEMORY_ANNOTATION: "1048576",
+			},
+		},
+		{
+			name: "best fit with GPUs",
+			annotations: map[string]string{
+				mutating_webhook.PEERPODS_CPU_ANNOTATION:    "2",
+				mutating_webhook.PEERPODS_MEMORY_ANNOTATION: "4096",
+				mutating_webhook.PEERPODS_GPU_ANNOTATION:    "1",
+			},
+		},
+		{
+			name: "instance type without GPUs",
+			annotations: map[string]string{
+				PEERPODS_INSTANCE_TYPE_ANNOTATION:        "large",
+				mutating_webhook.PEERPODS_GPU_ANNOTATION: "1",
+			},
+			wantErr: "instance type large has 0 GPUs",
+		},
+		{
+			name:        "unknown profile",
+			annotations: map[string]string{PEERPODS_PROFILE_ANNOTATION: "missing"},
+			wantErr:     `supported values: "kata-remote", "other-cloud"`,
+		},
+		{
+			name: "profile catalog",
+			annotations: map[string]string{
+				PEERPODS_PROFILE_ANNOTATION:       "other-cloud",
+				PEERPODS_INSTANCE_TYPE_ANNOTATION: "large",
+			},
+			wantErr: `Unsupported value: "large": supported values: "tiny"`,
+		},
+		{
+			name:             "profile selected by the RuntimeClass without catalog",
+			runtimeClassName: "kata-remote",
+			annotations:      map[string]string{PEERPODS_INSTANCE_TYPE_ANNOTATION: "huge"},
+		},
+		{
+			name:        "valid initdata",
+			annotations: map[string]string{PEERPODS_INITDATA_ANNOTATION: encodeInitdata("algorithm = \"sha256\"\nversion = \"0.1.0\"\n[data]\n\"aa.toml\" = '''\n'''\n")},
+		},
+		{
+			name:        "initdata not base64",
+			annotations: map[string]string{PEERPODS_INITDATA_ANNOTATION: "not base64!"},
+			wantErr:     "initdata is not base64 encoded",
+		},
+		{
+			name:        "initdata not TOML",
+			annotations: map[string]string{PEERPODS_INITDATA_ANNOTATION: encodeInitdata("algorithm = ")},
+			wantErr:     "initdata is not a TOML document",
+		},
+		{
+			name:        "initdata too long",
+			annotations: map[string]string{PEERPODS_INITDATA_ANNOTATION: encodeInitdata(strings.Repeat("#", 2048))},
+			wantErr:     "must have at most 1024 bytes",
+		},
+		{
+			name:        "initdata with unsupported values",
+			annotations: map[string]string{PEERPODS_INITDATA_ANNOTATION: encodeInitdata("algorithm = \"md5\"\n[data]\n\"other.toml\" = ''\n")},
+			wantErr:     `algorithm: Unsupported value: "md5"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtimeClassName := "kata-remote-custom"
+			if tt.runtimeClassName != "" {
+				runtimeClassName = tt.runtimeClassName
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations},
+				Spec:       corev1.PodSpec{RuntimeClassName: &runtimeClassName},
+			}
+			errs := validatePod(pod, testCatalog())
+			if tt.wantErr == "" {
+				if len(errs) > 0 {
+					t.Errorf("validatePod() = %v, want no error", errs.ToAggregate())
+				}
+				return
+			}
+			if len(errs) == 0 || !strings.Contains(errs.ToAggregate().Error(), tt.wantErr) {
+				t.Errorf("validatePod() = %v, want %q", errs.ToAggregate(), tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package validating_webhook
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/confidential-containers/cloud-api-adaptor/src/webhook/pkg/policy"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:admissionReviewVersions=v1,path=/validate-v1-pod,mutating=false,failurePolicy=fail,groups="",resources=pods,verbs=create,versions=v1,name=vwebhook.peerpods.io,sideEffects=None
+// +kubebuilder:rbac:groups="",resources=configmaps,resourceNames=peer-pods-catalog,verbs=get
+
+var logger = log.New(log.Writer(), "[pod-validator] ", log.LstdFlags|log.Lmsgprefix)
+
+// PodValidator rejects the peer pods that the cloud-api-adaptor would fail
+// to create a pod VM for, according to the catalog it publishes
+type PodValidator struct {
+	// Reader reads the catalog ConfigMap, it should not be a cached client
+	// since only that ConfigMap can be read
+	Reader  client.Reader
+	Decoder *admission.Decoder
+	// Policies select the peer pods runtimeClasses, the TARGET_RUNTIMECLASS
+	// environment variable is used when nil
+	Policies *policy.Store
+}
+
+func (v *PodValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pod := &corev1.Pod{}
+
+	err := v.Decoder.Decode(req, pod)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	policies := v.Policies
+	if policies == nil {
+		policies = policy.NewStore("")
+	}
+	// Validate only if the POD is using a peer pods runtimeClass
+	if pod.Spec.RuntimeClassName == nil {
+		return admission.Allowed("")
+	}
+	if _, ok := policies.Lookup(*pod.Spec.RuntimeClassName); !ok {
+		return admission.Allowed("")
+	}
+
+	namespace := os.Getenv("PEERPODS_NAMESPACE")
+	if namespace == "" {
+		namespace = PEERPODS_NAMESPACE_DEFAULT
+	}
+	// Pods are not held back by a missing or unreadable catalog, the
+	// cloud-api-adaptor still validates them
+	catalog, err := getCatalog(ctx, v.Reader, namespace)
+	if err != nil {
+		logger.Printf("Error reading the catalog: %v", err)
+		return admission.Allowed("").WithWarnings(fmt.Sprintf("pod not validated, the peer pods catalog can't be read: %v", err))
+	}
+	if catalog == nil {
+		return admission.Allowed("").WithWarnings(fmt.Sprintf("pod not validated, the peer pods catalog is not published in namespace %s", namespace))
+	}
+
+	if errs := validatePod(pod, catalog); len(errs) > 0 {
+		logger.Printf("Rejecting pod %s/%s: %v", req.Namespace, pod.Name, errs.ToAggregate())
+		return admission.Denied(errs.ToAggregate().Error())
+	}
+	return admission.Allowed("")
+}